@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -11,6 +13,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sine-io/oh-my-agent-flow/internal/console"
@@ -20,52 +24,240 @@ func main() {
 	log.SetOutput(os.Stderr)
 	log.SetFlags(0)
 
-	port := flag.Int("port", 0, "Port to bind (0 = random free port)")
-	noOpen := flag.Bool("no-open", false, "Disable auto-opening the browser")
+	if len(os.Args) > 1 && os.Args[1] == "hash-secret" {
+		token := len(os.Args) > 2 && os.Args[2] == "--token"
+		if err := runHashSecret(os.Stdin, os.Stdout, token); err != nil {
+			log.Fatalf("hash-secret: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == console.FireSupervisorCommand {
+		os.Exit(console.RunFireSupervisor(os.Args[2:]))
+	}
+
+	// Flag defaults only document the built-in values; a flag overrides config files and env only when set explicitly.
+	defaults := console.DefaultServerConfig()
+	port := flag.Int("port", defaults.Port, "Port to bind (0 = random free port)")
+	noOpen := flag.Bool("no-open", defaults.NoOpen, "Disable auto-opening the browser")
+	archiveCompress := flag.Bool("archive-compress", defaults.Archive.Compress, "Gzip finished run archives")
+	archiveKeep := flag.Int("archive-keep", defaults.Archive.RetentionCount, "Max number of run archives to keep (-1 = unlimited)")
+	archiveMaxBytes := flag.Int64("archive-max-bytes", defaults.Archive.RetentionBytes, "Max total size of run archives in bytes (-1 = unlimited)")
+	archiveMaxAge := flag.Duration("archive-max-age", time.Duration(defaults.Archive.RetentionAge), "Delete run archives older than this, e.g. 720h (0 = keep regardless of age)")
+	var redactPatterns stringListFlag
+	flag.Var(&redactPatterns, "redact-pattern", "Extra regular expression to redact from process output (repeatable; added to config patterns)")
+	redactEntropy := flag.Bool("redact-entropy", defaults.Redact.Entropy, "Redact long high-entropy strings from process output")
+	remote := flag.Bool("remote", defaults.Remote.Enabled, "Enable authenticated remote access over TLS (requires remote.passwordHash or remote.tokens in config)")
+	bind := flag.String("bind", defaults.Remote.Bind, "Interface to bind in remote mode")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate (PEM) for remote mode; self-signed when empty")
+	tlsKey := flag.String("tls-key", "", "TLS private key (PEM) for remote mode")
+	readAuth := flag.String("read-auth", defaults.Auth.ReadMode, "Require a token for reads: off, sensitive (files, streams, runs) or all /api/*")
 	flag.Parse()
 
-	listener, baseURL, err := console.ListenLocal(*port)
+	projectRoot, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("startup error: %v", err)
+	}
+
+	cfg, err := console.LoadServerConfig(console.GlobalConfigPath(), console.ProjectConfigPath(projectRoot), os.Environ())
 	if err != nil {
 		log.Fatalf("startup error: %v", err)
 	}
+	var setFlags []string
+	flag.Visit(func(f *flag.Flag) {
+		setFlags = append(setFlags, f.Name)
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "no-open":
+			cfg.NoOpen = *noOpen
+		case "archive-compress":
+			cfg.Archive.Compress = *archiveCompress
+		case "archive-keep":
+			cfg.Archive.RetentionCount = *archiveKeep
+		case "archive-max-bytes":
+			cfg.Archive.RetentionBytes = *archiveMaxBytes
+		case "archive-max-age":
+			cfg.Archive.RetentionAge = console.Duration(*archiveMaxAge)
+		case "redact-pattern":
+			cfg.Redact.Patterns = append(cfg.Redact.Patterns, redactPatterns...)
+		case "redact-entropy":
+			cfg.Redact.Entropy = *redactEntropy
+		case "remote":
+			cfg.Remote.Enabled = *remote
+		case "bind":
+			cfg.Remote.Bind = *bind
+		case "tls-cert":
+			cfg.Remote.TLSCert = *tlsCert
+		case "tls-key":
+			cfg.Remote.TLSKey = *tlsKey
+		case "read-auth":
+			cfg.Auth.ReadMode = *readAuth
+		}
+	})
+	if len(setFlags) > 0 {
+		cfg.Sources = append(cfg.Sources, "flags:"+strings.Join(setFlags, ","))
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("startup error: %v", err)
+	}
+
+	var (
+		listener   net.Listener
+		baseURL    string
+		remoteAuth *console.RemoteAuth
+	)
+	scheme, canonicalHost := "http", "127.0.0.1"
+	if cfg.Remote.Enabled {
+		tlsResult, err := console.LoadRemoteTLS(console.RemoteTLSConfig{
+			CertFile:     cfg.Remote.TLSCert,
+			KeyFile:      cfg.Remote.TLSKey,
+			GeneratedDir: filepath.Join(projectRoot, ".ohmyagentflow", "tls"),
+			Hosts:        append([]string{cfg.Remote.Bind}, cfg.Remote.TLSHosts...),
+		})
+		if err != nil {
+			log.Fatalf("startup error: %v", err)
+		}
+		remoteAuth, err = console.NewRemoteAuth(console.RemoteAuthConfig{
+			PasswordHash: cfg.Remote.PasswordHash,
+			Tokens:       cfg.Remote.Tokens,
+			SessionTTL:   time.Duration(cfg.Remote.SessionTTL),
+		})
+		if err != nil {
+			log.Fatalf("startup error: %v", err)
+		}
+		listener, baseURL, err = console.ListenRemote(cfg.Remote.Bind, cfg.Port, tlsResult.Config)
+		if err != nil {
+			log.Fatalf("startup error: %v", err)
+		}
+		if tlsResult.Generated {
+			log.Printf("generated self-signed TLS certificate %s", tlsResult.CertPath)
+		}
+		log.Printf("remote mode: listening on %s, TLS SHA-256 fingerprint %s", listener.Addr(), tlsResult.Fingerprint)
+		scheme, canonicalHost = "https", console.RemoteCanonicalHost(cfg.Remote.Bind)
+	} else {
+		listener, baseURL, err = console.ListenLocal(cfg.Port)
+		if err != nil {
+			log.Fatalf("startup error: %v", err)
+		}
+	}
 
 	actualPort := listener.Addr().(*net.TCPAddr).Port
-	canonicalHostPort := fmt.Sprintf("127.0.0.1:%d", actualPort)
-	baseOrigin127 := fmt.Sprintf("http://127.0.0.1:%d", actualPort)
-	baseOriginLocalhost := fmt.Sprintf("http://localhost:%d", actualPort)
+	canonicalHostPort := net.JoinHostPort(canonicalHost, strconv.Itoa(actualPort))
+	baseOrigin127 := fmt.Sprintf("%s://127.0.0.1:%d", scheme, actualPort)
+	baseOriginLocalhost := fmt.Sprintf("%s://localhost:%d", scheme, actualPort)
 
-	sessionToken, err := console.GenerateSessionToken()
+	sessionTokens := console.NewSessionTokenStore(console.SessionTokenConfig{
+		TTL: time.Duration(cfg.Auth.SessionTokenTTL),
+	})
+
+	fsReader, err := console.NewFSReader(console.FSReadConfig{
+		ProjectRoot: projectRoot,
+		MaxBytes:    cfg.FS.MaxReadBytes,
+		Whitelist:   cfg.FS.ReadWhitelist,
+	})
 	if err != nil {
 		log.Fatalf("startup error: %v", err)
 	}
 
-	projectRoot, err := os.Getwd()
+	metrics := console.NewMetrics()
+
+	auditLog, err := console.NewAuditLog(console.AuditConfig{
+		Path: filepath.Join(projectRoot, ".ohmyagentflow", console.AuditFileName),
+	})
 	if err != nil {
 		log.Fatalf("startup error: %v", err)
 	}
-	fsReader, err := console.NewFSReader(console.FSReadConfig{
-		ProjectRoot: projectRoot,
-		MaxBytes:    console.DefaultMaxReadBytes,
+
+	backups, err := console.NewBackupStore(console.BackupConfig{
+		ProjectRoot:    projectRoot,
+		RetentionCount: cfg.Backups.RetentionCount,
+		RetentionBytes: cfg.Backups.RetentionBytes,
+		RetentionAge:   time.Duration(cfg.Backups.RetentionAge),
+	})
+	if err != nil {
+		log.Fatalf("startup error: %v", err)
+	}
+
+	prompts, err := console.NewPromptStore(console.PromptConfig{ProjectRoot: projectRoot, Backups: backups})
+	if err != nil {
+		log.Fatalf("startup error: %v", err)
+	}
+
+	redactor, err := console.NewRedactor(console.RedactConfig{
+		Patterns:       cfg.Redact.Patterns,
+		DisableEntropy: !cfg.Redact.Entropy,
 	})
 	if err != nil {
 		log.Fatalf("startup error: %v", err)
 	}
 
 	streamHub := console.NewStreamHub(console.StreamHubConfig{
-		ArchiveDir: filepath.Join(projectRoot, ".ohmyagentflow", "runs"),
+		MaxEventsPerRun:       cfg.Stream.MaxEventsPerRun,
+		SubscriberBufSize:     cfg.Stream.SubscriberBufSize,
+		MaxProcessTextBytes:   cfg.Stream.MaxProcessTextBytes,
+		ArchiveDir:            filepath.Join(projectRoot, ".ohmyagentflow", "runs"),
+		MaxArchiveBytes:       cfg.Archive.MaxRunBytes,
+		CompressArchives:      cfg.Archive.Compress,
+		ArchiveRetentionCount: cfg.Archive.RetentionCount,
+		ArchiveRetentionBytes: cfg.Archive.RetentionBytes,
+		ArchiveRetentionAge:   time.Duration(cfg.Archive.RetentionAge),
+		Redactor:              redactor,
+		Metrics:               metrics,
 	})
 
+	// Detached Fire runs are supervised by this binary; see RunFireSupervisor.
+	var supervisor []string
+	if self, err := os.Executable(); err != nil {
+		log.Printf("warning: detached Fire runs are unavailable: %v", err)
+	} else {
+		supervisor = []string{self, console.FireSupervisorCommand}
+	}
+
+	usageInterval := time.Duration(cfg.Fire.UsageInterval)
+	if usageInterval == 0 {
+		usageInterval = -1 // disabled in the config
+	}
 	fireSvc, err := console.NewFireService(console.FireConfig{
-		ProjectRoot: projectRoot,
-		Hub:         streamHub,
+		ProjectRoot:      projectRoot,
+		Hub:              streamHub,
+		Metrics:          metrics,
+		MaxIterationsCap: cfg.Fire.MaxIterationsCap,
+		Prompts:          prompts,
+		Verify:           cfg.Fire.Verify,
+		Backups:          backups,
+		Sandbox:          cfg.Fire.Sandbox,
+		Limits:           cfg.Fire.Limits,
+		UsageInterval:    usageInterval,
+		StopGracePeriod:  time.Duration(cfg.Fire.StopGracePeriod),
+		Supervisor:       supervisor,
 	})
 	if err != nil {
 		log.Fatalf("startup error: %v", err)
 	}
+	orphan, err := fireSvc.RecoverOrphanedRun()
+	if err != nil {
+		log.Printf("warning: fire recovery: %v", err)
+	}
+	// Only a group whose leader is still the recorded supervisor is taken
+	// over automatically; anything else waits for the user in the Fire panel.
+	if orphan != nil && orphan.Detached && orphan.LeaderVerified() {
+		if runID, err := fireSvc.AttachOrphan(); err != nil {
+			log.Printf("warning: failed to re-attach detached Fire run %s: %v", orphan.RunID, err)
+		} else {
+			log.Printf("re-attached detached Fire run %s as %s", orphan.RunID, runID)
+		}
+	} else if orphan != nil && orphan.Detached {
+		log.Printf("detached Fire run %s is waiting to be re-attached from the Fire panel", orphan.RunID)
+	} else if orphan != nil {
+		log.Printf("warning: Fire run %s (process group %d) from a previous console is still running; re-attach to it or kill it from the Fire panel", orphan.RunID, orphan.PGID)
+	}
 
 	prdChat, err := console.NewPRDChatService(console.PRDChatConfig{
-		ProjectRoot: projectRoot,
-		SessionTTL:  30 * time.Minute,
+		ProjectRoot:  projectRoot,
+		SessionTTL:   time.Duration(cfg.Chat.SessionTTL),
+		ModelTimeout: time.Duration(cfg.Chat.ModelTimeout),
+		Metrics:      metrics,
+		Backups:      backups,
 	})
 	if err != nil {
 		log.Fatalf("startup error: %v", err)
@@ -73,17 +265,28 @@ func main() {
 
 	fmt.Println(baseURL)
 
-	if !*noOpen {
+	if !cfg.NoOpen {
 		if err := tryAutoOpen(baseURL); err != nil {
 			log.Printf("warning: failed to auto-open browser: %v", err)
 		}
 	}
 
 	mux := http.NewServeMux()
+	// The page embeds a fresh session token for whoever can load it. Other
+	// sites cannot read it across origins, but in local mode any process that
+	// reaches the port can; only remote mode puts a login in front of it.
 	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		issued, err := sessionTokens.Issue()
+		if err != nil {
+			log.Printf("warning: failed to issue session token: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
 		htmlBytes, err := console.RenderIndexHTML(console.IndexPageData{
-			SessionToken: sessionToken,
-			ProjectRoot:  projectRoot,
+			SessionToken:          issued.Token,
+			SessionTokenExpiresAt: issued.ExpiresAt,
+			ReadAuth:              cfg.Auth.ReadMode,
+			ProjectRoot:           projectRoot,
 		})
 		if err != nil {
 			log.Printf("warning: failed to render index page: %v", err)
@@ -95,28 +298,90 @@ func main() {
 		_, _ = w.Write(htmlBytes)
 	})
 
+	if remoteAuth != nil {
+		// Anyone may load the login page, so it gets a login nonce rather than
+		// a session token from the bounded store.
+		mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+			nonce, err := remoteAuth.LoginNonce()
+			if err != nil {
+				log.Printf("warning: failed to issue login nonce: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			htmlBytes, err := console.RenderLoginHTML(console.LoginPageData{LoginNonce: nonce})
+			if err != nil {
+				log.Printf("warning: failed to render login page: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(htmlBytes)
+		})
+		mux.HandleFunc("POST /api/auth/login", remoteAuth.LoginHandler())
+		mux.HandleFunc("POST /api/auth/logout", remoteAuth.LogoutHandler())
+	}
+	mux.HandleFunc("GET /api/auth/me", console.WhoAmIHandler())
+	mux.HandleFunc("POST /api/session/refresh", sessionTokens.RefreshHandler())
+	mux.HandleFunc("POST /api/session/revoke", sessionTokens.RevokeHandler())
+	mux.HandleFunc("GET /metrics", console.MetricsHandler(metrics))
+	mux.HandleFunc("GET /api/config", console.ConfigHandler(cfg))
+	mux.HandleFunc("GET /api/audit", console.AuditHandler(auditLog))
+	mux.HandleFunc("GET /api/backups", console.BackupListHandler(backups))
+	mux.HandleFunc("POST /api/backups/{id}/restore", console.BackupRestoreHandler(backups))
+	mux.HandleFunc("GET /api/prompts", prompts.ListHandler())
+	mux.HandleFunc("GET /api/prompts/{name}", prompts.GetHandler())
+	mux.HandleFunc("POST /api/prompts/{name}", prompts.WriteHandler())
+	mux.HandleFunc("GET /api/prompts/{name}/history", prompts.HistoryHandler())
+	mux.HandleFunc("GET /api/prompts/{name}/history/{version}", prompts.VersionHandler())
+	mux.HandleFunc("POST /api/prompt/preview", prompts.PreviewHandler())
 	mux.HandleFunc("GET /api/fs/read", console.FSReadHandler(fsReader))
+	mux.HandleFunc("GET /api/fs/list", console.FSListHandler(fsReader))
 	mux.HandleFunc("GET /api/stream", console.StreamHandler(streamHub))
+	mux.HandleFunc("GET /api/runs", console.RunListHandler(streamHub))
+	mux.HandleFunc("GET /api/runs/{id}/search", console.RunSearchHandler(streamHub))
+	mux.HandleFunc("DELETE /api/runs/{id}", console.RunDeleteHandler(streamHub))
+	mux.HandleFunc("POST /api/runs/{id}/pin", console.RunPinHandler(streamHub))
+	mux.HandleFunc("DELETE /api/runs/{id}/pin", console.RunPinHandler(streamHub))
 
-	mux.HandleFunc("POST /api/init", console.InitHandler(console.InitConfig{ProjectRoot: projectRoot}))
-	mux.HandleFunc("POST /api/prd/generate", console.PRDGenerateHandler(console.PRDGenerateConfig{ProjectRoot: projectRoot}))
+	mux.HandleFunc("POST /api/init", console.InitHandler(console.InitConfig{ProjectRoot: projectRoot, Backups: backups}))
+	mux.HandleFunc("POST /api/prd/generate", console.PRDGenerateHandler(console.PRDGenerateConfig{ProjectRoot: projectRoot, Backups: backups}))
 	mux.HandleFunc("POST /api/prd/chat/session", prdChat.SessionHandler())
 	mux.HandleFunc("POST /api/prd/chat/message", prdChat.MessageHandler())
 	mux.HandleFunc("GET /api/prd/chat/state", prdChat.StateHandler())
 	mux.HandleFunc("POST /api/prd/chat/finalize", prdChat.FinalizeHandler())
-	mux.HandleFunc("POST /api/convert", console.ConvertHandler(console.ConvertConfig{ProjectRoot: projectRoot, FSReader: fsReader}))
+	mux.HandleFunc("POST /api/convert", console.ConvertHandler(console.ConvertConfig{ProjectRoot: projectRoot, FSReader: fsReader, Backups: backups}))
 	mux.HandleFunc("POST /api/fire", fireSvc.StartHandler())
 	mux.HandleFunc("POST /api/fire/stop", fireSvc.StopHandler())
+	mux.HandleFunc("POST /api/fire/detach", fireSvc.DetachHandler())
+	mux.HandleFunc("GET /api/fire/processes", fireSvc.ProcessesHandler())
+	mux.HandleFunc("GET /api/fire/orphan", fireSvc.OrphanHandler())
+	mux.HandleFunc("POST /api/fire/orphan/attach", fireSvc.OrphanAttachHandler())
+	mux.HandleFunc("POST /api/fire/orphan/kill", fireSvc.OrphanKillHandler())
 
 	mux.HandleFunc("POST /api/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
 	})
 
-	protected := console.RequireWriteAuth(mux, console.WriteAuthConfig{
-		SessionToken:   sessionToken,
-		AllowedOrigins: []string{baseOrigin127, baseOriginLocalhost},
+	readProtected := console.RequireReadAuth(mux, console.ReadAuthConfig{
+		Mode:          cfg.Auth.ReadMode,
+		Tokens:        sessionTokens,
+		ReadTokenHash: cfg.Auth.ReadTokenHash,
 	})
+	writeAuth := console.WriteAuthConfig{
+		Tokens:              sessionTokens,
+		AllowedOrigins:      []string{baseOrigin127, baseOriginLocalhost},
+		AllowSameHostOrigin: remoteAuth != nil,
+	}
+	if remoteAuth != nil {
+		writeAuth.LoginPath = "/api/auth/login"
+	}
+	protected := console.RequireWriteAuth(readProtected, writeAuth)
+	protected = console.AuditWrites(protected, auditLog)
+	if remoteAuth != nil {
+		protected = remoteAuth.Middleware(protected)
+	}
 
 	server := &http.Server{Handler: console.RedirectLocalhostTo127(canonicalHostPort, protected)}
 	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
@@ -146,3 +411,35 @@ func tryAutoOpen(url string) error {
 	}()
 	return nil
 }
+
+// runHashSecret prints the hash of the first line of in, for use as
+// remote.passwordHash or auth.readTokenHash, or with token as a
+// remote.tokens[].hash value.
+func runHashSecret(in io.Reader, out io.Writer, token bool) error {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	hashFn := console.HashSecret
+	if token {
+		hashFn = console.HashToken
+	}
+	hash, err := hashFn(strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, hash)
+	return err
+}
+
+// stringListFlag collects the values of a repeatable string flag.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
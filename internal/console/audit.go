@@ -0,0 +1,496 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuditFileName = "audit.jsonl"
+
+	// Request bodies are summarized, never stored: at most this much is
+	// inspected, and string values longer than auditMaxSummaryString are
+	// replaced by their length.
+	auditMaxBodyBytes      = 64 << 10
+	auditMaxSummaryString  = 120
+	auditMaxErrorBodyBytes = 4 << 10
+	auditMaxLineBytes      = 1 << 20
+
+	defaultAuditQueryLimit = 200
+	maxAuditQueryLimit     = 2000
+)
+
+// AuditEntry is one line of .ohmyagentflow/audit.jsonl, written for every
+// state-changing /api/* request, including ones rejected by auth.
+type AuditEntry struct {
+	Time       string         `json:"time"`
+	Actor      string         `json:"actor"`
+	Role       string         `json:"role,omitempty"`
+	ClientIP   string         `json:"clientIp,omitempty"`
+	Method     string         `json:"method"`
+	Endpoint   string         `json:"endpoint"`
+	Query      string         `json:"query,omitempty"`
+	Request    map[string]any `json:"request,omitempty"`
+	Files      []AuditFile    `json:"files,omitempty"`
+	RunIDs     []string       `json:"runIds,omitempty"`
+	Status     int            `json:"status"`
+	ErrorCode  string         `json:"errorCode,omitempty"`
+	DurationMs int64          `json:"durationMs"`
+}
+
+type AuditFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // created | overwritten
+	Before string `json:"beforeSha256,omitempty"`
+	After  string `json:"afterSha256,omitempty"`
+	Backup string `json:"backupPath,omitempty"`
+}
+
+type AuditConfig struct {
+	// Path is the audit log file, normally .ohmyagentflow/audit.jsonl.
+	Path string
+	Now  func() time.Time
+}
+
+// AuditLog appends AuditEntry lines to a file. Entries are never rewritten.
+type AuditLog struct {
+	path string
+	now  func() time.Time
+	mu   sync.Mutex
+}
+
+func NewAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	if strings.TrimSpace(cfg.Path) == "" {
+		return nil, errors.New("audit log path is required")
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &AuditLog{path: cfg.Path, now: now}, nil
+}
+
+func (l *AuditLog) Append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditRecorder collects what a handler did while serving one request.
+type auditRecorder struct {
+	mu     sync.Mutex
+	files  []AuditFile
+	runIDs []string
+}
+
+type auditCtxKey struct{}
+
+func auditRecorderFrom(ctx context.Context) *auditRecorder {
+	rec, _ := ctx.Value(auditCtxKey{}).(*auditRecorder)
+	return rec
+}
+
+// fileSnapshot is a file's state before a handler overwrites it.
+type fileSnapshot struct {
+	exists bool
+	sha256 string
+}
+
+func snapshotFile(path string) fileSnapshot {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileSnapshot{}
+	}
+	return fileSnapshot{exists: true, sha256: sha256Hex(data)}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordAuditFileWrite notes that rel (project-relative) now holds after. It is
+// a no-op when the request is not being audited.
+func recordAuditFileWrite(ctx context.Context, rel string, before fileSnapshot, after []byte, backupRel string) {
+	rec := auditRecorderFrom(ctx)
+	if rec == nil {
+		return
+	}
+	f := AuditFile{Path: filepath.ToSlash(rel), Action: "created", After: sha256Hex(after), Backup: backupRel}
+	if before.exists {
+		f.Action = "overwritten"
+		f.Before = before.sha256
+	}
+	rec.mu.Lock()
+	rec.files = append(rec.files, f)
+	rec.mu.Unlock()
+}
+
+func recordAuditRun(ctx context.Context, runID string) {
+	rec := auditRecorderFrom(ctx)
+	if rec == nil || runID == "" {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, id := range rec.runIDs {
+		if id == runID {
+			return
+		}
+	}
+	rec.runIDs = append(rec.runIDs, runID)
+}
+
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 && w.body.Len() < auditMaxErrorBodyBytes {
+		n := auditMaxErrorBodyBytes - w.body.Len()
+		if n > len(p) {
+			n = len(p)
+		}
+		w.body.Write(p[:n])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// isAuditedRequest reports whether r changes state. Session token refresh
+// and revoke are bookkeeping and would drown the log.
+func isAuditedRequest(r *http.Request) bool {
+	if isSafeMethod(r.Method) || !strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	return !strings.HasPrefix(r.URL.Path, "/api/session/")
+}
+
+// AuditWrites records every state-changing /api/* request. Place it outside
+// RequireWriteAuth so rejected attempts are logged as well, and inside remote
+// auth so the actor is known.
+func AuditWrites(next http.Handler, audit *AuditLog) http.Handler {
+	if audit == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAuditedRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := audit.now()
+		summary := summarizeAuditBody(r)
+		rec := &auditRecorder{}
+		aw := &auditResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), auditCtxKey{}, rec)))
+
+		entry := AuditEntry{
+			Time:       start.UTC().Format(time.RFC3339Nano),
+			Actor:      "local",
+			ClientIP:   clientIP(r),
+			Method:     r.Method,
+			Endpoint:   r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Request:    summary,
+			Status:     aw.status,
+			DurationMs: audit.now().Sub(start).Milliseconds(),
+		}
+		if p, ok := PrincipalFromRequest(r); ok {
+			entry.Actor, entry.Role = p.Name, p.Role
+		}
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		if entry.Status >= 400 {
+			var apiErr APIError
+			if json.Unmarshal(aw.body.Bytes(), &apiErr) == nil {
+				entry.ErrorCode = apiErr.Code
+			}
+		}
+		rec.mu.Lock()
+		entry.Files = append([]AuditFile(nil), rec.files...)
+		entry.RunIDs = append([]string(nil), rec.runIDs...)
+		rec.mu.Unlock()
+
+		if err := audit.Append(entry); err != nil {
+			log.Printf("warning: failed to write audit log: %v", err)
+		}
+	})
+}
+
+// summarizeAuditBody reads (and restores) the request body and returns a
+// shallow summary: scalars are kept, secrets, long strings and nested values
+// are reduced to a description.
+func summarizeAuditBody(r *http.Request) map[string]any {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, auditMaxBodyBytes+1))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), Closer: r.Body}
+	if err != nil || len(bytes.TrimSpace(buf)) == 0 {
+		return nil
+	}
+	if len(buf) > auditMaxBodyBytes {
+		return map[string]any{"_body": fmt.Sprintf("<more than %d bytes>", auditMaxBodyBytes)}
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return map[string]any{"_body": fmt.Sprintf("<%d bytes, not a JSON object>", len(buf))}
+	}
+	out := make(map[string]any, len(obj))
+	for k, v := range obj {
+		out[k] = summarizeAuditValue(k, v)
+	}
+	return out
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func summarizeAuditValue(key string, v any) any {
+	lower := strings.ToLower(key)
+	for _, secret := range []string{"password", "token", "secret", "apikey", "api_key"} {
+		if strings.Contains(lower, secret) {
+			return "[REDACTED]"
+		}
+	}
+	switch t := v.(type) {
+	case string:
+		if len(t) > auditMaxSummaryString {
+			return fmt.Sprintf("<string, %d bytes>", len(t))
+		}
+		s, _ := DefaultRedactor().Redact(t)
+		return s
+	case []any:
+		return fmt.Sprintf("<array, %d items>", len(t))
+	case map[string]any:
+		return fmt.Sprintf("<object, %d keys>", len(t))
+	default:
+		return t
+	}
+}
+
+type AuditQuery struct {
+	Endpoint string // prefix match
+	Actor    string
+	RunID    string
+	Path     string // substring of a touched file path
+	Result   string // "ok", "error" or an error code
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+type AuditQueryResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Limited bool         `json:"limited"`
+}
+
+func (q AuditQuery) matches(e AuditEntry) bool {
+	if q.Endpoint != "" && !strings.HasPrefix(e.Endpoint, q.Endpoint) {
+		return false
+	}
+	if q.Actor != "" && e.Actor != q.Actor {
+		return false
+	}
+	if q.RunID != "" {
+		found := false
+		for _, id := range e.RunIDs {
+			found = found || id == q.RunID
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Path != "" {
+		found := false
+		for _, f := range e.Files {
+			found = found || strings.Contains(f.Path, q.Path) || (f.Backup != "" && strings.Contains(f.Backup, q.Path))
+		}
+		if !found {
+			return false
+		}
+	}
+	switch q.Result {
+	case "":
+	case "ok":
+		if e.Status >= 400 {
+			return false
+		}
+	case "error":
+		if e.Status < 400 {
+			return false
+		}
+	default:
+		if e.ErrorCode != q.Result {
+			return false
+		}
+	}
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		t, err := time.Parse(time.RFC3339Nano, e.Time)
+		if err != nil {
+			return false
+		}
+		if !q.Since.IsZero() && t.Before(q.Since) {
+			return false
+		}
+		if !q.Until.IsZero() && !t.Before(q.Until) {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns matching entries, newest first.
+func (l *AuditLog) Query(q AuditQuery) (AuditQueryResponse, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultAuditQueryLimit
+	}
+	resp := AuditQueryResponse{Entries: []AuditEntry{}}
+
+	l.mu.Lock()
+	f, err := os.Open(l.path)
+	l.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return resp, nil
+		}
+		return resp, err
+	}
+	defer f.Close()
+
+	var matched []AuditEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), auditMaxLineBytes)
+	for sc.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil || !q.matches(e) {
+			continue
+		}
+		matched = append(matched, e)
+		// Keep only the newest limit+1 entries in memory.
+		if len(matched) > 2*(limit+1) {
+			matched = append(matched[:0], matched[len(matched)-(limit+1):]...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return resp, err
+	}
+
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	if len(matched) > limit {
+		matched = matched[:limit]
+		resp.Limited = true
+	}
+	resp.Entries = matched
+	return resp, nil
+}
+
+// AuditHandler serves GET /api/audit?endpoint=&actor=&runId=&path=&result=&since=&until=&limit=.
+func AuditHandler(audit *AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query()
+		q := AuditQuery{
+			Endpoint: strings.TrimSpace(v.Get("endpoint")),
+			Actor:    strings.TrimSpace(v.Get("actor")),
+			RunID:    strings.TrimSpace(v.Get("runId")),
+			Path:     strings.TrimSpace(v.Get("path")),
+			Result:   strings.TrimSpace(v.Get("result")),
+		}
+		for _, tf := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &q.Since}, {"until", &q.Until}} {
+			raw := strings.TrimSpace(v.Get(tf.name))
+			if raw == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				WriteAPIError(w, http.StatusBadRequest, APIError{
+					Code:    "INVALID_QUERY",
+					Message: fmt.Sprintf("%s must be an RFC 3339 timestamp.", tf.name),
+					Hint:    "Example: 2025-01-31T09:00:00Z",
+				})
+				return
+			}
+			*tf.dst = t
+		}
+		limit, ok := parseBoundedQueryInt(strings.TrimSpace(v.Get("limit")), defaultAuditQueryLimit, maxAuditQueryLimit)
+		if !ok || limit == 0 {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "INVALID_QUERY",
+				Message: fmt.Sprintf("limit must be an integer between 1 and %d.", maxAuditQueryLimit),
+			})
+			return
+		}
+		q.Limit = limit
+
+		resp, err := audit.Query(q)
+		if err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, APIError{
+				Code:    "INTERNAL_ERROR",
+				Message: "failed to read audit log",
+				Hint:    err.Error(),
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,214 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const auditTestPRD = `---
+schema: ohmyagentflow/prd@1
+project: "demo"
+feature_slug: "demo-feature"
+title: "Demo"
+description: "Demo desc"
+---
+
+# PRD: Demo
+
+## Goals
+- Do thing
+
+## User Stories
+### US-001: First story
+**Description:** As a user, I want one thing so that I can do it.
+
+**Acceptance Criteria:**
+- [ ] A
+- [ ] Typecheck passes
+
+## Functional Requirements
+1. FR-1: TBD
+
+## Non-Goals
+- TBD
+
+## Success Metrics
+- TBD
+
+## Open Questions
+- TBD
+`
+
+func newAuditedConvertServer(t *testing.T, root string) (http.Handler, *AuditLog) {
+	t.Helper()
+	reader, err := NewFSReader(FSReadConfig{ProjectRoot: root, MaxBytes: DefaultMaxReadBytes})
+	if err != nil {
+		t.Fatalf("NewFSReader error: %v", err)
+	}
+	audit, err := NewAuditLog(AuditConfig{Path: filepath.Join(root, ".ohmyagentflow", AuditFileName)})
+	if err != nil {
+		t.Fatalf("NewAuditLog error: %v", err)
+	}
+
+	backups, err := NewBackupStore(BackupConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewBackupStore error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/convert", ConvertHandler(ConvertConfig{ProjectRoot: root, FSReader: reader, Backups: backups}))
+	mux.HandleFunc("POST /api/auth/login", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+	mux.HandleFunc("GET /api/audit", AuditHandler(audit))
+	protected := RequireWriteAuth(mux, WriteAuthConfig{SessionToken: "tok", AllowedOrigins: []string{"http://127.0.0.1:1234"}})
+	return AuditWrites(protected, audit), audit
+}
+
+func auditPost(h http.Handler, path string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:1234"+path, strings.NewReader(body))
+	req.Header.Set("Origin", "http://127.0.0.1:1234")
+	req.Header.Set("X-Session-Token", token)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuditWrites_RecordsFilesHashesAndBackups(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "tasks"), 0o755); err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "tasks", "prd-demo-feature.md"), []byte(auditTestPRD), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	oldJSON := []byte("{\"old\":true}\n")
+	if err := os.WriteFile(filepath.Join(root, "prd.json"), oldJSON, 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	h, audit := newAuditedConvertServer(t, root)
+
+	if rr := auditPost(h, "/api/convert", `{"prdPath":"tasks/prd-demo-feature.md"}`, "tok"); rr.Code != http.StatusOK {
+		t.Fatalf("convert failed: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := auditPost(h, "/api/convert", `{"prdPath":"tasks/prd-demo-feature.md"}`, "stolen"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected forged write to be rejected, got %d", rr.Code)
+	}
+
+	resp, err := audit.Query(AuditQuery{})
+	if err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", resp.Entries)
+	}
+	rejected, ok := resp.Entries[0], resp.Entries[1]
+	if rejected.Status != http.StatusForbidden || rejected.ErrorCode != "SESSION_TOKEN_INVALID" || len(rejected.Files) != 0 {
+		t.Fatalf("unexpected rejected entry (newest first): %+v", rejected)
+	}
+
+	if ok.Endpoint != "/api/convert" || ok.Method != http.MethodPost || ok.Actor != "local" || ok.Status != http.StatusOK {
+		t.Fatalf("unexpected entry: %+v", ok)
+	}
+	if ok.Request["prdPath"] != "tasks/prd-demo-feature.md" {
+		t.Fatalf("expected request summary to include prdPath, got %v", ok.Request)
+	}
+	if len(ok.Files) != 1 {
+		t.Fatalf("expected one file record, got %+v", ok.Files)
+	}
+	f := ok.Files[0]
+	newJSON, _ := os.ReadFile(filepath.Join(root, "prd.json"))
+	if f.Path != "prd.json" || f.Action != "overwritten" || f.Before != sha256Hex(oldJSON) || f.After != sha256Hex(newJSON) {
+		t.Fatalf("unexpected file record: %+v", f)
+	}
+	if backup, err := os.ReadFile(filepath.Join(root, f.Backup)); err != nil || !bytes.Equal(backup, oldJSON) {
+		t.Fatalf("expected backupPath %q to hold the previous prd.json (err=%v)", f.Backup, err)
+	}
+}
+
+func TestAuditWrites_SummarizesWithoutSecrets(t *testing.T) {
+	root := t.TempDir()
+	h, audit := newAuditedConvertServer(t, root)
+
+	body := `{"password":"hunter2hunter2","notes":"` + strings.Repeat("x", 500) + `","tags":["a","b"],"n":3}`
+	auditPost(h, "/api/auth/login", body, "tok")
+
+	raw, err := os.ReadFile(filepath.Join(root, ".ohmyagentflow", AuditFileName))
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	if strings.Contains(string(raw), "hunter2") || strings.Contains(string(raw), strings.Repeat("x", 200)) {
+		t.Fatalf("audit log leaked request content: %s", raw)
+	}
+	resp, _ := audit.Query(AuditQuery{})
+	req := resp.Entries[0].Request
+	if req["password"] != "[REDACTED]" || req["notes"] != "<string, 500 bytes>" || req["tags"] != "<array, 2 items>" || req["n"] != float64(3) {
+		t.Fatalf("unexpected summary: %v", req)
+	}
+}
+
+func TestAuditHandler_Filters(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)}
+	audit, _ := NewAuditLog(AuditConfig{Path: filepath.Join(dir, AuditFileName), Now: clock.Now})
+	for i, e := range []AuditEntry{
+		{Endpoint: "/api/fire", RunIDs: []string{"fire-1"}, Status: 200},
+		{Endpoint: "/api/fire/stop", RunIDs: []string{"fire-1"}, Status: 200},
+		{Endpoint: "/api/convert", Files: []AuditFile{{Path: "prd.json", Action: "created"}}, Status: 200},
+		{Endpoint: "/api/fire", Status: 409, ErrorCode: "FIRE_ALREADY_RUNNING"},
+	} {
+		e.Actor = "local"
+		e.Method = http.MethodPost
+		e.Time = clock.Now().Add(time.Duration(i) * time.Hour).Format(time.RFC3339Nano)
+		if err := audit.Append(e); err != nil {
+			t.Fatalf("Append error: %v", err)
+		}
+	}
+
+	query := func(qs string) AuditQueryResponse {
+		rr := httptest.NewRecorder()
+		AuditHandler(audit).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/audit?"+qs, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d (%s)", qs, rr.Code, rr.Body.String())
+		}
+		var resp AuditQueryResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	for _, tc := range []struct {
+		qs   string
+		want []string
+	}{
+		{"endpoint=/api/fire", []string{"/api/fire", "/api/fire/stop", "/api/fire"}},
+		{"runId=fire-1", []string{"/api/fire/stop", "/api/fire"}},
+		{"path=prd.json", []string{"/api/convert"}},
+		{"result=error", []string{"/api/fire"}},
+		{"result=FIRE_ALREADY_RUNNING", []string{"/api/fire"}},
+		{"since=2025-01-01T10:00:00Z&until=2025-01-01T12:00:00Z", []string{"/api/convert", "/api/fire/stop"}},
+		{"limit=1", []string{"/api/fire"}},
+	} {
+		resp := query(tc.qs)
+		var got []string
+		for _, e := range resp.Entries {
+			got = append(got, e.Endpoint)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Fatalf("%s: got %v, want %v", tc.qs, got, tc.want)
+		}
+	}
+	if !query("limit=1").Limited {
+		t.Fatalf("expected limited=true when more entries match")
+	}
+
+	rr := httptest.NewRecorder()
+	AuditHandler(audit).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/audit?since=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad since, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,420 @@
+package console
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBackupRetentionCount = 200
+	DefaultBackupRetentionBytes = int64(100 << 20)
+	DefaultBackupRetentionAge   = 30 * 24 * time.Hour
+
+	backupMetaFileName    = "meta.json"
+	backupContentFileName = "content"
+)
+
+var backupIDRe = regexp.MustCompile(`^\d{8}-\d{6}\.\d{3}-[0-9a-f]{8}$`)
+
+type BackupConfig struct {
+	ProjectRoot string
+	// Dir defaults to <ProjectRoot>/.ohmyagentflow/backups.
+	Dir string
+	// Retention limits are applied after every snapshot. 0 means the default;
+	// negative means unlimited (for age: 0 keeps snapshots regardless of age).
+	RetentionCount int
+	RetentionBytes int64
+	RetentionAge   time.Duration
+	Now            func() time.Time
+}
+
+// BackupStore keeps the previous content of every project file a console
+// operation overwrites, so it can be listed and restored. Each snapshot is a
+// directory <id>/ holding meta.json and the raw content.
+type BackupStore struct {
+	root     string
+	paths    *SafePath
+	dir      string
+	maxCount int
+	maxBytes int64
+	maxAge   time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+type BackupInfo struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	CreatedAt string `json:"createdAt"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	// Operation is the tmp-file prefix of the write that replaced the file
+	// (".convert-*", ".prd-*", ...) or "restore".
+	Operation string `json:"operation"`
+	// Mode is the file's permission bits in octal ("0755"). Snapshots taken
+	// before it was recorded restore with 0644.
+	Mode string `json:"mode,omitempty"`
+}
+
+type BackupListResponse struct {
+	Backups []BackupInfo `json:"backups"`
+}
+
+type BackupRestoreResponse struct {
+	OK       bool   `json:"ok"`
+	Path     string `json:"path"`
+	Restored string `json:"restored"`
+	// BackupID is the snapshot of the content that the restore replaced, so a
+	// restore can itself be undone. Empty when the file did not exist or was
+	// already identical.
+	BackupID string `json:"backupId,omitempty"`
+}
+
+func NewBackupStore(cfg BackupConfig) (*BackupStore, error) {
+	if strings.TrimSpace(cfg.ProjectRoot) == "" {
+		return nil, errors.New("backup store requires a project root")
+	}
+	paths, err := NewSafePath(SafePathConfig{ProjectRoot: cfg.ProjectRoot})
+	if err != nil {
+		return nil, err
+	}
+	root := paths.Root()
+	dir := cfg.Dir
+	if dir == "" {
+		dir = filepath.Join(root, ".ohmyagentflow", "backups")
+	}
+	s := &BackupStore{
+		root:     root,
+		paths:    paths,
+		dir:      dir,
+		maxCount: cfg.RetentionCount,
+		maxBytes: cfg.RetentionBytes,
+		maxAge:   cfg.RetentionAge,
+		now:      cfg.Now,
+	}
+	if s.maxCount == 0 {
+		s.maxCount = DefaultBackupRetentionCount
+	}
+	if s.maxBytes == 0 {
+		s.maxBytes = DefaultBackupRetentionBytes
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	return s, nil
+}
+
+// WriteFile atomically writes data to abs, a path inside the project, after
+// snapshotting the content it replaces. It returns the snapshot ID, empty when
+// there was nothing to preserve. A nil store writes without a snapshot.
+func (s *BackupStore) WriteFile(abs string, data []byte, perm os.FileMode, tmpPrefix string) (string, error) {
+	if s == nil {
+		return "", writeFileAtomicWithPrefix(abs, data, perm, tmpPrefix)
+	}
+	abs, err := filepath.Abs(abs)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.root, abs)
+	if err != nil || abs == s.root || !isWithinRoot(s.root, abs) {
+		return "", fmt.Errorf("%s is outside the project root", abs)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := s.snapshotLocked(rel, abs, data, tmpPrefix)
+	if err != nil {
+		return "", fmt.Errorf("snapshot %s before overwrite: %w", filepath.ToSlash(rel), err)
+	}
+	if err := writeFileAtomicWithPrefix(abs, data, perm, tmpPrefix); err != nil {
+		return id, err
+	}
+	return id, nil
+}
+
+// resolve maps a snapshot's recorded path back to a writable project file.
+func (s *BackupStore) resolve(rel string) (string, error) {
+	abs, apiErr, _ := s.paths.ResolveWrite(rel, ConsoleWriteWhitelist)
+	if apiErr != nil {
+		return "", errors.New(apiErr.Message)
+	}
+	return abs, nil
+}
+
+// RelPath returns the project-relative location of a snapshot's content.
+func (s *BackupStore) RelPath(id string) string {
+	if s == nil || id == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(s.root, filepath.Join(s.dir, id, backupContentFileName))
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (s *BackupStore) snapshotLocked(rel string, abs string, next []byte, operation string) (string, error) {
+	info, err := os.Stat(abs)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s exists but is not a regular file", rel)
+	}
+	prev, err := os.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+	if next != nil && string(prev) == string(next) {
+		return "", nil
+	}
+
+	now := s.now()
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", err
+	}
+	id := now.UTC().Format("20060102-150405.000") + "-" + hex.EncodeToString(suffix[:])
+	snapDir := filepath.Join(s.dir, id)
+	if err := os.MkdirAll(snapDir, 0o755); err != nil {
+		return "", err
+	}
+	meta := BackupInfo{
+		ID:        id,
+		Path:      filepath.ToSlash(filepath.Clean(filepath.FromSlash(rel))),
+		CreatedAt: now.UTC().Format(time.RFC3339Nano),
+		Size:      int64(len(prev)),
+		SHA256:    sha256Hex(prev),
+		Operation: operation,
+		Mode:      fmt.Sprintf("%04o", info.Mode().Perm()),
+	}
+	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	// Content first: a snapshot is only listed once meta.json exists.
+	if err := writeFileAtomicWithPrefix(filepath.Join(snapDir, backupContentFileName), prev, info.Mode().Perm(), ".backup-*"); err != nil {
+		_ = os.RemoveAll(snapDir)
+		return "", err
+	}
+	if err := writeFileAtomicWithPrefix(filepath.Join(snapDir, backupMetaFileName), append(metaBytes, '\n'), 0o644, ".backup-meta-*"); err != nil {
+		_ = os.RemoveAll(snapDir)
+		return "", err
+	}
+	s.pruneLocked(id)
+	return id, nil
+}
+
+func (s *BackupStore) listLocked() []BackupInfo {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	var out []BackupInfo
+	for _, e := range entries {
+		if !e.IsDir() || !backupIDRe.MatchString(e.Name()) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(s.dir, e.Name(), backupMetaFileName))
+		if err != nil {
+			continue
+		}
+		var meta BackupInfo
+		if json.Unmarshal(raw, &meta) != nil || meta.ID != e.Name() {
+			continue
+		}
+		out = append(out, meta)
+	}
+	// IDs start with a UTC timestamp, so they sort chronologically.
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out
+}
+
+// pruneLocked enforces retention, never removing keep (the snapshot just taken).
+func (s *BackupStore) pruneLocked(keep string) {
+	all := s.listLocked()
+	var total int64
+	cutoff := time.Time{}
+	if s.maxAge > 0 {
+		cutoff = s.now().Add(-s.maxAge)
+	}
+	for i, b := range all {
+		total += b.Size
+		if b.ID == keep {
+			continue
+		}
+		expired := false
+		if s.maxCount > 0 && i >= s.maxCount {
+			expired = true
+		}
+		if s.maxBytes > 0 && total > s.maxBytes {
+			expired = true
+		}
+		if !cutoff.IsZero() {
+			if t, err := time.Parse(time.RFC3339Nano, b.CreatedAt); err == nil && t.Before(cutoff) {
+				expired = true
+			}
+		}
+		if expired {
+			_ = os.RemoveAll(filepath.Join(s.dir, b.ID))
+			total -= b.Size
+		}
+	}
+}
+
+// List returns snapshots newest first, optionally only those of path.
+func (s *BackupStore) List(path string) []BackupInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := s.listLocked()
+	out := make([]BackupInfo, 0, len(all))
+	want := filepath.ToSlash(filepath.Clean(filepath.FromSlash(path)))
+	for _, b := range all {
+		if path == "" || b.Path == want {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Restore writes a snapshot back to its original path, first snapshotting the
+// content it replaces.
+func (s *BackupStore) Restore(id string) (BackupRestoreResponse, *APIError, int) {
+	if !backupIDRe.MatchString(id) {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "BACKUP_NOT_FOUND",
+			Message: fmt.Sprintf("backup %q not found.", id),
+			Hint:    "List backups with GET /api/backups.",
+		}, http.StatusNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapDir := filepath.Join(s.dir, id)
+	raw, err := os.ReadFile(filepath.Join(snapDir, backupMetaFileName))
+	if err != nil {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "BACKUP_NOT_FOUND",
+			Message: fmt.Sprintf("backup %q not found.", id),
+			Hint:    "It may have been removed by retention. List backups with GET /api/backups.",
+		}, http.StatusNotFound
+	}
+	var meta BackupInfo
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "BACKUP_CORRUPT",
+			Message: fmt.Sprintf("backup %q has an unreadable meta.json.", id),
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+	content, err := os.ReadFile(filepath.Join(snapDir, backupContentFileName))
+	if err != nil || sha256Hex(content) != meta.SHA256 {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "BACKUP_CORRUPT",
+			Message: fmt.Sprintf("backup %q content is missing or does not match its checksum.", id),
+		}, http.StatusInternalServerError
+	}
+	abs, err := s.resolve(meta.Path)
+	if err != nil {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "BACKUP_CORRUPT",
+			Message: fmt.Sprintf("backup %q points outside the project.", id),
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+
+	prevID, err := s.snapshotLocked(meta.Path, abs, content, "restore")
+	if err != nil {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: fmt.Sprintf("failed to snapshot %s before restoring", meta.Path),
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: fmt.Sprintf("failed to create parent dir for %s", meta.Path),
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+	if err := writeFileAtomicWithPrefix(abs, content, meta.perm(), ".restore-*"); err != nil {
+		return BackupRestoreResponse{}, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: fmt.Sprintf("failed to restore %s", meta.Path),
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+	return BackupRestoreResponse{OK: true, Path: meta.Path, Restored: id, BackupID: prevID}, nil, http.StatusOK
+}
+
+func (b BackupInfo) perm() os.FileMode {
+	mode, err := strconv.ParseUint(b.Mode, 8, 32)
+	if err != nil {
+		return 0o644
+	}
+	return os.FileMode(mode).Perm()
+}
+
+func BackupListHandler(store *BackupStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := BackupListResponse{Backups: store.List(strings.TrimSpace(r.URL.Query().Get("path")))}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func BackupRestoreHandler(store *BackupStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		before := fileSnapshot{}
+		if info, ok := store.find(id); ok {
+			if abs, err := store.resolve(info.Path); err == nil {
+				before = snapshotFile(abs)
+			}
+		}
+		resp, apiErr, status := store.Restore(id)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		if abs, err := store.resolve(resp.Path); err == nil {
+			if content, err := os.ReadFile(abs); err == nil {
+				recordAuditFileWrite(r.Context(), resp.Path, before, content, store.RelPath(resp.BackupID))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (s *BackupStore) find(id string) (BackupInfo, bool) {
+	if !backupIDRe.MatchString(id) {
+		return BackupInfo{}, false
+	}
+	raw, err := os.ReadFile(filepath.Join(s.dir, id, backupMetaFileName))
+	if err != nil {
+		return BackupInfo{}, false
+	}
+	var meta BackupInfo
+	if json.Unmarshal(raw, &meta) != nil {
+		return BackupInfo{}, false
+	}
+	return meta, true
+}
@@ -0,0 +1,205 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupStore_WriteFileSnapshotsAndRestores(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store, err := NewBackupStore(BackupConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewBackupStore error: %v", err)
+	}
+	dest := filepath.Join(root, "tasks", "prd-demo.md")
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+
+	if id, err := store.WriteFile(dest, []byte("v1"), 0o644, ".prd-*"); err != nil || id != "" {
+		t.Fatalf("expected no snapshot for a new file, got id=%q err=%v", id, err)
+	}
+	if id, err := store.WriteFile(dest, []byte("v1"), 0o644, ".prd-*"); err != nil || id != "" {
+		t.Fatalf("expected no snapshot for identical content, got id=%q err=%v", id, err)
+	}
+	id, err := store.WriteFile(dest, []byte("v2"), 0o644, ".prd-*")
+	if err != nil || id == "" {
+		t.Fatalf("expected a snapshot of v1, got id=%q err=%v", id, err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, store.RelPath(id))); string(raw) != "v1" {
+		t.Fatalf("expected snapshot content v1, got %q", raw)
+	}
+
+	list := store.List("tasks/prd-demo.md")
+	if len(list) != 1 || list[0].ID != id || list[0].Operation != ".prd-*" || list[0].SHA256 != sha256Hex([]byte("v1")) {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+	if other := store.List("prd.json"); len(other) != 0 {
+		t.Fatalf("expected path filter to exclude other files, got %+v", other)
+	}
+
+	resp, apiErr, status := store.Restore(id)
+	if apiErr != nil {
+		t.Fatalf("Restore error: %d %+v", status, apiErr)
+	}
+	if raw, _ := os.ReadFile(dest); string(raw) != "v1" {
+		t.Fatalf("expected restored content v1, got %q", raw)
+	}
+	// The restore snapshotted v2, so it can be undone.
+	if resp.BackupID == "" {
+		t.Fatalf("expected restore to snapshot the replaced content")
+	}
+	if _, apiErr, _ := store.Restore(resp.BackupID); apiErr != nil {
+		t.Fatalf("undo Restore error: %+v", apiErr)
+	}
+	if raw, _ := os.ReadFile(dest); string(raw) != "v2" {
+		t.Fatalf("expected undo to bring back v2, got %q", raw)
+	}
+}
+
+func TestBackupStore_RestoreKeepsFileMode(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not preserved on windows")
+	}
+
+	root := t.TempDir()
+	store, err := NewBackupStore(BackupConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewBackupStore error: %v", err)
+	}
+	for _, mode := range []os.FileMode{0o755, 0o600} {
+		dest := filepath.Join(root, "tasks", fmt.Sprintf("prd-%04o.md", mode))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			t.Fatalf("MkdirAll error: %v", err)
+		}
+		if err := os.WriteFile(dest, []byte("v1"), mode); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+		if err := os.Chmod(dest, mode); err != nil {
+			t.Fatalf("Chmod error: %v", err)
+		}
+		id, err := store.WriteFile(dest, []byte("v2"), 0o644, ".prd-*")
+		if err != nil || id == "" {
+			t.Fatalf("expected a snapshot, got id=%q err=%v", id, err)
+		}
+		if list := store.List(filepath.ToSlash(filepath.Join("tasks", filepath.Base(dest)))); len(list) != 1 || list[0].Mode != fmt.Sprintf("%04o", mode) {
+			t.Fatalf("expected mode %04o in the snapshot metadata, got %+v", mode, list)
+		}
+		if _, apiErr, status := store.Restore(id); apiErr != nil {
+			t.Fatalf("Restore error: %d %+v", status, apiErr)
+		}
+		info, err := os.Stat(dest)
+		if err != nil {
+			t.Fatalf("Stat error: %v", err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Fatalf("expected restored mode %04o, got %04o", mode, info.Mode().Perm())
+		}
+	}
+}
+
+func TestBackupStore_Retention(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store, _ := NewBackupStore(BackupConfig{
+		ProjectRoot:    root,
+		RetentionCount: 3,
+		RetentionBytes: -1,
+		RetentionAge:   48 * time.Hour,
+		Now:            clock.Now,
+	})
+	dest := filepath.Join(root, "prd.json")
+	_ = os.WriteFile(dest, []byte("v0"), 0o644)
+
+	var ids []string
+	for i := 1; i <= 5; i++ {
+		clock.Advance(time.Hour)
+		id, err := store.WriteFile(dest, []byte("v"+string(rune('0'+i))), 0o644, ".convert-*")
+		if err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	list := store.List("")
+	if len(list) != 3 || list[0].ID != ids[4] || list[2].ID != ids[2] {
+		t.Fatalf("expected the 3 newest snapshots, got %+v", list)
+	}
+
+	clock.Advance(72 * time.Hour)
+	newest, _ := store.WriteFile(dest, []byte("v6"), 0o644, ".convert-*")
+	if list := store.List(""); len(list) != 1 || list[0].ID != newest {
+		t.Fatalf("expected old snapshots to age out, got %+v", list)
+	}
+
+	bytesStore, _ := NewBackupStore(BackupConfig{ProjectRoot: t.TempDir(), RetentionBytes: 5})
+	dest = filepath.Join(bytesStore.root, "big.txt")
+	_ = os.WriteFile(dest, []byte("0123456789"), 0o644)
+	if id, _ := bytesStore.WriteFile(dest, []byte("abc"), 0o644, ".init-*"); id == "" || len(bytesStore.List("")) != 1 {
+		t.Fatalf("expected the newest snapshot to be kept even when over the byte limit")
+	}
+}
+
+func TestBackupHandlers(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store, _ := NewBackupStore(BackupConfig{ProjectRoot: root})
+	dest := filepath.Join(root, "prd.json")
+	_ = os.WriteFile(dest, []byte("old"), 0o644)
+	id, _ := store.WriteFile(dest, []byte("new"), 0o644, ".convert-*")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/backups", BackupListHandler(store))
+	mux.HandleFunc("POST /api/backups/{id}/restore", BackupRestoreHandler(store))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/backups?path=prd.json", nil))
+	var list BackupListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Backups) != 1 || list.Backups[0].Path != "prd.json" {
+		t.Fatalf("unexpected list: %s", rr.Body.String())
+	}
+
+	for _, bad := range []string{"nope", "20250101-000000.000-zzzzzzzz", "20250101-000000.000-00000000"} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/backups/"+bad+"/restore", nil))
+		if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "BACKUP_NOT_FOUND") {
+			t.Fatalf("%s: expected BACKUP_NOT_FOUND, got %d %s", bad, rr.Code, rr.Body.String())
+		}
+	}
+
+	// A tampered meta.json must not let a restore write outside the project.
+	metaPath := filepath.Join(root, ".ohmyagentflow", "backups", id, backupMetaFileName)
+	raw, _ := os.ReadFile(metaPath)
+	_ = os.WriteFile(metaPath, []byte(strings.Replace(string(raw), `"path": "prd.json"`, `"path": "../escape.txt"`, 1)), 0o644)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/backups/"+id+"/restore", nil))
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "BACKUP_CORRUPT") {
+		t.Fatalf("expected BACKUP_CORRUPT, got %d %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape.txt")); err == nil {
+		t.Fatalf("restore escaped the project root")
+	}
+	_ = os.WriteFile(metaPath, raw, 0o644)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/backups/"+id+"/restore", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "old" {
+		t.Fatalf("expected prd.json restored, got %q", got)
+	}
+}
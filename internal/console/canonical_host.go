@@ -7,14 +7,19 @@ import (
 )
 
 // RedirectLocalhostTo127 returns a handler that redirects UI GET/HEAD requests
-// from http://localhost:<port> to http://127.0.0.1:<port>.
+// from http://localhost:<port> to http://127.0.0.1:<port>. The scheme of the
+// incoming request is kept, so the same handler serves remote (TLS) mode.
 //
-// canonicalHostPort must be in the form "127.0.0.1:<port>".
+// canonicalHostPort must be in the form "<host>:<port>", normally 127.0.0.1.
 func RedirectLocalhostTo127(canonicalHostPort string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet || r.Method == http.MethodHead {
 			if hostWithoutPort(r.Host) == "localhost" {
-				target := "http://" + canonicalHostPort + r.URL.RequestURI()
+				scheme := "http"
+				if r.TLS != nil {
+					scheme = "https"
+				}
+				target := scheme + "://" + canonicalHostPort + r.URL.RequestURI()
 				http.Redirect(w, r, target, http.StatusFound)
 				return
 			}
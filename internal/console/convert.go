@@ -4,16 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"time"
 )
 
 type ConvertConfig struct {
 	ProjectRoot string
 	FSReader    *FSReader
+	// Optional. Snapshots the existing prd.json before it is overwritten.
+	Backups *BackupStore
 }
 
 type ConvertRequest struct {
@@ -28,6 +28,7 @@ type ConvertSummary struct {
 type ConvertResponse struct {
 	InputPath  string         `json:"inputPath"`
 	OutputPath string         `json:"outputPath"`
+	BackupID   string         `json:"backupId,omitempty"`
 	BackupPath string         `json:"backupPath,omitempty"`
 	Summary    ConvertSummary `json:"summary"`
 	PRD        any            `json:"prd"`
@@ -54,6 +55,7 @@ type ConvertedUserStory struct {
 func ConvertHandler(cfg ConvertConfig) http.HandlerFunc {
 	projectRoot := strings.TrimSpace(cfg.ProjectRoot)
 	reader := cfg.FSReader
+	backups := cfg.Backups
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -114,14 +116,14 @@ func ConvertHandler(cfg ConvertConfig) http.HandlerFunc {
 		}
 		jsonBytes = append(jsonBytes, '\n')
 
-		destAbs := filepath.Join(projectRoot, "prd.json")
-		backupRel, apiErr, status := backupPRDJSONIfExists(projectRoot, destAbs)
+		destAbs, apiErr, status := reader.paths.ResolveWrite("prd.json", ConsoleWriteWhitelist)
 		if apiErr != nil {
 			WriteAPIError(w, status, *apiErr)
 			return
 		}
-
-		if err := writeFileAtomicWithPrefix(destAbs, jsonBytes, 0o644, ".convert-*"); err != nil {
+		before := snapshotFile(destAbs)
+		backupID, err := backups.WriteFile(destAbs, jsonBytes, 0o644, ".convert-*")
+		if err != nil {
 			WriteAPIError(w, http.StatusInternalServerError, APIError{
 				Code:    "INTERNAL_ERROR",
 				Message: "failed to write prd.json",
@@ -130,6 +132,9 @@ func ConvertHandler(cfg ConvertConfig) http.HandlerFunc {
 			return
 		}
 
+		backupRel := backups.RelPath(backupID)
+		recordAuditFileWrite(r.Context(), "prd.json", before, jsonBytes, backupRel)
+
 		totalAC := 0
 		for _, s := range prd.UserStories {
 			totalAC += len(s.AcceptanceCriteria)
@@ -138,6 +143,7 @@ func ConvertHandler(cfg ConvertConfig) http.HandlerFunc {
 		resp := ConvertResponse{
 			InputPath:  fsResp.Path,
 			OutputPath: "prd.json",
+			BackupID:   backupID,
 			BackupPath: backupRel,
 			Summary: ConvertSummary{
 				Stories:            len(prd.UserStories),
@@ -152,48 +158,6 @@ func ConvertHandler(cfg ConvertConfig) http.HandlerFunc {
 	}
 }
 
-func backupPRDJSONIfExists(projectRoot, destAbs string) (string, *APIError, int) {
-	info, err := os.Stat(destAbs)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil, http.StatusOK
-		}
-		return "", &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: "failed to stat prd.json",
-			Hint:    err.Error(),
-		}, http.StatusInternalServerError
-	}
-	if !info.Mode().IsRegular() {
-		return "", &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: "prd.json exists but is not a regular file",
-			Hint:    "Remove or rename the existing path and retry.",
-		}, http.StatusInternalServerError
-	}
-
-	data, err := os.ReadFile(destAbs)
-	if err != nil {
-		return "", &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: "failed to read existing prd.json for backup",
-			Hint:    err.Error(),
-		}, http.StatusInternalServerError
-	}
-
-	ts := time.Now().Format("20060102-150405")
-	backupRel := fmt.Sprintf("prd.json.bak-%s.json", ts)
-	backupAbs := filepath.Join(projectRoot, backupRel)
-	if err := writeFileAtomicWithPrefix(backupAbs, data, 0o644, ".convert-bak-*"); err != nil {
-		return "", &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: "failed to write prd.json backup",
-			Hint:    err.Error(),
-		}, http.StatusInternalServerError
-	}
-	return backupRel, nil, http.StatusOK
-}
-
 var storyHeaderRe = regexp.MustCompile(`^US-\d{3}$`)
 
 func parseConvertPRDMarkdown(md, file, defaultProject string) (ConvertedPRD, *APIError, int) {
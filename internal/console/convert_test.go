@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -63,10 +64,15 @@ description: "Demo desc"
 		t.Fatalf("NewFSReader error: %v", err)
 	}
 
+	backups, err := NewBackupStore(BackupConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewBackupStore error: %v", err)
+	}
+
 	body, _ := json.Marshal(ConvertRequest{PRDPath: prdPath})
 	req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/api/convert", bytes.NewReader(body))
 	rr := httptest.NewRecorder()
-	ConvertHandler(ConvertConfig{ProjectRoot: root, FSReader: reader}).ServeHTTP(rr, req)
+	ConvertHandler(ConvertConfig{ProjectRoot: root, FSReader: reader, Backups: backups}).ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d (body=%q)", rr.Code, rr.Body.String())
@@ -79,12 +85,15 @@ description: "Demo desc"
 	if decoded.OutputPath != "prd.json" {
 		t.Fatalf("unexpected outputPath: %q", decoded.OutputPath)
 	}
-	if decoded.BackupPath == "" {
-		t.Fatalf("expected backupPath to be set")
+	if decoded.BackupID == "" || !strings.HasPrefix(decoded.BackupPath, ".ohmyagentflow/backups/") {
+		t.Fatalf("expected backup under .ohmyagentflow/backups, got id=%q path=%q", decoded.BackupID, decoded.BackupPath)
 	}
 	if _, err := os.Stat(filepath.Join(root, decoded.BackupPath)); err != nil {
 		t.Fatalf("expected backup file to exist: %v", err)
 	}
+	if matches, _ := filepath.Glob(filepath.Join(root, "prd.json.bak-*")); len(matches) != 0 {
+		t.Fatalf("expected no backups in the project root, got %v", matches)
+	}
 
 	got, err := os.ReadFile(filepath.Join(root, "prd.json"))
 	if err != nil {
@@ -0,0 +1,141 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrExecDenied is returned (wrapped) when a command is not on the ExecPolicy
+// whitelist.
+var ErrExecDenied = errors.New("command not allowed by exec policy")
+
+// ExecPolicy is the single place child processes are created (design doc
+// §14.2). Each rule names a program and validates its argv and working
+// directory; there is no shell and no string concatenation.
+type ExecPolicy struct {
+	rules map[string]execRule
+}
+
+type execRule struct {
+	// check validates the working directory and arguments.
+	check func(dir string, args []string) error
+}
+
+// consoleExecPolicy lists every command this package runs.
+var consoleExecPolicy = &ExecPolicy{rules: map[string]execRule{
+	"bash":   {check: checkFireArgs},
+	"codex":  {check: exactArgs("exec", "--dangerously-bypass-approvals-and-sandbox", "-")},
+	"claude": {check: exactArgs("--dangerously-skip-permissions", "--print")},
+	"ps":     {check: exactArgs("-eo", "pid=,ppid=")},
+	"git":    {check: exactArgs(gitStatusArgs...)},
+}}
+
+// CommandContext returns an *exec.Cmd for name and args running in dir, or an
+// error wrapping ErrExecDenied. An empty dir inherits the server's cwd.
+func (p *ExecPolicy) CommandContext(ctx context.Context, dir string, name string, args ...string) (*exec.Cmd, error) {
+	rule, ok := p.rules[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not whitelisted", ErrExecDenied, name)
+	}
+	if err := rule.check(dir, args); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrExecDenied, name, err)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	return cmd, nil
+}
+
+// withCommands returns a copy of p that also allows each argv exactly, in any
+// working directory; it backs the project-configured verification commands.
+func (p *ExecPolicy) withCommands(argvs ...[]string) *ExecPolicy {
+	rules := make(map[string]execRule, len(p.rules)+len(argvs))
+	for name, rule := range p.rules {
+		rules[name] = rule
+	}
+	for _, argv := range argvs {
+		name, allowed := argv[0], exactArgs(argv[1:]...)
+		prev, ok := rules[name]
+		if !ok {
+			rules[name] = execRule{check: allowed}
+			continue
+		}
+		rules[name] = execRule{check: func(dir string, args []string) error {
+			if allowed(dir, args) == nil {
+				return nil
+			}
+			return prev.check(dir, args)
+		}}
+	}
+	return &ExecPolicy{rules: rules}
+}
+
+// withWrapper returns a copy of p that also allows program with exactly
+// prefix followed by a command p itself allows, such as a sandbox launcher or
+// the supervisor of detached Fire runs.
+func (p *ExecPolicy) withWrapper(program string, prefix []string) *ExecPolicy {
+	rules := make(map[string]execRule, len(p.rules)+1)
+	for name, rule := range p.rules {
+		rules[name] = rule
+	}
+	prev, hasPrev := p.rules[program]
+	rules[program] = execRule{check: func(dir string, args []string) error {
+		if len(args) > len(prefix) && slices.Equal(args[:len(prefix)], prefix) {
+			inner, ok := p.rules[args[len(prefix)]]
+			if !ok {
+				return fmt.Errorf("wrapped command %q is not whitelisted", args[len(prefix)])
+			}
+			return inner.check(dir, args[len(prefix)+1:])
+		}
+		if hasPrev {
+			return prev.check(dir, args)
+		}
+		return fmt.Errorf("arguments must start with %q", prefix)
+	}}
+	return &ExecPolicy{rules: rules}
+}
+
+func exactArgs(want ...string) func(string, []string) error {
+	return func(_ string, args []string) error {
+		if len(args) != len(want) {
+			return fmt.Errorf("expected arguments %q, got %q", want, args)
+		}
+		for i := range want {
+			if args[i] != want[i] {
+				return fmt.Errorf("expected arguments %q, got %q", want, args)
+			}
+		}
+		return nil
+	}
+}
+
+// checkFireArgs allows exactly: bash <dir>/ralph-codex.sh --tool <codex|claude> <n>.
+func checkFireArgs(dir string, args []string) error {
+	if dir == "" || !filepath.IsAbs(dir) {
+		return errors.New("fire must run in the absolute project root")
+	}
+	if len(args) != 4 {
+		return fmt.Errorf("expected 4 arguments, got %d", len(args))
+	}
+	if args[0] != filepath.Join(dir, "ralph-codex.sh") {
+		return fmt.Errorf("script must be %s", filepath.Join(dir, "ralph-codex.sh"))
+	}
+	if args[1] != "--tool" {
+		return fmt.Errorf("expected --tool, got %q", args[1])
+	}
+	switch FireTool(args[2]) {
+	case FireToolCodex, FireToolClaude:
+	default:
+		return fmt.Errorf("unsupported tool %q", args[2])
+	}
+	n, err := strconv.Atoi(args[3])
+	if err != nil || n < 1 || strings.TrimSpace(args[3]) != args[3] {
+		return fmt.Errorf("maxIterations must be a positive integer, got %q", args[3])
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecPolicy_CommandContext(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	script := filepath.Join(root, "ralph-codex.sh")
+	ctx := context.Background()
+
+	cmd, err := consoleExecPolicy.CommandContext(ctx, root, "bash", script, "--tool", "codex", "3")
+	if err != nil {
+		t.Fatalf("expected fire command to be allowed: %v", err)
+	}
+	if cmd.Dir != root || len(cmd.Args) != 5 || cmd.Args[1] != script {
+		t.Fatalf("unexpected cmd: dir=%q args=%q", cmd.Dir, cmd.Args)
+	}
+	if _, err := consoleExecPolicy.CommandContext(ctx, "", "ps", "-eo", "pid=,ppid="); err != nil {
+		t.Fatalf("expected ps to be allowed: %v", err)
+	}
+	if _, err := consoleExecPolicy.CommandContext(ctx, root, "git", gitStatusArgs...); err != nil {
+		t.Fatalf("expected git status to be allowed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		dir  string
+		cmd  string
+		args []string
+	}{
+		{"shell", root, "sh", []string{"-c", "echo hi"}},
+		{"bash -c", root, "bash", []string{"-c", "echo hi", "--tool", "codex"}},
+		{"other script", root, "bash", []string{filepath.Join(root, "evil.sh"), "--tool", "codex", "3"}},
+		{"script outside dir", root, "bash", []string{filepath.Join(filepath.Dir(root), "ralph-codex.sh"), "--tool", "codex", "3"}},
+		{"relative dir", "project", "bash", []string{"project/ralph-codex.sh", "--tool", "codex", "3"}},
+		{"bad tool", root, "bash", []string{script, "--tool", "rm", "3"}},
+		{"bad iterations", root, "bash", []string{script, "--tool", "codex", "3; rm -rf /"}},
+		{"zero iterations", root, "bash", []string{script, "--tool", "codex", "0"}},
+		{"extra arg", root, "bash", []string{script, "--tool", "codex", "3", "--yolo"}},
+		{"codex extra arg", "", "codex", []string{"exec", "--dangerously-bypass-approvals-and-sandbox", "-", "x"}},
+		{"ps args", "", "ps", []string{"aux"}},
+		{"git other", root, "git", []string{"reset", "--hard"}},
+	} {
+		if _, err := consoleExecPolicy.CommandContext(ctx, tc.dir, tc.cmd, tc.args...); !errors.Is(err, ErrExecDenied) {
+			t.Fatalf("%s: expected ErrExecDenied, got %v", tc.name, err)
+		}
+	}
+}
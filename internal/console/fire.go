@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,28 +29,117 @@ const (
 
 var (
 	reRalphIterationHeader = regexp.MustCompile(`\bRalph Iteration (\d+) of (\d+)\b`)
-	reIterationComplete    = regexp.MustCompile(`\bIteration (\d+) complete\.\b`)
+	reIterationComplete    = regexp.MustCompile(`\bIteration (\d+) complete\.`)
+	reRalphMaxIterations   = regexp.MustCompile(`\bRalph reached max iterations\b`)
+)
+
+const DefaultFireMaxIterationsCap = 200
+
+// run_finished reasons besides "stopped" and "error".
+const (
+	// fireReasonCompletedVerified: COMPLETE was claimed, every story passes
+	// and the configured verification commands passed.
+	fireReasonCompletedVerified = "completed_verified"
+	// fireReasonCompletedUnverified: as above, but no verification ran.
+	fireReasonCompletedUnverified = "completed_unverified"
+	// fireReasonIncomplete: the last COMPLETE claim was rejected.
+	fireReasonIncomplete    = "incomplete"
+	fireReasonMaxIterations = "max_iterations"
+	fireReasonStoriesPassed = "stories_passed"
+	// fireReasonOrphaned: the console lost track of the run, either because
+	// it exited mid-run or because a re-attached run's processes exited.
+	fireReasonOrphaned = "orphaned"
+	// fireReasonDetached: the console let go of a detached run that is
+	// still running; see DetachHandler.
+	fireReasonDetached = "detached"
 )
 
 type FireConfig struct {
 	ProjectRoot string
 	Hub         *StreamHub
+	Metrics     *Metrics
+	// MaxIterationsCap bounds maxIterations in start requests; 0 means DefaultFireMaxIterationsCap.
+	MaxIterationsCap int
+	// Optional. When set, each run records the prompt version it was started with.
+	Prompts *PromptStore
+	// Verify runs after every loop iteration; see FireVerifyCommand.
+	Verify []FireVerifyCommand
+	// Optional. Snapshots prd.json before failed verification reverts stories.
+	Backups *BackupStore
+	// Sandbox wraps the agent (or ralph-codex.sh); the zero value runs it on the host.
+	Sandbox SandboxConfig
+	// Limits bounds the run's processes; the zero value sets none.
+	Limits FireLimits
+	// StopGracePeriod bounds a graceful stop; 0 means DefaultFireStopGracePeriod.
+	StopGracePeriod time.Duration
+	// UsageInterval is how often resource_usage is sampled; 0 means
+	// DefaultFireUsageInterval and a negative value disables sampling.
+	UsageInterval time.Duration
+	// Supervisor is the argv prefix that runs RunFireSupervisor, usually the
+	// console binary and FireSupervisorCommand. Detached runs are refused
+	// when it is empty.
+	Supervisor []string
 }
 
 type FireService struct {
 	rootAbs string
+	paths   *SafePath
 	hub     *StreamHub
+	metrics *Metrics
+	maxIter int
+	prompts *PromptStore
+	verify  []FireVerifyCommand
+	exec    *ExecPolicy
+	backups *BackupStore
+	sandbox *FireSandbox
+	limits  FireLimits
+
+	supervisor    []string
+	usageInterval time.Duration
+	stopGrace     time.Duration
 
 	mu     sync.Mutex
 	active *fireRunState
+	// orphan is a run a previous console left running; see RecoverOrphanedRun.
+	orphan *FireActiveRun
+
+	// recordMu orders writes and removals of active.json.
+	recordMu sync.Mutex
 }
 
 type fireRunState struct {
 	runID         string
 	tool          FireTool
+	mode          FireMode
 	maxIterations int
-	iteration     int
-	complete      bool
+	startedAt     time.Time
+	// loop is set for FireModeLoop runs, where the console (not the script)
+	// announces iterations and detects COMPLETE.
+	loop bool
+	// reattached is set for a run a previous console started; there is no
+	// cmd, only the process group at pgid.
+	reattached bool
+	// leaderStartTicks is the recorded start time of a re-attached group's
+	// leader; the group is only signalled while the leader matches it.
+	leaderStartTicks uint64
+	// detached is set for a run under a supervisor (see RunFireSupervisor).
+	detached bool
+	// log and errLog are the run's output logs, relative to the project root
+	// (see fireOutputLogs); a detached run has only the supervisor's log.
+	log    string
+	errLog string
+	// passesBefore is prd.json before a detached run, for verification.
+	passesBefore map[string]bool
+	// detaching is set by DetachHandler; keepRecord keeps active.json once
+	// the run slot is released.
+	detaching  bool
+	keepRecord bool
+	iteration  int
+	complete   bool
+	// maxReached is set when the script reports it ran out of iterations.
+	maxReached bool
+
+	iterationStartedAt time.Time
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -59,25 +149,34 @@ type fireRunState struct {
 
 	pgid int
 
+	// cgroup is created on the first process start when limits use one.
+	cgroup *runCgroup
+	usage  fireUsage
+
 	stopping     bool
 	stopSignal   string
 	stopIssuedAt time.Time
+	stopMode     FireStopMode
+	// stopAfterIteration is a pending after-iteration or graceful stop.
+	stopAfterIteration bool
 }
 
 type FireStartRequest struct {
 	Tool          string `json:"tool"`
 	MaxIterations int    `json:"maxIterations"`
+	// Mode is "script" (default), "loop" or "single-story".
+	Mode string `json:"mode,omitempty"`
+	// StoryIDs are the target stories of a single-story run.
+	StoryIDs []string `json:"storyIds,omitempty"`
+	// Detached runs the script under a supervisor so that it survives
+	// console restarts; script mode only.
+	Detached bool `json:"detached,omitempty"`
 }
 
 type FireStartResponse struct {
-	OK    bool   `json:"ok"`
-	RunID string `json:"runId"`
-}
-
-type FireStopResponse struct {
-	OK       bool   `json:"ok"`
-	RunID    string `json:"runId,omitempty"`
-	Stopping bool   `json:"stopping"`
+	OK     bool       `json:"ok"`
+	RunID  string     `json:"runId"`
+	Prompt *PromptRef `json:"prompt,omitempty"`
 }
 
 func NewFireService(cfg FireConfig) (*FireService, error) {
@@ -91,7 +190,63 @@ func NewFireService(cfg FireConfig) (*FireService, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &FireService{rootAbs: rootAbs, hub: cfg.Hub}, nil
+	paths, err := NewSafePath(SafePathConfig{ProjectRoot: rootAbs})
+	if err != nil {
+		return nil, err
+	}
+	maxIter := cfg.MaxIterationsCap
+	if maxIter <= 0 {
+		maxIter = DefaultFireMaxIterationsCap
+	}
+	if err := ValidateFireVerifyCommands(cfg.Verify); err != nil {
+		return nil, fmt.Errorf("fire verify: %w", err)
+	}
+	sandbox, err := NewFireSandbox(cfg.Sandbox, rootAbs)
+	if err != nil {
+		return nil, fmt.Errorf("fire sandbox: %w", err)
+	}
+	if err := ValidateFireLimits(cfg.Limits); err != nil {
+		return nil, fmt.Errorf("fire limits: %w", err)
+	}
+	stopGrace := cfg.StopGracePeriod
+	if stopGrace <= 0 {
+		stopGrace = DefaultFireStopGracePeriod
+	}
+	usageInterval := cfg.UsageInterval
+	if usageInterval == 0 {
+		usageInterval = DefaultFireUsageInterval
+	}
+	policy := sandbox.policy(consoleExecPolicy).withCommands(verifyArgvs(cfg.Verify)...)
+	if len(cfg.Supervisor) > 0 {
+		// Detached runs start the Fire command through the supervisor.
+		policy = policy.withWrapper(cfg.Supervisor[0], append(slices.Clone(cfg.Supervisor[1:]), "--"))
+	}
+	s := &FireService{
+		rootAbs: rootAbs,
+		paths:   paths,
+		hub:     cfg.Hub,
+		metrics: cfg.Metrics,
+		maxIter: maxIter,
+		prompts: cfg.Prompts,
+		verify:  slices.Clone(cfg.Verify),
+		exec:    policy,
+		backups: cfg.Backups,
+		sandbox: sandbox,
+		limits:  cfg.Limits,
+
+		supervisor:    slices.Clone(cfg.Supervisor),
+		usageInterval: usageInterval,
+		stopGrace:     stopGrace,
+	}
+	cfg.Metrics.setGaugeFunc(metricFireActiveRuns, func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.active != nil {
+			return 1
+		}
+		return 0
+	})
+	return s, nil
 }
 
 func (s *FireService) StartHandler() http.HandlerFunc {
@@ -111,87 +266,96 @@ func (s *FireService) StartHandler() http.HandlerFunc {
 			WriteAPIError(w, status, *apiErr)
 			return
 		}
-		if req.MaxIterations < 1 || req.MaxIterations > 200 {
+		mode, apiErr, status := parseFireMode(req.Mode)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		storyIDs, apiErr, status := parseFireStoryIDs(mode, req.StoryIDs)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		if req.MaxIterations < 1 || req.MaxIterations > s.maxIter {
 			WriteAPIError(w, http.StatusBadRequest, APIError{
 				Code:    "VALIDATION_ERROR",
-				Message: "maxIterations must be between 1 and 200.",
+				Message: fmt.Sprintf("maxIterations must be between 1 and %d.", s.maxIter),
 				Hint:    "Pick a value like 10 (or 1 for a quick smoke run).",
 			})
 			return
 		}
 
-		if _, apiErr, status := requireRegularFileUnderRoot(s.rootAbs, "prd.json", "prd.json"); apiErr != nil {
+		if _, apiErr, status := s.paths.RequireRegularFile("prd.json", fireInputWhitelist); apiErr != nil {
 			WriteAPIError(w, status, *apiErr)
 			return
 		}
-		scriptAbs, apiErr, status := requireRegularFileUnderRoot(s.rootAbs, "ralph-codex.sh", "ralph-codex.sh")
+		if apiErr := s.sandbox.checkAvailable(); apiErr != nil {
+			WriteAPIError(w, http.StatusBadGateway, *apiErr)
+			return
+		}
+		if req.Detached {
+			if apiErr := s.checkDetachable(mode); apiErr != nil {
+				WriteAPIError(w, http.StatusBadRequest, *apiErr)
+				return
+			}
+		}
+		if mode != FireModeScript {
+			s.startLoop(w, r, fireLoopPlan{tool: tool, maxIterations: req.MaxIterations, mode: mode, storyIDs: storyIDs})
+			return
+		}
+		scriptAbs, apiErr, status := s.paths.RequireRegularFile("ralph-codex.sh", fireInputWhitelist)
 		if apiErr != nil {
 			WriteAPIError(w, status, *apiErr)
 			return
 		}
 
-		runToken, err := GenerateSessionToken()
-		if err != nil {
-			WriteAPIError(w, http.StatusInternalServerError, APIError{
-				Code:    "INTERNAL_ERROR",
-				Message: "Failed to generate run id.",
-				Hint:    "Retry the request.",
-			})
-			return
-		}
-		runID := "fire-" + runToken
+		prompt := s.snapshotPrompt(tool)
+		passesBefore := s.storyPasses()
 
-		s.mu.Lock()
-		if s.active != nil {
-			s.mu.Unlock()
-			WriteAPIError(w, http.StatusConflict, APIError{
-				Code:    "RESOURCE_CONFLICT",
-				Message: "A Fire run is already active.",
-				Hint:    "Wait for it to finish (or use Stop once available).",
-			})
+		runID, ctx, apiErr, status := s.beginRun(tool, req.MaxIterations, FireModeScript)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
 			return
 		}
-		ctx, cancel := context.WithCancel(context.Background())
-		s.active = &fireRunState{
-			runID:         runID,
-			tool:          tool,
-			maxIterations: req.MaxIterations,
-			ctx:           ctx,
-			cancel:        cancel,
-			done:          make(chan struct{}),
-		}
-		s.mu.Unlock()
 
-		cmd := exec.Command("bash", scriptAbs, "--tool", string(tool), strconv.Itoa(req.MaxIterations))
-		cmd.Dir = s.rootAbs
-		setProcessGroup(cmd)
-
-		stdout, err := cmd.StdoutPipe()
+		// Clear a container left behind by a forced stop; the name is reused.
+		s.sandbox.removeContainer(s.exec)
+		name, args := s.sandbox.wrap("bash", []string{scriptAbs, "--tool", string(tool), strconv.Itoa(req.MaxIterations)})
+		cmd, err := s.exec.CommandContext(context.Background(), s.rootAbs, name, args...)
 		if err != nil {
 			s.clearActive(runID)
 			WriteAPIError(w, http.StatusInternalServerError, APIError{
 				Code:    "FIRE_START_FAILED",
 				Message: "Failed to start Fire.",
-				Hint:    "Retry the request.",
+				Hint:    err.Error(),
 			})
 			return
 		}
-		stderr, err := cmd.StderrPipe()
+		if req.Detached {
+			s.startDetached(w, r, runID, ctx, cmd, s.scriptStartedData(tool, req.MaxIterations, scriptAbs, prompt), prompt, passesBefore)
+			return
+		}
+		setProcessGroup(cmd)
+
+		out, err := s.openProcessOutput(runID, cmd)
 		if err != nil {
 			s.clearActive(runID)
 			WriteAPIError(w, http.StatusInternalServerError, APIError{
 				Code:    "FIRE_START_FAILED",
-				Message: "Failed to start Fire.",
-				Hint:    "Retry the request.",
+				Message: "Failed to open the Fire output logs.",
+				Hint:    err.Error(),
 			})
 			return
 		}
-
-		if err := cmd.Start(); err != nil {
+		err = s.startLimited(runID, cmd)
+		out.closeFiles()
+		if err != nil {
 			s.clearActive(runID)
 			hint := "Ensure bash is installed and ralph-codex.sh is present under the project root."
 			if isExecNotFound(err) {
 				hint = "bash was not found on PATH. Install bash (or run on a Unix-like environment) and retry."
+			} else if s.limits.any() {
+				hint = err.Error()
 			}
 			WriteAPIError(w, http.StatusBadGateway, APIError{
 				Code:    "FIRE_START_FAILED",
@@ -209,20 +373,16 @@ func (s *FireService) StartHandler() http.HandlerFunc {
 			}
 		}
 		s.mu.Unlock()
+		s.saveActiveRun(runID)
 
+		startedData := s.scriptStartedData(tool, req.MaxIterations, scriptAbs, prompt)
+		startedData["pid"] = cmd.Process.Pid
 		s.hub.Publish(StreamEvent{
 			RunID: runID,
 			Type:  "run_started",
 			Step:  "fire",
 			Level: "info",
-			Data: map[string]any{
-				"op":            "fire",
-				"cwd":           s.rootAbs,
-				"tool":          tool,
-				"maxIterations": req.MaxIterations,
-				"pid":           cmd.Process.Pid,
-				"cmd":           []string{"bash", scriptAbs, "--tool", string(tool), strconv.Itoa(req.MaxIterations)},
-			},
+			Data:  startedData,
 		})
 
 		s.publishFireProgress(runID, "info", map[string]any{
@@ -231,89 +391,62 @@ func (s *FireService) StartHandler() http.HandlerFunc {
 			"completeDetected": false,
 		})
 
-		go s.streamPipe(runID, "process_stdout", stdout)
-		go s.streamPipe(runID, "process_stderr", stderr)
-		go s.waitAndFinalize(runID, cmd)
+		drained := out.stream(s, runID, "fire", nil)
+		go s.waitAndFinalize(runID, cmd, passesBefore, out, drained)
+		if s.usageInterval > 0 {
+			go s.sampleUsage(ctx, runID)
+		}
 
+		recordAuditRun(r.Context(), runID)
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		_ = json.NewEncoder(w).Encode(FireStartResponse{OK: true, RunID: runID})
+		_ = json.NewEncoder(w).Encode(FireStartResponse{OK: true, RunID: runID, Prompt: prompt})
 	}
 }
 
-func (s *FireService) StopHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		s.mu.Lock()
-		active := s.active
-		if active == nil || active.cmd == nil || active.cmd.Process == nil {
-			s.mu.Unlock()
-			w.Header().Set("Content-Type", "application/json; charset=utf-8")
-			_ = json.NewEncoder(w).Encode(FireStopResponse{OK: true, Stopping: false})
-			return
-		}
-		runID := active.runID
-		if active.stopping {
-			s.mu.Unlock()
-			w.Header().Set("Content-Type", "application/json; charset=utf-8")
-			_ = json.NewEncoder(w).Encode(FireStopResponse{OK: true, RunID: runID, Stopping: true})
-			return
-		}
-		active.stopping = true
-		active.stopSignal = "SIGINT"
-		active.stopIssuedAt = time.Now()
-		pgid := active.pgid
-		pid := active.cmd.Process.Pid
-		s.mu.Unlock()
-
-		if pgid == 0 {
-			pgid = pid
-		}
-
-		// Best effort: stop via process group (Unix) or the process itself (Windows).
-		_ = sendInterruptToProcessGroup(pgid, pid)
-
-		s.publishFireProgress(runID, "info", map[string]any{
-			"phase": "stopped",
-			"note":  "Stop requested; sending SIGINT.",
-		})
-
-		deadline := time.Now().Add(5 * time.Second)
-		for time.Now().Before(deadline) {
-			if !processGroupExists(pgid) {
-				w.Header().Set("Content-Type", "application/json; charset=utf-8")
-				_ = json.NewEncoder(w).Encode(FireStopResponse{OK: true, RunID: runID, Stopping: false})
-				return
-			}
-			time.Sleep(50 * time.Millisecond)
-		}
-
-		s.mu.Lock()
-		active = s.active
-		if active != nil && active.runID == runID {
-			active.stopSignal = "SIGKILL"
-		}
-		s.mu.Unlock()
-
-		_ = sendKillToProcessGroup(pgid, pid)
-
-		s.publishFireProgress(runID, "warn", map[string]any{
-			"phase": "stopped",
-			"note":  "Process did not exit after SIGINT; sent SIGKILL.",
-		})
+// scriptStartedData is the run_started payload of a script run, without the
+// pid.
+func (s *FireService) scriptStartedData(tool FireTool, maxIterations int, scriptAbs string, prompt *PromptRef) map[string]any {
+	data := map[string]any{
+		"op":            "fire",
+		"cwd":           s.rootAbs,
+		"tool":          tool,
+		"maxIterations": maxIterations,
+		"cmd":           []string{"bash", scriptAbs, "--tool", string(tool), strconv.Itoa(maxIterations)},
+		"sandbox":       s.sandbox.Status(),
+	}
+	if s.limits.any() {
+		data["limits"] = s.limits
+	}
+	if prompt != nil {
+		data["prompt"] = prompt
+	}
+	return data
+}
 
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		_ = json.NewEncoder(w).Encode(FireStopResponse{OK: true, RunID: runID, Stopping: true})
+// snapshotPrompt records the version of the prompt file ralph-codex.sh pipes
+// to tool (CODEX.md or CLAUDE.md). It returns nil when prompts are not tracked
+// or the file is missing; the script reports the latter itself.
+func (s *FireService) snapshotPrompt(tool FireTool) *PromptRef {
+	if s.prompts == nil {
+		return nil
+	}
+	ref, err := s.prompts.Snapshot(promptFileForTool(tool))
+	if err != nil {
+		return nil
 	}
+	return &ref
 }
 
-func (s *FireService) waitAndFinalize(runID string, cmd *exec.Cmd) {
+func (s *FireService) waitAndFinalize(runID string, cmd *exec.Cmd, passesBefore map[string]bool, out *processOutput, drained <-chan struct{}) {
 	startedAt := time.Now()
 	err := cmd.Wait()
 
+	// Publish remaining output (and progress derived from it) before run_finished.
+	out.exit()
+	<-drained
+
 	var exitCodePtr *int
 	var signalPtr *string
-	level := "info"
-	ok := true
-	reason := "completed"
 
 	if runtime.GOOS != "windows" {
 		if exitCode, sig, okParse := parseUnixExitStatus(err); okParse {
@@ -339,15 +472,46 @@ func (s *FireService) waitAndFinalize(runID string, cmd *exec.Cmd) {
 		exitCodePtr = &exitCode
 	}
 
-	if err != nil {
-		ok = false
-		level = "error"
-		reason = "error"
-	} else {
-		ok = true
-		level = "info"
-		reason = "completed"
-	}
+	fin := s.scriptOutcome(runID, err != nil, passesBefore)
+	fin.exitCode, fin.signal = exitCodePtr, signalPtr
+	s.finishRun(runID, startedAt, fin)
+}
+
+// scriptOutcome judges a finished ralph-codex.sh run by whether it failed
+// (exited non-zero or by a signal).
+func (s *FireService) scriptOutcome(runID string, failed bool, passesBefore map[string]bool) fireFinish {
+	switch {
+	case failed && s.scriptReachedMax(runID):
+		return fireFinish{ok: false, level: "warn", reason: fireReasonMaxIterations}
+	case failed:
+		return fireFinish{ok: false, level: "error", reason: "error"}
+	}
+	// ralph-codex.sh exits 0 only after the agent printed COMPLETE. The
+	// script cannot verify between iterations, so check the claim once.
+	var verified fireVerifyResult
+	if len(s.verify) > 0 && !s.stopRequested(runID) {
+		iteration, _, _, _ := s.fireProgressSnapshot(runID)
+		verified = s.verifyIteration(runID, iteration, passesBefore)
+	}
+	if accepted, okComplete := s.acceptComplete(runID, verified); okComplete {
+		return fireFinish{ok: true, level: "info", reason: accepted}
+	}
+	return fireFinish{ok: false, level: "warn", reason: fireReasonIncomplete}
+}
+
+// fireFinish is the outcome of a run before a Stop request is taken into account.
+type fireFinish struct {
+	ok       bool
+	level    string
+	reason   string
+	exitCode *int
+	signal   *string
+}
+
+// finishRun publishes run_finished and releases the active run slot.
+func (s *FireService) finishRun(runID string, startedAt time.Time, fin fireFinish) {
+	ok, level, reason := fin.ok, fin.level, fin.reason
+	exitCodePtr, signalPtr := fin.exitCode, fin.signal
 
 	s.mu.Lock()
 	active := s.active
@@ -361,8 +525,25 @@ func (s *FireService) waitAndFinalize(runID string, cmd *exec.Cmd) {
 	if done {
 		close(active.done)
 	}
+	var openIteration time.Duration
+	var tool string
+	var usage map[string]any
+	if active != nil && active.runID == runID {
+		tool = string(active.tool)
+		usage = active.usage.summary(active.cgroup)
+		if !active.iterationStartedAt.IsZero() {
+			openIteration = time.Since(active.iterationStartedAt)
+			active.iterationStartedAt = time.Time{}
+		}
+	}
 	s.mu.Unlock()
 
+	// The script exits without an "Iteration N complete." line on COMPLETE (or when stopped).
+	if openIteration > 0 {
+		s.metrics.fireIterationObserved(tool, openIteration)
+	}
+
+	var worktree map[string]any
 	if stopRequested {
 		reason = "stopped"
 		ok = false
@@ -370,6 +551,11 @@ func (s *FireService) waitAndFinalize(runID string, cmd *exec.Cmd) {
 		if stopSignal != "" {
 			signalPtr = &stopSignal
 			exitCodePtr = nil
+			// A signal may have interrupted the agent mid-commit.
+			worktree = s.checkWorktree()
+			if worktree["dirty"] == true || worktree["indexLock"] == true {
+				level = "warn"
+			}
 		}
 	}
 
@@ -382,21 +568,28 @@ func (s *FireService) waitAndFinalize(runID string, cmd *exec.Cmd) {
 		signalVal = *signalPtr
 	}
 
+	finished := map[string]any{
+		"op":     "fire",
+		"ok":     ok,
+		"reason": reason,
+		"durationMs": func() int64 {
+			return time.Since(startedAt).Milliseconds()
+		}(),
+		"exitCode": exitCodeVal,
+		"signal":   signalVal,
+	}
+	if usage != nil {
+		finished["usage"] = usage
+	}
+	if worktree != nil {
+		finished["worktree"] = worktree
+	}
 	s.hub.Publish(StreamEvent{
 		RunID: runID,
 		Type:  "run_finished",
 		Step:  "fire",
 		Level: level,
-		Data: map[string]any{
-			"op":     "fire",
-			"ok":     ok,
-			"reason": reason,
-			"durationMs": func() int64 {
-				return time.Since(startedAt).Milliseconds()
-			}(),
-			"exitCode": exitCodeVal,
-			"signal":   signalVal,
-		},
+		Data:  finished,
 	})
 
 	s.publishFireProgress(runID, level, map[string]any{
@@ -404,13 +597,30 @@ func (s *FireService) waitAndFinalize(runID string, cmd *exec.Cmd) {
 		"note":  "Fire finished: " + reason + ".",
 	})
 
+	s.metrics.fireRunFinished(reason)
 	s.clearActive(runID)
 }
 
 func (s *FireService) clearActive(runID string) {
+	var cg *runCgroup
+	forget := false
+	var logs []string
+	defer func() {
+		cg.remove()
+		if forget {
+			s.removeActiveRun()
+			// The run archive now holds everything the logs had.
+			s.removeRunLogs(logs...)
+		}
+	}()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.active != nil && s.active.runID == runID {
+		// A detached run keeps its record and log for the next attach; its
+		// cgroup stays while its processes are in it.
+		forget = !s.active.keepRecord
+		logs = []string{s.active.log, s.active.errLog}
+		cg = s.active.cgroup
 		if s.active.cancel != nil {
 			s.active.cancel()
 		}
@@ -425,55 +635,70 @@ func (s *FireService) clearActive(runID string) {
 	}
 }
 
-func (s *FireService) streamPipe(runID string, eventType string, r io.Reader) {
+func (s *FireService) streamPipe(runID string, step string, eventType string, r io.Reader) {
 	sc := bufio.NewScanner(r)
 	// Allow long lines; StreamHub will truncate payloads for safety.
 	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	for sc.Scan() {
-		text := sc.Text()
-		if text == "" {
-			continue
-		}
+		s.publishLine(runID, step, eventType, sc.Text())
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+		s.publishReadError(runID, step, err)
+	}
+}
 
-		pre, post := s.detectFireProgress(runID, text)
-		for _, ev := range pre {
-			s.hub.Publish(ev)
-		}
+// publishLine publishes a line of process output along with the progress it
+// reveals.
+func (s *FireService) publishLine(runID string, step string, eventType string, text string) {
+	if text == "" {
+		return
+	}
+	var pre, post []StreamEvent
+	var stop bool
+	if step == "fire" {
+		pre, post, stop = s.detectFireProgress(runID, text)
+	}
+	for _, ev := range pre {
+		s.hub.Publish(ev)
+	}
 
-		iter, maxIter, tool, complete := s.fireProgressSnapshot(runID)
-		s.hub.Publish(StreamEvent{
-			RunID: runID,
-			Type:  eventType,
-			Step:  "fire",
-			Level: "info",
-			Data: map[string]any{
-				"text":          text,
-				"tool":          tool,
-				"iteration":     iter,
-				"maxIterations": maxIter,
-				"isStdErr":      eventType == "process_stderr",
-				"isStdOut":      eventType == "process_stdout",
-				"complete":      complete,
-			},
-		})
+	iter, maxIter, tool, complete := s.fireProgressSnapshot(runID)
+	s.hub.Publish(StreamEvent{
+		RunID: runID,
+		Type:  eventType,
+		Step:  step,
+		Level: "info",
+		Data: map[string]any{
+			"text":          text,
+			"tool":          tool,
+			"iteration":     iter,
+			"maxIterations": maxIter,
+			"isStdErr":      eventType == "process_stderr",
+			"isStdOut":      eventType == "process_stdout",
+			"complete":      complete,
+		},
+	})
 
-		for _, ev := range post {
-			s.hub.Publish(ev)
-		}
+	for _, ev := range post {
+		s.hub.Publish(ev)
 	}
-	if err := sc.Err(); err != nil {
-		s.hub.Publish(StreamEvent{
-			RunID: runID,
-			Type:  "error",
-			Step:  "fire",
-			Level: "error",
-			Data: map[string]any{
-				"message": fmt.Sprintf("failed to read process output: %v", err),
-			},
-		})
+	if stop {
+		go s.interruptRun(runID)
 	}
 }
 
+func (s *FireService) publishReadError(runID string, step string, err error) {
+	s.hub.Publish(StreamEvent{
+		RunID: runID,
+		Type:  "error",
+		Step:  step,
+		Level: "error",
+		Data: map[string]any{
+			"message": fmt.Sprintf("failed to read process output: %v", err),
+		},
+	})
+}
+
 func (s *FireService) fireProgressSnapshot(runID string) (iteration int, maxIterations int, tool string, completeDetected bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -512,7 +737,10 @@ func (s *FireService) publishFireProgress(runID string, level string, data map[s
 	})
 }
 
-func (s *FireService) detectFireProgress(runID string, text string) (pre []StreamEvent, post []StreamEvent) {
+// detectFireProgress derives progress events from a ralph-codex.sh output
+// line. stop is set when a pending after-iteration stop should now interrupt
+// the script, which is sleeping between iterations.
+func (s *FireService) detectFireProgress(runID string, text string) (pre []StreamEvent, post []StreamEvent, stop bool) {
 	var emitIterationStart bool
 	var iteration int
 
@@ -535,15 +763,25 @@ func (s *FireService) detectFireProgress(runID string, text string) (pre []Strea
 	}
 
 	emitComplete := strings.Contains(text, "<promise>COMPLETE</promise>")
+	maxReached := reRalphMaxIterations.MatchString(text)
 
 	s.mu.Lock()
 	active := s.active
-	if active == nil || active.runID != runID {
+	if active == nil || active.runID != runID || active.loop {
 		s.mu.Unlock()
-		return nil, nil
+		return nil, nil, false
+	}
+
+	if maxReached {
+		active.maxReached = true
 	}
 
 	if emitIterationStart && active.iteration != iteration {
+		now := time.Now()
+		if !active.iterationStartedAt.IsZero() {
+			s.metrics.fireIterationObserved(string(active.tool), now.Sub(active.iterationStartedAt))
+		}
+		active.iterationStartedAt = now
 		active.iteration = iteration
 		pre = append(pre, StreamEvent{
 			RunID: runID,
@@ -566,6 +804,10 @@ func (s *FireService) detectFireProgress(runID string, text string) (pre []Strea
 		if active.iteration < iterationDone {
 			active.iteration = iterationDone
 		}
+		if !active.iterationStartedAt.IsZero() {
+			s.metrics.fireIterationObserved(string(active.tool), time.Since(active.iterationStartedAt))
+			active.iterationStartedAt = time.Time{}
+		}
 		post = append(post, StreamEvent{
 			RunID: runID,
 			Type:  "progress",
@@ -580,6 +822,7 @@ func (s *FireService) detectFireProgress(runID string, text string) (pre []Strea
 				"note":             "Iteration finished.",
 			},
 		})
+		stop = active.stopAfterIteration && !active.stopping
 	}
 
 	if emitComplete && !active.complete {
@@ -601,7 +844,7 @@ func (s *FireService) detectFireProgress(runID string, text string) (pre []Strea
 	}
 	s.mu.Unlock()
 
-	return pre, post
+	return pre, post, stop
 }
 
 func parseFireTool(raw string) (FireTool, *APIError, int) {
@@ -617,49 +860,3 @@ func parseFireTool(raw string) (FireTool, *APIError, int) {
 		}, http.StatusBadRequest
 	}
 }
-
-func requireRegularFileUnderRoot(rootAbs string, relPath string, displayName string) (string, *APIError, int) {
-	relPath = filepath.Clean(relPath)
-	if filepath.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) || strings.Contains(relPath, string(filepath.Separator)) {
-		return "", &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: "unsafe server path configuration.",
-		}, http.StatusInternalServerError
-	}
-
-	abs := filepath.Join(rootAbs, relPath)
-	info, err := os.Lstat(abs)
-	if err != nil {
-		if os.IsNotExist(err) {
-			msg := fmt.Sprintf("%s is required but was not found.", displayName)
-			hint := ""
-			code := "VALIDATION_ERROR"
-			status := http.StatusBadRequest
-			if displayName == "prd.json" {
-				hint = "Generate or Convert a PRD first so prd.json exists, then retry Fire."
-			} else if displayName == "ralph-codex.sh" {
-				hint = "Ensure ralph-codex.sh exists under the project root and is not a symlink."
-			}
-			return "", &APIError{Code: code, Message: msg, Hint: hint}, status
-		}
-		return "", &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: fmt.Sprintf("Failed to stat %s.", displayName),
-		}, http.StatusInternalServerError
-	}
-
-	if info.Mode()&os.ModeSymlink != 0 {
-		return "", &APIError{
-			Code:    "VALIDATION_ERROR",
-			Message: fmt.Sprintf("%s must be a regular file (symlinks are not allowed).", displayName),
-			Hint:    "Replace the symlink with a real file under the project root and retry.",
-		}, http.StatusBadRequest
-	}
-	if !info.Mode().IsRegular() {
-		return "", &APIError{
-			Code:    "VALIDATION_ERROR",
-			Message: fmt.Sprintf("%s must be a regular file.", displayName),
-		}, http.StatusBadRequest
-	}
-	return abs, nil, http.StatusOK
-}
@@ -0,0 +1,282 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// fireDetachedLogDir holds the logs of detached runs, one per run, written by
+// the supervisor (see RunFireSupervisor).
+const fireDetachedLogDir = ".ohmyagentflow/detached"
+
+type FireDetachResponse struct {
+	OK    bool   `json:"ok"`
+	RunID string `json:"runId"`
+}
+
+func (s *FireService) checkDetachable(mode FireMode) *APIError {
+	switch {
+	case mode != FireModeScript:
+		return &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "detached is only supported in script mode.",
+			Hint:    "In loop and single-story modes the console drives the iterations and cannot be restarted mid-run.",
+		}
+	case runtime.GOOS == "windows":
+		return &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "Detached runs are not supported on Windows.",
+		}
+	case len(s.supervisor) == 0:
+		return &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "Detached runs are not available: no supervisor is configured.",
+			Hint:    "Run the ohmyagentflow binary, which supervises detached runs itself.",
+		}
+	}
+	return nil
+}
+
+// startSupervised starts inner under the supervisor in a session of its own,
+// with its output going to a new log under fireDetachedLogDir. It returns
+// the supervisor and the log path relative to the project root. Like the
+// logs of other runs, the log is not redacted: it is private to the user and
+// removed once the run is finalized.
+func (s *FireService) startSupervised(runID string, inner *exec.Cmd) (*exec.Cmd, string, error) {
+	if inner.Err != nil {
+		return nil, "", inner.Err
+	}
+	logRel := path.Join(fireDetachedLogDir, runID+".log")
+	logAbs, apiErr, _ := s.paths.ResolveWrite(logRel, fireRunLogWhitelist)
+	if apiErr != nil {
+		return nil, "", errors.New(apiErr.Message)
+	}
+	// inner was built by s.exec, so its Args[0] is the whitelisted name.
+	args := append(slices.Clone(s.supervisor[1:]), "--")
+	sup, err := s.exec.CommandContext(context.Background(), inner.Dir, s.supervisor[0], append(args, inner.Args...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(logAbs), 0o700); err != nil {
+		return nil, "", err
+	}
+	f, err := os.OpenFile(logAbs, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, "", err
+	}
+	sup.Env = inner.Env
+	sup.Stdout = f
+	setSession(sup)
+	// The supervisor waits for EOF on stdin, so limits apply before the
+	// script starts.
+	stdin, err := sup.StdinPipe()
+	if err == nil {
+		err = s.startLimited(runID, sup)
+		_ = stdin.Close()
+	}
+	_ = f.Close()
+	if err != nil {
+		_ = os.Remove(logAbs)
+		return nil, "", err
+	}
+	return sup, logRel, nil
+}
+
+// startDetached starts the script command of run runID under the supervisor
+// and follows its log.
+func (s *FireService) startDetached(w http.ResponseWriter, r *http.Request, runID string, ctx context.Context, cmd *exec.Cmd, startedData map[string]any, prompt *PromptRef, passesBefore map[string]bool) {
+	sup, logRel, err := s.startSupervised(runID, cmd)
+	if err != nil {
+		s.clearActive(runID)
+		WriteAPIError(w, http.StatusBadGateway, APIError{
+			Code:    "FIRE_START_FAILED",
+			Message: "Failed to start the detached Fire process.",
+			Hint:    err.Error(),
+		})
+		return
+	}
+	// Reap the supervisor while this console lives; the run does not end
+	// with it.
+	go func() { _ = sup.Wait() }()
+
+	pgid := sup.Process.Pid
+	s.mu.Lock()
+	if s.active != nil && s.active.runID == runID {
+		s.active.cmd = sup
+		s.active.pgid = pgid
+		s.active.detached = true
+		s.active.log = logRel
+		s.active.errLog = ""
+		s.active.passesBefore = passesBefore
+	}
+	s.mu.Unlock()
+	s.saveActiveRun(runID)
+
+	startedData["pid"] = pgid
+	startedData["detached"] = true
+	startedData["log"] = logRel
+	s.hub.Publish(StreamEvent{
+		RunID: runID,
+		Type:  "run_started",
+		Step:  "fire",
+		Level: "info",
+		Data:  startedData,
+	})
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase":            "started",
+		"note":             "Fire started detached; output goes through " + logRel + ".",
+		"completeDetected": false,
+	})
+
+	logAbs := filepath.Join(s.rootAbs, filepath.FromSlash(logRel))
+	go s.followDetached(ctx, runID, FireActiveRun{PGID: pgid, LeaderStartTicks: procStartTicks(pgid)}, logAbs, passesBefore)
+	if s.usageInterval > 0 {
+		go s.sampleUsage(ctx, runID)
+	}
+
+	recordAuditRun(r.Context(), runID)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(FireStartResponse{OK: true, RunID: runID, Prompt: prompt})
+}
+
+// followDetached publishes a detached run's log from the start until its
+// exit status, or until the processes of group are gone or the console
+// detaches.
+func (s *FireService) followDetached(ctx context.Context, runID string, group FireActiveRun, logAbs string, passesBefore map[string]bool) {
+	startedAt := time.Now()
+	tail := &fileTail{path: logAbs, poll: fireTailPollInterval, done: func() bool {
+		return ctx.Err() != nil || !group.alive()
+	}}
+
+	var exit *fireSupervisorExit
+	sc := bufio.NewScanner(tail)
+	// Lines are JSON-escaped process output of up to 1 MiB.
+	sc.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	for exit == nil && sc.Scan() {
+		var rec fireSupervisorRecord
+		if json.Unmarshal(sc.Bytes(), &rec) != nil {
+			continue
+		}
+		switch {
+		case rec.Exit != nil:
+			exit = rec.Exit
+		case rec.Stream == "stdout" || rec.Stream == "stderr":
+			s.publishLine(runID, "fire", "process_"+rec.Stream, rec.Text)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		s.publishReadError(runID, "fire", err)
+	}
+
+	s.mu.Lock()
+	detaching := s.active != nil && s.active.runID == runID && s.active.detaching
+	s.mu.Unlock()
+	if detaching && exit == nil {
+		s.finishDetach(runID, startedAt)
+		return
+	}
+
+	fin := fireFinish{ok: false, level: "warn", reason: fireReasonOrphaned}
+	switch {
+	case exit != nil && exit.Error != "":
+		s.hub.Publish(StreamEvent{
+			RunID: runID,
+			Type:  "error",
+			Step:  "fire",
+			Level: "error",
+			Data:  map[string]any{"message": "The supervisor could not start the script: " + exit.Error},
+		})
+		fin = fireFinish{ok: false, level: "error", reason: "error"}
+	case exit != nil:
+		fin = s.scriptOutcome(runID, exit.Signal != "" || exit.Code == nil || *exit.Code != 0, passesBefore)
+		if exit.Signal != "" {
+			sig := exit.Signal
+			fin.signal = &sig
+		} else {
+			fin.exitCode = exit.Code
+		}
+	}
+	s.finishRun(runID, startedAt, fin)
+}
+
+// finishDetach releases the run slot of a detached run that keeps running:
+// it becomes the orphan, to be re-attached (by this console or the next).
+func (s *FireService) finishDetach(runID string, startedAt time.Time) {
+	s.mu.Lock()
+	a := s.active
+	if a == nil || a.runID != runID {
+		s.mu.Unlock()
+		return
+	}
+	rec := activeRecord(a)
+	a.keepRecord = true
+	s.mu.Unlock()
+	rec.stamp()
+
+	s.mu.Lock()
+	if s.active == a {
+		s.orphan = &rec
+	}
+	s.mu.Unlock()
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase": "detached",
+		"note":  fmt.Sprintf("Detached; the run keeps going in process group %d. Re-attach to follow it again.", rec.PGID),
+	})
+	s.finishRun(runID, startedAt, fireFinish{ok: false, level: "info", reason: fireReasonDetached})
+}
+
+// DetachHandler serves POST /api/fire/detach: the console stops following a
+// detached run, which keeps running. It is listed as the orphan until it is
+// re-attached (POST /api/fire/orphan/attach) or killed.
+func (s *FireService) DetachHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		active := s.active
+		if active == nil {
+			s.mu.Unlock()
+			WriteAPIError(w, http.StatusNotFound, APIError{
+				Code:    "NOT_FOUND",
+				Message: "No Fire run is active.",
+			})
+			return
+		}
+		runID := active.runID
+		switch {
+		case !active.detached:
+			s.mu.Unlock()
+			WriteAPIError(w, http.StatusConflict, APIError{
+				Code:    "RESOURCE_CONFLICT",
+				Message: fmt.Sprintf("Fire run %s was not started detached; its output goes through the console.", runID),
+				Hint:    "Start the run with detached=true to be able to detach from it.",
+			})
+			return
+		case active.stopping:
+			s.mu.Unlock()
+			WriteAPIError(w, http.StatusConflict, APIError{
+				Code:    "RESOURCE_CONFLICT",
+				Message: fmt.Sprintf("Fire run %s is stopping.", runID),
+			})
+			return
+		}
+		active.detaching = true
+		active.cancel()
+		done := active.done
+		s.mu.Unlock()
+		recordAuditRun(r.Context(), runID)
+
+		<-done
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(FireDetachResponse{OK: true, RunID: runID})
+	}
+}
@@ -0,0 +1,164 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFireSupervisorHelperProcess is the supervisor of detached runs in
+// these tests; it does nothing when run as a test.
+func TestFireSupervisorHelperProcess(t *testing.T) {
+	if os.Getenv("OHMYAGENTFLOW_TEST_FIRE_SUPERVISOR") != "1" {
+		return
+	}
+	i := slices.Index(os.Args, "--")
+	os.Exit(RunFireSupervisor(os.Args[i+1:]))
+}
+
+func newDetachedFixture(t *testing.T, script string) (*FireService, *StreamHub, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("detached runs need Unix sessions")
+	}
+	t.Setenv("OHMYAGENTFLOW_TEST_FIRE_SUPERVISOR", "1")
+	poll := fireTailPollInterval
+	fireTailPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { fireTailPollInterval = poll })
+
+	root := t.TempDir()
+	writeConfigFile(t, filepath.Join(root, "prd.json"), `{"userStories":[]}`)
+	writeConfigFile(t, filepath.Join(root, "ralph-codex.sh"), script)
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 200, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Supervisor: detachedTestSupervisor()})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+	return svc, hub, root
+}
+
+func detachedTestSupervisor() []string {
+	return []string{os.Args[0], "-test.run=^TestFireSupervisorHelperProcess$", "--"}
+}
+
+func TestFireService_DetachedRun(t *testing.T) {
+	svc, hub, root := newDetachedFixture(t, "#!/usr/bin/env bash\necho hello\necho oops >&2\nexit 3\n")
+
+	runID := startFireRun(t, svc, FireStartRequest{Tool: "codex", MaxIterations: 1, Detached: true})
+	events := waitForRunFinished(t, hub, runID)
+	var started map[string]any
+	var stderr []string
+	for _, ev := range events {
+		data, _ := ev.Data.(map[string]any)
+		switch ev.Type {
+		case "run_started":
+			started = data
+		case "process_stderr":
+			stderr = append(stderr, data["text"].(string))
+		}
+	}
+	logRel, _ := started["log"].(string)
+	if started["detached"] != true || !strings.HasPrefix(logRel, fireDetachedLogDir+"/") {
+		t.Fatalf("unexpected run_started: %+v", started)
+	}
+	if lines := stdoutLines(events); !slices.Equal(lines, []string{"hello"}) || !slices.Equal(stderr, []string{"oops"}) {
+		t.Fatalf("unexpected output: stdout %q, stderr %q", lines, stderr)
+	}
+	_, data := runFinishedEvent(t, events)
+	if data["reason"] != "error" || data["exitCode"] != 3 {
+		t.Fatalf("unexpected run_finished: %+v", data)
+	}
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(logRel))); !os.IsNotExist(err) {
+		t.Fatalf("expected the log to be removed after the run, got %v", err)
+	}
+	if rec := readActiveRun(t, root); rec != nil {
+		t.Fatalf("expected active.json to be removed, got %+v", rec)
+	}
+
+	sup := detachedTestSupervisor()
+	if _, err := svc.exec.CommandContext(context.Background(), root, sup[0], append(sup[1:], "--", "sh", "-c", "id")...); !errors.Is(err, ErrExecDenied) {
+		t.Fatalf("expected the supervisor to wrap only whitelisted commands, got %v", err)
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 1, Mode: "loop", Detached: true})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected detached loop runs to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFireService_DetachedRunSurvivesDetach(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("recovering a run needs its leader's start time from procfs")
+	}
+	svc, hub, root := newDetachedFixture(t, "#!/usr/bin/env bash\necho one\nwhile [ ! -f go-on ]; do sleep 0.05; done\necho two\n")
+
+	runID := startFireRun(t, svc, FireStartRequest{Tool: "codex", MaxIterations: 1, Detached: true})
+	waitForOutput(t, hub, runID, "one")
+
+	w := httptest.NewRecorder()
+	svc.DetachHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire/detach", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("detach: %d %s", w.Code, w.Body.String())
+	}
+	_, data := runFinishedEvent(t, waitForRunFinished(t, hub, runID))
+	if data["reason"] != fireReasonDetached {
+		t.Fatalf("unexpected run_finished: %+v", data)
+	}
+	rec := readActiveRun(t, root)
+	if rec == nil || rec.RunID != runID || !rec.Detached || !rec.alive() {
+		t.Fatalf("expected active.json to keep the running detached run, got %+v", rec)
+	}
+	t.Cleanup(func() { _ = sendKillToProcessGroup(rec.PGID, rec.PGID) })
+	if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(rec.Log))); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the unredacted log to be private, got %v (%v)", info, err)
+	}
+
+	// A console restart: a new service finds the run and replays its log.
+	svc2, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Supervisor: detachedTestSupervisor()})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+	orphan, err := svc2.RecoverOrphanedRun()
+	if err != nil || orphan == nil || orphan.RunID != runID || !orphan.Detached {
+		t.Fatalf("expected the detached run to be recovered, got %+v (%v)", orphan, err)
+	}
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 1})
+	w = httptest.NewRecorder()
+	svc2.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected a new run to be refused while the detached run waits, got %d: %s", w.Code, w.Body.String())
+	}
+
+	attachedID, err := svc2.AttachOrphan()
+	if err != nil {
+		t.Fatalf("AttachOrphan: %v", err)
+	}
+	waitForOutput(t, hub, attachedID, "one")
+	writeConfigFile(t, filepath.Join(root, "go-on"), "")
+	events := waitForRunFinished(t, hub, attachedID)
+	if lines := stdoutLines(events); !slices.Equal(lines, []string{"one", "two"}) {
+		t.Fatalf("expected the whole log to be replayed, got %q", lines)
+	}
+	_, data = runFinishedEvent(t, events)
+	if data["reason"] != fireReasonCompletedUnverified || data["exitCode"] != 0 {
+		t.Fatalf("unexpected run_finished: %+v", data)
+	}
+	if rec := readActiveRun(t, root); rec != nil {
+		t.Fatalf("expected active.json to be removed, got %+v", rec)
+	}
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(rec.Log))); !os.IsNotExist(err) {
+		t.Fatalf("expected the log to be removed after the run, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFireUsageInterval is how often a run's resource usage is sampled.
+const DefaultFireUsageInterval = 5 * time.Second
+
+// FireLimits bounds the processes of a run: the agent, ralph-codex.sh and the
+// verification commands. Zero fields are unlimited. Limits are applied on
+// Linux only; children inherit them.
+type FireLimits struct {
+	// MemoryBytes caps each process's address space (RLIMIT_AS) or, with
+	// CgroupParent, the run's total memory (memory.max). Runtimes that reserve
+	// large virtual ranges (Node, the JVM) need a generous RLIMIT_AS.
+	MemoryBytes int64 `json:"memoryBytes"`
+	// CPUSeconds caps each process's CPU time (RLIMIT_CPU).
+	CPUSeconds int `json:"cpuSeconds"`
+	// Processes caps the processes of the console's user (RLIMIT_NPROC) or,
+	// with CgroupParent, of the run (pids.max).
+	Processes int `json:"processes"`
+	// OpenFiles caps each process's open descriptors (RLIMIT_NOFILE).
+	OpenFiles int `json:"openFiles"`
+	// CgroupParent is a cgroup v2 directory delegated to the console's user;
+	// each run gets a child cgroup there.
+	CgroupParent string `json:"cgroupParent"`
+}
+
+func (l FireLimits) any() bool {
+	return l.MemoryBytes > 0 || l.CPUSeconds > 0 || l.Processes > 0 || l.OpenFiles > 0 || l.CgroupParent != ""
+}
+
+// ValidateFireLimits reports the first invalid limit.
+func ValidateFireLimits(l FireLimits) error {
+	if l.MemoryBytes < 0 || l.CPUSeconds < 0 || l.Processes < 0 || l.OpenFiles < 0 {
+		return errors.New("memoryBytes, cpuSeconds, processes and openFiles must not be negative")
+	}
+	if l.CgroupParent != "" && !filepath.IsAbs(l.CgroupParent) {
+		return fmt.Errorf("cgroupParent %q must be an absolute path", l.CgroupParent)
+	}
+	if l.any() && !fireLimitsSupported {
+		return errors.New("limits are only supported on Linux")
+	}
+	return nil
+}
+
+// runCgroup is the cgroup v2 directory of one run.
+type runCgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// newRunCgroup creates parent/name with the memory and process limits of l.
+func newRunCgroup(parent string, name string, l FireLimits) (*runCgroup, error) {
+	if _, err := os.Stat(filepath.Join(parent, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("%s is not a cgroup v2 directory", parent)
+	}
+	var controllers []string
+	if l.MemoryBytes > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if l.Processes > 0 {
+		controllers = append(controllers, "+pids")
+	}
+	if len(controllers) > 0 {
+		// Fails when already enabled or not delegated; writing the limits
+		// below reports the latter.
+		_ = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(strings.Join(controllers, " ")), 0o644)
+	}
+	dir := filepath.Join(parent, name)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, err
+	}
+	cg := &runCgroup{dir: dir}
+	write := func(file string, v int64) error {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(strconv.FormatInt(v, 10)), 0o644); err != nil {
+			return fmt.Errorf("set %s: %w", file, err)
+		}
+		return nil
+	}
+	var err error
+	if l.MemoryBytes > 0 {
+		err = write("memory.max", l.MemoryBytes)
+	}
+	if err == nil && l.Processes > 0 {
+		err = write("pids.max", int64(l.Processes))
+	}
+	if err == nil {
+		cg.fd, err = os.Open(dir)
+	}
+	if err != nil {
+		_ = os.Remove(dir)
+		return nil, err
+	}
+	return cg, nil
+}
+
+// memoryPeak returns memory.peak (Linux 5.19+), or 0.
+func (cg *runCgroup) memoryPeak() int64 {
+	if cg == nil {
+		return 0
+	}
+	raw, err := os.ReadFile(filepath.Join(cg.dir, "memory.peak"))
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	return v
+}
+
+// remove deletes the cgroup; it stays behind while processes the run left
+// running are still in it.
+func (cg *runCgroup) remove() {
+	if cg == nil {
+		return
+	}
+	if cg.fd != nil {
+		_ = cg.fd.Close()
+	}
+	_ = os.Remove(cg.dir)
+}
+
+// startLimited starts cmd in the run's cgroup (created on first use) and
+// applies the rlimits right after it starts.
+func (s *FireService) startLimited(runID string, cmd *exec.Cmd) error {
+	if !s.limits.any() {
+		return cmd.Start()
+	}
+	cg, err := s.runCgroup(runID)
+	if err != nil {
+		return fmt.Errorf("fire.limits: cgroup: %w", err)
+	}
+	cg.attach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := applyProcessLimits(cmd.Process.Pid, s.limits); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("fire.limits: %w", err)
+	}
+	return nil
+}
+
+func (s *FireService) runCgroup(runID string) (*runCgroup, error) {
+	if s.limits.CgroupParent == "" {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil || s.active.runID != runID {
+		return nil, errors.New("run is not active")
+	}
+	if s.active.cgroup == nil {
+		cg, err := newRunCgroup(s.limits.CgroupParent, runID, s.limits)
+		if err != nil {
+			return nil, err
+		}
+		s.active.cgroup = cg
+	}
+	return s.active.cgroup, nil
+}
+
+// fireUsage tracks the peaks of a run's resource_usage samples.
+type fireUsage struct {
+	samples        int
+	peakRSS        int64
+	peakProcesses  int
+	peakCPUPercent float64
+}
+
+func (u fireUsage) summary(cg *runCgroup) map[string]any {
+	if u.samples == 0 && cg == nil {
+		return nil
+	}
+	out := map[string]any{
+		"samples":        u.samples,
+		"peakRssBytes":   u.peakRSS,
+		"peakProcesses":  u.peakProcesses,
+		"peakCpuPercent": u.peakCPUPercent,
+	}
+	if peak := cg.memoryPeak(); peak > 0 {
+		out["cgroupMemoryPeakBytes"] = peak
+	}
+	return out
+}
+
+// sampleUsage publishes resource_usage for the run's current process group
+// every interval until ctx is done. It stops quietly without procfs.
+func (s *FireService) sampleUsage(ctx context.Context, runID string) {
+	ticker := time.NewTicker(s.usageInterval)
+	defer ticker.Stop()
+	var lastPGID int
+	var lastCPU float64
+	var lastAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		var pgid, iteration int
+		if s.active != nil && s.active.runID == runID {
+			pgid, iteration = s.active.pgid, s.active.iteration
+		}
+		s.mu.Unlock()
+		if pgid == 0 {
+			continue
+		}
+		u, err := sampleProcessGroup(pgid)
+		if errors.Is(err, errProcUnavailable) {
+			return
+		}
+		if err != nil || u.Processes == 0 {
+			continue
+		}
+		now := time.Now()
+		cpuPercent := 0.0
+		if pgid == lastPGID && !lastAt.IsZero() {
+			// Exited processes drop out of the sum; clamp instead of going negative.
+			cpuPercent = math.Max(0, (u.CPUSeconds-lastCPU)/now.Sub(lastAt).Seconds()*100)
+			cpuPercent = math.Round(cpuPercent*10) / 10
+		}
+		lastPGID, lastCPU, lastAt = pgid, u.CPUSeconds, now
+
+		s.mu.Lock()
+		if s.active != nil && s.active.runID == runID {
+			us := &s.active.usage
+			us.samples++
+			us.peakRSS = max(us.peakRSS, u.RSSBytes)
+			us.peakProcesses = max(us.peakProcesses, u.Processes)
+			us.peakCPUPercent = max(us.peakCPUPercent, cpuPercent)
+		}
+		s.mu.Unlock()
+		s.hub.Publish(StreamEvent{RunID: runID, Type: "resource_usage", Step: "fire", Level: "info", Data: map[string]any{
+			"pgid":       pgid,
+			"iteration":  iteration,
+			"processes":  u.Processes,
+			"rssBytes":   u.RSSBytes,
+			"cpuSeconds": math.Round(u.CPUSeconds*100) / 100,
+			"cpuPercent": cpuPercent,
+		}})
+	}
+}
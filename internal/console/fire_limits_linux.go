@@ -0,0 +1,56 @@
+//go:build linux
+
+package console
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+const fireLimitsSupported = true
+
+// attach makes cmd start inside the cgroup.
+func (cg *runCgroup) attach(cmd *exec.Cmd) {
+	if cg == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
+
+// applyProcessLimits sets the rlimits of a running process with prlimit(2).
+// With a cgroup, memory and process counts are limited there instead.
+func applyProcessLimits(pid int, l FireLimits) error {
+	const rlimitNproc = 6 // RLIMIT_NPROC; not exported by syscall.
+	type limit struct {
+		name     string
+		resource int
+		value    uint64
+	}
+	var limits []limit
+	if l.MemoryBytes > 0 && l.CgroupParent == "" {
+		limits = append(limits, limit{"memoryBytes", syscall.RLIMIT_AS, uint64(l.MemoryBytes)})
+	}
+	if l.CPUSeconds > 0 {
+		limits = append(limits, limit{"cpuSeconds", syscall.RLIMIT_CPU, uint64(l.CPUSeconds)})
+	}
+	if l.Processes > 0 && l.CgroupParent == "" {
+		limits = append(limits, limit{"processes", rlimitNproc, uint64(l.Processes)})
+	}
+	if l.OpenFiles > 0 {
+		limits = append(limits, limit{"openFiles", syscall.RLIMIT_NOFILE, uint64(l.OpenFiles)})
+	}
+	for _, lim := range limits {
+		rl := syscall.Rlimit{Cur: lim.value, Max: lim.value}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(lim.resource), uintptr(unsafe.Pointer(&rl)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("set %s: %w", lim.name, errno)
+		}
+	}
+	return nil
+}
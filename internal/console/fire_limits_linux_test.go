@@ -0,0 +1,66 @@
+//go:build linux
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFireService_LoopModeAppliesLimitsAndReportsUsage(t *testing.T) {
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\ncat >/dev/null\n"+
+		"echo \"nofile=$(ulimit -n) cpu=$(ulimit -t)\"\nsleep 0.5\necho 'tokens used 1'\n")
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{
+		ProjectRoot:   root,
+		Hub:           hub,
+		Prompts:       newTestPromptStore(t, root),
+		Limits:        FireLimits{OpenFiles: 64, CPUSeconds: 30},
+		UsageInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	events, finished := runFireToEnd(t, svc, hub, FireStartRequest{Tool: "codex", MaxIterations: 1, Mode: "loop"})
+	var limited bool
+	var samples []map[string]any
+	for _, ev := range events {
+		data, _ := ev.Data.(map[string]any)
+		switch ev.Type {
+		case "run_started":
+			if l, _ := data["limits"].(FireLimits); l.OpenFiles != 64 {
+				t.Fatalf("expected the limits in run_started, got %+v", data)
+			}
+		case "process_stdout":
+			text, _ := data["text"].(string)
+			limited = limited || strings.Contains(text, "nofile=64 cpu=30")
+		case "resource_usage":
+			samples = append(samples, data)
+		}
+	}
+	if !limited {
+		t.Fatalf("expected the agent to run with the limits, got %+v", events)
+	}
+	if len(samples) == 0 || samples[0]["processes"].(int) < 1 || samples[0]["rssBytes"].(int64) <= 0 || samples[0]["iteration"] != 1 {
+		t.Fatalf("expected resource_usage samples of the agent's process group, got %+v", samples)
+	}
+	usage, _ := finished["usage"].(map[string]any)
+	if usage == nil || usage["samples"] != len(samples) || usage["peakRssBytes"].(int64) < samples[0]["rssBytes"].(int64) {
+		t.Fatalf("expected peak usage in run_finished, got %+v", finished)
+	}
+}
+
+func TestNewRunCgroup_RejectsNonCgroupDir(t *testing.T) {
+	if _, err := newRunCgroup(t.TempDir(), "fire-x", FireLimits{MemoryBytes: 1 << 30}); err == nil || !strings.Contains(err.Error(), "not a cgroup v2 directory") {
+		t.Fatalf("expected a plain directory to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package console
+
+import (
+	"errors"
+	"os/exec"
+)
+
+const fireLimitsSupported = false
+
+func (cg *runCgroup) attach(cmd *exec.Cmd) {}
+
+func applyProcessLimits(pid int, l FireLimits) error {
+	return errors.New("limits are only supported on Linux")
+}
@@ -0,0 +1,673 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type FireMode string
+
+const (
+	// FireModeScript runs ralph-codex.sh, which loops over the static prompt file.
+	FireModeScript FireMode = "script"
+	// FireModeLoop drives the iterations from the console and renders the
+	// prompt template (see PromptTemplateData) before each one.
+	FireModeLoop FireMode = "loop"
+	// FireModeSingleStory is a loop limited to FireStartRequest.StoryIDs that
+	// ends once those stories pass, whatever the agent claims.
+	FireModeSingleStory FireMode = "single-story"
+)
+
+// fireLoopIterationPause mirrors the `sleep 2` between ralph-codex.sh iterations.
+var fireLoopIterationPause = 2 * time.Second
+
+// maxAgentOutputBytes bounds the output kept per iteration for COMPLETE detection.
+const maxAgentOutputBytes = 4 << 20
+
+// ralphStateWhitelist lists the files the loop maintains like ralph-codex.sh does.
+var ralphStateWhitelist = PathWhitelist{"progress.txt", ".last-branch", "archive/*/prd.json", "archive/*/progress.txt"}
+
+func parseFireMode(raw string) (FireMode, *APIError, int) {
+	switch FireMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", FireModeScript:
+		return FireModeScript, nil, http.StatusOK
+	case FireModeLoop:
+		return FireModeLoop, nil, http.StatusOK
+	case FireModeSingleStory:
+		return FireModeSingleStory, nil, http.StatusOK
+	default:
+		return "", &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "mode must be one of: script, loop, single-story.",
+			Hint:    "Use mode=loop to render the prompt template for every iteration.",
+		}, http.StatusBadRequest
+	}
+}
+
+// parseFireStoryIDs trims and de-duplicates storyIds; they are required for
+// single-story runs and rejected otherwise.
+func parseFireStoryIDs(mode FireMode, raw []string) ([]string, *APIError, int) {
+	var ids []string
+	seen := make(map[string]bool, len(raw))
+	for _, id := range raw {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	switch {
+	case mode == FireModeSingleStory && len(ids) == 0:
+		return nil, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "storyIds is required for mode=single-story.",
+			Hint:    "Send e.g. {\"mode\":\"single-story\",\"storyIds\":[\"US-007\"]}.",
+		}, http.StatusBadRequest
+	case mode != FireModeSingleStory && len(ids) > 0:
+		return nil, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "storyIds is only supported with mode=single-story.",
+		}, http.StatusBadRequest
+	}
+	return ids, nil, http.StatusOK
+}
+
+// fireLoopPlan describes a console-driven run.
+type fireLoopPlan struct {
+	tool          FireTool
+	maxIterations int
+	mode          FireMode
+	storyIDs      []string
+}
+
+func (p fireLoopPlan) iteration(i int) PromptIteration {
+	return PromptIteration{Tool: p.tool, Iteration: i, MaxIterations: p.maxIterations, StoryIDs: p.storyIDs}
+}
+
+func agentCommandArgs(tool FireTool) (string, []string) {
+	if tool == FireToolClaude {
+		return "claude", []string{"--dangerously-skip-permissions", "--print"}
+	}
+	return "codex", []string{"exec", "--dangerously-bypass-approvals-and-sandbox", "-"}
+}
+
+// startLoop starts a console-driven run. Validation errors are written to w;
+// iterations then run in the background.
+func (s *FireService) startLoop(w http.ResponseWriter, r *http.Request, plan fireLoopPlan) {
+	if s.prompts == nil {
+		WriteAPIError(w, http.StatusBadRequest, APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: fmt.Sprintf("mode=%s is not available: prompt templates are not configured.", plan.mode),
+			Hint:    "Use mode=script.",
+		})
+		return
+	}
+	if plan.mode == FireModeSingleStory {
+		if apiErr, status := s.checkTargets(plan.storyIDs); apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+	}
+	agent, agentArgs := agentCommandArgs(plan.tool)
+	// In a container the agent comes from the image, not the host PATH.
+	if _, err := exec.LookPath(agent); err != nil && !s.sandbox.isContainer() {
+		WriteAPIError(w, http.StatusBadGateway, APIError{
+			Code:    "FIRE_START_FAILED",
+			Message: "Failed to start Fire.",
+			Hint:    fmt.Sprintf("%s was not found on PATH. Install it (or use mode=script) and retry.", agent),
+		})
+		return
+	}
+
+	runID, ctx, apiErr, status := s.beginRun(plan.tool, plan.maxIterations, plan.mode)
+	if apiErr != nil {
+		WriteAPIError(w, status, *apiErr)
+		return
+	}
+	// Clear a container left behind by a forced stop; the name is reused.
+	s.sandbox.removeContainer(s.exec)
+	if err := prepareRalphState(s.paths, time.Now()); err != nil {
+		s.clearActive(runID)
+		WriteAPIError(w, http.StatusInternalServerError, APIError{
+			Code:    "FIRE_START_FAILED",
+			Message: "Failed to prepare progress.txt for the run.",
+			Hint:    err.Error(),
+		})
+		return
+	}
+	rendered, prompt, apiErr, status := s.prompts.RenderIteration(plan.iteration(1))
+	if apiErr != nil {
+		s.clearActive(runID)
+		WriteAPIError(w, status, *apiErr)
+		return
+	}
+
+	startedData := map[string]any{
+		"op":            "fire",
+		"mode":          plan.mode,
+		"cwd":           s.rootAbs,
+		"tool":          plan.tool,
+		"maxIterations": plan.maxIterations,
+		"cmd":           append([]string{agent}, agentArgs...),
+		"prompt":        &prompt,
+		"sandbox":       s.sandbox.Status(),
+	}
+	if len(plan.storyIDs) > 0 {
+		startedData["storyIds"] = plan.storyIDs
+	}
+	if len(s.verify) > 0 {
+		names := make([]string, 0, len(s.verify))
+		for _, vc := range s.verify {
+			names = append(names, vc.displayName())
+		}
+		startedData["verify"] = names
+	}
+	if s.limits.any() {
+		startedData["limits"] = s.limits
+	}
+	s.hub.Publish(StreamEvent{
+		RunID: runID,
+		Type:  "run_started",
+		Step:  "fire",
+		Level: "info",
+		Data:  startedData,
+	})
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase":            "started",
+		"note":             "Fire started.",
+		"completeDetected": false,
+	})
+
+	go s.runLoop(ctx, runID, plan, rendered, prompt)
+	if s.usageInterval > 0 {
+		go s.sampleUsage(ctx, runID)
+	}
+
+	recordAuditRun(r.Context(), runID)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(FireStartResponse{OK: true, RunID: runID, Prompt: &prompt})
+}
+
+func (s *FireService) runLoop(ctx context.Context, runID string, plan fireLoopPlan, rendered string, prompt PromptRef) {
+	startedAt := time.Now()
+	fin := fireFinish{ok: false, level: "warn", reason: fireReasonMaxIterations}
+	tool := plan.tool
+
+	for i := 1; i <= plan.maxIterations; i++ {
+		if i > 1 {
+			if s.stopAtIterationBoundary(runID) {
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(fireLoopIterationPause):
+			}
+			if s.stopRequested(runID) {
+				break
+			}
+			var apiErr *APIError
+			rendered, prompt, apiErr, _ = s.prompts.RenderIteration(plan.iteration(i))
+			if apiErr != nil {
+				s.publishLoopError(runID, fmt.Sprintf("failed to render the prompt for iteration %d: %s (%s)", i, apiErr.Message, apiErr.Hint))
+				fin = fireFinish{ok: false, level: "error", reason: "error"}
+				break
+			}
+		}
+
+		s.beginIteration(runID, i)
+		promptData := map[string]any{
+			"iteration": i,
+			"name":      prompt.Name,
+			"version":   prompt.Version,
+			"sha256":    sha256Hex([]byte(rendered)),
+			"bytes":     len(rendered),
+		}
+		if rel, err := s.prompts.ArchiveRendered(runID, i, rendered); err != nil {
+			promptData["archiveError"] = err.Error()
+		} else {
+			promptData["path"] = rel
+		}
+		s.hub.Publish(StreamEvent{RunID: runID, Type: "prompt_rendered", Step: "fire", Level: "info", Data: promptData})
+
+		var passesBefore map[string]bool
+		if len(s.verify) > 0 {
+			passesBefore = s.storyPasses()
+		}
+		output, err := s.runAgentIteration(runID, tool, rendered)
+		s.endIteration(runID)
+		if err != nil {
+			s.publishLoopError(runID, fmt.Sprintf("failed to start %s: %v", tool, err))
+			fin = fireFinish{ok: false, level: "error", reason: "error"}
+			break
+		}
+		if s.stopRequested(runID) {
+			break
+		}
+		var verified fireVerifyResult
+		if len(s.verify) > 0 {
+			verified = s.verifyIteration(runID, i, passesBefore)
+			if s.stopRequested(runID) {
+				break
+			}
+		}
+		claimed := agentOutputClaimsComplete(tool, output)
+		if plan.mode == FireModeSingleStory {
+			if s.targetsPass(runID, plan.storyIDs, claimed) {
+				fin = fireFinish{ok: true, level: "info", reason: fireReasonStoriesPassed}
+				break
+			}
+			continue
+		}
+		if claimed {
+			s.markComplete(runID)
+			if reason, ok := s.acceptComplete(runID, verified); ok {
+				fin = fireFinish{ok: true, level: "info", reason: reason}
+				break
+			}
+			if i == plan.maxIterations {
+				fin = fireFinish{ok: false, level: "warn", reason: fireReasonIncomplete}
+			}
+		}
+	}
+
+	s.finishRun(runID, startedAt, fin)
+}
+
+// beginRun reserves the single active run slot.
+func (s *FireService) beginRun(tool FireTool, maxIterations int, mode FireMode) (string, context.Context, *APIError, int) {
+	runID, apiErr, status := newFireRunID()
+	if apiErr != nil {
+		return "", nil, apiErr, status
+	}
+	// Forgets an orphan whose processes have exited since startup.
+	s.currentOrphan()
+
+	s.mu.Lock()
+	if s.active != nil {
+		s.mu.Unlock()
+		return "", nil, &APIError{
+			Code:    "RESOURCE_CONFLICT",
+			Message: "A Fire run is already active.",
+			Hint:    "Wait for it to finish (or use Stop once available).",
+		}, http.StatusConflict
+	}
+	if s.orphan != nil {
+		apiErr := orphanConflictError(s.orphan)
+		s.mu.Unlock()
+		return "", nil, apiErr, http.StatusConflict
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stdoutLog, stderrLog := fireOutputLogs(runID)
+	s.active = &fireRunState{
+		runID:         runID,
+		tool:          tool,
+		mode:          mode,
+		maxIterations: maxIterations,
+		startedAt:     time.Now(),
+		loop:          mode != FireModeScript,
+		log:           stdoutLog,
+		errLog:        stderrLog,
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+	s.mu.Unlock()
+	s.saveActiveRun(runID)
+	return runID, ctx, nil, http.StatusOK
+}
+
+func newFireRunID() (string, *APIError, int) {
+	runToken, err := GenerateSessionToken()
+	if err != nil {
+		return "", &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to generate run id.",
+			Hint:    "Retry the request.",
+		}, http.StatusInternalServerError
+	}
+	return "fire-" + runToken, nil, http.StatusOK
+}
+
+func (s *FireService) stopRequested(runID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active != nil && s.active.runID == runID && s.active.stopping
+}
+
+func (s *FireService) beginIteration(runID string, iteration int) {
+	s.mu.Lock()
+	if s.active != nil && s.active.runID == runID {
+		s.active.iteration = iteration
+		s.active.iterationStartedAt = time.Now()
+	}
+	s.mu.Unlock()
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase": "iteration_started",
+		"note":  "Iteration started.",
+	})
+}
+
+func (s *FireService) endIteration(runID string) {
+	var elapsed time.Duration
+	var tool string
+	s.mu.Lock()
+	if s.active != nil && s.active.runID == runID && !s.active.iterationStartedAt.IsZero() {
+		elapsed = time.Since(s.active.iterationStartedAt)
+		tool = string(s.active.tool)
+		s.active.iterationStartedAt = time.Time{}
+	}
+	s.mu.Unlock()
+	if elapsed > 0 {
+		s.metrics.fireIterationObserved(tool, elapsed)
+	}
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase": "iteration_finished",
+		"note":  "Iteration finished.",
+	})
+}
+
+func (s *FireService) markComplete(runID string) {
+	s.mu.Lock()
+	if s.active != nil && s.active.runID == runID {
+		s.active.complete = true
+	}
+	s.mu.Unlock()
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase":            "complete_detected",
+		"completeDetected": true,
+		"note":             "Detected <promise>COMPLETE</promise> in agent output.",
+	})
+}
+
+// checkTargets validates single-story targets before a run starts.
+func (s *FireService) checkTargets(ids []string) (*APIError, int) {
+	prd, apiErr, status := loadPRD(s.paths)
+	if apiErr != nil {
+		return apiErr, status
+	}
+	if apiErr := validateStoryIDs(prd, ids); apiErr != nil {
+		return apiErr, http.StatusBadRequest
+	}
+	var passing []string
+	for _, us := range prd.UserStories {
+		if us.Passes && slices.Contains(ids, us.ID) {
+			passing = append(passing, us.ID)
+		}
+	}
+	if len(passing) > 0 {
+		return &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: fmt.Sprintf("%s already passes.", strings.Join(passing, ", ")),
+			Hint:    "Set passes:false in prd.json (with review notes) to redo a story.",
+			File:    "prd.json",
+		}, http.StatusBadRequest
+	}
+	return nil, http.StatusOK
+}
+
+// targetsPass re-reads prd.json after an iteration of a single-story run and
+// reports whether every target story passes. A COMPLETE claim alone does not
+// end such a run.
+func (s *FireService) targetsPass(runID string, ids []string, claimed bool) bool {
+	prd, apiErr, _ := loadPRD(s.paths)
+	if apiErr != nil {
+		s.publishFireProgress(runID, "warn", map[string]any{
+			"phase": "targets_checked",
+			"note":  "Could not read prd.json to check target stories: " + apiErr.Message,
+		})
+		return false
+	}
+	passes := make(map[string]bool, len(prd.UserStories))
+	for _, us := range prd.UserStories {
+		passes[us.ID] = us.Passes
+	}
+	targets := make([]map[string]any, 0, len(ids))
+	remaining := 0
+	for _, id := range ids {
+		if !passes[id] {
+			remaining++
+		}
+		targets = append(targets, map[string]any{"id": id, "passes": passes[id]})
+	}
+	note := fmt.Sprintf("%d of %d target stories pass.", len(ids)-remaining, len(ids))
+	if claimed && remaining > 0 {
+		note += " Ignoring <promise>COMPLETE</promise> until they do."
+	}
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase":     "targets_checked",
+		"targets":   targets,
+		"remaining": remaining,
+		"note":      note,
+	})
+	return remaining == 0
+}
+
+func (s *FireService) publishLoopError(runID string, message string) {
+	s.hub.Publish(StreamEvent{
+		RunID: runID,
+		Type:  "error",
+		Step:  "fire",
+		Level: "error",
+		Data:  map[string]any{"message": message},
+	})
+}
+
+// runAgentIteration runs the agent once with the rendered prompt on stdin,
+// streaming its output, and returns the (tail of the) combined output. A
+// non-zero exit is not an error, as in ralph-codex.sh.
+func (s *FireService) runAgentIteration(runID string, tool FireTool, prompt string) (string, error) {
+	name, args := s.sandbox.wrap(agentCommandArgs(tool))
+	cmd, err := s.exec.CommandContext(context.Background(), s.rootAbs, name, args...)
+	if err != nil {
+		return "", err
+	}
+	out, _, err := s.runStreamed(runID, "fire", cmd, strings.NewReader(prompt), 0)
+	return out, err
+}
+
+// runStreamed runs cmd in its own process group as the run's active process,
+// so Stop reaches it, and streams its output as events of step. A positive
+// timeout kills the process group once it expires.
+func (s *FireService) runStreamed(runID string, step string, cmd *exec.Cmd, stdin io.Reader, timeout time.Duration) (output string, timedOut bool, err error) {
+	setProcessGroup(cmd)
+	cmd.Stdin = stdin
+
+	streams, err := s.openProcessOutput(runID, cmd)
+	if err != nil {
+		return "", false, err
+	}
+	err = s.startLimited(runID, cmd)
+	streams.closeFiles()
+	if err != nil {
+		return "", false, err
+	}
+
+	s.mu.Lock()
+	stopNow := false
+	if s.active != nil && s.active.runID == runID {
+		s.active.cmd = cmd
+		if runtime.GOOS != "windows" {
+			s.active.pgid = cmd.Process.Pid
+		}
+		stopNow = s.active.stopping
+	}
+	s.mu.Unlock()
+	s.saveActiveRun(runID)
+	if stopNow {
+		// Stop arrived between iterations, after the loop last checked.
+		_ = sendInterruptToProcessGroup(cmd.Process.Pid, cmd.Process.Pid)
+	}
+	var expired atomic.Bool
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			expired.Store(true)
+			_ = sendKillToProcessGroup(cmd.Process.Pid, cmd.Process.Pid)
+		})
+		defer timer.Stop()
+	}
+
+	out := &agentOutputBuffer{max: maxAgentOutputBytes}
+	drained := streams.stream(s, runID, step, out)
+	_ = cmd.Wait()
+	streams.exit()
+	<-drained
+
+	s.mu.Lock()
+	if s.active != nil && s.active.runID == runID && s.active.cmd == cmd {
+		s.active.cmd = nil
+		s.active.pgid = 0
+	}
+	s.mu.Unlock()
+	return out.String(), expired.Load(), nil
+}
+
+// agentOutputBuffer keeps the last max bytes written to it.
+type agentOutputBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (b *agentOutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *agentOutputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// agentOutputClaimsComplete applies ralph-codex.sh's completion check. Codex
+// echoes the prompt (which contains the marker), so only its assistant
+// output, or failing that the post-run summary, is searched.
+func agentOutputClaimsComplete(tool FireTool, output string) bool {
+	if tool == FireToolCodex {
+		lines := strings.Split(output, "\n")
+		var kept []string
+		switch {
+		case hasLineWithPrefix(lines, "assistant"):
+			found := false
+			for _, line := range lines {
+				if strings.HasPrefix(line, "assistant") {
+					found = true
+					continue
+				}
+				if found {
+					kept = append(kept, line)
+				}
+			}
+			output = strings.Join(kept, "\n")
+		case hasLineWithPrefix(lines, "tokens used"):
+			for i, line := range lines {
+				if strings.HasPrefix(line, "tokens used") {
+					kept = lines[i:]
+					break
+				}
+			}
+			output = strings.Join(kept, "\n")
+		}
+	}
+	return strings.Contains(output, PromptCompleteMarker)
+}
+
+func hasLineWithPrefix(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareRalphState does what ralph-codex.sh does before its loop: archive
+// prd.json and progress.txt when the branch changed since the last run,
+// remember the branch in .last-branch, and create progress.txt if missing.
+func prepareRalphState(paths *SafePath, now time.Time) error {
+	readOptional := func(rel string) (string, error) {
+		abs, _, apiErr, _ := paths.ResolveRead(rel, append(PathWhitelist{"prd.json"}, ralphStateWhitelist...))
+		if apiErr != nil {
+			if apiErr.Code == "FS_READ_NOT_FOUND" {
+				return "", nil
+			}
+			return "", errors.New(apiErr.Message)
+		}
+		raw, _, err := readFileUpTo(abs, DefaultMaxReadBytes)
+		return string(raw), err
+	}
+	write := func(rel string, data string) error {
+		abs, apiErr, _ := paths.ResolveWrite(rel, ralphStateWhitelist)
+		if apiErr != nil {
+			return errors.New(apiErr.Message)
+		}
+		if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+			return err
+		}
+		return writeFileAtomicWithPrefix(abs, []byte(data), 0o644, ".ralph-*")
+	}
+	freshProgress := "# Ralph Progress Log\nStarted: " + now.Format(time.UnixDate) + "\n---\n"
+
+	prdRaw, err := readOptional("prd.json")
+	if err != nil {
+		return err
+	}
+	var prd struct {
+		BranchName string `json:"branchName"`
+	}
+	_ = json.Unmarshal([]byte(prdRaw), &prd)
+	branch := strings.TrimSpace(prd.BranchName)
+	lastRaw, err := readOptional(".last-branch")
+	if err != nil {
+		return err
+	}
+	last := strings.TrimSpace(lastRaw)
+	progress, err := readOptional("progress.txt")
+	if err != nil {
+		return err
+	}
+
+	if branch != "" && last != "" && branch != last {
+		folder := now.Format("2006-01-02") + "-" + strings.ReplaceAll(strings.TrimPrefix(last, "ralph/"), "/", "-")
+		if err := write("archive/"+folder+"/prd.json", prdRaw); err != nil {
+			return err
+		}
+		if progress != "" {
+			if err := write("archive/"+folder+"/progress.txt", progress); err != nil {
+				return err
+			}
+		}
+		if err := write("progress.txt", freshProgress); err != nil {
+			return err
+		}
+		progress = freshProgress
+	}
+	if branch != "" && branch != last {
+		if err := write(".last-branch", branch+"\n"); err != nil {
+			return err
+		}
+	}
+	if progress == "" {
+		return write("progress.txt", freshProgress)
+	}
+	return nil
+}
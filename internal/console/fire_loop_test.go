@@ -0,0 +1,257 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// installFakeAgent puts an executable named name on PATH for the test.
+func installFakeAgent(t *testing.T, name string, script string) {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake %s: %v", name, err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func waitForRunFinished(t *testing.T, hub *StreamHub, runID string) []StreamEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hub.mu.Lock()
+		var events []StreamEvent
+		if state := hub.runs[runID]; state != nil {
+			events = append(events, state.events...)
+		}
+		hub.mu.Unlock()
+		for _, ev := range events {
+			if ev.Type == "run_finished" {
+				return events
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for run_finished for runId=%s", runID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFireService_LoopModeRendersPromptPerIteration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent is a shell script")
+	}
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	// Echo the prompt like codex does (it contains the marker), then finish
+	// every story and claim completion only on the second call.
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\n"+
+		"cat\n"+
+		"echo 'tokens used 42'\n"+
+		"if [ -f calls ]; then\n"+
+		"  sed 's/\"passes\": false/\"passes\": true/g' prd.json > prd.tmp && mv prd.tmp prd.json\n"+
+		"  echo '"+PromptCompleteMarker+"'\n"+
+		"fi\n"+
+		"echo x >> calls\n")
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Prompts: newTestPromptStore(t, root)})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 5, Mode: "loop"})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FireStartResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Prompt == nil || resp.Prompt.Name != "CODEX.md" {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	events := waitForRunFinished(t, hub, resp.RunID)
+	var rendered []map[string]any
+	var finished map[string]any
+	for _, ev := range events {
+		data, _ := ev.Data.(map[string]any)
+		switch ev.Type {
+		case "prompt_rendered":
+			rendered = append(rendered, data)
+		case "run_finished":
+			finished = data
+		}
+	}
+	if len(rendered) != 2 {
+		t.Fatalf("expected 2 rendered prompts (echoed marker must not end the run), got %d", len(rendered))
+	}
+	if finished["reason"] != fireReasonCompletedUnverified || finished["ok"] != true {
+		t.Fatalf("unexpected run_finished: %+v", finished)
+	}
+	archived, err := os.ReadFile(filepath.Join(root, rendered[1]["path"].(string)))
+	if err != nil || !strings.Contains(string(archived), "Iteration 2 of 5") || !strings.Contains(string(archived), "US-002") {
+		t.Fatalf("unexpected archived prompt %q err=%v", archived, err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, ".last-branch")); string(raw) != "ralph/demo\n" {
+		t.Fatalf("expected .last-branch to be written, got %q", raw)
+	}
+}
+
+func TestFireService_LoopModeRejectsInvalidTemplate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent is a shell script")
+	}
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	_ = os.WriteFile(filepath.Join(root, "CODEX.md"), []byte(promptTemplateMarker+"\n{{.Nope}} "+PromptCompleteMarker), 0o644)
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\nexit 0\n")
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 16})
+	svc, _ := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Prompts: newTestPromptStore(t, root)})
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 1, Mode: "loop"})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "PROMPT_TEMPLATE_INVALID") {
+		t.Fatalf("expected PROMPT_TEMPLATE_INVALID, got %d %s", w.Code, w.Body.String())
+	}
+	svc.mu.Lock()
+	active := svc.active
+	svc.mu.Unlock()
+	if active != nil {
+		t.Fatalf("expected the run slot to be released")
+	}
+}
+
+func TestAgentOutputClaimsComplete(t *testing.T) {
+	t.Parallel()
+
+	echoed := "user\nPrint " + PromptCompleteMarker + " when done\n"
+	cases := []struct {
+		tool FireTool
+		out  string
+		want bool
+	}{
+		{FireToolCodex, echoed + "assistant\nworking\n", false},
+		{FireToolCodex, echoed + "assistant\n" + PromptCompleteMarker + "\n", true},
+		{FireToolCodex, echoed + "tokens used 10\n", false},
+		{FireToolCodex, echoed + "tokens used 10\n" + PromptCompleteMarker + "\n", true},
+		{FireToolClaude, "done " + PromptCompleteMarker, true},
+		{FireToolClaude, "still working", false},
+	}
+	for i, tc := range cases {
+		if got := agentOutputClaimsComplete(tc.tool, tc.out); got != tc.want {
+			t.Fatalf("case %d: got %v want %v", i, got, tc.want)
+		}
+	}
+}
+
+func TestPrepareRalphState_ArchivesOnBranchChange(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	_ = os.WriteFile(filepath.Join(root, ".last-branch"), []byte("ralph/old\n"), 0o644)
+	paths, _ := NewSafePath(SafePathConfig{ProjectRoot: root})
+
+	now := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := prepareRalphState(paths, now); err != nil {
+		t.Fatalf("prepareRalphState: %v", err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, "archive", "2026-03-04-old", "progress.txt")); string(raw) != testPromptProgress {
+		t.Fatalf("expected progress.txt archived, got %q", raw)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, "archive", "2026-03-04-old", "prd.json")); string(raw) != testPromptPRD {
+		t.Fatalf("expected prd.json archived, got %q", raw)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, "progress.txt")); !strings.HasPrefix(string(raw), "# Ralph Progress Log\nStarted: ") {
+		t.Fatalf("expected progress.txt reset, got %q", raw)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, ".last-branch")); string(raw) != "ralph/demo\n" {
+		t.Fatalf("expected .last-branch updated, got %q", raw)
+	}
+}
+
+func TestFireService_SingleStoryModeEndsWhenTargetsPass(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent is a shell script")
+	}
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	// The first call only claims COMPLETE; the second flips US-002 to passing.
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\n"+
+		"cat >/dev/null\n"+
+		"echo 'tokens used 1'\n"+
+		"if [ -f calls ]; then\n"+
+		"  sed 's/\"passes\": false, \"notes\": \"failed review\"/\"passes\": true, \"notes\": \"\"/' prd.json > prd.tmp && mv prd.tmp prd.json\n"+
+		"else\n"+
+		"  echo '"+PromptCompleteMarker+"'\n"+
+		"fi\n"+
+		"echo x >> calls\n")
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, _ := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Prompts: newTestPromptStore(t, root)})
+
+	for _, tc := range []struct {
+		req  FireStartRequest
+		code string
+	}{
+		{FireStartRequest{Tool: "codex", MaxIterations: 3, Mode: "single-story"}, "storyIds is required"},
+		{FireStartRequest{Tool: "codex", MaxIterations: 3, Mode: "loop", StoryIDs: []string{"US-002"}}, "only supported with mode=single-story"},
+		{FireStartRequest{Tool: "codex", MaxIterations: 3, Mode: "single-story", StoryIDs: []string{"US-001"}}, "already passes"},
+		{FireStartRequest{Tool: "codex", MaxIterations: 3, Mode: "single-story", StoryIDs: []string{"US-404"}}, "not in prd.json"},
+	} {
+		body, _ := json.Marshal(tc.req)
+		w := httptest.NewRecorder()
+		svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.code) {
+			t.Fatalf("%+v: expected 400 %q, got %d %s", tc.req, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 5, Mode: "single-story", StoryIDs: []string{" US-002 ", "US-002"}})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FireStartResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	events := waitForRunFinished(t, hub, resp.RunID)
+	iterations := 0
+	var finished map[string]any
+	for _, ev := range events {
+		data, _ := ev.Data.(map[string]any)
+		switch {
+		case ev.Type == "run_started":
+			if ids, _ := data["storyIds"].([]string); len(ids) != 1 || ids[0] != "US-002" {
+				t.Fatalf("unexpected run_started storyIds: %+v", data["storyIds"])
+			}
+		case ev.Type == "prompt_rendered":
+			iterations++
+		case ev.Type == "run_finished":
+			finished = data
+		}
+	}
+	if iterations != 2 || finished["reason"] != "stories_passed" || finished["ok"] != true {
+		t.Fatalf("expected 2 iterations ending with stories_passed, got %d %+v", iterations, finished)
+	}
+}
@@ -0,0 +1,139 @@
+package console
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fireOutputLogDir holds the output of script and loop runs. Their processes
+// write to <runID>.stdout.log and <runID>.stderr.log directly rather than to
+// pipes, so the output does not die with the console: a console re-attached
+// after a restart follows the same files. They are removed when the run
+// finishes; the run archive holds the output from then on.
+const fireOutputLogDir = ".ohmyagentflow/logs"
+
+// fireOutputPollInterval is how often the logs of a live run are read once
+// the console has caught up with them.
+var fireOutputPollInterval = 50 * time.Millisecond
+
+// fireOutputLogs returns the stdout and stderr logs of run runID, relative
+// to the project root.
+func fireOutputLogs(runID string) (string, string) {
+	base := path.Join(fireOutputLogDir, runID)
+	return base + ".stdout.log", base + ".stderr.log"
+}
+
+// processOutput connects one process of a run to the run's output logs.
+type processOutput struct {
+	files  []*os.File
+	tails  []*fileTail
+	exited chan struct{}
+}
+
+// openProcessOutput points cmd's stdout and stderr at the ends of the logs of
+// run runID. Call closeFiles once cmd has started (or failed to start) and
+// exit once it has exited.
+func (s *FireService) openProcessOutput(runID string, cmd *exec.Cmd) (*processOutput, error) {
+	s.mu.Lock()
+	var logs []string
+	if a := s.active; a != nil && a.runID == runID {
+		logs = []string{a.log, a.errLog}
+	}
+	s.mu.Unlock()
+	if len(logs) == 0 {
+		return nil, errors.New("the run is no longer active")
+	}
+
+	o := &processOutput{exited: make(chan struct{})}
+	done := func() bool {
+		select {
+		case <-o.exited:
+			return true
+		default:
+			return false
+		}
+	}
+	for _, rel := range logs {
+		abs, apiErr, _ := s.paths.ResolveWrite(rel, fireRunLogWhitelist)
+		if apiErr != nil {
+			o.closeFiles()
+			return nil, errors.New(apiErr.Message)
+		}
+		if err := os.MkdirAll(filepath.Dir(abs), 0o700); err != nil {
+			o.closeFiles()
+			return nil, err
+		}
+		// Agent output may hold secrets; only the hub's copy is redacted.
+		f, err := os.OpenFile(abs, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			o.closeFiles()
+			return nil, err
+		}
+		var offset int64
+		if info, err := f.Stat(); err == nil {
+			offset = info.Size()
+		}
+		o.files = append(o.files, f)
+		o.tails = append(o.tails, &fileTail{path: abs, offset: offset, poll: fireOutputPollInterval, done: done})
+	}
+	cmd.Stdout = o.files[0]
+	cmd.Stderr = o.files[1]
+	return o, nil
+}
+
+// closeFiles closes the console's copies of the logs.
+func (o *processOutput) closeFiles() {
+	for _, f := range o.files {
+		_ = f.Close()
+	}
+}
+
+// exit reports that the process has exited: streaming stops at the end of
+// what it wrote. Output of descendants that outlive it is not followed.
+func (o *processOutput) exit() {
+	close(o.exited)
+}
+
+// stream publishes what the process writes as events of step, copying it to
+// tee when set. The returned channel is closed once the logs are read up to
+// the process exit.
+func (o *processOutput) stream(s *FireService, runID string, step string, tee io.Writer) <-chan struct{} {
+	drained := make(chan struct{})
+	var readers sync.WaitGroup
+	for i, eventType := range []string{"process_stdout", "process_stderr"} {
+		var r io.Reader = o.tails[i]
+		if tee != nil {
+			r = io.TeeReader(r, tee)
+		}
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			s.streamPipe(runID, step, eventType, r)
+		}()
+	}
+	go func() {
+		readers.Wait()
+		close(drained)
+	}()
+	return drained
+}
+
+// removeRunLogs deletes the output logs named by a run or its record. Paths
+// outside fireRunLogWhitelist are left alone: active.json is a file in the
+// project and must not name arbitrary files.
+func (s *FireService) removeRunLogs(logs ...string) {
+	for _, rel := range logs {
+		if rel == "" {
+			continue
+		}
+		if abs, apiErr, _ := s.paths.ResolveWrite(rel, fireRunLogWhitelist); apiErr == nil {
+			_ = os.Remove(abs)
+		}
+	}
+}
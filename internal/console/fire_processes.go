@@ -0,0 +1,142 @@
+package console
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// maxProcessCommandBytes bounds the command line reported per process.
+const maxProcessCommandBytes = 1024
+
+// FireProcess is one process of the active run, as read from /proc.
+type FireProcess struct {
+	PID  int `json:"pid"`
+	PPID int `json:"ppid"`
+	PGID int `json:"pgid"`
+	// Depth is 0 for the run's current process and for group members whose
+	// parent exited.
+	Depth   int    `json:"depth"`
+	Command string `json:"command"`
+	State   string `json:"state"`
+	// CPUPercent is the average since the process started.
+	CPUSeconds float64 `json:"cpuSeconds"`
+	CPUPercent float64 `json:"cpuPercent"`
+	RSSBytes   int64   `json:"rssBytes"`
+}
+
+type FireProcessesResponse struct {
+	OK     bool   `json:"ok"`
+	Active bool   `json:"active"`
+	RunID  string `json:"runId,omitempty"`
+	PGID   int    `json:"pgid,omitempty"`
+	// Processes is empty between iterations, when no process is running.
+	Processes []FireProcess `json:"processes"`
+}
+
+// ProcessesHandler serves GET /api/fire/processes: the process tree of the
+// active run's current command (agent, ralph-codex.sh or verification).
+func (s *FireService) ProcessesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := FireProcessesResponse{OK: true, Processes: []FireProcess{}}
+		var rootPID int
+		s.mu.Lock()
+		if s.active != nil {
+			resp.Active = true
+			resp.RunID = s.active.runID
+			resp.PGID = s.active.pgid
+			if s.active.cmd != nil && s.active.cmd.Process != nil {
+				rootPID = s.active.cmd.Process.Pid
+			} else if s.active.reattached {
+				rootPID = s.active.pgid
+			}
+		}
+		s.mu.Unlock()
+
+		if rootPID != 0 {
+			stats, err := readProcStats()
+			if err != nil {
+				WriteAPIError(w, http.StatusNotImplemented, APIError{
+					Code:    "PROCESSES_UNSUPPORTED",
+					Message: "Listing the run's processes needs /proc, which this platform does not provide.",
+					Hint:    "Watch resource_usage events or use the OS process viewer.",
+				})
+				return
+			}
+			resp.Processes = s.processTree(stats, rootPID, resp.PGID)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// processTree lists rootPID and its descendants depth-first, followed by
+// members of pgid that are not among them (reparented after their parent
+// exited).
+func (s *FireService) processTree(stats []procStat, rootPID int, pgid int) []FireProcess {
+	byPID := make(map[int]procStat, len(stats))
+	for _, st := range stats {
+		byPID[st.PID] = st
+	}
+	children := procChildren(stats)
+	for _, pids := range children {
+		slices.Sort(pids)
+	}
+	uptime, _ := procUptime()
+	page := int64(os.Getpagesize())
+
+	out := []FireProcess{}
+	seen := make(map[int]bool)
+	var walk func(pid int, depth int)
+	walk = func(pid int, depth int) {
+		st, ok := byPID[pid]
+		if !ok || seen[pid] {
+			return
+		}
+		seen[pid] = true
+		out = append(out, s.fireProcess(st, depth, uptime, page))
+		for _, child := range children[pid] {
+			walk(child, depth+1)
+		}
+	}
+	walk(rootPID, 0)
+	if pgid > 0 {
+		for _, st := range stats {
+			if st.PGID == pgid && !seen[st.PID] && !seen[st.PPID] {
+				walk(st.PID, 0)
+			}
+		}
+	}
+	return out
+}
+
+func (s *FireService) fireProcess(st procStat, depth int, uptime float64, page int64) FireProcess {
+	command := procCmdline(st.PID)
+	if command == "" {
+		command = "[" + st.Comm + "]"
+	}
+	if cut, truncated := truncateUTF8ToBytes(command, maxProcessCommandBytes); truncated {
+		command = cut + "…"
+	}
+	// Command lines can carry tokens; apply the same redaction as the log.
+	if s.hub.redactor != nil {
+		command, _ = s.hub.redactor.Redact(command)
+	}
+	cpu := float64(st.CPUTicks) / procClockTicks
+	p := FireProcess{
+		PID:        st.PID,
+		PPID:       st.PPID,
+		PGID:       st.PGID,
+		Depth:      depth,
+		Command:    command,
+		State:      st.State,
+		CPUSeconds: math.Round(cpu*100) / 100,
+		RSSBytes:   st.RSSPages * page,
+	}
+	if age := uptime - float64(st.StartTicks)/procClockTicks; uptime > 0 && age > 0 {
+		p.CPUPercent = math.Round(cpu/age*1000) / 10
+	}
+	return p
+}
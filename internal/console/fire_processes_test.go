@@ -0,0 +1,72 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getFireProcesses(t *testing.T, svc *FireService) (int, FireProcessesResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	svc.ProcessesHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/fire/processes", nil))
+	var resp FireProcessesResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestFireService_ProcessesHandlerListsRunTree(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc")
+	}
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\ncat >/dev/null\nsleep 1.5 &\nwait\necho 'tokens used 1'\n")
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Prompts: newTestPromptStore(t, root)})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	if code, resp := getFireProcesses(t, svc); code != http.StatusOK || resp.Active || resp.Processes == nil || len(resp.Processes) != 0 {
+		t.Fatalf("expected an empty list without a run, got %d %+v", code, resp)
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 1, Mode: "loop"})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	var started FireStartResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp FireProcessesResponse
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		_, resp = getFireProcesses(t, svc)
+		if len(resp.Processes) >= 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !resp.Active || resp.RunID != started.RunID || len(resp.Processes) < 2 {
+		t.Fatalf("expected the agent and its child, got %+v", resp)
+	}
+	agent, child := resp.Processes[0], resp.Processes[1]
+	if agent.Depth != 0 || agent.PID != resp.PGID || !strings.HasSuffix(agent.Command, "exec --dangerously-bypass-approvals-and-sandbox -") {
+		t.Fatalf("unexpected root process: %+v", agent)
+	}
+	if child.Depth != 1 || child.PPID != agent.PID || child.Command != "sleep 1.5" || child.RSSBytes <= 0 {
+		t.Fatalf("unexpected child process: %+v", child)
+	}
+	waitForRunFinished(t, hub, started.RunID)
+}
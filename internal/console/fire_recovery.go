@@ -0,0 +1,602 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fireActiveFileName, under .ohmyagentflow, records the active run so a
+// console restarted after a crash can find the processes it left behind.
+const fireActiveFileName = "active.json"
+
+var fireRunLogWhitelist = PathWhitelist{fireOutputLogDir + "/*.log", fireDetachedLogDir + "/*.log"}
+
+// fireTailPollInterval is how often a followed log (of a re-attached or
+// detached run) and the run's processes are checked.
+var fireTailPollInterval = 500 * time.Millisecond
+
+// FireActiveRun is the content of .ohmyagentflow/active.json.
+type FireActiveRun struct {
+	RunID     string    `json:"runId"`
+	Tool      FireTool  `json:"tool"`
+	Mode      FireMode  `json:"mode"`
+	StartedAt time.Time `json:"startedAt"`
+	// PGID is the process group of the run's current command; 0 between
+	// loop iterations.
+	PGID int `json:"pgid,omitempty"`
+	// LeaderStartTicks is the group leader's start time on Linux, so that a
+	// reused pgid is not mistaken for the run.
+	LeaderStartTicks  uint64 `json:"leaderStartTicks,omitempty"`
+	ConsolePID        int    `json:"consolePid"`
+	ConsoleStartTicks uint64 `json:"consoleStartTicks,omitempty"`
+	// Log and StderrLog are the run's output logs, relative to the project
+	// root, followed on re-attach (see fireOutputLogs).
+	Log       string `json:"log"`
+	StderrLog string `json:"stderrLog,omitempty"`
+	// Cgroup is the run's cgroup directory (see FireLimits.CgroupParent).
+	Cgroup string `json:"cgroup,omitempty"`
+	// Detached runs write Log (only) through a supervisor. It holds all
+	// their output and exit status, so it is replayed in full on re-attach,
+	// even after the run has exited.
+	Detached bool `json:"detached,omitempty"`
+	// PassesBefore is the passes state of prd.json when a detached run
+	// started, for verifying its COMPLETE claim.
+	PassesBefore map[string]bool `json:"passesBefore,omitempty"`
+}
+
+type FireOrphanResponse struct {
+	OK bool `json:"ok"`
+	// Orphan is null when no run of a previous console is still running
+	// and no detached run waits to be re-attached.
+	Orphan *FireActiveRun `json:"orphan"`
+	// Running is false for a detached run that exited while detached.
+	Running   bool          `json:"running"`
+	Processes []FireProcess `json:"processes"`
+}
+
+type FireOrphanKillResponse struct {
+	OK    bool   `json:"ok"`
+	RunID string `json:"runId"`
+	// Signal is SIGINT, or SIGKILL when the processes outlived
+	// fireStopKillDelay; empty when they had already exited.
+	Signal   string         `json:"signal,omitempty"`
+	Worktree map[string]any `json:"worktree,omitempty"`
+}
+
+func (s *FireService) activeRunPath() string {
+	return filepath.Join(s.rootAbs, ".ohmyagentflow", fireActiveFileName)
+}
+
+// saveActiveRun rewrites active.json for the active run. It is best effort: a
+// failed write only costs crash recovery.
+func (s *FireService) saveActiveRun(runID string) {
+	s.recordMu.Lock()
+	defer s.recordMu.Unlock()
+
+	s.mu.Lock()
+	a := s.active
+	if a == nil || a.runID != runID {
+		s.mu.Unlock()
+		return
+	}
+	rec := activeRecord(a)
+	s.mu.Unlock()
+	rec.stamp()
+
+	raw, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return
+	}
+	path := s.activeRunPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	_ = writeFileAtomicWithPrefix(path, append(raw, '\n'), 0o644, ".active-*")
+}
+
+// activeRecord describes the run a; s.mu must be held. The start times are
+// left to stamp.
+func activeRecord(a *fireRunState) FireActiveRun {
+	rec := FireActiveRun{
+		RunID:     a.runID,
+		Tool:      a.tool,
+		Mode:      a.mode,
+		StartedAt: a.startedAt.UTC(),
+		PGID:      a.pgid,
+		// Kept for a re-attached group: its leader may be gone by now.
+		LeaderStartTicks: a.leaderStartTicks,
+		ConsolePID:       os.Getpid(),
+		Log:              a.log,
+		StderrLog:        a.errLog,
+		Detached:         a.detached,
+		PassesBefore:     a.passesBefore,
+	}
+	if a.cgroup != nil {
+		rec.Cgroup = a.cgroup.dir
+	}
+	return rec
+}
+
+// stamp records the start times of the group leader, unless already known,
+// and the console.
+func (rec *FireActiveRun) stamp() {
+	if rec.LeaderStartTicks == 0 {
+		rec.LeaderStartTicks = procStartTicks(rec.PGID)
+	}
+	rec.ConsoleStartTicks = procStartTicks(rec.ConsolePID)
+}
+
+func (s *FireService) removeActiveRun() {
+	s.recordMu.Lock()
+	defer s.recordMu.Unlock()
+	_ = os.Remove(s.activeRunPath())
+}
+
+func (s *FireService) loadActiveRun() (*FireActiveRun, error) {
+	raw, err := os.ReadFile(s.activeRunPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rec FireActiveRun
+	if err := json.Unmarshal(raw, &rec); err != nil || rec.RunID == "" {
+		return nil, fmt.Errorf("%s is not a valid run record", fireActiveFileName)
+	}
+	// The record is a file in the project: without a real process group and
+	// the start time of its leader, it could point signals at anything (a
+	// pgid of 1 is every process the user may signal).
+	if rec.PGID <= 1 {
+		return nil, fmt.Errorf("%s: run %s has no process group to recover", fireActiveFileName, rec.RunID)
+	}
+	if rec.LeaderStartTicks == 0 {
+		return nil, fmt.Errorf("%s: run %s has no leader start time, so process group %d cannot be verified", fireActiveFileName, rec.RunID, rec.PGID)
+	}
+	return &rec, nil
+}
+
+// procStartTicks returns the start time of pid from /proc, or 0.
+func procStartTicks(pid int) uint64 {
+	if pid <= 0 {
+		return 0
+	}
+	st, err := readProcStat(pid)
+	if err != nil {
+		return 0
+	}
+	return st.StartTicks
+}
+
+// sameProcess reports whether pid is still the process that had startTicks.
+// Without procfs (or a recorded start time) a live pid is taken as a match.
+func sameProcess(pid int, startTicks uint64) bool {
+	if !processExists(pid) {
+		return false
+	}
+	if startTicks == 0 {
+		return true
+	}
+	st, err := readProcStat(pid)
+	return err != nil || st.StartTicks == startTicks
+}
+
+// runGroupAlive reports whether pgid has live members. Zombies are ignored
+// where procfs tells them apart: the console is not their parent and cannot
+// reap them.
+func runGroupAlive(pgid int) bool {
+	if pgid <= 0 {
+		return false
+	}
+	if u, err := sampleProcessGroup(pgid); err == nil {
+		return u.Processes > 0
+	}
+	return processGroupExists(pgid)
+}
+
+func (rec *FireActiveRun) alive() bool {
+	if !runGroupAlive(rec.PGID) {
+		return false
+	}
+	// A reused pgid has a leader with another start time. The group outlives
+	// its leader, so a missing leader proves nothing.
+	if rec.LeaderStartTicks != 0 {
+		if st, err := readProcStat(rec.PGID); err == nil && st.StartTicks != rec.LeaderStartTicks {
+			return false
+		}
+	}
+	return true
+}
+
+// LeaderVerified reports whether the group leader is still the process the
+// record was written for. Without a recorded start time, or once the leader
+// has exited, a reused pgid cannot be ruled out.
+func (rec *FireActiveRun) LeaderVerified() bool {
+	return groupLeaderIs(rec.PGID, rec.LeaderStartTicks)
+}
+
+// groupLeaderIs reports whether process pgid is alive and started at
+// startTicks.
+func groupLeaderIs(pgid int, startTicks uint64) bool {
+	if pgid <= 1 || startTicks == 0 {
+		return false
+	}
+	st, err := readProcStat(pgid)
+	return err == nil && st.StartTicks == startTicks
+}
+
+// RecoverOrphanedRun cleans up after a console that exited mid-run: run
+// archives it left in progress are finalized with run_finished reason
+// "orphaned", and a run whose processes are still alive is kept (and
+// returned) so it can be re-attached or killed. Call it once at startup,
+// before serving requests.
+func (s *FireService) RecoverOrphanedRun() (*FireActiveRun, error) {
+	var problems []error
+	rec, err := s.loadActiveRun()
+	if err != nil {
+		problems = append(problems, err)
+		s.removeActiveRun()
+	}
+	if rec != nil && rec.ConsolePID != os.Getpid() && sameProcess(rec.ConsolePID, rec.ConsoleStartTicks) {
+		return nil, fmt.Errorf("run %s belongs to a console that is still running (pid %d); stop it, or remove %s if it is stale", rec.RunID, rec.ConsolePID, s.activeRunPath())
+	}
+
+	alive := rec != nil && rec.alive()
+	_, err = s.hub.recoverOrphanedArchives(func(runID string) map[string]any {
+		if rec == nil || runID != rec.RunID {
+			return nil
+		}
+		extra := map[string]any{"pgid": rec.PGID, "processesAlive": alive}
+		switch {
+		case alive:
+			extra["note"] = "The console exited before the run finished; its processes are still running. Re-attach to them or kill them from the console."
+		case rec.Detached:
+			extra["note"] = "The console exited before the run finished; the run's log holds the rest. Re-attach to replay it."
+		}
+		return extra
+	})
+	if err != nil {
+		problems = append(problems, fmt.Errorf("finalize run archives: %w", err))
+	}
+
+	switch {
+	case alive || rec != nil && rec.Detached:
+		s.mu.Lock()
+		s.orphan = rec
+		s.mu.Unlock()
+	case rec != nil:
+		s.forgetOrphan(rec)
+		rec = nil
+	}
+	return rec, errors.Join(problems...)
+}
+
+// currentOrphan returns the orphaned run, forgetting it once its processes
+// have exited. A detached run is kept until it is re-attached or killed: its
+// log still has to be read.
+func (s *FireService) currentOrphan() *FireActiveRun {
+	s.mu.Lock()
+	rec := s.orphan
+	s.mu.Unlock()
+	if rec == nil || rec.Detached || rec.alive() {
+		return rec
+	}
+	s.mu.Lock()
+	gone := s.orphan == rec
+	if gone {
+		s.orphan = nil
+	}
+	s.mu.Unlock()
+	if gone {
+		s.forgetOrphan(rec)
+	}
+	return nil
+}
+
+// takeOrphan releases rec from the orphan slot; it returns false when
+// another request took it first.
+func (s *FireService) takeOrphan(rec *FireActiveRun) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.orphan != rec {
+		return false
+	}
+	s.orphan = nil
+	return true
+}
+
+// forgetOrphan removes what is left of an orphan whose processes are gone.
+func (s *FireService) forgetOrphan(rec *FireActiveRun) {
+	s.removeActiveRun()
+	s.removeRunLogs(rec.Log, rec.StderrLog)
+	// Only a run cgroup under the configured parent; the record is a file in
+	// the project and must not name arbitrary paths.
+	if rec.Cgroup != "" && s.limits.CgroupParent != "" && filepath.Dir(rec.Cgroup) == filepath.Clean(s.limits.CgroupParent) {
+		_ = os.Remove(rec.Cgroup)
+	}
+}
+
+func orphanConflictError(rec *FireActiveRun) *APIError {
+	if rec.Detached {
+		return &APIError{
+			Code:    "RESOURCE_CONFLICT",
+			Message: fmt.Sprintf("Detached Fire run %s is not attached to this console.", rec.RunID),
+			Hint:    "Re-attach to it or kill it first.",
+		}
+	}
+	return &APIError{
+		Code:    "RESOURCE_CONFLICT",
+		Message: fmt.Sprintf("Fire run %s from a previous console is still running (process group %d).", rec.RunID, rec.PGID),
+		Hint:    "Re-attach to it or kill it first.",
+	}
+}
+
+func noOrphanError() APIError {
+	return APIError{
+		Code:    "NOT_FOUND",
+		Message: "No Fire run from a previous console is running, and no detached run is waiting.",
+	}
+}
+
+// OrphanHandler serves GET /api/fire/orphan.
+func (s *FireService) OrphanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := FireOrphanResponse{OK: true, Processes: []FireProcess{}}
+		if rec := s.currentOrphan(); rec != nil {
+			copied := *rec
+			resp.Orphan = &copied
+			resp.Running = rec.alive()
+			if stats, err := readProcStats(); err == nil {
+				resp.Processes = s.processTree(stats, rec.PGID, rec.PGID)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// OrphanAttachHandler serves POST /api/fire/orphan/attach: the orphan becomes
+// the active run under a new run id, streaming its log until its processes
+// exit. Stop works as for any run.
+func (s *FireService) OrphanAttachHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runID, apiErr, status := s.attachOrphan()
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		recordAuditRun(r.Context(), runID)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(FireStartResponse{OK: true, RunID: runID})
+	}
+}
+
+// AttachOrphan re-attaches the run RecoverOrphanedRun returned, as
+// POST /api/fire/orphan/attach does, and returns the new run id.
+func (s *FireService) AttachOrphan() (string, error) {
+	runID, apiErr, _ := s.attachOrphan()
+	if apiErr != nil {
+		return "", errors.New(apiErr.Message)
+	}
+	return runID, nil
+}
+
+func (s *FireService) attachOrphan() (string, *APIError, int) {
+	rec := s.currentOrphan()
+	if rec == nil {
+		apiErr := noOrphanError()
+		return "", &apiErr, http.StatusNotFound
+	}
+	// logs are the stdout log and, unless detached, the stderr log.
+	var logs []string
+	for i, rel := range []string{rec.Log, rec.StderrLog} {
+		if i == 1 && rec.Detached {
+			break
+		}
+		abs, apiErr, status := s.paths.ResolveWrite(rel, fireRunLogWhitelist)
+		if apiErr != nil {
+			return "", apiErr, status
+		}
+		logs = append(logs, abs)
+	}
+	runID, apiErr, status := newFireRunID()
+	if apiErr != nil {
+		return "", apiErr, status
+	}
+
+	s.mu.Lock()
+	if s.active != nil || s.orphan != rec {
+		s.mu.Unlock()
+		return "", &APIError{
+			Code:    "RESOURCE_CONFLICT",
+			Message: "A Fire run is already active.",
+		}, http.StatusConflict
+	}
+	s.orphan = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	s.active = &fireRunState{
+		runID:            runID,
+		tool:             rec.Tool,
+		mode:             rec.Mode,
+		startedAt:        rec.StartedAt,
+		reattached:       true,
+		detached:         rec.Detached,
+		log:              rec.Log,
+		errLog:           rec.StderrLog,
+		passesBefore:     rec.PassesBefore,
+		pgid:             rec.PGID,
+		leaderStartTicks: rec.LeaderStartTicks,
+		ctx:              ctx,
+		cancel:           cancel,
+		done:             make(chan struct{}),
+	}
+	s.mu.Unlock()
+	s.saveActiveRun(runID)
+
+	s.hub.Publish(StreamEvent{
+		RunID: runID,
+		Type:  "run_started",
+		Step:  "fire",
+		Level: "info",
+		Data: map[string]any{
+			"op":          "fire",
+			"mode":        rec.Mode,
+			"cwd":         s.rootAbs,
+			"tool":        rec.Tool,
+			"pgid":        rec.PGID,
+			"reattached":  true,
+			"detached":    rec.Detached,
+			"orphanRunId": rec.RunID,
+			"startedAt":   rec.StartedAt,
+			"log":         rec.Log,
+		},
+	})
+	note := fmt.Sprintf("Re-attached to process group %d; following %s. Earlier output is in run %s.", rec.PGID, rec.Log, rec.RunID)
+	if rec.Detached {
+		note = fmt.Sprintf("Re-attached to detached run %s; replaying %s from the start.", rec.RunID, rec.Log)
+	}
+	s.publishFireProgress(runID, "info", map[string]any{"phase": "started", "note": note})
+
+	if rec.Detached {
+		go s.followDetached(ctx, runID, *rec, logs[0], rec.PassesBefore)
+	} else {
+		done := func() bool {
+			return ctx.Err() != nil || !runGroupAlive(rec.PGID)
+		}
+		var tails []*fileTail
+		for _, logAbs := range logs {
+			// Output from before the restart is not replayed.
+			var offset int64
+			if info, err := os.Stat(logAbs); err == nil {
+				offset = info.Size()
+			}
+			tails = append(tails, &fileTail{path: logAbs, offset: offset, poll: fireTailPollInterval, done: done})
+		}
+		go s.followOrphan(runID, tails[0], tails[1])
+	}
+	if s.usageInterval > 0 {
+		go s.sampleUsage(ctx, runID)
+	}
+	return runID, nil, http.StatusOK
+}
+
+// followOrphan streams what the re-attached run appends to its stdout and
+// stderr logs until its processes exit. The exit status is unknown: the
+// console is not their parent.
+func (s *FireService) followOrphan(runID string, stdout *fileTail, stderr *fileTail) {
+	startedAt := time.Now()
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		s.streamPipe(runID, "fire", "process_stdout", stdout)
+	}()
+	go func() {
+		defer readers.Done()
+		s.streamPipe(runID, "fire", "process_stderr", stderr)
+	}()
+	readers.Wait()
+	s.finishRun(runID, startedAt, fireFinish{ok: false, level: "warn", reason: fireReasonOrphaned})
+}
+
+// OrphanKillHandler serves POST /api/fire/orphan/kill: SIGINT to the orphan's
+// process group, then SIGKILL after fireStopKillDelay. Only a group whose
+// leader matches the recorded start time is signalled.
+func (s *FireService) OrphanKillHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := s.currentOrphan()
+		if rec != nil && rec.alive() && !rec.LeaderVerified() {
+			WriteAPIError(w, http.StatusConflict, APIError{
+				Code:    "RESOURCE_CONFLICT",
+				Message: fmt.Sprintf("Cannot confirm that process group %d still belongs to Fire run %s.", rec.PGID, rec.RunID),
+				Hint:    "Its leader's start time is unknown or the leader has exited, so the pgid may have been reused. Check the processes and kill them yourself if they are the run's; the run is forgotten once they are gone.",
+			})
+			return
+		}
+		if rec == nil || !s.takeOrphan(rec) {
+			WriteAPIError(w, http.StatusNotFound, noOrphanError())
+			return
+		}
+		recordAuditRun(r.Context(), rec.RunID)
+
+		resp := FireOrphanKillResponse{OK: true, RunID: rec.RunID}
+		// A detached run may have exited long ago; its pgid may be reused.
+		if rec.alive() {
+			resp.Signal = "SIGINT"
+			_ = sendInterruptToProcessGroup(rec.PGID, rec.PGID)
+			deadline := time.Now().Add(fireStopKillDelay)
+			for runGroupAlive(rec.PGID) {
+				if time.Now().After(deadline) {
+					if !rec.LeaderVerified() {
+						break
+					}
+					resp.Signal = "SIGKILL"
+					_ = sendKillToProcessGroup(rec.PGID, rec.PGID)
+					s.sandbox.removeContainer(s.exec)
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			resp.Worktree = s.checkWorktree()
+		}
+		s.forgetOrphan(rec)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// fileTail reads a file that is still being appended to. At the end of the
+// file it polls until done reports true, then returns io.EOF once the rest is
+// read. A file that shrinks (rotated or truncated) is read from the start.
+type fileTail struct {
+	path   string
+	offset int64
+	poll   time.Duration
+	done   func() bool
+}
+
+func (t *fileTail) Read(p []byte) (int, error) {
+	for {
+		n, err := t.readAt(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+		if t.done() {
+			// Catch what was written between the read and the check.
+			if n, err := t.readAt(p); n > 0 || err != nil {
+				return n, err
+			}
+			return 0, io.EOF
+		}
+		time.Sleep(t.poll)
+	}
+}
+
+func (t *fileTail) readAt(p []byte) (int, error) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() < t.offset {
+		t.offset = 0
+	}
+	n, err := f.ReadAt(p, t.offset)
+	t.offset += int64(n)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,369 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startOrphanGroup starts a process group standing in for a run left behind
+// by a previous console.
+func startOrphanGroup(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start sleep: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		_ = sendKillToProcessGroup(cmd.Process.Pid, cmd.Process.Pid)
+		<-exited
+	})
+	return cmd.Process.Pid
+}
+
+// newOrphanFixture returns a service whose project holds the active.json and
+// in-progress archive of run fire-old, with its processes in group pgid.
+func newOrphanFixture(t *testing.T, pgid int) (*FireService, *StreamHub, string) {
+	t.Helper()
+	return newOrphanFixtureWithTicks(t, pgid, procStartTicks(pgid))
+}
+
+// newOrphanFixtureWithTicks is newOrphanFixture with the recorded start time
+// of the group leader given.
+func newOrphanFixtureWithTicks(t *testing.T, pgid int, leaderStartTicks uint64) (*FireService, *StreamHub, string) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("recovering a run needs its leader's start time from procfs")
+	}
+	poll := fireTailPollInterval
+	fireTailPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { fireTailPollInterval = poll })
+
+	root := t.TempDir()
+	writeConfigFile(t, filepath.Join(root, "prd.json"), `{"userStories":[]}`)
+	writeConfigFile(t, filepath.Join(root, "ralph-codex.sh"), "#!/usr/bin/env bash\nexit 0\n")
+	stdoutLog, stderrLog := fireOutputLogs("fire-old")
+	writeConfigFile(t, filepath.Join(root, filepath.FromSlash(stdoutLog)), "old line\n")
+	writeConfigFile(t, filepath.Join(root, filepath.FromSlash(stderrLog)), "")
+	runsDir := filepath.Join(root, ".ohmyagentflow", "runs")
+	writeConfigFile(t, filepath.Join(runsDir, "fire-old.jsonl.tmp"), `{"ts":"t1","seq":1,"runId":"fire-old","type":"run_started","step":"fire","data":{"op":"fire"}}`+"\n")
+	raw, _ := json.Marshal(FireActiveRun{
+		RunID:            "fire-old",
+		Tool:             FireToolCodex,
+		Mode:             FireModeScript,
+		StartedAt:        time.Now().Add(-time.Hour),
+		PGID:             pgid,
+		LeaderStartTicks: leaderStartTicks,
+		Log:              stdoutLog,
+		StderrLog:        stderrLog,
+	})
+	writeConfigFile(t, filepath.Join(root, ".ohmyagentflow", fireActiveFileName), string(raw))
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 200, SubscriberBufSize: 16, ArchiveDir: runsDir})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+	return svc, hub, root
+}
+
+func readActiveRun(t *testing.T, root string) *FireActiveRun {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join(root, ".ohmyagentflow", fireActiveFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	var rec FireActiveRun
+	if err != nil || json.Unmarshal(raw, &rec) != nil {
+		t.Fatalf("read active.json: %v %s", err, raw)
+	}
+	return &rec
+}
+
+func TestFireService_PersistsActiveRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash")
+	}
+	root := t.TempDir()
+	writeConfigFile(t, filepath.Join(root, "prd.json"), `{"userStories":[]}`)
+	writeConfigFile(t, filepath.Join(root, "ralph-codex.sh"), "#!/usr/bin/env bash\necho running\nsleep 0.5\n")
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	runID := startFireRun(t, svc, FireStartRequest{Tool: "codex", MaxIterations: 1})
+	waitForOutput(t, hub, runID, "running")
+	rec := readActiveRun(t, root)
+	stdoutLog, stderrLog := fireOutputLogs(runID)
+	if rec == nil || rec.RunID != runID || rec.Mode != FireModeScript || rec.PGID <= 0 || rec.ConsolePID != os.Getpid() || rec.Log != stdoutLog || rec.StderrLog != stderrLog {
+		t.Fatalf("unexpected active.json: %+v", rec)
+	}
+	raw, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(stdoutLog)))
+	if err != nil || string(raw) != "running\n" {
+		t.Fatalf("expected the script to write its output to %s, got %q (%v)", stdoutLog, raw, err)
+	}
+	if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(stderrLog))); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected a private stderr log, got %v (%v)", info, err)
+	}
+	waitForRunFinished(t, hub, runID)
+	if rec := readActiveRun(t, root); rec != nil {
+		t.Fatalf("expected active.json to be removed after the run, got %+v", rec)
+	}
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(stdoutLog))); !os.IsNotExist(err) {
+		t.Fatalf("expected the output logs to be removed after the run, got %v", err)
+	}
+}
+
+func TestFireService_ReattachesToOrphanedRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires process groups")
+	}
+	pgid := startOrphanGroup(t)
+	svc, hub, root := newOrphanFixture(t, pgid)
+
+	orphan, err := svc.RecoverOrphanedRun()
+	if err != nil || orphan == nil || orphan.RunID != "fire-old" || orphan.PGID != pgid {
+		t.Fatalf("expected fire-old to be recovered as an orphan, got %+v (%v)", orphan, err)
+	}
+	var finished map[string]any
+	_ = hub.scanRunArchive("fire-old", func(ev StreamEvent) error {
+		if ev.Type == "run_finished" {
+			finished, _ = ev.Data.(map[string]any)
+		}
+		return nil
+	})
+	if finished["reason"] != fireReasonOrphaned || finished["processesAlive"] != true {
+		t.Fatalf("expected the old archive to be finalized as orphaned, got %+v", finished)
+	}
+
+	w := httptest.NewRecorder()
+	svc.OrphanHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/fire/orphan", nil))
+	var got FireOrphanResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Orphan == nil || got.Orphan.RunID != "fire-old" {
+		t.Fatalf("unexpected orphan response: %s", w.Body.String())
+	}
+	if runtime.GOOS == "linux" && (len(got.Processes) == 0 || got.Processes[0].PID != pgid) {
+		t.Fatalf("expected the orphan's processes, got %+v", got.Processes)
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 1})
+	w = httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "fire-old") {
+		t.Fatalf("expected a new run to be refused while the orphan runs, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.OrphanAttachHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire/orphan/attach", nil))
+	var attached FireStartResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &attached); err != nil || w.Code != http.StatusOK || attached.RunID == "" {
+		t.Fatalf("attach: %d %s", w.Code, w.Body.String())
+	}
+	runID := attached.RunID
+	if rec := readActiveRun(t, root); rec == nil || rec.RunID != runID || rec.PGID != pgid {
+		t.Fatalf("expected active.json to follow the re-attached run, got %+v", rec)
+	}
+
+	// The orphan's processes keep appending to the run's logs.
+	stdoutLog, stderrLog := fireOutputLogs("fire-old")
+	for _, log := range []string{stdoutLog, stderrLog} {
+		f, err := os.OpenFile(filepath.Join(root, filepath.FromSlash(log)), os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("open %s: %v", log, err)
+		}
+		_, _ = f.WriteString("new line in " + filepath.Base(log) + "\n")
+		_ = f.Close()
+	}
+	waitForOutput(t, hub, runID, "new line in fire-old.stdout.log")
+
+	if code, resp := postFireStop(t, svc, `{"mode":"after-iteration"}`); code != http.StatusOK || resp.Mode != FireStopImmediate {
+		t.Fatalf("expected an immediate stop of the re-attached run, got %d %+v", code, resp)
+	}
+	events := waitForRunFinished(t, hub, runID)
+	_, data := runFinishedEvent(t, events)
+	if data["reason"] != "stopped" || data["signal"] != "SIGINT" {
+		t.Fatalf("unexpected run_finished: %+v", data)
+	}
+	if lines := stdoutLines(events); len(lines) != 1 || lines[0] != "new line in fire-old.stdout.log" {
+		t.Fatalf("expected only the lines appended after re-attaching, got %q", lines)
+	}
+	var stderr []string
+	for _, ev := range events {
+		if data, _ := ev.Data.(map[string]any); ev.Type == "process_stderr" {
+			stderr = append(stderr, data["text"].(string))
+		}
+	}
+	if len(stderr) != 1 || stderr[0] != "new line in fire-old.stderr.log" {
+		t.Fatalf("expected the stderr log to be followed too, got %q", stderr)
+	}
+	if rec := readActiveRun(t, root); rec != nil {
+		t.Fatalf("expected active.json to be removed, got %+v", rec)
+	}
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(stdoutLog))); !os.IsNotExist(err) {
+		t.Fatalf("expected the orphan's logs to be removed, got %v", err)
+	}
+}
+
+func TestFireService_KillsOrphanedRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires process groups")
+	}
+	pgid := startOrphanGroup(t)
+	svc, _, root := newOrphanFixture(t, pgid)
+	if orphan, err := svc.RecoverOrphanedRun(); err != nil || orphan == nil {
+		t.Fatalf("expected an orphan, got %+v (%v)", orphan, err)
+	}
+
+	w := httptest.NewRecorder()
+	svc.OrphanKillHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire/orphan/kill", nil))
+	var resp FireOrphanKillResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.RunID != "fire-old" || resp.Signal != "SIGINT" {
+		t.Fatalf("kill: %d %s", w.Code, w.Body.String())
+	}
+	if runGroupAlive(pgid) {
+		t.Fatalf("expected process group %d to be gone", pgid)
+	}
+	if rec := readActiveRun(t, root); rec != nil {
+		t.Fatalf("expected active.json to be removed, got %+v", rec)
+	}
+
+	w = httptest.NewRecorder()
+	svc.OrphanKillHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire/orphan/kill", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 once the orphan is gone, got %d", w.Code)
+	}
+}
+
+func TestFireService_RecoverRejectsUnverifiableRecords(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires procfs")
+	}
+	pgid := startOrphanGroup(t)
+	for _, tc := range []struct {
+		name  string
+		pgid  int
+		ticks uint64
+		want  string
+	}{
+		{name: "pgid 0", pgid: 0, ticks: 1, want: "no process group"},
+		{name: "pgid 1", pgid: 1, ticks: procStartTicks(1), want: "no process group"},
+		{name: "no start time", pgid: pgid, ticks: 0, want: "cannot be verified"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, _, root := newOrphanFixtureWithTicks(t, tc.pgid, tc.ticks)
+			orphan, err := svc.RecoverOrphanedRun()
+			if orphan != nil || err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected the record to be rejected with %q, got %+v (%v)", tc.want, orphan, err)
+			}
+			if rec := readActiveRun(t, root); rec != nil {
+				t.Fatalf("expected active.json to be removed, got %+v", rec)
+			}
+			w := httptest.NewRecorder()
+			svc.OrphanKillHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire/orphan/kill", nil))
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected no orphan to kill, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+	if !runGroupAlive(pgid) {
+		t.Fatalf("expected process group %d to be left alone", pgid)
+	}
+}
+
+func TestFireService_ReusedPGIDIsNotSignalled(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires procfs")
+	}
+	pgid := startOrphanGroup(t)
+
+	// The leader's start time differs: the pgid now belongs to another group.
+	svc, _, _ := newOrphanFixtureWithTicks(t, pgid, procStartTicks(pgid)+1)
+	if orphan, err := svc.RecoverOrphanedRun(); err != nil || orphan != nil {
+		t.Fatalf("expected a reused pgid not to be recovered, got %+v (%v)", orphan, err)
+	}
+
+	// The same, once re-attached: Stop leaves the group alone.
+	svc, hub, _ := newOrphanFixture(t, pgid)
+	if orphan, err := svc.RecoverOrphanedRun(); err != nil || orphan == nil {
+		t.Fatalf("expected an orphan, got %+v (%v)", orphan, err)
+	}
+	runID, err := svc.AttachOrphan()
+	if err != nil {
+		t.Fatalf("AttachOrphan: %v", err)
+	}
+	svc.mu.Lock()
+	svc.active.leaderStartTicks++
+	svc.mu.Unlock()
+	body, _ := json.Marshal(FireStopRequest{Mode: string(FireStopImmediate)})
+	w := httptest.NewRecorder()
+	svc.StopHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire/stop", bytes.NewReader(body)))
+	var resp FireStopResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.Stopping {
+		t.Fatalf("expected stop to signal nothing, got %d: %s", w.Code, w.Body.String())
+	}
+	if !runGroupAlive(pgid) {
+		t.Fatalf("expected process group %d to be left alone", pgid)
+	}
+	var noted bool
+	hub.mu.Lock()
+	for _, ev := range hub.runs[runID].events {
+		data, _ := ev.Data.(map[string]any)
+		if note, _ := data["note"].(string); strings.Contains(note, "Not signalling process group") {
+			noted = true
+		}
+	}
+	hub.mu.Unlock()
+	if !noted {
+		t.Fatalf("expected a note that the group was not signalled")
+	}
+	svc.mu.Lock()
+	svc.active.cancel()
+	svc.mu.Unlock()
+}
+
+func TestFireService_RecoverForgetsExitedRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires process groups")
+	}
+	cmd := exec.Command("true")
+	setProcessGroup(cmd)
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run true: %v", err)
+	}
+	// The leader has exited, so its start time is no longer readable.
+	svc, hub, root := newOrphanFixtureWithTicks(t, cmd.Process.Pid, 1)
+
+	orphan, err := svc.RecoverOrphanedRun()
+	if err != nil || orphan != nil {
+		t.Fatalf("expected no orphan, got %+v (%v)", orphan, err)
+	}
+	if rec := readActiveRun(t, root); rec != nil {
+		t.Fatalf("expected active.json to be removed, got %+v", rec)
+	}
+	var finished map[string]any
+	_ = hub.scanRunArchive("fire-old", func(ev StreamEvent) error {
+		if ev.Type == "run_finished" {
+			finished, _ = ev.Data.(map[string]any)
+		}
+		return nil
+	})
+	if finished["reason"] != fireReasonOrphaned || finished["processesAlive"] != false {
+		t.Fatalf("expected the archive to be finalized as orphaned, got %+v", finished)
+	}
+}
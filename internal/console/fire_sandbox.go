@@ -0,0 +1,313 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Sandbox backends for FireService.
+const (
+	SandboxNone       = "none"
+	SandboxBubblewrap = "bubblewrap"
+	SandboxDocker     = "docker"
+	SandboxPodman     = "podman"
+)
+
+// SandboxConfig wraps the agent (or ralph-codex.sh) in a sandbox. The zero
+// value runs it directly on the host.
+type SandboxConfig struct {
+	// Backend is "none", "bubblewrap", "docker" or "podman".
+	Backend string `json:"backend"`
+	// Image is the container image for docker/podman; it must provide bash
+	// and the agent CLI.
+	Image string `json:"image"`
+	// Network is "allow" (default) or "deny". Note that the agents need
+	// network access to reach their model API.
+	Network string `json:"network"`
+	// ReadOnlyPaths and WritablePaths are extra host paths mounted at the
+	// same location, e.g. "~/.codex" for the agent's credentials. The project
+	// root is always writable; the home directory is otherwise hidden.
+	ReadOnlyPaths []string `json:"readOnlyPaths"`
+	WritablePaths []string `json:"writablePaths"`
+	// Env names host variables passed into containers (bubblewrap inherits
+	// the environment).
+	Env []string `json:"env"`
+	// CPUs, MemoryBytes and Pids are cgroup limits; 0 means unlimited.
+	// bubblewrap applies them through a systemd-run --user scope.
+	CPUs        float64 `json:"cpus"`
+	MemoryBytes int64   `json:"memoryBytes"`
+	Pids        int     `json:"pids"`
+}
+
+func (c SandboxConfig) backend() string {
+	if b := strings.ToLower(strings.TrimSpace(c.Backend)); b != "" {
+		return b
+	}
+	return SandboxNone
+}
+
+func (c SandboxConfig) denyNetwork() bool {
+	return strings.EqualFold(strings.TrimSpace(c.Network), "deny")
+}
+
+func (c SandboxConfig) hasLimits() bool {
+	return c.CPUs > 0 || c.MemoryBytes > 0 || c.Pids > 0
+}
+
+// ValidateSandboxConfig reports the first invalid setting.
+func ValidateSandboxConfig(c SandboxConfig) error {
+	switch c.backend() {
+	case SandboxNone, SandboxBubblewrap:
+	case SandboxDocker, SandboxPodman:
+		if strings.TrimSpace(c.Image) == "" {
+			return fmt.Errorf("image is required for backend %q", c.backend())
+		}
+	default:
+		return fmt.Errorf("backend must be %q, %q, %q or %q (got %q)", SandboxNone, SandboxBubblewrap, SandboxDocker, SandboxPodman, c.Backend)
+	}
+	switch strings.ToLower(strings.TrimSpace(c.Network)) {
+	case "", "allow", "deny":
+	default:
+		return fmt.Errorf("network must be \"allow\" or \"deny\" (got %q)", c.Network)
+	}
+	if c.CPUs < 0 || c.MemoryBytes < 0 || c.Pids < 0 {
+		return errors.New("cpus, memoryBytes and pids must not be negative")
+	}
+	for _, p := range append(append([]string(nil), c.ReadOnlyPaths...), c.WritablePaths...) {
+		if !strings.HasPrefix(p, "~/") && !filepath.IsAbs(p) {
+			return fmt.Errorf("mount %q must be absolute or start with ~/", p)
+		}
+	}
+	for _, name := range c.Env {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return fmt.Errorf("env entry %q must be a variable name", name)
+		}
+	}
+	return nil
+}
+
+// FireSandbox builds the sandboxed argv for a run. A nil *FireSandbox runs
+// commands unchanged.
+type FireSandbox struct {
+	cfg      SandboxConfig
+	root     string
+	home     string
+	readOnly []string
+	writable []string
+	// program and prefix are prepended to the wrapped command.
+	program string
+	prefix  []string
+	// container names the container so a forced stop can remove it.
+	container string
+}
+
+// FireSandboxStatus is reported in run_started.data.sandbox.
+type FireSandboxStatus struct {
+	Backend   string         `json:"backend"`
+	Image     string         `json:"image,omitempty"`
+	Network   string         `json:"network,omitempty"`
+	ReadWrite []string       `json:"readWrite,omitempty"`
+	ReadOnly  []string       `json:"readOnly,omitempty"`
+	Limits    *SandboxLimits `json:"limits,omitempty"`
+	// Cgroup names what enforces Limits: "systemd-run" or the container runtime.
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+type SandboxLimits struct {
+	CPUs        float64 `json:"cpus,omitempty"`
+	MemoryBytes int64   `json:"memoryBytes,omitempty"`
+	Pids        int     `json:"pids,omitempty"`
+}
+
+// NewFireSandbox returns nil for the "none" backend.
+func NewFireSandbox(cfg SandboxConfig, rootAbs string) (*FireSandbox, error) {
+	if err := ValidateSandboxConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.backend() == SandboxNone {
+		return nil, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	sb := &FireSandbox{cfg: cfg, root: rootAbs, home: filepath.Clean(home)}
+	expand := func(paths []string) []string {
+		out := make([]string, 0, len(paths))
+		for _, p := range paths {
+			if rest, ok := strings.CutPrefix(p, "~/"); ok {
+				p = filepath.Join(sb.home, rest)
+			}
+			out = append(out, filepath.Clean(p))
+		}
+		return out
+	}
+	sb.readOnly = expand(cfg.ReadOnlyPaths)
+	sb.writable = expand(cfg.WritablePaths)
+
+	switch cfg.backend() {
+	case SandboxBubblewrap:
+		sb.program, sb.prefix = "bwrap", sb.bubblewrapArgs()
+		if cfg.hasLimits() {
+			sb.program, sb.prefix = "systemd-run", append(sb.systemdRunArgs(), append([]string{"bwrap"}, sb.prefix...)...)
+		}
+	default:
+		sb.container = "ohmyagentflow-fire-" + sha256Hex([]byte(rootAbs))[:12]
+		sb.program, sb.prefix = cfg.backend(), sb.containerArgs()
+	}
+	return sb, nil
+}
+
+func (sb *FireSandbox) bubblewrapArgs() []string {
+	args := []string{"--die-with-parent", "--unshare-pid", "--unshare-ipc", "--unshare-uts"}
+	if sb.cfg.denyNetwork() {
+		args = append(args, "--unshare-net")
+	}
+	// The host is visible read-only, the home directory (credentials) is
+	// hidden, and later binds override earlier ones.
+	args = append(args, "--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp", "--tmpfs", sb.home)
+	for _, p := range sb.readOnly {
+		args = append(args, "--ro-bind", p, p)
+	}
+	for _, p := range sb.writable {
+		args = append(args, "--bind", p, p)
+	}
+	return append(args, "--bind", sb.root, sb.root, "--chdir", sb.root, "--")
+}
+
+func (sb *FireSandbox) systemdRunArgs() []string {
+	args := []string{"--user", "--scope", "--quiet", "--collect"}
+	if sb.cfg.CPUs > 0 {
+		args = append(args, "-p", fmt.Sprintf("CPUQuota=%d%%", int(math.Round(sb.cfg.CPUs*100))))
+	}
+	if sb.cfg.MemoryBytes > 0 {
+		args = append(args, "-p", "MemoryMax="+strconv.FormatInt(sb.cfg.MemoryBytes, 10))
+	}
+	if sb.cfg.Pids > 0 {
+		args = append(args, "-p", "TasksMax="+strconv.Itoa(sb.cfg.Pids))
+	}
+	return append(args, "--")
+}
+
+func (sb *FireSandbox) containerArgs() []string {
+	args := []string{"run", "--rm", "-i", "--init", "--name", sb.container}
+	if sb.cfg.denyNetwork() {
+		args = append(args, "--network", "none")
+	}
+	if sb.cfg.backend() == SandboxPodman {
+		args = append(args, "--userns", "keep-id")
+	} else if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	if sb.cfg.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(sb.cfg.CPUs, 'f', -1, 64))
+	}
+	if sb.cfg.MemoryBytes > 0 {
+		args = append(args, "--memory", strconv.FormatInt(sb.cfg.MemoryBytes, 10))
+	}
+	if sb.cfg.Pids > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(sb.cfg.Pids))
+	}
+	args = append(args, "-e", "HOME="+sb.home)
+	for _, name := range sb.cfg.Env {
+		args = append(args, "-e", name)
+	}
+	for _, p := range sb.readOnly {
+		args = append(args, "-v", p+":"+p+":ro")
+	}
+	for _, p := range sb.writable {
+		args = append(args, "-v", p+":"+p)
+	}
+	return append(args, "-v", sb.root+":"+sb.root, "-w", sb.root, sb.cfg.Image)
+}
+
+// wrap returns the command that runs name and args inside the sandbox.
+func (sb *FireSandbox) wrap(name string, args []string) (string, []string) {
+	if sb == nil {
+		return name, args
+	}
+	wrapped := append(append(append([]string(nil), sb.prefix...), name), args...)
+	return sb.program, wrapped
+}
+
+// isContainer reports whether the agent runs in a container image, where host
+// binaries are not visible.
+func (sb *FireSandbox) isContainer() bool {
+	return sb != nil && sb.container != ""
+}
+
+// checkAvailable verifies that the sandbox launcher is installed.
+func (sb *FireSandbox) checkAvailable() *APIError {
+	if sb == nil {
+		return nil
+	}
+	programs := []string{sb.program}
+	if sb.program == "systemd-run" {
+		programs = append(programs, "bwrap")
+	}
+	for _, p := range programs {
+		if _, err := exec.LookPath(p); err != nil {
+			return &APIError{
+				Code:    "FIRE_START_FAILED",
+				Message: fmt.Sprintf("The %s sandbox is not available.", sb.cfg.backend()),
+				Hint:    fmt.Sprintf("%s was not found on PATH. Install it or set fire.sandbox.backend to \"none\".", p),
+			}
+		}
+	}
+	return nil
+}
+
+// removeContainer force-removes the run's container; the runtime CLI does
+// not stop it when the CLI process itself is killed.
+func (sb *FireSandbox) removeContainer(policy *ExecPolicy) {
+	if !sb.isContainer() {
+		return
+	}
+	cmd, err := policy.CommandContext(context.Background(), sb.root, sb.program, "rm", "-f", sb.container)
+	if err == nil {
+		_ = cmd.Run()
+	}
+}
+
+// policy extends base with the sandbox launcher (wrapping only commands base
+// allows) and the container cleanup command.
+func (sb *FireSandbox) policy(base *ExecPolicy) *ExecPolicy {
+	if sb == nil {
+		return base
+	}
+	p := base.withWrapper(sb.program, sb.prefix)
+	if sb.isContainer() {
+		p = p.withCommands([]string{sb.program, "rm", "-f", sb.container})
+	}
+	return p
+}
+
+func (sb *FireSandbox) Status() FireSandboxStatus {
+	if sb == nil {
+		return FireSandboxStatus{Backend: SandboxNone}
+	}
+	st := FireSandboxStatus{
+		Backend:   sb.cfg.backend(),
+		Network:   "allow",
+		ReadWrite: append([]string{sb.root}, sb.writable...),
+		ReadOnly:  sb.readOnly,
+	}
+	if sb.isContainer() {
+		st.Image = sb.cfg.Image
+	}
+	if sb.cfg.denyNetwork() {
+		st.Network = "deny"
+	}
+	if sb.cfg.hasLimits() {
+		st.Limits = &SandboxLimits{CPUs: sb.cfg.CPUs, MemoryBytes: sb.cfg.MemoryBytes, Pids: sb.cfg.Pids}
+		st.Cgroup = sb.program
+	}
+	return st
+}
@@ -0,0 +1,159 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewFireSandbox_BuildsLauncherArgs(t *testing.T) {
+	t.Setenv("HOME", "/home/dev")
+
+	if sb, err := NewFireSandbox(SandboxConfig{}, "/work/app"); sb != nil || err != nil {
+		t.Fatalf("expected no sandbox by default, got %+v %v", sb, err)
+	}
+	if st := (*FireSandbox)(nil).Status(); st.Backend != SandboxNone {
+		t.Fatalf("unexpected status for no sandbox: %+v", st)
+	}
+
+	sb, err := NewFireSandbox(SandboxConfig{Backend: "bubblewrap", Network: "deny", ReadOnlyPaths: []string{"~/.codex"}}, "/work/app")
+	if err != nil {
+		t.Fatalf("NewFireSandbox: %v", err)
+	}
+	name, args := sb.wrap("codex", []string{"exec", "-"})
+	got := name + " " + strings.Join(args, " ")
+	want := "bwrap --die-with-parent --unshare-pid --unshare-ipc --unshare-uts --unshare-net " +
+		"--ro-bind / / --dev /dev --proc /proc --tmpfs /tmp --tmpfs /home/dev " +
+		"--ro-bind /home/dev/.codex /home/dev/.codex --bind /work/app /work/app --chdir /work/app -- codex exec -"
+	if got != want {
+		t.Fatalf("unexpected bubblewrap argv:\n got %s\nwant %s", got, want)
+	}
+
+	sb, _ = NewFireSandbox(SandboxConfig{Backend: "bubblewrap", CPUs: 1.5, MemoryBytes: 1 << 30, Pids: 256}, "/work/app")
+	name, args = sb.wrap("codex", nil)
+	got = name + " " + strings.Join(args, " ")
+	if !strings.HasPrefix(got, "systemd-run --user --scope --quiet --collect -p CPUQuota=150% -p MemoryMax=1073741824 -p TasksMax=256 -- bwrap --die-with-parent") {
+		t.Fatalf("unexpected limited bubblewrap argv: %s", got)
+	}
+	if st := sb.Status(); st.Cgroup != "systemd-run" || st.Limits == nil || st.Limits.Pids != 256 || st.Network != "allow" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	sb, _ = NewFireSandbox(SandboxConfig{Backend: "docker", Image: "agent:latest", Network: "deny", Env: []string{"OPENAI_API_KEY"}, MemoryBytes: 512 << 20}, "/work/app")
+	name, args = sb.wrap("bash", []string{"/work/app/ralph-codex.sh"})
+	got = name + " " + strings.Join(args, " ")
+	for _, part := range []string{
+		"docker run --rm -i --init --name ohmyagentflow-fire-",
+		" --network none ",
+		" --memory 536870912 ",
+		" -e HOME=/home/dev -e OPENAI_API_KEY ",
+		" -v /work/app:/work/app -w /work/app agent:latest bash /work/app/ralph-codex.sh",
+	} {
+		if !strings.Contains(got, part) {
+			t.Fatalf("docker argv missing %q:\n%s", part, got)
+		}
+	}
+
+	for _, bad := range []SandboxConfig{
+		{Backend: "firejail"},
+		{Backend: "podman"},
+		{Backend: "bubblewrap", Network: "proxy"},
+		{Backend: "bubblewrap", ReadOnlyPaths: []string{"relative/dir"}},
+		{Backend: "docker", Image: "x", Env: []string{"A=b"}},
+		{Backend: "bubblewrap", Pids: -1},
+	} {
+		if _, err := NewFireSandbox(bad, "/work/app"); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestFireSandbox_PolicyWrapsOnlyWhitelistedCommands(t *testing.T) {
+	t.Setenv("HOME", "/home/dev")
+
+	dir := t.TempDir()
+	sb, _ := NewFireSandbox(SandboxConfig{Backend: "docker", Image: "agent:latest"}, dir)
+	policy := sb.policy(consoleExecPolicy)
+	allowed := [][]string{
+		{"codex", "exec", "--dangerously-bypass-approvals-and-sandbox", "-"},
+		{"bash", filepath.Join(dir, "ralph-codex.sh"), "--tool", "claude", "3"},
+	}
+	for _, argv := range allowed {
+		name, args := sb.wrap(argv[0], argv[1:])
+		if _, err := policy.CommandContext(context.Background(), dir, name, args...); err != nil {
+			t.Fatalf("wrapped %q should be allowed: %v", argv, err)
+		}
+	}
+	if _, err := policy.CommandContext(context.Background(), dir, "docker", "rm", "-f", sb.container); err != nil {
+		t.Fatalf("container cleanup should be allowed: %v", err)
+	}
+	denied := [][]string{
+		{"docker", "run", "--rm", "-i", "evil", "bash"},
+		{"docker", "rm", "-f", "other"},
+	}
+	name, args := sb.wrap("rm", []string{"-rf", "/"})
+	denied = append(denied, append([]string{name}, args...))
+	for _, argv := range denied {
+		if _, err := policy.CommandContext(context.Background(), dir, argv[0], argv[1:]...); !errors.Is(err, ErrExecDenied) {
+			t.Fatalf("%q should be denied, got %v", argv, err)
+		}
+	}
+}
+
+func TestFireService_LoopModeRunsAgentInSandbox(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake launcher is a shell script")
+	}
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\ncat >/dev/null\necho 'tokens used 1'\n")
+	// The fake launcher records that it ran, drops its options and runs the
+	// wrapped command.
+	installFakeAgent(t, "bwrap", "#!/usr/bin/env bash\n"+
+		"echo \"$@\" > sandboxed\n"+
+		"while [ \"$1\" != -- ]; do shift; done\nshift\nexec \"$@\"\n")
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{
+		ProjectRoot: root,
+		Hub:         hub,
+		Prompts:     newTestPromptStore(t, root),
+		Sandbox:     SandboxConfig{Backend: "bubblewrap", Network: "deny"},
+	})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	events, finished := runFireToEnd(t, svc, hub, FireStartRequest{Tool: "codex", MaxIterations: 1, Mode: "loop"})
+	if finished["reason"] != fireReasonMaxIterations {
+		t.Fatalf("unexpected run_finished: %+v", finished)
+	}
+	started, _ := events[0].Data.(map[string]any)
+	if st, _ := started["sandbox"].(FireSandboxStatus); events[0].Type != "run_started" || st.Backend != SandboxBubblewrap || st.Network != "deny" || st.ReadWrite[0] != svc.rootAbs {
+		t.Fatalf("expected the sandbox in run_started, got %+v", started)
+	}
+	raw, err := os.ReadFile(filepath.Join(root, "sandboxed"))
+	if err != nil || !strings.Contains(string(raw), "--unshare-net") || !strings.HasSuffix(strings.TrimSpace(string(raw)), "-- codex exec --dangerously-bypass-approvals-and-sandbox -") {
+		t.Fatalf("expected the agent to run through bwrap, got %q err=%v", raw, err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 1, Mode: "loop"})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "bwrap was not found") {
+		t.Fatalf("expected a missing launcher to be reported, got %d %s", w.Code, w.Body.String())
+	}
+}
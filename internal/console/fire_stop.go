@@ -0,0 +1,335 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FireStopMode selects how POST /api/fire/stop ends a run.
+type FireStopMode string
+
+const (
+	// FireStopImmediate interrupts the run right away (SIGINT, then SIGKILL
+	// after fireStopKillDelay).
+	FireStopImmediate FireStopMode = "immediate"
+	// FireStopGraceful lets the current iteration finish for up to a grace
+	// period, then stops immediately.
+	FireStopGraceful FireStopMode = "graceful"
+	// FireStopAfterIteration lets the current iteration finish and skips the
+	// remaining ones.
+	FireStopAfterIteration FireStopMode = "after-iteration"
+)
+
+// DefaultFireStopGracePeriod bounds a graceful stop without its own period.
+const DefaultFireStopGracePeriod = 2 * time.Minute
+
+// fireStopKillDelay is how long an interrupted run gets before SIGKILL.
+const fireStopKillDelay = 5 * time.Second
+
+// worktreeCheckTimeout bounds the git status run after a forced stop.
+const worktreeCheckTimeout = 30 * time.Second
+
+// maxWorktreeFiles bounds the changed paths listed in run_finished.
+const maxWorktreeFiles = 20
+
+var gitStatusArgs = []string{"--no-optional-locks", "status", "--porcelain"}
+
+type FireStopRequest struct {
+	// Mode is "immediate" (default), "graceful" or "after-iteration".
+	Mode string `json:"mode,omitempty"`
+	// GracePeriod overrides fire.stopGracePeriod for mode=graceful.
+	GracePeriod Duration `json:"gracePeriod,omitempty"`
+}
+
+type FireStopResponse struct {
+	OK       bool         `json:"ok"`
+	RunID    string       `json:"runId,omitempty"`
+	Stopping bool         `json:"stopping"`
+	Mode     FireStopMode `json:"mode,omitempty"`
+}
+
+func parseFireStopMode(raw string) (FireStopMode, *APIError, int) {
+	switch FireStopMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", FireStopImmediate:
+		return FireStopImmediate, nil, http.StatusOK
+	case FireStopGraceful:
+		return FireStopGraceful, nil, http.StatusOK
+	case FireStopAfterIteration:
+		return FireStopAfterIteration, nil, http.StatusOK
+	default:
+		return "", &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "mode must be one of: immediate, graceful, after-iteration.",
+			Hint:    "Use mode=after-iteration to let the agent finish its current iteration.",
+		}, http.StatusBadRequest
+	}
+}
+
+func (s *FireService) StopHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req FireStopRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "BAD_JSON",
+				Message: "Invalid JSON request body.",
+				Hint:    "Send {} or {\"mode\":\"after-iteration\"}.",
+			})
+			return
+		}
+		mode, apiErr, status := parseFireStopMode(req.Mode)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		if req.GracePeriod < 0 {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "gracePeriod must not be negative.",
+			})
+			return
+		}
+		grace := s.stopGrace
+		if req.GracePeriod > 0 {
+			grace = time.Duration(req.GracePeriod)
+		}
+		respond := func(resp FireStopResponse) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_ = json.NewEncoder(w).Encode(resp)
+		}
+
+		s.mu.Lock()
+		active := s.active
+		if active == nil {
+			s.mu.Unlock()
+			respond(FireStopResponse{OK: true, Stopping: false})
+			return
+		}
+		runID := active.runID
+		recordAuditRun(r.Context(), runID)
+		if active.stopping {
+			s.mu.Unlock()
+			respond(FireStopResponse{OK: true, RunID: runID, Stopping: true, Mode: active.stopMode})
+			return
+		}
+		// A loop between iterations has nothing to wait for, and iterations of
+		// a re-attached run cannot be told apart unless it is detached (its
+		// log is replayed in full).
+		inIteration := !active.loop || active.cmd != nil
+		if mode != FireStopImmediate && inIteration && (!active.reattached || active.detached) {
+			pending := active.stopAfterIteration
+			active.stopAfterIteration = true
+			active.stopMode = mode
+			s.mu.Unlock()
+
+			note := "Stop requested; the current iteration will finish first."
+			if mode == FireStopGraceful {
+				note = fmt.Sprintf("Stop requested; the current iteration has %s to finish.", grace)
+				time.AfterFunc(grace, func() { s.expireStopGrace(runID, grace) })
+			}
+			if !pending || mode == FireStopGraceful {
+				s.publishFireProgress(runID, "info", map[string]any{"phase": "stop_requested", "mode": mode, "note": note})
+			}
+			respond(FireStopResponse{OK: true, RunID: runID, Stopping: true, Mode: mode})
+			return
+		}
+		active.stopMode = FireStopImmediate
+		s.mu.Unlock()
+
+		stopping := s.interruptRun(runID)
+		respond(FireStopResponse{OK: true, RunID: runID, Stopping: stopping, Mode: FireStopImmediate})
+	}
+}
+
+// interruptRun sends SIGINT to the run's current process group and SIGKILL
+// if it is still there after fireStopKillDelay. It returns false when the
+// processes exited in time.
+func (s *FireService) interruptRun(runID string) bool {
+	s.mu.Lock()
+	active := s.active
+	if active == nil || active.runID != runID {
+		s.mu.Unlock()
+		return false
+	}
+	active.stopAfterIteration = false
+	if active.loop && active.cmd == nil {
+		// Between loop iterations: no process to signal, just end the loop.
+		active.stopping = true
+		active.stopIssuedAt = time.Now()
+		active.cancel()
+		s.mu.Unlock()
+		return true
+	}
+	pgid := active.pgid
+	// A re-attached group is not our child: its pgid may have been reused.
+	leaderStartTicks := active.leaderStartTicks
+	var pid int
+	if active.cmd != nil && active.cmd.Process != nil {
+		pid = active.cmd.Process.Pid
+	} else if active.reattached {
+		if !groupLeaderIs(pgid, leaderStartTicks) {
+			s.mu.Unlock()
+			s.publishFireProgress(runID, "warn", map[string]any{
+				"phase": "stopped",
+				"note":  fmt.Sprintf("Not signalling process group %d: its leader is no longer the run's process, so the pgid may have been reused.", pgid),
+			})
+			return false
+		}
+		pid = pgid
+	}
+	if pid == 0 {
+		s.mu.Unlock()
+		return false
+	}
+	active.stopping = true
+	active.stopSignal = "SIGINT"
+	active.stopIssuedAt = time.Now()
+	s.mu.Unlock()
+
+	if pgid == 0 {
+		pgid = pid
+	}
+
+	// Best effort: stop via process group (Unix) or the process itself (Windows).
+	_ = sendInterruptToProcessGroup(pgid, pid)
+
+	s.publishFireProgress(runID, "info", map[string]any{
+		"phase": "stopped",
+		"note":  "Stop requested; sending SIGINT.",
+	})
+
+	deadline := time.Now().Add(fireStopKillDelay)
+	for time.Now().Before(deadline) {
+		if !processGroupExists(pgid) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if leaderStartTicks != 0 && !groupLeaderIs(pgid, leaderStartTicks) {
+		return false
+	}
+	s.mu.Lock()
+	active = s.active
+	if active != nil && active.runID == runID {
+		active.stopSignal = "SIGKILL"
+	}
+	s.mu.Unlock()
+
+	_ = sendKillToProcessGroup(pgid, pid)
+	s.sandbox.removeContainer(s.exec)
+
+	s.publishFireProgress(runID, "warn", map[string]any{
+		"phase": "stopped",
+		"note":  "Process did not exit after SIGINT; sent SIGKILL.",
+	})
+	return true
+}
+
+// stopAtIterationBoundary ends a loop run with a pending after-iteration or
+// graceful stop once the current iteration has finished.
+func (s *FireService) stopAtIterationBoundary(runID string) bool {
+	s.mu.Lock()
+	active := s.active
+	pending := active != nil && active.runID == runID && active.stopAfterIteration && !active.stopping
+	if pending {
+		active.stopAfterIteration = false
+		active.stopping = true
+		active.stopIssuedAt = time.Now()
+	}
+	s.mu.Unlock()
+	if pending {
+		s.publishFireProgress(runID, "info", map[string]any{
+			"phase": "stopped",
+			"note":  "Iteration finished; skipping the remaining iterations.",
+		})
+	}
+	return pending
+}
+
+// expireStopGrace interrupts the iteration of a graceful stop that is still
+// pending once its grace period is over.
+func (s *FireService) expireStopGrace(runID string, grace time.Duration) {
+	s.mu.Lock()
+	active := s.active
+	pending := active != nil && active.runID == runID && active.stopAfterIteration && !active.stopping
+	s.mu.Unlock()
+	if !pending {
+		return
+	}
+	s.publishFireProgress(runID, "warn", map[string]any{
+		"phase": "stop_requested",
+		"mode":  FireStopGraceful,
+		"note":  fmt.Sprintf("The iteration did not finish within %s; stopping now.", grace),
+	})
+	s.interruptRun(runID)
+}
+
+// checkWorktree reports what a forced stop may have left behind: uncommitted
+// changes and a stale .git/index.lock. It returns nil outside a git checkout.
+func (s *FireService) checkWorktree() map[string]any {
+	gitDir := filepath.Join(s.rootAbs, ".git")
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return nil
+	}
+	if !info.IsDir() {
+		// A linked worktree or submodule: .git holds "gitdir: <path>".
+		raw, err := os.ReadFile(gitDir)
+		if err != nil {
+			return nil
+		}
+		dir, ok := strings.CutPrefix(strings.TrimSpace(string(raw)), "gitdir:")
+		if !ok {
+			return nil
+		}
+		gitDir = strings.TrimSpace(dir)
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(s.rootAbs, gitDir)
+		}
+	}
+
+	out := map[string]any{}
+	var notes []string
+	if _, err := os.Stat(filepath.Join(gitDir, "index.lock")); err == nil {
+		out["indexLock"] = true
+		notes = append(notes, "a stale .git/index.lock was left behind; remove it once no git process is running")
+	} else {
+		out["indexLock"] = false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), worktreeCheckTimeout)
+	defer cancel()
+	var raw []byte
+	cmd, err := s.exec.CommandContext(ctx, s.rootAbs, "git", gitStatusArgs...)
+	if err == nil {
+		raw, err = cmd.Output()
+	}
+	if err != nil {
+		out["error"] = "git status failed: " + err.Error()
+	} else {
+		var files []string
+		for _, line := range strings.Split(string(raw), "\n") {
+			if strings.TrimSpace(line) != "" {
+				files = append(files, line)
+			}
+		}
+		out["dirty"] = len(files) > 0
+		out["changedFiles"] = len(files)
+		if len(files) > 0 {
+			out["files"] = files[:min(len(files), maxWorktreeFiles)]
+			notes = append(notes, fmt.Sprintf("%d uncommitted change(s) in the working tree", len(files)))
+		}
+	}
+	if len(notes) > 0 {
+		out["note"] = "After the forced stop, " + strings.Join(notes, "; ") + "."
+	}
+	return out
+}
@@ -0,0 +1,239 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startFireRun(t *testing.T, svc *FireService, req FireStartRequest) string {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	var resp FireStartResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	return resp.RunID
+}
+
+func postFireStop(t *testing.T, svc *FireService, body string) (int, FireStopResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	svc.StopHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire/stop", strings.NewReader(body)))
+	var resp FireStopResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+// waitForOutput waits until the run printed a line containing text.
+func waitForOutput(t *testing.T, hub *StreamHub, runID string, text string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		hub.mu.Lock()
+		var found bool
+		if state := hub.runs[runID]; state != nil {
+			for _, ev := range state.events {
+				data, _ := ev.Data.(map[string]any)
+				if s, _ := data["text"].(string); ev.Type == "process_stdout" && strings.Contains(s, text) {
+					found = true
+				}
+			}
+		}
+		hub.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %q", text)
+}
+
+func waitForProgress(t *testing.T, hub *StreamHub, runID string, phase string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		hub.mu.Lock()
+		var found bool
+		if state := hub.runs[runID]; state != nil {
+			for _, ev := range state.events {
+				data, _ := ev.Data.(map[string]any)
+				if ev.Type == "progress" && data["phase"] == phase {
+					found = true
+				}
+			}
+		}
+		hub.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for the %s progress event", phase)
+}
+
+func runFinishedEvent(t *testing.T, events []StreamEvent) (StreamEvent, map[string]any) {
+	t.Helper()
+	for _, ev := range events {
+		if ev.Type == "run_finished" {
+			data, _ := ev.Data.(map[string]any)
+			return ev, data
+		}
+	}
+	t.Fatalf("no run_finished in %+v", events)
+	return StreamEvent{}, nil
+}
+
+func stdoutLines(events []StreamEvent) []string {
+	var out []string
+	for _, ev := range events {
+		if data, _ := ev.Data.(map[string]any); ev.Type == "process_stdout" {
+			s, _ := data["text"].(string)
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestFireService_StopAfterIterationInLoopMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent is a shell script")
+	}
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\ncat >/dev/null\necho working\nsleep 0.4\necho 'tokens used 1'\n")
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Prompts: newTestPromptStore(t, root)})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	runID := startFireRun(t, svc, FireStartRequest{Tool: "codex", MaxIterations: 3, Mode: "loop"})
+	waitForOutput(t, hub, runID, "working")
+	if code, _ := postFireStop(t, svc, `{"mode":"later"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown mode to be rejected, got %d", code)
+	}
+	if code, resp := postFireStop(t, svc, `{"mode":"after-iteration"}`); code != http.StatusOK || !resp.Stopping || resp.Mode != FireStopAfterIteration || resp.RunID != runID {
+		t.Fatalf("unexpected stop response: %d %+v", code, resp)
+	}
+
+	events := waitForRunFinished(t, hub, runID)
+	_, finished := runFinishedEvent(t, events)
+	if finished["reason"] != "stopped" || finished["signal"] != nil || finished["worktree"] != nil {
+		t.Fatalf("expected a clean stop, got %+v", finished)
+	}
+	if lines := stdoutLines(events); !slices.Equal(lines, []string{"working", "tokens used 1"}) {
+		t.Fatalf("expected exactly one complete iteration, got %q", lines)
+	}
+}
+
+func TestFireService_GracefulStopReportsDirtyWorktree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent is a shell script")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	writePromptFixture(t, root)
+	// The agent is interrupted while it holds the index lock.
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\ncat >/dev/null\n"+
+		"touch .git/index.lock\necho edit > edited.txt\necho working\nsleep 10\n")
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Prompts: newTestPromptStore(t, root)})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	runID := startFireRun(t, svc, FireStartRequest{Tool: "codex", MaxIterations: 2, Mode: "loop"})
+	waitForOutput(t, hub, runID, "working")
+	if code, resp := postFireStop(t, svc, `{"mode":"graceful","gracePeriod":"100ms"}`); code != http.StatusOK || resp.Mode != FireStopGraceful {
+		t.Fatalf("unexpected stop response: %d %+v", code, resp)
+	}
+
+	events := waitForRunFinished(t, hub, runID)
+	last, finished := runFinishedEvent(t, events)
+	if finished["reason"] != "stopped" || finished["signal"] != "SIGINT" || last.Level != "warn" {
+		t.Fatalf("expected the grace period to expire into an interrupt, got %s %+v", last.Level, finished)
+	}
+	wt, _ := finished["worktree"].(map[string]any)
+	files, _ := wt["files"].([]string)
+	if wt["indexLock"] != true || wt["dirty"] != true || !slices.Contains(files, "?? edited.txt") || !strings.Contains(wt["note"].(string), "index.lock") {
+		t.Fatalf("expected the lock and the uncommitted change to be reported, got %+v", wt)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".git", "index.lock")); err != nil {
+		t.Fatalf("the lock must be reported, not removed: %v", err)
+	}
+}
+
+func TestFireService_StopAfterIterationInScriptMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process-group stop test is Unix-only")
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "prd.json"), []byte(`{}`+"\n"), 0o644); err != nil {
+		t.Fatalf("write prd.json: %v", err)
+	}
+	// Iteration 1 only finishes once the stop is pending. Between iterations
+	// the script waits in a builtin rather than in sleep: a SIGINT that lands
+	// while bash forks sleep can leave the child exiting normally, and bash
+	// then carries on with the next iteration.
+	script := "#!/usr/bin/env bash\n" +
+		"for i in 1 2 3; do\n" +
+		"  echo \"Ralph Iteration $i of 3\"\n" +
+		"  while [ ! -f finish-iteration ]; do sleep 0.05; done\n" +
+		"  echo \"Iteration $i complete. Continuing...\"\n" +
+		"  read -t 5 <> <(:)\n" +
+		"done\n"
+	if err := os.WriteFile(filepath.Join(root, "ralph-codex.sh"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write ralph-codex.sh: %v", err)
+	}
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 200, SubscriberBufSize: 32})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	runID := startFireRun(t, svc, FireStartRequest{Tool: "codex", MaxIterations: 3})
+	waitForOutput(t, hub, runID, "Ralph Iteration 1 of 3")
+	if code, resp := postFireStop(t, svc, `{"mode":"after-iteration"}`); code != http.StatusOK || !resp.Stopping {
+		t.Fatalf("unexpected stop response: %d %+v", code, resp)
+	}
+	if err := os.WriteFile(filepath.Join(root, "finish-iteration"), nil, 0o644); err != nil {
+		t.Fatalf("write finish-iteration: %v", err)
+	}
+	waitForProgress(t, hub, runID, "iteration_finished")
+
+	events := waitForRunFinished(t, hub, runID)
+	_, finished := runFinishedEvent(t, events)
+	if finished["reason"] != "stopped" {
+		t.Fatalf("expected the run to stop, got %+v", finished)
+	}
+	var started []any
+	for _, ev := range events {
+		if data, _ := ev.Data.(map[string]any); ev.Type == "progress" && data["phase"] == "iteration_started" {
+			started = append(started, data["iteration"])
+		}
+	}
+	if len(started) != 1 || slices.Contains(stdoutLines(events), "Ralph Iteration 2 of 3") {
+		t.Fatalf("expected the script to stop between iterations 1 and 2, got iterations %v, output %q", started, stdoutLines(events))
+	}
+}
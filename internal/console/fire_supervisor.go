@@ -0,0 +1,172 @@
+package console
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FireSupervisorCommand is the hidden console subcommand that runs
+// RunFireSupervisor.
+const FireSupervisorCommand = "fire-supervise"
+
+// fireDrainTimeout bounds how long the supervisor reads output after the
+// command exits; descendants left in the background may hold the pipes open
+// indefinitely.
+const fireDrainTimeout = 2 * time.Second
+
+// fireSupervisorRecord is one line of a detached run's log. Exactly one of
+// Stream (with Text), PID or Exit is set.
+type fireSupervisorRecord struct {
+	TS string `json:"ts"`
+	// Stream is "stdout" or "stderr".
+	Stream string `json:"stream,omitempty"`
+	Text   string `json:"text,omitempty"`
+	// PID is the supervised command, logged once it has started.
+	PID  int                 `json:"pid,omitempty"`
+	Exit *fireSupervisorExit `json:"exit,omitempty"`
+}
+
+type fireSupervisorExit struct {
+	Code   *int   `json:"code"`
+	Signal string `json:"signal,omitempty"`
+	// Error is set when the command could not be started.
+	Error string `json:"error,omitempty"`
+}
+
+type supervisorLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *supervisorLog) write(rec fireSupervisorRecord) {
+	rec.TS = time.Now().UTC().Format(time.RFC3339Nano)
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(line, '\n'))
+}
+
+func (l *supervisorLog) copyLines(stream string, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		l.write(fireSupervisorRecord{Stream: stream, Text: sc.Text()})
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+		l.write(fireSupervisorRecord{Stream: "stderr", Text: fmt.Sprintf("fire-supervise: %s: %v", stream, err)})
+		// Keep draining so the command never blocks on a full pipe.
+		_, _ = io.Copy(io.Discard, r)
+	}
+}
+
+// RunFireSupervisor runs the command of a detached Fire run and returns the
+// process exit code:
+//
+//	fire-supervise -- <command> [args...]
+//
+// It owns the command's stdout and stderr, so the run does not depend on the
+// console that started it, and writes them to its own stdout (the run's log,
+// opened by the console) as JSON lines, followed by the exit status. The command starts once stdin reaches EOF,
+// which gives the console time to apply resource limits first.
+func RunFireSupervisor(args []string) int {
+	fs := flag.NewFlagSet(FireSupervisorCommand, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	argv := fs.Args()
+	if len(argv) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s -- <command> [args...]\n", FireSupervisorCommand)
+		return 2
+	}
+	out := &supervisorLog{w: os.Stdout}
+
+	// The supervisor shares the command's process group. A Stop interrupts the
+	// whole group; the supervisor stays to record how the command exited.
+	signals := make(chan os.Signal, 4)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	_, _ = io.Copy(io.Discard, os.Stdin)
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
+		out.write(fireSupervisorRecord{Exit: &fireSupervisorExit{Error: err.Error()}})
+		return 1
+	}
+	stderr, stderrW, err := os.Pipe()
+	if err != nil {
+		out.write(fireSupervisorRecord{Exit: &fireSupervisorExit{Error: err.Error()}})
+		return 1
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	err = cmd.Start()
+	_ = stdoutW.Close()
+	_ = stderrW.Close()
+	if err != nil {
+		out.write(fireSupervisorRecord{Exit: &fireSupervisorExit{Error: err.Error()}})
+		return 1
+	}
+	out.write(fireSupervisorRecord{PID: cmd.Process.Pid})
+
+	go func() {
+		for sig := range signals {
+			if sig != os.Interrupt {
+				_ = cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	drained := make(chan struct{})
+	var pipes sync.WaitGroup
+	pipes.Add(2)
+	go func() {
+		defer pipes.Done()
+		out.copyLines("stdout", stdout)
+	}()
+	go func() {
+		defer pipes.Done()
+		out.copyLines("stderr", stderr)
+	}()
+	go func() {
+		pipes.Wait()
+		close(drained)
+	}()
+
+	err = cmd.Wait()
+	// Descendants that outlive the command may hold the pipes open.
+	select {
+	case <-drained:
+	case <-time.After(fireDrainTimeout):
+		_ = stdout.Close()
+		_ = stderr.Close()
+		<-drained
+	}
+
+	exit := &fireSupervisorExit{}
+	code := cmd.ProcessState.ExitCode()
+	if runtime.GOOS != "windows" {
+		if c, sig, ok := parseUnixExitStatus(err); ok {
+			code = c
+			exit.Signal = sig
+		}
+	}
+	if exit.Signal == "" {
+		exit.Code = &code
+	}
+	out.write(fireSupervisorRecord{Exit: exit})
+	return 0
+}
@@ -138,6 +138,24 @@ func TestFireService_StartHandler_RejectsBadTool(t *testing.T) {
 	}
 }
 
+func TestFireService_StartHandler_EnforcesConfiguredIterationCap(t *testing.T) {
+	root := t.TempDir()
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 10, SubscriberBufSize: 4})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, MaxIterationsCap: 5})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 6})
+	req := httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "between 1 and 5") {
+		t.Fatalf("expected 400 mentioning the cap, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 func TestFireService_StartHandler_RejectsConcurrentRun(t *testing.T) {
 	root := t.TempDir()
 	if err := os.WriteFile(filepath.Join(root, "prd.json"), []byte(`{}`+"\n"), 0644); err != nil {
@@ -365,6 +383,7 @@ func TestFireService_EmitsProgressEventsAndDetectsComplete(t *testing.T) {
 	}
 
 	var sawIterStart bool
+	var sawIterDone bool
 	var sawComplete bool
 	var completeCount int
 
@@ -394,6 +413,9 @@ func TestFireService_EmitsProgressEventsAndDetectsComplete(t *testing.T) {
 		if phase == "iteration_started" {
 			sawIterStart = true
 		}
+		if phase == "iteration_finished" {
+			sawIterDone = true
+		}
 		if phase == "complete_detected" {
 			completeCount++
 			sawComplete = true
@@ -406,6 +428,9 @@ func TestFireService_EmitsProgressEventsAndDetectsComplete(t *testing.T) {
 	if !sawIterStart {
 		t.Fatalf("expected to see iteration_started progress event; got %d total events", len(events))
 	}
+	if !sawIterDone {
+		t.Fatalf("expected \"Iteration 1 complete.\" to produce iteration_finished; got %d total events", len(events))
+	}
 	if !sawComplete {
 		t.Fatalf("expected to see complete_detected progress event; got %d total events", len(events))
 	}
@@ -413,3 +438,36 @@ func TestFireService_EmitsProgressEventsAndDetectsComplete(t *testing.T) {
 		t.Fatalf("expected exactly 1 complete_detected event, got %d", completeCount)
 	}
 }
+
+func TestFireService_FinishesWhileDescendantsHoldOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash")
+	}
+	root := t.TempDir()
+	writeConfigFile(t, filepath.Join(root, "prd.json"), `{"userStories":[]}`)
+	// The background sleep inherits stdout and stderr and outlives the script;
+	// the run ends with the script regardless.
+	writeConfigFile(t, filepath.Join(root, "ralph-codex.sh"), "#!/usr/bin/env bash\necho before exit\nsleep 30 &\nexit 0\n")
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	runID := startFireRun(t, svc, FireStartRequest{Tool: "codex", MaxIterations: 1})
+	events := waitForRunFinished(t, hub, runID)
+	started, _ := events[0].Data.(map[string]any)
+	if pid, ok := started["pid"].(int); ok {
+		t.Cleanup(func() { _ = sendKillToProcessGroup(pid, 0) })
+	}
+	if lines := stdoutLines(events); len(lines) != 1 || lines[0] != "before exit" {
+		t.Fatalf("expected the output written before exit, got %q", lines)
+	}
+	ev, data := runFinishedEvent(t, events)
+	if ev.Level != "info" || data["exitCode"] != 0 {
+		t.Fatalf("unexpected run_finished: %+v", data)
+	}
+	if ms, _ := data["durationMs"].(int64); ms > time.Second.Milliseconds() {
+		t.Fatalf("expected run_finished once the script exited, took %dms", ms)
+	}
+}
@@ -0,0 +1,446 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultFireVerifyTimeout bounds a verification command without its own timeout.
+const DefaultFireVerifyTimeout = 10 * time.Minute
+
+// maxVerifyNotesBytes bounds the failure output copied into a story's notes.
+const maxVerifyNotesBytes = 4 << 10
+
+// verifyNotesPrefix starts the block the console writes into a reverted
+// story's notes; an older block is replaced rather than accumulated.
+const verifyNotesPrefix = "[verify] "
+
+// FireVerifyCommand is a project check the console runs after every loop
+// iteration, e.g. {"name":"typecheck","argv":["npm","run","typecheck"]}.
+// Argv runs in the project root without a shell.
+type FireVerifyCommand struct {
+	Name    string   `json:"name,omitempty"`
+	Argv    []string `json:"argv"`
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+func (c FireVerifyCommand) displayName() string {
+	if name := strings.TrimSpace(c.Name); name != "" {
+		return name
+	}
+	return strings.Join(c.Argv, " ")
+}
+
+// ValidateFireVerifyCommands reports the first malformed command.
+func ValidateFireVerifyCommands(cmds []FireVerifyCommand) error {
+	seen := make(map[string]bool, len(cmds))
+	for i, c := range cmds {
+		if len(c.Argv) == 0 || strings.TrimSpace(c.Argv[0]) == "" {
+			return fmt.Errorf("command %d: argv must name a program", i+1)
+		}
+		if c.Timeout < 0 {
+			return fmt.Errorf("command %q: timeout must not be negative", c.displayName())
+		}
+		name := c.displayName()
+		if seen[name] {
+			return fmt.Errorf("command %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// parseFireVerifyEnv reads one command per line, split on whitespace (no
+// quoting), e.g. "go test ./...\nnpm run typecheck".
+func parseFireVerifyEnv(v string) []FireVerifyCommand {
+	var cmds []FireVerifyCommand
+	for _, line := range strings.Split(v, "\n") {
+		if argv := strings.Fields(line); len(argv) > 0 {
+			cmds = append(cmds, FireVerifyCommand{Argv: argv})
+		}
+	}
+	return cmds
+}
+
+// fireVerifyResult summarises the checks run after one iteration.
+type fireVerifyResult struct {
+	ran      bool
+	ok       bool
+	failed   string
+	exitCode int
+	timedOut bool
+	output   string
+}
+
+// verifyIteration runs the configured commands in order, stopping at the
+// first failure, and reverts stories the agent marked as passing during the
+// iteration when verification fails. before holds the passes flags read
+// before the agent ran.
+func (s *FireService) verifyIteration(runID string, iteration int, before map[string]bool) fireVerifyResult {
+	res := fireVerifyResult{ok: true}
+	for _, vc := range s.verify {
+		if s.stopRequested(runID) {
+			break
+		}
+		res.ran = true
+		name := vc.displayName()
+		s.hub.Publish(StreamEvent{RunID: runID, Type: "step_started", Step: "verify", Level: "info", Data: map[string]any{
+			"step":      "verify",
+			"name":      name,
+			"argv":      vc.Argv,
+			"iteration": iteration,
+		}})
+
+		startedAt := time.Now()
+		timeout := time.Duration(vc.Timeout)
+		if timeout <= 0 {
+			timeout = DefaultFireVerifyTimeout
+		}
+		exitCode := -1
+		var output string
+		var timedOut bool
+		cmd, err := s.exec.CommandContext(context.Background(), s.rootAbs, vc.Argv[0], vc.Argv[1:]...)
+		if err == nil {
+			output, timedOut, err = s.runStreamed(runID, "verify", cmd, nil, timeout)
+		}
+		if err == nil && cmd.ProcessState != nil {
+			exitCode = cmd.ProcessState.ExitCode()
+		}
+		ok := err == nil && exitCode == 0 && !timedOut
+
+		finished := map[string]any{
+			"step":       "verify",
+			"name":       name,
+			"iteration":  iteration,
+			"ok":         ok,
+			"exitCode":   exitCode,
+			"timedOut":   timedOut,
+			"durationMs": time.Since(startedAt).Milliseconds(),
+		}
+		level := "info"
+		if err != nil {
+			finished["error"] = err.Error()
+			output = err.Error()
+		}
+		if !ok {
+			level = "warn"
+		}
+		s.hub.Publish(StreamEvent{RunID: runID, Type: "step_finished", Step: "verify", Level: level, Data: finished})
+
+		if !ok {
+			res = fireVerifyResult{ran: true, ok: false, failed: name, exitCode: exitCode, timedOut: timedOut, output: output}
+			break
+		}
+	}
+	if !res.ran {
+		return res
+	}
+
+	progress := map[string]any{"phase": "verify_finished", "verified": res.ok}
+	level := "info"
+	if res.ok {
+		progress["note"] = "Verification passed."
+	} else {
+		level = "warn"
+		progress["failed"] = res.failed
+		progress["note"] = fmt.Sprintf("Verification failed: %s.", res.failed)
+		reverted, backupID, err := s.revertClaimedStories(iteration, before, res)
+		switch {
+		case err != nil:
+			progress["note"] = fmt.Sprintf("Verification failed: %s. Could not revert prd.json: %v", res.failed, err)
+		case len(reverted) > 0:
+			progress["reverted"] = reverted
+			progress["backupId"] = backupID
+			progress["note"] = fmt.Sprintf("Verification failed: %s. Set passes:false for %s.", res.failed, strings.Join(reverted, ", "))
+		}
+	}
+	s.publishFireProgress(runID, level, progress)
+	return res
+}
+
+// acceptComplete cross-checks a COMPLETE claim against prd.json and the
+// verification that followed it. A rejected claim publishes
+// progress{phase:"complete_rejected"} and clears completeDetected; an
+// accepted one returns the run_finished reason.
+func (s *FireService) acceptComplete(runID string, verified fireVerifyResult) (string, bool) {
+	data := map[string]any{"phase": "complete_rejected", "completeDetected": false}
+	var problems []string
+	prd, apiErr, _ := loadPRD(s.paths)
+	if apiErr != nil {
+		problems = append(problems, "prd.json could not be read ("+apiErr.Message+")")
+	} else {
+		var pending []string
+		for _, us := range prd.UserStories {
+			if !us.Passes {
+				pending = append(pending, us.ID)
+			}
+		}
+		if len(pending) > 0 {
+			data["pending"] = pending
+			problems = append(problems, fmt.Sprintf("%s still passes:false", strings.Join(pending, ", ")))
+		}
+	}
+	if verified.ran && !verified.ok {
+		data["verifyFailed"] = verified.failed
+		problems = append(problems, "verification failed ("+verified.failed+")")
+	}
+	if len(problems) == 0 {
+		if verified.ran {
+			return fireReasonCompletedVerified, true
+		}
+		return fireReasonCompletedUnverified, true
+	}
+
+	s.mu.Lock()
+	if s.active != nil && s.active.runID == runID {
+		s.active.complete = false
+	}
+	s.mu.Unlock()
+	data["note"] = "Ignoring <promise>COMPLETE</promise>: " + strings.Join(problems, "; ") + "."
+	s.publishFireProgress(runID, "warn", data)
+	return "", false
+}
+
+// scriptReachedMax reports whether ralph-codex.sh announced it ran out of
+// iterations.
+func (s *FireService) scriptReachedMax(runID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active != nil && s.active.runID == runID && s.active.maxReached
+}
+
+// storyPasses returns the passes flag of every story in prd.json, or nil when
+// it cannot be read.
+func (s *FireService) storyPasses() map[string]bool {
+	prd, apiErr, _ := loadPRD(s.paths)
+	if apiErr != nil {
+		return nil
+	}
+	passes := make(map[string]bool, len(prd.UserStories))
+	for _, us := range prd.UserStories {
+		passes[us.ID] = us.Passes
+	}
+	return passes
+}
+
+// revertClaimedStories sets passes:false on stories that started passing
+// during the iteration and records the failure in their notes. The rest of
+// prd.json is kept byte for byte.
+func (s *FireService) revertClaimedStories(iteration int, before map[string]bool, res fireVerifyResult) ([]string, string, error) {
+	if before == nil {
+		return nil, "", errors.New("prd.json could not be read before the iteration")
+	}
+	abs, apiErr, _ := s.paths.ResolveWrite("prd.json", ConsoleWriteWhitelist)
+	if apiErr != nil {
+		return nil, "", errors.New(apiErr.Message)
+	}
+	raw, _, err := readFileUpTo(abs, DefaultMaxReadBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	var prd ConvertedPRD
+	if err := json.Unmarshal(raw, &prd); err != nil {
+		return nil, "", fmt.Errorf("prd.json: %w", err)
+	}
+	// prd.json is committed and read by the agent: the output gets the same
+	// redaction as the streamed verify lines.
+	if s.hub.redactor != nil {
+		res.output, _ = s.hub.redactor.Redact(res.output)
+	}
+	note := verifyFailureNote(iteration, res)
+	notes := make(map[int]string)
+	var reverted []string
+	for i, us := range prd.UserStories {
+		if !us.Passes || before[us.ID] {
+			continue
+		}
+		notes[i] = replaceVerifyNote(us.Notes, note)
+		reverted = append(reverted, us.ID)
+	}
+	if len(reverted) == 0 {
+		return nil, "", nil
+	}
+
+	data, err := revertStoriesJSON(raw, notes)
+	if err != nil {
+		return nil, "", fmt.Errorf("prd.json: %w", err)
+	}
+	backupID, err := s.backups.WriteFile(abs, data, 0o644, ".verify-*")
+	if err != nil {
+		return nil, "", err
+	}
+	return reverted, backupID, nil
+}
+
+// revertStoriesJSON sets passes to false and notes to notes[i] on the i-th
+// entry of userStories in the prd.json document raw. Only those values are
+// replaced (or notes added); every other field and all formatting survive.
+func revertStoriesJSON(raw []byte, notes map[int]string) ([]byte, error) {
+	type splice struct {
+		start, end int
+		value      []byte
+	}
+	var splices []splice
+	err := jsonObjectMembers(raw, 0, func(key string, start, end int) error {
+		if key != "userStories" {
+			return nil
+		}
+		return jsonArrayElements(raw, start, end, func(i, start, end int) error {
+			note, ok := notes[i]
+			if !ok {
+				return nil
+			}
+			value, err := json.Marshal(note)
+			if err != nil {
+				return err
+			}
+			passesEnd, keyStart, hasNotes := -1, -1, false
+			err = jsonObjectMembers(raw[:end], start, func(key string, start, end int) error {
+				switch key {
+				case "passes":
+					splices = append(splices, splice{start, end, []byte("false")})
+					passesEnd = end
+					keyStart = bytes.LastIndexByte(raw[:start], '"')
+					keyStart = bytes.LastIndexByte(raw[:keyStart], '"')
+				case "notes":
+					splices = append(splices, splice{start, end, value})
+					hasNotes = true
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if passesEnd < 0 {
+				return fmt.Errorf("story %d has no passes field", i)
+			}
+			if !hasNotes {
+				// Add notes after passes, on a line of its own when passes is.
+				lineStart := bytes.LastIndexByte(raw[:keyStart], '\n') + 1
+				sep := []byte(", ")
+				if indent := raw[lineStart:keyStart]; len(bytes.TrimLeft(indent, " \t")) == 0 {
+					sep = append([]byte(",\n"), indent...)
+				}
+				added := append(append(sep, `"notes": `...), value...)
+				splices = append(splices, splice{passesEnd, passesEnd, added})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(splices, func(a, b int) bool { return splices[a].start < splices[b].start })
+	var out bytes.Buffer
+	last := 0
+	for _, sp := range splices {
+		out.Write(raw[last:sp.start])
+		out.Write(sp.value)
+		last = sp.end
+	}
+	out.Write(raw[last:])
+	return out.Bytes(), nil
+}
+
+// jsonObjectMembers calls fn with the key and value span of each member of
+// the object starting at raw[offset:].
+func jsonObjectMembers(raw []byte, offset int, fn func(key string, start, end int) error) error {
+	dec := json.NewDecoder(bytes.NewReader(raw[offset:]))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return errors.New("expected an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		end := offset + int(dec.InputOffset())
+		if err := fn(key, end-len(value), end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonArrayElements calls fn with the index and span of each element of the
+// array raw[start:end].
+func jsonArrayElements(raw []byte, start, end int, fn func(i, start, end int) error) error {
+	dec := json.NewDecoder(bytes.NewReader(raw[start:end]))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return errors.New("userStories is not an array")
+	}
+	for i := 0; dec.More(); i++ {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		elemEnd := start + int(dec.InputOffset())
+		if err := fn(i, elemEnd-len(value), elemEnd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyFailureNote(iteration int, res fireVerifyResult) string {
+	status := fmt.Sprintf("exited with code %d", res.exitCode)
+	if res.timedOut {
+		status = "timed out"
+	}
+	note := fmt.Sprintf("%sIteration %d: %s %s.", verifyNotesPrefix, iteration, res.failed, status)
+	if out := verifyOutputTail(res.output); out != "" {
+		note += "\n" + out
+	}
+	return note
+}
+
+// verifyOutputTail keeps the last maxVerifyNotesBytes of output, starting at
+// a line boundary when possible.
+func verifyOutputTail(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxVerifyNotesBytes {
+		output = output[len(output)-maxVerifyNotesBytes:]
+		if i := strings.IndexByte(output, '\n'); i >= 0 && i < len(output)-1 {
+			output = output[i+1:]
+		}
+		for len(output) > 0 && !utf8.RuneStart(output[0]) {
+			output = output[1:]
+		}
+	}
+	return strings.ToValidUTF8(output, "")
+}
+
+// replaceVerifyNote appends note to notes, dropping an earlier [verify] block.
+func replaceVerifyNote(notes string, note string) string {
+	if strings.HasPrefix(notes, verifyNotesPrefix) {
+		notes = ""
+	} else if i := strings.Index(notes, "\n\n"+verifyNotesPrefix); i >= 0 {
+		notes = notes[:i]
+	}
+	notes = strings.TrimSpace(notes)
+	if notes == "" {
+		return note
+	}
+	return notes + "\n\n" + note
+}
+
+// verifyArgvs lists the argv of each command, for ExecPolicy.withCommands.
+func verifyArgvs(cmds []FireVerifyCommand) [][]string {
+	out := make([][]string, 0, len(cmds))
+	for _, c := range cmds {
+		out = append(out, c.Argv)
+	}
+	return out
+}
@@ -0,0 +1,316 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFireService_VerifyRevertsUnverifiedStories(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent is a shell script")
+	}
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	// Every call marks all stories as passing; the check only succeeds once
+	// the second call has created "fixed".
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\n"+
+		"cat >/dev/null\n"+
+		"echo 'tokens used 1'\n"+
+		"if [ -f calls ]; then cp prd.json prd.after1; touch fixed; fi\n"+
+		"sed 's/\"passes\": false/\"passes\": true/g' prd.json > prd.tmp && mv prd.tmp prd.json\n"+
+		"echo x >> calls\n")
+	installFakeAgent(t, "fakecheck", "#!/usr/bin/env bash\n"+
+		"if [ -f fixed ]; then echo ok; exit 0; fi\n"+
+		"echo 'FAIL: TestLogin' >&2\nexit 3\n")
+
+	backups, err := NewBackupStore(BackupConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewBackupStore: %v", err)
+	}
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{
+		ProjectRoot: root,
+		Hub:         hub,
+		Prompts:     newTestPromptStore(t, root),
+		Verify:      []FireVerifyCommand{{Name: "unit", Argv: []string{"fakecheck", "--all"}}},
+		Backups:     backups,
+	})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 3, Mode: "single-story", StoryIDs: []string{"US-002"}})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FireStartResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	events := waitForRunFinished(t, hub, resp.RunID)
+	var verifyOK []bool
+	var verified []map[string]any
+	var verifyOutput []string
+	var finished map[string]any
+	for _, ev := range events {
+		data, _ := ev.Data.(map[string]any)
+		switch {
+		case ev.Type == "step_finished" && ev.Step == "verify":
+			verifyOK = append(verifyOK, data["ok"] == true)
+		case ev.Type == "process_stderr" && ev.Step == "verify":
+			verifyOutput = append(verifyOutput, data["text"].(string))
+		case ev.Type == "progress" && data["phase"] == "verify_finished":
+			verified = append(verified, data)
+		case ev.Type == "run_finished":
+			finished = data
+		}
+	}
+	if len(verifyOK) != 2 || verifyOK[0] || !verifyOK[1] {
+		t.Fatalf("expected verify to fail then pass, got %v", verifyOK)
+	}
+	if len(verifyOutput) != 1 || verifyOutput[0] != "FAIL: TestLogin" {
+		t.Fatalf("expected the check's stderr streamed as a verify step, got %q", verifyOutput)
+	}
+	if reverted, _ := verified[0]["reverted"].([]string); len(reverted) != 2 || reverted[0] != "US-003" || reverted[1] != "US-002" {
+		t.Fatalf("expected US-003 and US-002 reverted, got %+v", verified[0])
+	}
+	if finished["reason"] != "stories_passed" {
+		t.Fatalf("expected the run to end once verified, got %+v", finished)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(root, "prd.after1"))
+	if err != nil {
+		t.Fatalf("read prd.json after iteration 1: %v", err)
+	}
+	var prd ConvertedPRD
+	_ = json.Unmarshal(raw, &prd)
+	us := prd.UserStories[2]
+	if us.ID != "US-002" || us.Passes || us.Notes != "failed review\n\n[verify] Iteration 1: unit exited with code 3.\nFAIL: TestLogin" {
+		t.Fatalf("unexpected reverted story: %+v", us)
+	}
+	if !prd.UserStories[0].Passes {
+		t.Fatalf("a story that already passed must not be reverted")
+	}
+	if list := backups.List("prd.json"); len(list) != 1 {
+		t.Fatalf("expected prd.json to be snapshotted before the revert, got %+v", list)
+	}
+}
+
+func TestFireService_RevertKeepsOtherPRDFieldsAndRedactsOutput(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	prd := "{\n" +
+		"    \"project\": \"demo\",\n" +
+		"    \"owner\": {\"team\": \"web\"},\n" +
+		"    \"userStories\": [\n" +
+		"        {\"id\": \"US-001\", \"passes\": true, \"notes\": \"done\", \"estimate\": 3},\n" +
+		"        {\n" +
+		"            \"id\": \"US-002\",\n" +
+		"            \"passes\": true,\n" +
+		"            \"labels\": [\"auth\"]\n" +
+		"        }\n" +
+		"    ]\n" +
+		"}\n"
+	writeConfigFile(t, filepath.Join(root, "prd.json"), prd)
+	backups, err := NewBackupStore(BackupConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewBackupStore: %v", err)
+	}
+	redactor, err := NewRedactor(RedactConfig{Patterns: []string{"hunter2"}})
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 10, SubscriberBufSize: 4, Redactor: redactor})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Backups: backups})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	res := fireVerifyResult{failed: "unit", exitCode: 1, output: "login failed with password hunter2"}
+	reverted, _, err := svc.revertClaimedStories(2, map[string]bool{"US-001": false, "US-002": false}, res)
+	if err != nil || len(reverted) != 2 {
+		t.Fatalf("revertClaimedStories: %v %v", reverted, err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(root, "prd.json"))
+	got := string(raw)
+	if strings.Contains(got, "hunter2") || !strings.Contains(got, "[REDACTED") {
+		t.Fatalf("expected the verify output to be redacted in the notes:\n%s", got)
+	}
+	note := `"[verify] Iteration 2: unit exited with code 1.\n` + "login failed with password [REDACTED:custom]\""
+	want := strings.NewReplacer(
+		`"passes": true, "notes": "done"`, `"passes": false, "notes": "done\n\n`+note[1:],
+		"\"passes\": true,\n", "\"passes\": false,\n            \"notes\": "+note+",\n",
+	).Replace(prd)
+	if got != want {
+		t.Fatalf("expected only passes and notes to change, got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestReplaceVerifyNote(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct{ notes, want string }{
+		{"", "[verify] new"},
+		{"review: fix login", "review: fix login\n\n[verify] new"},
+		{"review\n\n[verify] Iteration 1: old\nFAIL", "review\n\n[verify] new"},
+		{"[verify] Iteration 1: old", "[verify] new"},
+	}
+	for _, tc := range cases {
+		if got := replaceVerifyNote(tc.notes, "[verify] new"); got != tc.want {
+			t.Fatalf("replaceVerifyNote(%q) = %q, want %q", tc.notes, got, tc.want)
+		}
+	}
+	long := strings.Repeat("x", maxVerifyNotesBytes) + "\nlast line"
+	if got := verifyOutputTail(long); got != "last line" {
+		t.Fatalf("expected the tail to start at a line boundary, got %q", got)
+	}
+}
+
+func TestExecPolicy_WithCommands(t *testing.T) {
+	t.Parallel()
+
+	cmds := parseFireVerifyEnv("go test ./...\n\n  npm run   typecheck \n")
+	if len(cmds) != 2 || strings.Join(cmds[1].Argv, "|") != "npm|run|typecheck" {
+		t.Fatalf("unexpected parsed commands: %+v", cmds)
+	}
+	policy := consoleExecPolicy.withCommands(verifyArgvs(append(cmds, FireVerifyCommand{Argv: []string{"ps", "aux"}}))...)
+	dir := t.TempDir()
+	for _, argv := range [][]string{{"go", "test", "./..."}, {"npm", "run", "typecheck"}, {"ps", "aux"}, {"ps", "-eo", "pid=,ppid="}} {
+		if _, err := policy.CommandContext(context.Background(), dir, argv[0], argv[1:]...); err != nil {
+			t.Fatalf("%q should be allowed: %v", argv, err)
+		}
+	}
+	for _, argv := range [][]string{{"go", "test", "./...", "-run", "X"}, {"npm", "install"}, {"rm", "-rf", "/"}} {
+		if _, err := policy.CommandContext(context.Background(), dir, argv[0], argv[1:]...); !errors.Is(err, ErrExecDenied) {
+			t.Fatalf("%q should be denied, got %v", argv, err)
+		}
+	}
+	if _, err := consoleExecPolicy.CommandContext(context.Background(), dir, "go", "test", "./..."); !errors.Is(err, ErrExecDenied) {
+		t.Fatalf("the base policy must not change, got %v", err)
+	}
+	if err := ValidateFireVerifyCommands([]FireVerifyCommand{{Argv: []string{"go", "vet"}}, {Name: "go vet", Argv: []string{"x"}}}); err == nil {
+		t.Fatalf("expected duplicate names to be rejected")
+	}
+}
+
+// runFireToEnd starts a run and returns its events and run_finished data.
+func runFireToEnd(t *testing.T, svc *FireService, hub *StreamHub, req FireStartRequest) ([]StreamEvent, map[string]any) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FireStartResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	events := waitForRunFinished(t, hub, resp.RunID)
+	for _, ev := range events {
+		if ev.Type == "run_finished" {
+			data, _ := ev.Data.(map[string]any)
+			return events, data
+		}
+	}
+	return events, nil
+}
+
+func completeRejections(events []StreamEvent) []map[string]any {
+	var out []map[string]any
+	for _, ev := range events {
+		if data, _ := ev.Data.(map[string]any); ev.Type == "progress" && data["phase"] == "complete_rejected" {
+			out = append(out, data)
+		}
+	}
+	return out
+}
+
+func TestFireService_LoopRejectsUnverifiedComplete(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent is a shell script")
+	}
+	pause := fireLoopIterationPause
+	fireLoopIterationPause = 0
+	t.Cleanup(func() { fireLoopIterationPause = pause })
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	// Always claims COMPLETE. From the second call on it marks every story
+	// as passing; the check only succeeds from the third call on.
+	installFakeAgent(t, "codex", "#!/usr/bin/env bash\n"+
+		"cat >/dev/null\n"+
+		"echo 'tokens used 1'\n"+
+		"n=$(cat calls 2>/dev/null | wc -l)\n"+
+		"if [ \"$n\" -ge 1 ]; then sed 's/\"passes\": false/\"passes\": true/g' prd.json > prd.tmp && mv prd.tmp prd.json; fi\n"+
+		"if [ \"$n\" -ge 2 ]; then touch fixed; fi\n"+
+		"echo '"+PromptCompleteMarker+"'\n"+
+		"echo x >> calls\n")
+	installFakeAgent(t, "fakecheck", "#!/usr/bin/env bash\n[ -f fixed ] || { echo 'FAIL' >&2; exit 1; }\n")
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, _ := NewFireService(FireConfig{
+		ProjectRoot: root,
+		Hub:         hub,
+		Prompts:     newTestPromptStore(t, root),
+		Verify:      []FireVerifyCommand{{Argv: []string{"fakecheck"}}},
+	})
+
+	events, finished := runFireToEnd(t, svc, hub, FireStartRequest{Tool: "codex", MaxIterations: 1, Mode: "loop"})
+	rejected := completeRejections(events)
+	if len(rejected) != 1 || finished["reason"] != fireReasonIncomplete || finished["ok"] != false {
+		t.Fatalf("expected a rejected claim ending as incomplete, got %+v %+v", rejected, finished)
+	}
+	if pending, _ := rejected[0]["pending"].([]string); len(pending) != 2 || rejected[0]["completeDetected"] != false {
+		t.Fatalf("expected the pending stories in complete_rejected, got %+v", rejected[0])
+	}
+
+	events, finished = runFireToEnd(t, svc, hub, FireStartRequest{Tool: "codex", MaxIterations: 5, Mode: "loop"})
+	rejected = completeRejections(events)
+	if len(rejected) != 1 || rejected[0]["verifyFailed"] != "fakecheck" {
+		t.Fatalf("expected the claim after failed verification to be rejected, got %+v", rejected)
+	}
+	if finished["reason"] != fireReasonCompletedVerified || finished["ok"] != true {
+		t.Fatalf("expected completed_verified, got %+v", finished)
+	}
+}
+
+func TestFireService_ScriptModeChecksCompleteClaim(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake script is a bash script")
+	}
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	script := "#!/usr/bin/env bash\n" +
+		"if [ -f done ]; then echo 'Ralph reached max iterations (1) without completing all tasks.'; exit 1; fi\n" +
+		"touch done\n" +
+		"echo 'assistant " + PromptCompleteMarker + "'\n" +
+		"echo 'Ralph completed all tasks!'\n"
+	if err := os.WriteFile(filepath.Join(root, "ralph-codex.sh"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write ralph-codex.sh: %v", err)
+	}
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 500, SubscriberBufSize: 16})
+	svc, _ := NewFireService(FireConfig{ProjectRoot: root, Hub: hub})
+
+	events, finished := runFireToEnd(t, svc, hub, FireStartRequest{Tool: "codex", MaxIterations: 1})
+	if len(completeRejections(events)) != 1 || finished["reason"] != fireReasonIncomplete {
+		t.Fatalf("expected the script's COMPLETE to be rejected while stories are pending, got %+v", finished)
+	}
+	_, finished = runFireToEnd(t, svc, hub, FireStartRequest{Tool: "codex", MaxIterations: 1})
+	if finished["reason"] != fireReasonMaxIterations || finished["ok"] != false {
+		t.Fatalf("expected max_iterations, got %+v", finished)
+	}
+}
@@ -0,0 +1,99 @@
+package console
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+const maxFSListEntries = 1000
+
+type FSListEntry struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Type    string `json:"type"` // "file" or "dir"
+	Size    int64  `json:"size,omitempty"`
+	ModTime string `json:"modTime"`
+}
+
+type FSListResponse struct {
+	Dir       string        `json:"dir"`
+	Entries   []FSListEntry `json:"entries"`
+	Truncated bool          `json:"truncated"`
+}
+
+func FSListHandler(reader *FSReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, apiErr, status := reader.ListDir(r.URL.Query().Get("dir"))
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// ListDir lists the readable files in dir, and the subdirectories that can
+// contain readable files, according to the read whitelist. Entries whose
+// symlinks resolve outside the project root are omitted.
+func (r *FSReader) ListDir(dir string) (FSListResponse, *APIError, int) {
+	realDir, apiErr, status := r.paths.ResolveReadDir(dir)
+	if apiErr != nil {
+		return FSListResponse{}, apiErr, status
+	}
+	clean := ""
+	if dir != "" {
+		if clean = path.Clean(dir); clean == "." {
+			clean = ""
+		}
+	}
+	if !r.whitelist.AllowsDescendant(clean) {
+		return FSListResponse{}, &APIError{
+			Code:    "FS_READ_NOT_ALLOWED",
+			Message: "Directory not allowed.",
+			Hint:    "No readable path pattern lies under this directory.",
+		}, http.StatusForbidden
+	}
+
+	dirEntries, err := os.ReadDir(realDir)
+	if err != nil {
+		return FSListResponse{}, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to list directory.",
+			Hint:    "Check directory permissions and try again.",
+		}, http.StatusInternalServerError
+	}
+
+	resp := FSListResponse{Dir: clean, Entries: []FSListEntry{}}
+	for _, de := range dirEntries {
+		rel := path.Join(clean, de.Name())
+		real, exists, apiErr, _ := r.paths.resolve(rel, nil, safePathRead)
+		if apiErr != nil || !exists {
+			continue
+		}
+		info, err := os.Stat(real)
+		if err != nil {
+			continue
+		}
+		entry := FSListEntry{Name: de.Name(), Path: rel, ModTime: info.ModTime().UTC().Format(time.RFC3339)}
+		switch {
+		case info.Mode().IsRegular() && r.whitelist.Allows(rel):
+			entry.Type = "file"
+			entry.Size = info.Size()
+		case info.IsDir() && r.whitelist.AllowsDescendant(rel):
+			entry.Type = "dir"
+		default:
+			continue
+		}
+		if len(resp.Entries) == maxFSListEntries {
+			resp.Truncated = true
+			break
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+	return resp, nil, http.StatusOK
+}
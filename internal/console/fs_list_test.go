@@ -0,0 +1,118 @@
+package console
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFSReader_ListDir(t *testing.T) {
+	root := t.TempDir()
+	for rel, content := range map[string]string{
+		"prd.json":                      "{}",
+		"README.md":                     "no",
+		"AGENTS.md":                     "agents",
+		"tasks/prd-a.md":                "# a",
+		"tasks/notes.txt":               "no",
+		"archive/2025-01-01-x/prd.json": "{}",
+		"src/main.go":                   "package main",
+	} {
+		abs := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+			t.Fatalf("MkdirAll error: %v", err)
+		}
+		if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+	}
+	outside := t.TempDir()
+	_ = os.WriteFile(filepath.Join(outside, "prd-out.md"), []byte("secret"), 0o644)
+	symlinks := os.Symlink(filepath.Join(outside, "prd-out.md"), filepath.Join(root, "tasks", "prd-out.md")) == nil
+
+	reader, err := NewFSReader(FSReadConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewFSReader error: %v", err)
+	}
+	h := FSListHandler(reader)
+	list := func(dir string) (int, FSListResponse, string) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/fs/list?dir="+dir, nil))
+		var resp FSListResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp, rr.Body.String()
+	}
+	names := func(resp FSListResponse) string {
+		var out []string
+		for _, e := range resp.Entries {
+			out = append(out, e.Type+":"+e.Path)
+		}
+		return strings.Join(out, ",")
+	}
+
+	// src/ is listed because **/AGENTS.md could match below it.
+	if code, resp, body := list(""); code != http.StatusOK || names(resp) != "file:AGENTS.md,dir:archive,file:prd.json,dir:src,dir:tasks" {
+		t.Fatalf("unexpected root listing: %d %s", code, body)
+	}
+	code, resp, body := list("tasks")
+	if code != http.StatusOK || names(resp) != "file:tasks/prd-a.md" {
+		t.Fatalf("unexpected tasks listing (symlinks=%v): %d %s", symlinks, code, body)
+	}
+	if resp.Entries[0].Size != 3 {
+		t.Fatalf("expected size 3, got %+v", resp.Entries[0])
+	}
+	if _, resp, _ := list("archive/2025-01-01-x"); names(resp) != "file:archive/2025-01-01-x/prd.json" {
+		t.Fatalf("unexpected archive listing: %s", names(resp))
+	}
+
+	for dir, wantCode := range map[string]int{"..": http.StatusForbidden, "missing": http.StatusNotFound, "prd.json": http.StatusBadRequest} {
+		if code, _, body := list(dir); code != wantCode {
+			t.Fatalf("dir=%q: expected %d, got %d %s", dir, wantCode, code, body)
+		}
+	}
+
+	narrow, _ := NewFSReader(FSReadConfig{ProjectRoot: root, Whitelist: PathWhitelist{"prd.json"}})
+	if _, apiErr, status := narrow.ListDir("tasks"); apiErr == nil || status != http.StatusForbidden {
+		t.Fatalf("expected tasks/ to be unlistable with a narrow whitelist, got %d %+v", status, apiErr)
+	}
+}
+
+func TestFSReader_ConfiguredWhitelistKeepsProtections(t *testing.T) {
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "docs"), 0o755)
+	_ = os.WriteFile(filepath.Join(root, "docs", "a.md"), []byte("# ok"), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "docs", "big.md"), []byte(strings.Repeat("x", 64)), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "docs", "bin.md"), []byte{0xff, 0xfe}, 0o644)
+
+	reader, err := NewFSReader(FSReadConfig{ProjectRoot: root, MaxBytes: 32, Whitelist: PathWhitelist{"docs/**/*.md"}})
+	if err != nil {
+		t.Fatalf("NewFSReader error: %v", err)
+	}
+	if resp, apiErr, _ := reader.ReadWhitelistedText("docs/a.md"); apiErr != nil || resp.Content != "# ok" {
+		t.Fatalf("expected configured pattern to be readable, got %+v", apiErr)
+	}
+	for rel, code := range map[string]string{
+		"docs/big.md": "FS_READ_TOO_LARGE",
+		"docs/bin.md": "FS_READ_UNSUPPORTED_ENCODING",
+		"prd.json":    "FS_READ_NOT_ALLOWED",
+	} {
+		if _, apiErr, _ := reader.ReadWhitelistedText(rel); apiErr == nil || apiErr.Code != code {
+			t.Fatalf("%s: expected %s, got %+v", rel, code, apiErr)
+		}
+	}
+
+	outside := t.TempDir()
+	_ = os.WriteFile(filepath.Join(outside, "s.md"), []byte("secret"), 0o644)
+	if err := os.Symlink(outside, filepath.Join(root, "docs", "linked")); err == nil {
+		if _, apiErr, _ := reader.ReadWhitelistedText("docs/linked/s.md"); apiErr == nil || apiErr.Code != "FS_READ_NOT_ALLOWED" {
+			t.Fatalf("expected symlink escape to be rejected, got %+v", apiErr)
+		}
+	}
+
+	if _, err := NewFSReader(FSReadConfig{ProjectRoot: root, Whitelist: PathWhitelist{"/etc/*"}}); err == nil {
+		t.Fatalf("expected an absolute pattern to be rejected")
+	}
+}
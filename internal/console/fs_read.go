@@ -6,8 +6,7 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
+	"path"
 	"unicode/utf8"
 )
 
@@ -16,12 +15,14 @@ const DefaultMaxReadBytes int64 = 2 << 20 // 2 MiB
 type FSReadConfig struct {
 	ProjectRoot string
 	MaxBytes    int64
+	// Whitelist defaults to FSReadWhitelist.
+	Whitelist PathWhitelist
 }
 
 type FSReader struct {
-	rootAbs  string
-	rootReal string
-	maxBytes int64
+	paths     *SafePath
+	whitelist PathWhitelist
+	maxBytes  int64
 }
 
 type FSReadResponse struct {
@@ -32,16 +33,7 @@ type FSReadResponse struct {
 }
 
 func NewFSReader(cfg FSReadConfig) (*FSReader, error) {
-	if cfg.ProjectRoot == "" {
-		return nil, errors.New("project root is required")
-	}
-
-	rootAbs, err := filepath.Abs(cfg.ProjectRoot)
-	if err != nil {
-		return nil, err
-	}
-
-	rootReal, err := filepath.EvalSymlinks(rootAbs)
+	paths, err := NewSafePath(SafePathConfig{ProjectRoot: cfg.ProjectRoot})
 	if err != nil {
 		return nil, err
 	}
@@ -50,11 +42,18 @@ func NewFSReader(cfg FSReadConfig) (*FSReader, error) {
 	if maxBytes <= 0 {
 		maxBytes = DefaultMaxReadBytes
 	}
+	whitelist := cfg.Whitelist
+	if len(whitelist) == 0 {
+		whitelist = FSReadWhitelist
+	}
+	if err := ValidatePathWhitelist(whitelist); err != nil {
+		return nil, err
+	}
 
 	return &FSReader{
-		rootAbs:  rootAbs,
-		rootReal: rootReal,
-		maxBytes: maxBytes,
+		paths:     paths,
+		whitelist: whitelist,
+		maxBytes:  maxBytes,
 	}, nil
 }
 
@@ -80,92 +79,10 @@ func (r *FSReader) ReadWhitelistedText(relPath string) (FSReadResponse, *APIErro
 			Hint:    "Provide a project-relative path, e.g. tasks/prd-foo.md",
 		}, http.StatusBadRequest
 	}
-	if strings.Contains(relPath, "\x00") {
-		return FSReadResponse{}, &APIError{
-			Code:    "VALIDATION_ERROR",
-			Message: "path must not contain NUL bytes.",
-		}, http.StatusBadRequest
-	}
-	if strings.Contains(relPath, "\\") {
-		return FSReadResponse{}, &APIError{
-			Code:    "VALIDATION_ERROR",
-			Message: "path must use forward slashes (/).",
-			Hint:    "Use a project-relative path like tasks/prd-foo.md (not Windows-style backslashes).",
-		}, http.StatusBadRequest
-	}
-
-	clean := filepath.Clean(relPath)
-	if clean == "." || clean == string(filepath.Separator) {
-		return FSReadResponse{}, &APIError{
-			Code:    "VALIDATION_ERROR",
-			Message: "path must point to a file.",
-		}, http.StatusBadRequest
-	}
-	if filepath.IsAbs(clean) {
-		return FSReadResponse{}, &APIError{
-			Code:    "FS_READ_NOT_ALLOWED",
-			Message: "Absolute paths are not allowed.",
-			Hint:    "Provide a path relative to the project root.",
-		}, http.StatusForbidden
-	}
-	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
-		return FSReadResponse{}, &APIError{
-			Code:    "FS_READ_NOT_ALLOWED",
-			Message: "Path escapes project root.",
-			Hint:    "Remove '..' segments and use a project-relative path.",
-		}, http.StatusForbidden
-	}
-
-	if !isReadWhitelisted(clean) {
-		return FSReadResponse{}, &APIError{
-			Code:    "FS_READ_NOT_ALLOWED",
-			Message: "Path not allowed.",
-			Hint:    "Only tasks/prd-*.md, prd.json, and progress.txt are readable.",
-		}, http.StatusForbidden
-	}
-
-	absPath := filepath.Join(r.rootAbs, clean)
-	realPath, err := filepath.EvalSymlinks(absPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return FSReadResponse{}, &APIError{
-				Code:    "FS_READ_NOT_FOUND",
-				Message: "File not found.",
-			}, http.StatusNotFound
-		}
-		return FSReadResponse{}, &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: "Failed to resolve path.",
-			Hint:    "Check file permissions and try again.",
-		}, http.StatusInternalServerError
-	}
 
-	if !isWithinRoot(r.rootReal, realPath) {
-		return FSReadResponse{}, &APIError{
-			Code:    "FS_READ_NOT_ALLOWED",
-			Message: "Path escapes project root.",
-			Hint:    "Symlink escapes are not allowed; ensure the file resolves within the project root.",
-		}, http.StatusForbidden
-	}
-
-	info, err := os.Stat(realPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return FSReadResponse{}, &APIError{
-				Code:    "FS_READ_NOT_FOUND",
-				Message: "File not found.",
-			}, http.StatusNotFound
-		}
-		return FSReadResponse{}, &APIError{
-			Code:    "INTERNAL_ERROR",
-			Message: "Failed to stat file.",
-		}, http.StatusInternalServerError
-	}
-	if !info.Mode().IsRegular() {
-		return FSReadResponse{}, &APIError{
-			Code:    "FS_READ_NOT_ALLOWED",
-			Message: "Only regular files are readable.",
-		}, http.StatusForbidden
+	realPath, info, apiErr, status := r.paths.ResolveRead(relPath, r.whitelist)
+	if apiErr != nil {
+		return FSReadResponse{}, apiErr, status
 	}
 	if info.Size() > r.maxBytes {
 		return FSReadResponse{}, &APIError{
@@ -197,32 +114,13 @@ func (r *FSReader) ReadWhitelistedText(relPath string) (FSReadResponse, *APIErro
 	}
 
 	return FSReadResponse{
-		Path:      clean,
+		Path:      path.Clean(relPath),
 		Content:   string(content),
 		Size:      size,
 		Truncated: false,
 	}, nil, http.StatusOK
 }
 
-func isReadWhitelisted(relPath string) bool {
-	if relPath == "prd.json" || relPath == "progress.txt" {
-		return true
-	}
-	if !strings.HasPrefix(relPath, "tasks/prd-") || !strings.HasSuffix(relPath, ".md") {
-		return false
-	}
-	rest := strings.TrimPrefix(relPath, "tasks/prd-")
-	return !strings.Contains(rest, "/")
-}
-
-func isWithinRoot(rootReal, candidateReal string) bool {
-	rel, err := filepath.Rel(rootReal, candidateReal)
-	if err != nil {
-		return false
-	}
-	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
-}
-
 var errFileTooLarge = errors.New("file too large")
 
 func readFileUpTo(path string, maxBytes int64) ([]byte, int64, error) {
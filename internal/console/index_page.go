@@ -7,7 +7,13 @@ import (
 
 type IndexPageData struct {
 	SessionToken string
-	ProjectRoot  string
+	// SessionTokenExpiresAt (RFC 3339) tells the page when to refresh the
+	// token; empty means it does not expire.
+	SessionTokenExpiresAt string
+	// ReadAuth is the read auth mode; when not "off" the page also sends its
+	// token on reads and appends it to EventSource URLs.
+	ReadAuth    string
+	ProjectRoot string
 }
 
 var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
@@ -16,6 +22,8 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
     <meta charset="utf-8" />
     <meta name="viewport" content="width=device-width, initial-scale=1" />
     <meta name="ohmyagentflow-session-token" content="{{.SessionToken}}" />
+    <meta name="ohmyagentflow-session-token-expires" content="{{.SessionTokenExpiresAt}}" />
+    <meta name="ohmyagentflow-read-auth" content="{{.ReadAuth}}" />
     <title>Oh My Agent Flow</title>
     <style>
       :root {
@@ -291,6 +299,23 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
       .logrow.bad { color: var(--bad); }
       .logrow.good { color: var(--good); }
       .logrow.warn { color: var(--warn); }
+      .logrow.hit { background: rgba(255,255,255,0.12); }
+      .logsearch {
+        display: flex;
+        gap: 8px;
+        flex-wrap: wrap;
+        align-items: center;
+        margin-bottom: 10px;
+      }
+      .logsearch input[type="text"] { flex: 1; min-width: 160px; }
+      .searchresults {
+        max-height: 160px;
+        overflow: auto;
+        margin-bottom: 10px;
+        font-family: var(--mono);
+        font-size: 12px;
+      }
+      .searchresults .logrow { cursor: pointer; }
 
       .kv {
         display: grid;
@@ -329,18 +354,57 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
     <script>
       (function () {
         const meta = document.querySelector('meta[name="ohmyagentflow-session-token"]');
-        const token = meta && meta.content ? meta.content : '';
+        let token = meta && meta.content ? meta.content : '';
         if (!token) return;
+        const expiresMeta = document.querySelector('meta[name="ohmyagentflow-session-token-expires"]');
+        const readAuthMeta = document.querySelector('meta[name="ohmyagentflow-read-auth"]');
+        const readAuth = readAuthMeta && readAuthMeta.content ? readAuthMeta.content : 'off';
+        // EventSource cannot send headers; streams opened via this helper carry
+        // the current token as a query parameter when read auth is on.
+        window.ohmyagentflowStreamURL = function (path) {
+          if (readAuth === 'off') return path;
+          return path + (path.indexOf('?') >= 0 ? '&' : '?') + 'token=' + encodeURIComponent(token);
+        };
 
         const originalFetch = window.fetch.bind(window);
-        window.fetch = function (input, init) {
-          const requestInit = init || {};
-          const method = (requestInit.method || (input instanceof Request ? input.method : 'GET') || 'GET').toUpperCase();
-          const url = new URL(input instanceof Request ? input.url : String(input), window.location.href);
-          if (method !== 'POST' || !url.pathname.startsWith('/api/')) {
-            return originalFetch(input, requestInit);
-          }
+        // Writes wait for an in-flight refresh so they never race the
+        // revocation of the token being replaced.
+        let refreshing = null;
+
+        function scheduleRefresh(expiresAt) {
+          const at = Date.parse(expiresAt || '');
+          if (!at) return;
+          // Refresh when two thirds of the remaining lifetime has passed.
+          const delay = Math.max(1000, (at - Date.now()) * 2 / 3);
+          setTimeout(refreshToken, delay);
+        }
+
+        function refreshToken() {
+          refreshing = originalFetch('/api/session/refresh', {
+            method: 'POST',
+            headers: { 'X-Session-Token': token },
+          }).then((resp) => resp.ok ? resp.json() : null).then((data) => {
+            if (data && data.token) {
+              token = data.token;
+              scheduleRefresh(data.expiresAt);
+            }
+          }).catch(() => {}).finally(() => { refreshing = null; });
+          return refreshing;
+        }
 
+        scheduleRefresh(expiresMeta && expiresMeta.content);
+        window.addEventListener('pagehide', () => {
+          if (!expiresMeta || !expiresMeta.content) return;
+          originalFetch('/api/session/revoke', { method: 'POST', headers: { 'X-Session-Token': token }, keepalive: true }).catch(() => {});
+        });
+        // A page restored from the back/forward cache revoked its token on the
+        // way out; reload to get a fresh one.
+        window.addEventListener('pageshow', (e) => {
+          if (e.persisted && expiresMeta && expiresMeta.content) window.location.reload();
+        });
+
+        async function withToken(input, requestInit) {
+          if (refreshing) await refreshing;
           if (input instanceof Request) {
             const headers = new Headers(input.headers);
             if (requestInit.headers) new Headers(requestInit.headers).forEach((v, k) => headers.set(k, v));
@@ -352,6 +416,16 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
           const headers = new Headers(requestInit.headers || {});
           headers.set('X-Session-Token', token);
           return originalFetch(input, Object.assign({}, requestInit, { headers }));
+        }
+
+        window.fetch = function (input, init) {
+          const requestInit = init || {};
+          const method = (requestInit.method || (input instanceof Request ? input.method : 'GET') || 'GET').toUpperCase();
+          const url = new URL(input instanceof Request ? input.url : String(input), window.location.href);
+          if (!url.pathname.startsWith('/api/') || ((method === 'GET' || method === 'HEAD') && readAuth === 'off')) {
+            return originalFetch(input, requestInit);
+          }
+          return withToken(input, requestInit);
         };
       })();
     </script>
@@ -398,6 +472,10 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
               <span class="pill" aria-hidden="true"></span>
               <span id="stream-text">Stream: connecting…</span>
             </span>
+            <span class="badge" id="auth-badge" title="Remote access identity" hidden>
+              <span id="auth-text"></span>
+            </span>
+            <button class="btn" id="auth-logout" type="button" hidden>Log out</button>
             <button class="btn" id="copy-root" type="button">Copy root</button>
           </div>
         </header>
@@ -608,6 +686,14 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
           <section class="panel" data-panel="fire" style="display:none">
             <h2>Fire</h2>
             <p>Run Ralph until all stories pass. Live stream updates appear as SSE events.</p>
+            <div class="panel" id="fire-orphan" style="display:none">
+              <h2>Run not attached to this console</h2>
+              <p class="muted" id="fire-orphan-text"></p>
+              <div style="display:flex; gap:10px; flex-wrap:wrap">
+                <button class="btn primary" id="fire-orphan-attach" type="button">Re-attach</button>
+                <button class="btn danger" id="fire-orphan-kill" type="button">Kill</button>
+              </div>
+            </div>
             <div class="grid2">
               <div class="panel">
                 <h2>Run</h2>
@@ -618,14 +704,37 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
                     <option value="claude">claude</option>
                   </select>
                 </div>
+                <div class="field">
+                  <label for="fire-mode">Mode</label>
+                  <select id="fire-mode">
+                    <option value="script">script (ralph-codex.sh, static prompt)</option>
+                    <option value="loop">loop (console renders prompt per iteration)</option>
+                    <option value="single-story">single-story (only the stories below)</option>
+                  </select>
+                </div>
+                <div class="field">
+                  <label for="fire-story-ids">Story ids (single-story)</label>
+                  <input id="fire-story-ids" placeholder="US-007, US-009" autocomplete="off" />
+                </div>
                 <div class="field">
                   <label for="fire-iterations">Max iterations</label>
                   <input id="fire-iterations" type="number" min="1" max="200" value="10" />
                 </div>
+                <div class="field">
+                  <label><input id="fire-detached" type="checkbox" /> Detached (script mode; survives console restarts)</label>
+                </div>
                 <div style="display:flex; gap:10px; flex-wrap:wrap">
                   <button class="btn primary" id="fire-start" type="button">Start Fire</button>
+                  <select id="fire-stop-mode" title="Stop mode">
+                    <option value="immediate">stop now</option>
+                    <option value="graceful">graceful</option>
+                    <option value="after-iteration">after iteration</option>
+                  </select>
                   <button class="btn danger" id="fire-stop" type="button">Stop</button>
+                  <button class="btn" id="fire-detach" type="button">Detach</button>
+                  <button class="btn" id="fire-processes" type="button">Processes</button>
                 </div>
+                <div class="searchresults" id="fire-processes-list"></div>
               </div>
               <div class="panel">
                 <h2>Run log</h2>
@@ -636,9 +745,47 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
                     <button class="btn" id="fire-clear" type="button">Clear</button>
                   </div>
                 </div>
+                <div class="logsearch">
+                  <input id="fire-search-q" type="text" placeholder="Search this run (text or regex)" />
+                  <label class="muted"><input id="fire-search-regex" type="checkbox" /> regex</label>
+                  <select id="fire-search-level">
+                    <option value="">any level</option>
+                    <option value="warn">warn+</option>
+                    <option value="error">error</option>
+                  </select>
+                  <button class="btn" id="fire-search" type="button">Search</button>
+                </div>
+                <div class="searchresults" id="fire-search-results"></div>
                 <div class="logview" id="fire-log"></div>
               </div>
             </div>
+            <div class="grid2">
+              <div class="panel">
+                <h2>Prompt</h2>
+                <div class="field">
+                  <label for="prompt-name">File</label>
+                  <select id="prompt-name">
+                    <option value="CODEX.md">CODEX.md</option>
+                    <option value="CLAUDE.md">CLAUDE.md</option>
+                    <option value="prompt.md">prompt.md</option>
+                  </select>
+                </div>
+                <div class="field">
+                  <label for="prompt-content">Content (must keep &lt;promise&gt;COMPLETE&lt;/promise&gt;)</label>
+                  <textarea id="prompt-content" style="min-height:240px"></textarea>
+                </div>
+                <div style="display:flex; gap:10px; flex-wrap:wrap">
+                  <button class="btn" id="prompt-load" type="button">Reload</button>
+                  <button class="btn" id="prompt-preview" type="button">Preview diff</button>
+                  <button class="btn" id="prompt-render" type="button">Preview rendered</button>
+                  <button class="btn primary" id="prompt-save" type="button">Save</button>
+                </div>
+              </div>
+              <div class="panel">
+                <h2>Diff / history</h2>
+                <pre id="prompt-result">Not loaded yet.</pre>
+              </div>
+            </div>
           </section>
         </main>
       </section>
@@ -726,6 +873,10 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
           }
         });
 
+        function streamURL(path) {
+          return window.ohmyagentflowStreamURL ? window.ohmyagentflowStreamURL(path) : path;
+        }
+
         async function fetchJSON(url, init) {
           const resp = await fetch(url, init || {});
           const text = await resp.text();
@@ -1102,6 +1253,13 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
         const fireLog = document.getElementById('fire-log');
         const fireAutoScrollBtn = document.getElementById('fire-autoscroll');
         const fireClearBtn = document.getElementById('fire-clear');
+        const fireSearchQ = document.getElementById('fire-search-q');
+        const fireSearchRegex = document.getElementById('fire-search-regex');
+        const fireSearchLevel = document.getElementById('fire-search-level');
+        const fireSearchBtn = document.getElementById('fire-search');
+        const fireSearchResults = document.getElementById('fire-search-results');
+        let fireHighlightSeq = 0;
+        let fireJumpPending = 0;
         let fireRunId = '';
         let fireES = null;
         let fireState = null;
@@ -1268,7 +1426,7 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
             const row = document.createElement('div');
             const lvl = r.level ? String(r.level) : '';
             const isHeader = r.kind === 'header';
-            row.className = 'logrow' + (isHeader ? ' header' : '') + (lvl === 'error' ? ' bad' : (lvl === 'warn' ? ' warn' : (lvl === 'info' ? '' : '')));
+            row.className = 'logrow' + (isHeader ? ' header' : '') + (lvl === 'error' ? ' bad' : (lvl === 'warn' ? ' warn' : (lvl === 'info' ? '' : ''))) + ((!isHeader && fireHighlightSeq && r.seq === fireHighlightSeq) ? ' hit' : '');
             row.textContent = isHeader ? String(r.text || '') : String(r.text || '');
             frag.appendChild(row);
           }
@@ -1276,12 +1434,89 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
           fireItems.textContent = '';
           fireItems.appendChild(frag);
 
+          if (fireJumpPending && scrollToFireSeq(fireJumpPending)) {
+            fireJumpPending = 0;
+            return;
+          }
           if (fireAutoScroll) {
             const target = Math.max(0, (total * fireRowHeight) - (fireLog.clientHeight || 0));
             fireLog.scrollTop = target;
           }
         }
 
+        function scrollToFireSeq(seq) {
+          const st = ensureFireState(fireRunId);
+          const rows = st.rows || [];
+          for (let i = 0; i < rows.length; i++) {
+            const r = rows[i];
+            if (r && r.kind === 'event' && r.seq === seq) {
+              fireAutoScroll = false;
+              setAutoScrollLabel();
+              fireHighlightSeq = seq;
+              fireLog.scrollTop = Math.max(0, (i * fireRowHeight) - Math.floor((fireLog.clientHeight || 0) / 2));
+              scheduleFireRender();
+              return true;
+            }
+          }
+          return false;
+        }
+
+        function jumpToFireSeq(seq) {
+          seq = parseIntSafe(seq);
+          if (!seq || !fireRunId) return;
+          if (scrollToFireSeq(seq)) return;
+          // The row was trimmed from the local window: reload the log starting just before it.
+          resetFireState(fireRunId);
+          fireJumpPending = seq;
+          fireHighlightSeq = seq;
+          connectFireStream(fireRunId, Math.max(0, seq - 6));
+        }
+
+        async function runFireSearch() {
+          if (!fireSearchResults) return;
+          if (!fireRunId) {
+            fireSearchResults.textContent = 'Start Fire first.';
+            return;
+          }
+          const params = new URLSearchParams();
+          params.set('q', fireSearchQ ? String(fireSearchQ.value || '') : '');
+          if (fireSearchRegex && fireSearchRegex.checked) params.set('regex', '1');
+          if (fireSearchLevel && fireSearchLevel.value) params.set('level', String(fireSearchLevel.value));
+          params.set('context', '0');
+          fireSearchResults.textContent = 'Searching…';
+          try {
+            const data = await fetchJSON('/api/runs/' + encodeURIComponent(fireRunId) + '/search?' + params.toString());
+            const matches = (data && Array.isArray(data.matches)) ? data.matches : [];
+            fireSearchResults.textContent = '';
+            if (!matches.length) {
+              fireSearchResults.textContent = 'No matches.';
+              return;
+            }
+            const frag = document.createDocumentFragment();
+            for (let i = 0; i < matches.length; i++) {
+              const m = matches[i] || {};
+              const ev = m.event || {};
+              const evData = (ev.data && typeof ev.data === 'object') ? ev.data : {};
+              const text = evData.text || evData.message || evData.note || ev.type || '';
+              const row = document.createElement('div');
+              const lvl = ev.level ? String(ev.level) : '';
+              row.className = 'logrow' + (lvl === 'error' ? ' bad' : (lvl === 'warn' ? ' warn' : ''));
+              row.textContent = '#' + m.seq + ' ' + truncateText(sanitizeOneLine(text), 300);
+              row.addEventListener('click', () => jumpToFireSeq(m.seq));
+              frag.appendChild(row);
+            }
+            if (data.limited) {
+              const more = document.createElement('div');
+              more.className = 'muted';
+              more.textContent = 'More matches not shown; refine the search.';
+              frag.appendChild(more);
+            }
+            fireSearchResults.appendChild(frag);
+          } catch (e) {
+            fireSearchResults.textContent = String(e && e.message ? e.message : e);
+          }
+        }
+
         function handleFireEvent(ev) {
           if (!ev || typeof ev !== 'object') return;
           if (fireRunId && ev.runId && String(ev.runId) !== String(fireRunId)) return;
@@ -1295,7 +1530,17 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
             if (data.tool) st.tool = String(data.tool);
             if (data.maxIterations) st.maxIterations = parseIntSafe(data.maxIterations);
             st.phase = 'run_started';
-            appendFireEventRow(st, ev, st.currentIteration || 0, 'run_started', ev.level || '');
+            const sb = (data.sandbox && typeof data.sandbox === 'object') ? data.sandbox : null;
+            const sandboxText = (sb && sb.backend && sb.backend !== 'none') ? (' sandbox=' + String(sb.backend) + ' network=' + String(sb.network || 'allow')) : '';
+            appendFireEventRow(st, ev, st.currentIteration || 0, 'run_started' + sandboxText, ev.level || '');
+            return;
+          }
+
+          if (type === 'gap') {
+            // The server dropped events for this (slow) subscriber; replay them. Rows are deduped by seq.
+            const fromSeq = parseIntSafe(data.fromSeq);
+            appendFireEventRow(st, ev, st.currentIteration || 0, 'gap ' + (data.note ? String(data.note) : ''), 'warn');
+            if (fireRunId && fromSeq > 0) connectFireStream(fireRunId, fromSeq - 1);
             return;
           }
 
@@ -1305,7 +1550,11 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
             const reason = data && data.reason ? String(data.reason) : '';
             const exitCode = (data && data.exitCode !== undefined) ? String(data.exitCode) : '';
             const signal = (data && data.signal !== undefined) ? String(data.signal) : '';
-            const msg = 'run_finished' + (reason ? (' reason=' + reason) : '') + (exitCode ? (' exitCode=' + exitCode) : '') + (signal ? (' signal=' + signal) : '');
+            const usage = (data && data.usage && typeof data.usage === 'object') ? data.usage : null;
+            const usageText = (usage && usage.samples) ? (' peakRss=' + (Number(usage.peakRssBytes || 0) / 1048576).toFixed(1) + 'MiB peakProcesses=' + parseIntSafe(usage.peakProcesses)) : '';
+            const wt = (data && data.worktree && typeof data.worktree === 'object') ? data.worktree : null;
+            const worktreeText = (wt && wt.note) ? (' ' + String(wt.note)) : '';
+            const msg = 'run_finished' + (reason ? (' reason=' + reason) : '') + (exitCode ? (' exitCode=' + exitCode) : '') + (signal ? (' signal=' + signal) : '') + usageText + worktreeText;
             appendFireEventRow(st, ev, st.currentIteration || 0, msg, ev.level || '');
             return;
           }
@@ -1325,6 +1574,14 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
             return;
           }
 
+          if (type === 'resource_usage') {
+            const iter = (data.iteration !== undefined) ? parseIntSafe(data.iteration) : (st.currentIteration || 0);
+            const rssMiB = (Number(data.rssBytes || 0) / 1048576).toFixed(1);
+            const line = 'resource_usage processes=' + parseIntSafe(data.processes) + ' rss=' + rssMiB + 'MiB cpu=' + String(data.cpuPercent || 0) + '%';
+            appendFireEventRow(st, ev, iter, line, ev.level || '');
+            return;
+          }
+
           if (type === 'process_stdout' || type === 'process_stderr') {
             const iter = (data.iteration !== undefined) ? parseIntSafe(data.iteration) : (st.currentIteration || 0);
             const txt = data.text ? String(data.text) : '';
@@ -1360,11 +1617,12 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
           fireES = null;
         }
 
-        function connectFireStream(runId) {
+        function connectFireStream(runId, sinceSeq) {
           closeFireStream();
           if (!runId) return;
           try {
-            fireES = new EventSource('/api/stream?runId=' + encodeURIComponent(runId));
+            const since = parseIntSafe(sinceSeq);
+            fireES = new EventSource(streamURL('/api/stream?runId=' + encodeURIComponent(runId) + (since > 0 ? ('&sinceSeq=' + since) : '')));
             fireES.onmessage = (e) => {
               const raw = (e && e.data) ? e.data : '';
               if (!raw) return;
@@ -1377,6 +1635,14 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
             };
             fireES.onerror = () => {
               // Keep last message; Stream badge still reports global connectivity.
+              // The browser retries on its own unless the server refused the
+              // request (e.g. a rotated read token); then reconnect with a fresh URL.
+              if (!fireES || fireES.readyState !== EventSource.CLOSED || !fireRunId) return;
+              if (fireState && fireState.finished) return;
+              const seen = fireState ? Object.keys(fireState.seenSeq).map(Number) : [];
+              const last = seen.length ? Math.max.apply(null, seen) : 0;
+              const runId = fireRunId;
+              setTimeout(() => { if (fireRunId === runId) connectFireStream(runId, last); }, 2000);
             };
           } catch (_) {}
         }
@@ -1397,7 +1663,7 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
               const data = await fetchJSON('/api/fire', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ tool, maxIterations: n })
+                body: JSON.stringify(fireStartBody(tool, n))
               });
               fireRunId = (data && data.runId) ? String(data.runId) : '';
               if (!fireRunId) {
@@ -1414,22 +1680,146 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
           });
         }
 
+        function fireStartBody(tool, n) {
+          const mode = (document.getElementById('fire-mode') || {}).value || 'script';
+          const body = { tool, maxIterations: n, mode };
+          if ((document.getElementById('fire-detached') || {}).checked) body.detached = true;
+          if (mode === 'single-story') {
+            body.storyIds = String((document.getElementById('fire-story-ids') || {}).value || '')
+              .split(/[\s,]+/).filter(Boolean);
+          }
+          return body;
+        }
+
         if (fireStop) {
           fireStop.addEventListener('click', async () => {
             if (!fireRunId) {
               setFireOutput('No active runId. Start Fire first.');
               return;
             }
-            setFireOutput('Stopping runId=' + fireRunId + '…');
+            const mode = String((document.getElementById('fire-stop-mode') || {}).value || 'immediate');
+            setFireOutput('Stopping runId=' + fireRunId + ' (' + mode + ')…');
             try {
-              const data = await fetchJSON('/api/fire/stop', { method: 'POST' });
+              const data = await fetchJSON('/api/fire/stop', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ mode: mode })
+              });
               const stopping = !!(data && data.stopping);
-              setFireOutput(stopping ? ('Stop requested for runId=' + fireRunId + '.') : ('Stopped runId=' + fireRunId + '.'));
+              const waiting = mode !== 'immediate' && data && data.mode === mode;
+              setFireOutput(waiting ? ('Stop requested for runId=' + fireRunId + '; waiting for the current iteration to finish.') : (stopping ? ('Stop requested for runId=' + fireRunId + '.') : ('Stopped runId=' + fireRunId + '.')));
+            } catch (e) {
+              setFireOutput(String(e && e.message ? e.message : e));
+            }
+          });
+        }
+
+        const fireDetach = document.getElementById('fire-detach');
+        if (fireDetach) {
+          fireDetach.addEventListener('click', async () => {
+            if (!fireRunId) {
+              setFireOutput('No active runId. Start Fire first.');
+              return;
+            }
+            try {
+              const data = await fetchJSON('/api/fire/detach', { method: 'POST' });
+              setFireOutput('Detached from runId=' + String(data && data.runId || fireRunId) + '; it keeps running. Re-attach from the panel above.');
+            } catch (e) {
+              setFireOutput(String(e && e.message ? e.message : e));
+            }
+            loadFireOrphan();
+          });
+        }
+
+        const fireProcessesBtn = document.getElementById('fire-processes');
+        const fireProcessesList = document.getElementById('fire-processes-list');
+        if (fireProcessesBtn && fireProcessesList) {
+          fireProcessesBtn.addEventListener('click', async () => {
+            fireProcessesList.textContent = 'Loading…';
+            try {
+              const data = await fetchJSON('/api/fire/processes');
+              const procs = (data && Array.isArray(data.processes)) ? data.processes : [];
+              fireProcessesList.textContent = '';
+              if (!data || !data.active) {
+                fireProcessesList.textContent = 'No active run.';
+                return;
+              }
+              if (!procs.length) {
+                fireProcessesList.textContent = 'No process running (between iterations).';
+                return;
+              }
+              const frag = document.createDocumentFragment();
+              for (let i = 0; i < procs.length; i++) {
+                const p = procs[i] || {};
+                const row = document.createElement('div');
+                row.style.whiteSpace = 'pre';
+                const rssMiB = (Number(p.rssBytes || 0) / 1048576).toFixed(1);
+                row.textContent = '  '.repeat(parseIntSafe(p.depth)) + p.pid + ' ' + String(p.state || '') + ' cpu=' + String(p.cpuSeconds || 0) + 's (' + String(p.cpuPercent || 0) + '%) rss=' + rssMiB + 'MiB ' + truncateText(sanitizeOneLine(String(p.command || '')), 300);
+                frag.appendChild(row);
+              }
+              fireProcessesList.appendChild(frag);
+            } catch (e) {
+              fireProcessesList.textContent = String(e && e.message ? e.message : e);
+            }
+          });
+        }
+
+        // A run whose console crashed may still be running; offer to re-attach or kill it.
+        const fireOrphanBox = document.getElementById('fire-orphan');
+        const fireOrphanText = document.getElementById('fire-orphan-text');
+        async function loadFireOrphan() {
+          if (!fireOrphanBox || !fireOrphanText) return;
+          let data;
+          try {
+            data = await fetchJSON('/api/fire/orphan');
+          } catch (_) {
+            return;
+          }
+          const o = data && data.orphan;
+          fireOrphanBox.style.display = o ? '' : 'none';
+          if (!o) return;
+          const procs = Array.isArray(data.processes) ? data.processes.length : 0;
+          const what = 'Run ' + String(o.runId || '') + ' (' + String(o.tool || '') + ', ' + String(o.mode || '') + ', started ' + String(o.startedAt || '') + ')';
+          if (o.detached) {
+            fireOrphanText.textContent = what + ' is detached' + (data.running ? (' and still running in process group ' + String(o.pgid || '')) : ' and has exited') + '. Re-attach replays ' + String(o.log || '') + ' from the start.';
+            return;
+          }
+          fireOrphanText.textContent = what + ' is still running in process group ' + String(o.pgid || '') + (procs ? (' with ' + procs + ' process(es)') : '') + '. Re-attach follows ' + String(o.log || '') + ' until it exits.';
+        }
+        const fireOrphanAttach = document.getElementById('fire-orphan-attach');
+        if (fireOrphanAttach) {
+          fireOrphanAttach.addEventListener('click', async () => {
+            try {
+              const data = await fetchJSON('/api/fire/orphan/attach', { method: 'POST' });
+              fireRunId = (data && data.runId) ? String(data.runId) : '';
+              if (fireOrphanBox) fireOrphanBox.style.display = 'none';
+              if (!fireRunId) return;
+              resetFireState(fireRunId);
+              closeFireStream();
+              setFireOutput('Re-attached as runId=' + fireRunId + '. Connecting stream…');
+              connectFireStream(fireRunId);
+            } catch (e) {
+              setFireOutput(String(e && e.message ? e.message : e));
+              loadFireOrphan();
+            }
+          });
+        }
+        const fireOrphanKill = document.getElementById('fire-orphan-kill');
+        if (fireOrphanKill) {
+          fireOrphanKill.addEventListener('click', async () => {
+            if (!confirm('Kill the processes of the run not attached to this console?')) return;
+            try {
+              const data = await fetchJSON('/api/fire/orphan/kill', { method: 'POST' });
+              const note = data && data.worktree && data.worktree.note ? (' ' + String(data.worktree.note)) : '';
+              const sig = data && data.signal ? (' (' + String(data.signal) + ')') : '';
+              setFireOutput('Killed run ' + String(data && data.runId || '') + sig + '.' + note);
             } catch (e) {
               setFireOutput(String(e && e.message ? e.message : e));
             }
+            loadFireOrphan();
           });
         }
+        loadFireOrphan();
 
         if (fireAutoScrollBtn) {
           fireAutoScrollBtn.addEventListener('click', () => {
@@ -1448,6 +1838,129 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
           });
         }
 
+        // Prompt editor: saves are versioned server-side; baseSha256 guards against concurrent edits.
+        let promptBaseSha = '';
+        async function loadPrompt() {
+          const name = document.getElementById('prompt-name').value;
+          const out = document.getElementById('prompt-result');
+          try {
+            const data = await fetchJSON('/api/prompts/' + encodeURIComponent(name));
+            document.getElementById('prompt-content').value = data && data.content ? data.content : '';
+            promptBaseSha = data && data.sha256 ? data.sha256 : '';
+            const hist = await fetchJSON('/api/prompts/' + encodeURIComponent(name) + '/history');
+            const lines = (hist && hist.versions ? hist.versions : []).map((v) => 'v' + v.version + '  ' + v.createdAt + '  ' + v.source + '  ' + v.sha256.slice(0, 12));
+            out.textContent = (data && data.exists ? ('Loaded ' + name + (data.version ? ' (v' + data.version + ')' : ' (unversioned)')) : (name + ' does not exist yet.')) +
+              (lines.length ? '\n\nHistory:\n' + lines.join('\n') : '');
+          } catch (e) {
+            out.textContent = String(e && e.message ? e.message : e);
+          }
+        }
+        async function writePrompt(preview) {
+          const name = document.getElementById('prompt-name').value;
+          const out = document.getElementById('prompt-result');
+          out.textContent = preview ? 'Computing diff…' : 'Saving…';
+          try {
+            const data = await fetchJSON('/api/prompts/' + encodeURIComponent(name) + (preview ? '?preview=1' : ''), {
+              method: 'POST',
+              headers: { 'Content-Type': 'application/json' },
+              body: JSON.stringify({ content: document.getElementById('prompt-content').value, baseSha256: promptBaseSha })
+            });
+            if (!preview && data && data.sha256) promptBaseSha = data.sha256;
+            const head = !data.changed ? 'No changes.' : (preview ? 'Preview (not saved):' : ('Saved ' + name + ' as v' + data.version + '.'));
+            out.textContent = head + (data.diff ? '\n\n' + data.diff : '');
+          } catch (e) {
+            out.textContent = String(e && e.message ? e.message : e);
+          }
+        }
+        document.getElementById('prompt-render').addEventListener('click', async () => {
+          const name = document.getElementById('prompt-name').value;
+          const out = document.getElementById('prompt-result');
+          if (name === 'prompt.md') {
+            out.textContent = 'prompt.md is used by ralph.sh only; loop mode renders CODEX.md or CLAUDE.md.';
+            return;
+          }
+          out.textContent = 'Rendering…';
+          try {
+            const data = await fetchJSON('/api/prompt/preview', {
+              method: 'POST',
+              headers: { 'Content-Type': 'application/json' },
+              body: JSON.stringify({ tool: name === 'CLAUDE.md' ? 'claude' : 'codex', content: document.getElementById('prompt-content').value })
+            });
+            out.textContent = 'Rendered for iteration 1 (loop mode):\n\n' + (data && data.rendered ? data.rendered : '');
+          } catch (e) {
+            out.textContent = String(e && e.message ? e.message : e);
+          }
+        });
+        document.getElementById('prompt-name').addEventListener('change', loadPrompt);
+        document.getElementById('prompt-load').addEventListener('click', loadPrompt);
+        document.getElementById('prompt-preview').addEventListener('click', () => writePrompt(true));
+        document.getElementById('prompt-save').addEventListener('click', () => writePrompt(false));
+        loadPrompt();
+
+        // Adapt client-side limits to the server's effective config.
+        fetchJSON('/api/config').then((cfg) => {
+          const cap = cfg && cfg.fire ? parseIntSafe(cfg.fire.maxIterationsCap) : 0;
+          if (cap > 0 && fireIterations) fireIterations.max = String(cap);
+        }).catch(() => {});
+
+        // Suggest readable files (PRDs, prompts, AGENTS.md) from the server's whitelist.
+        async function loadPathSuggestions() {
+          const list = document.getElementById('prd-suggestions');
+          if (!list) return;
+          const seen = new Set();
+          for (const dir of ['', 'tasks']) {
+            let data;
+            try {
+              data = await fetchJSON('/api/fs/list' + (dir ? '?dir=' + encodeURIComponent(dir) : ''));
+            } catch (_) {
+              continue;
+            }
+            (data && data.entries ? data.entries : []).forEach((entry) => {
+              if (entry.type !== 'file' || seen.has(entry.path)) return;
+              seen.add(entry.path);
+              const opt = document.createElement('option');
+              opt.value = entry.path;
+              list.appendChild(opt);
+            });
+          }
+          if (seen.size > 0) {
+            Array.from(list.querySelectorAll('option')).forEach((opt) => {
+              if (!seen.has(opt.value)) opt.remove();
+            });
+          }
+        }
+        loadPathSuggestions();
+
+        // Remote mode: show who is logged in and disable writes for read-only roles.
+        fetchJSON('/api/auth/me').then((me) => {
+          if (!me || me.mode !== 'remote') return;
+          const badge = document.getElementById('auth-badge');
+          const logout = document.getElementById('auth-logout');
+          document.getElementById('auth-text').textContent = 'Remote: ' + (me.name || '?') + ' (' + me.role + ')';
+          badge.hidden = false;
+          logout.hidden = false;
+          logout.addEventListener('click', async () => {
+            try { await fetchJSON('/api/auth/logout', { method: 'POST' }); } catch (_) {}
+            window.location.assign('/login');
+          });
+          if (me.role !== 'operator') {
+            ['init-run', 'prd-gen-save', 'prd-chat-new', 'prd-chat-send', 'prd-chat-reset', 'prd-chat-finalize', 'convert-run', 'fire-start', 'fire-stop'].forEach((id) => {
+              const el = document.getElementById(id);
+              if (el) {
+                el.disabled = true;
+                el.title = 'Read-only access';
+              }
+            });
+          }
+        }).catch(() => {});
+
+        if (fireSearchBtn) fireSearchBtn.addEventListener('click', runFireSearch);
+        if (fireSearchQ) {
+          fireSearchQ.addEventListener('keydown', (e) => {
+            if (e.key === 'Enter') runFireSearch();
+          });
+        }
+
         if (fireLog) {
           fireLog.addEventListener('scroll', () => {
             if (!fireAutoScroll) {
@@ -1464,11 +1977,14 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
         }
 
         // Best-effort SSE connection for live status. Runs without requiring a runId.
-        try {
-          const es = new EventSource('/api/stream');
+        function connectStatusStream() {
+          const es = new EventSource(streamURL('/api/stream'));
           setStreamBadge('warn', 'Stream: connecting…');
           es.onopen = () => setStreamBadge('good', 'Stream: connected');
-          es.onerror = () => setStreamBadge('bad', 'Stream: disconnected');
+          es.onerror = () => {
+            setStreamBadge('bad', 'Stream: disconnected');
+            if (es.readyState === EventSource.CLOSED) setTimeout(connectStatusStream, 5000);
+          };
           es.onmessage = (e) => {
             if (fireRunId) return;
             const raw = (e && e.data) ? e.data : '';
@@ -1482,6 +1998,9 @@ var indexPageTmpl = template.Must(template.New("index").Parse(`<!doctype html>
               setFireOutput(raw);
             }
           };
+        }
+        try {
+          connectStatusStream();
         } catch (_) {
           setStreamBadge('bad', 'Stream: unavailable');
         }
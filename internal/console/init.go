@@ -12,16 +12,21 @@ import (
 
 type InitConfig struct {
 	ProjectRoot string
+	// Optional. Snapshots files before they are overwritten.
+	Backups *BackupStore
 }
 
 type InitResponse struct {
 	Created     []string `json:"created"`
 	Overwritten []string `json:"overwritten"`
 	Warnings    []string `json:"warnings"`
+	BackupIDs   []string `json:"backupIds,omitempty"`
 }
 
 func InitHandler(cfg InitConfig) http.HandlerFunc {
 	projectRoot := strings.TrimSpace(cfg.ProjectRoot)
+	backups := cfg.Backups
+	paths, pathsErr := NewSafePath(SafePathConfig{ProjectRoot: projectRoot})
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.Header().Set("Allow", http.MethodPost)
@@ -36,6 +41,14 @@ func InitHandler(cfg InitConfig) http.HandlerFunc {
 			})
 			return
 		}
+		if pathsErr != nil {
+			WriteAPIError(w, http.StatusInternalServerError, APIError{
+				Code:    "INTERNAL_ERROR",
+				Message: "failed to resolve project root",
+				Hint:    pathsErr.Error(),
+			})
+			return
+		}
 
 		resp := InitResponse{
 			Created:     []string{},
@@ -44,7 +57,11 @@ func InitHandler(cfg InitConfig) http.HandlerFunc {
 		}
 
 		mustMkdirAll := func(rel string) bool {
-			abs := filepath.Join(projectRoot, filepath.FromSlash(rel))
+			abs, apiErr, status := paths.ResolveDir(rel)
+			if apiErr != nil {
+				WriteAPIError(w, status, *apiErr)
+				return false
+			}
 			_, statErr := os.Stat(abs)
 			alreadyExists := statErr == nil
 			if err := os.MkdirAll(abs, 0o755); err != nil {
@@ -62,23 +79,31 @@ func InitHandler(cfg InitConfig) http.HandlerFunc {
 		}
 
 		ensureFile := func(srcRel, destRel string) bool {
-			srcAbs := filepath.Join(projectRoot, filepath.FromSlash(srcRel))
-			destAbs := filepath.Join(projectRoot, filepath.FromSlash(destRel))
+			srcAbs, _, apiErr, status := paths.ResolveRead(srcRel, initSourceWhitelist)
+			if apiErr != nil {
+				if apiErr.Code == "FS_READ_NOT_FOUND" {
+					WriteAPIError(w, http.StatusNotFound, APIError{
+						Code:    "NOT_FOUND",
+						Message: fmt.Sprintf("failed to read %s", srcRel),
+						Hint:    fmt.Sprintf("Missing file %q under the project root.", srcRel),
+					})
+					return false
+				}
+				WriteAPIError(w, status, *apiErr)
+				return false
+			}
+			destAbs, apiErr, status := paths.ResolveWrite(destRel, ConsoleWriteWhitelist)
+			if apiErr != nil {
+				WriteAPIError(w, status, *apiErr)
+				return false
+			}
 
 			srcBytes, err := os.ReadFile(srcAbs)
 			if err != nil {
-				status := http.StatusInternalServerError
-				code := "INIT_FAILED"
-				hint := err.Error()
-				if os.IsNotExist(err) {
-					status = http.StatusNotFound
-					code = "NOT_FOUND"
-					hint = fmt.Sprintf("Missing file %q under the project root.", srcRel)
-				}
-				WriteAPIError(w, status, APIError{
-					Code:    code,
+				WriteAPIError(w, http.StatusInternalServerError, APIError{
+					Code:    "INIT_FAILED",
 					Message: fmt.Sprintf("failed to read %s", srcRel),
-					Hint:    hint,
+					Hint:    err.Error(),
 				})
 				return false
 			}
@@ -100,8 +125,10 @@ func InitHandler(cfg InitConfig) http.HandlerFunc {
 
 			_, statErr := os.Stat(destAbs)
 			destExists := statErr == nil
+			before := snapshotFile(destAbs)
 
-			if err := writeFileAtomic(destAbs, srcBytes, 0o644); err != nil {
+			backupID, err := backups.WriteFile(destAbs, srcBytes, 0o644, ".init-*")
+			if err != nil {
 				WriteAPIError(w, http.StatusInternalServerError, APIError{
 					Code:    "INIT_FAILED",
 					Message: fmt.Sprintf("failed to write %s", destRel),
@@ -110,6 +137,10 @@ func InitHandler(cfg InitConfig) http.HandlerFunc {
 				return false
 			}
 
+			recordAuditFileWrite(r.Context(), destRel, before, srcBytes, backups.RelPath(backupID))
+			if backupID != "" {
+				resp.BackupIDs = append(resp.BackupIDs, backupID)
+			}
 			if destExists {
 				resp.Overwritten = append(resp.Overwritten, destRel)
 			} else {
@@ -143,7 +174,3 @@ func InitHandler(cfg InitConfig) http.HandlerFunc {
 		_ = json.NewEncoder(w).Encode(resp)
 	}
 }
-
-func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
-	return writeFileAtomicWithPrefix(path, data, perm, ".init-*")
-}
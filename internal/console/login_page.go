@@ -0,0 +1,117 @@
+package console
+
+import (
+	"bytes"
+	"html/template"
+)
+
+type LoginPageData struct {
+	// LoginNonce is sent back as LoginNonceHeader; see RemoteAuth.LoginNonce.
+	LoginNonce string
+}
+
+var loginPageTmpl = template.Must(template.New("login").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <meta name="ohmyagentflow-login-nonce" content="{{.LoginNonce}}" />
+    <title>Oh My Agent Flow · Login</title>
+    <style>
+      body {
+        margin: 0;
+        min-height: 100vh;
+        display: grid;
+        place-items: center;
+        background: #0b1020;
+        color: #e9edf7;
+        font-family: ui-sans-serif, system-ui, -apple-system, Segoe UI, Roboto, Helvetica, Arial;
+      }
+      form {
+        width: min(360px, 92vw);
+        padding: 24px;
+        border-radius: 14px;
+        background: #111832;
+        border: 1px solid rgba(255, 255, 255, 0.10);
+        box-shadow: 0 12px 30px rgba(0,0,0,0.45);
+      }
+      h1 { margin: 0 0 4px; font-size: 18px; }
+      p { margin: 0 0 16px; color: #a5b0cc; font-size: 13px; }
+      label { display: block; margin: 12px 0 6px; font-size: 12px; color: #a5b0cc; }
+      input {
+        width: 100%;
+        box-sizing: border-box;
+        padding: 9px 10px;
+        border-radius: 10px;
+        border: 1px solid rgba(255, 255, 255, 0.10);
+        background: #0f1630;
+        color: inherit;
+      }
+      button {
+        margin-top: 16px;
+        width: 100%;
+        padding: 10px;
+        border: 0;
+        border-radius: 10px;
+        background: #7aa2ff;
+        color: #0b1020;
+        font-weight: 600;
+        cursor: pointer;
+      }
+      #login-error { margin-top: 12px; color: #fb7185; font-size: 13px; white-space: pre-wrap; }
+    </style>
+  </head>
+  <body>
+    <form id="login-form">
+      <h1>Oh My Agent Flow</h1>
+      <p>Remote access. Log in with the console password or an API token.</p>
+      <label for="login-password">Password</label>
+      <input id="login-password" type="password" autocomplete="current-password" />
+      <label for="login-token">or API token</label>
+      <input id="login-token" type="password" autocomplete="off" />
+      <button type="submit">Log in</button>
+      <div id="login-error" role="alert"></div>
+    </form>
+    <script>
+      (function () {
+        const meta = document.querySelector('meta[name="ohmyagentflow-login-nonce"]');
+        const nonce = meta && meta.content ? meta.content : '';
+        const form = document.getElementById('login-form');
+        const errEl = document.getElementById('login-error');
+        form.addEventListener('submit', async (e) => {
+          e.preventDefault();
+          errEl.textContent = '';
+          const body = {};
+          const password = document.getElementById('login-password').value;
+          const apiToken = document.getElementById('login-token').value;
+          if (password) body.password = password;
+          else if (apiToken) body.token = apiToken;
+          try {
+            const resp = await fetch('/api/auth/login', {
+              method: 'POST',
+              headers: { 'Content-Type': 'application/json', 'X-Login-Nonce': nonce },
+              body: JSON.stringify(body),
+            });
+            if (resp.ok) {
+              window.location.assign('/');
+              return;
+            }
+            const data = await resp.json().catch(() => null);
+            errEl.textContent = data && data.message ? data.message : ('HTTP ' + resp.status);
+          } catch (err) {
+            errEl.textContent = String(err);
+          }
+        });
+      })();
+    </script>
+  </body>
+</html>
+`))
+
+func RenderLoginHTML(data LoginPageData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := loginPageTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,308 @@
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics is a small in-process registry that renders the Prometheus text
+// exposition format. All methods are safe to call on a nil *Metrics so that
+// services can record unconditionally.
+type Metrics struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricKind string
+
+const (
+	metricCounter   metricKind = "counter"
+	metricGauge     metricKind = "gauge"
+	metricHistogram metricKind = "histogram"
+)
+
+type metricFamily struct {
+	name       string
+	help       string
+	kind       metricKind
+	labelNames []string
+	buckets    []float64
+
+	series map[string]*metricSeries
+	fn     func() float64
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64
+
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+var defaultDurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+const (
+	metricFireActiveRuns        = "ohmyagentflow_fire_active_runs"
+	metricFireRunsTotal         = "ohmyagentflow_fire_runs_total"
+	metricFireIterationSeconds  = "ohmyagentflow_fire_iteration_duration_seconds"
+	metricStreamPublishedTotal  = "ohmyagentflow_stream_events_published_total"
+	metricStreamDroppedTotal    = "ohmyagentflow_stream_events_dropped_total"
+	metricStreamSubscriberDrops = "ohmyagentflow_stream_subscriber_dropped_events"
+	metricArchiveBytesTotal     = "ohmyagentflow_archive_bytes_written_total"
+	metricChatSessionsAlive     = "ohmyagentflow_chat_sessions_alive"
+	metricLLMCallSeconds        = "ohmyagentflow_llm_call_duration_seconds"
+	metricLLMCallFailuresTotal  = "ohmyagentflow_llm_call_failures_total"
+)
+
+func NewMetrics() *Metrics {
+	m := &Metrics{families: make(map[string]*metricFamily)}
+	m.register(metricFireActiveRuns, "Number of Fire runs currently active.", metricGauge, nil, nil)
+	m.register(metricFireRunsTotal, "Total finished Fire runs by outcome.", metricCounter, []string{"reason"}, nil)
+	m.register(metricFireIterationSeconds, "Duration of Fire iterations in seconds.", metricHistogram, []string{"tool"}, defaultDurationBuckets)
+	m.register(metricStreamPublishedTotal, "Total events published to the stream hub.", metricCounter, []string{"type"}, nil)
+	m.register(metricStreamDroppedTotal, "Total events dropped because a subscriber buffer was full.", metricCounter, nil, nil)
+	m.register(metricStreamSubscriberDrops, "Events dropped per live subscriber since it subscribed.", metricGauge, []string{"subscriber", "run_id"}, nil)
+	m.register(metricArchiveBytesTotal, "Total bytes written to run archives.", metricCounter, nil, nil)
+	m.register(metricChatSessionsAlive, "Number of PRD chat sessions that have not expired.", metricGauge, nil, nil)
+	m.register(metricLLMCallSeconds, "Latency of LLM provider calls in seconds.", metricHistogram, []string{"tool"}, defaultDurationBuckets)
+	m.register(metricLLMCallFailuresTotal, "Total failed LLM provider calls by tool and error code.", metricCounter, []string{"tool", "code"}, nil)
+	return m
+}
+
+func MetricsHandler(m *Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(m.render())
+	}
+}
+
+func (m *Metrics) register(name, help string, kind metricKind, labelNames []string, buckets []float64) {
+	m.families[name] = &metricFamily{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*metricSeries),
+	}
+}
+
+func (m *Metrics) seriesLocked(name string, labels []string) *metricSeries {
+	fam := m.families[name]
+	if fam == nil || len(labels) != len(fam.labelNames) {
+		return nil
+	}
+	key := strings.Join(labels, "\xff")
+	s := fam.series[key]
+	if s == nil {
+		s = &metricSeries{labels: append([]string(nil), labels...)}
+		if fam.kind == metricHistogram {
+			s.bucketCounts = make([]uint64, len(fam.buckets))
+		}
+		fam.series[key] = s
+	}
+	return s
+}
+
+func (m *Metrics) add(name string, delta float64, labels ...string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.seriesLocked(name, labels); s != nil {
+		s.value += delta
+	}
+}
+
+func (m *Metrics) observe(name string, v float64, labels ...string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fam := m.families[name]
+	s := m.seriesLocked(name, labels)
+	if fam == nil || s == nil {
+		return
+	}
+	for i, le := range fam.buckets {
+		if v <= le {
+			s.bucketCounts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (m *Metrics) deleteSeries(name string, labels ...string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fam := m.families[name]; fam != nil {
+		delete(fam.series, strings.Join(labels, "\xff"))
+	}
+}
+
+// setGaugeFunc makes an unlabeled gauge read its value from fn at scrape time.
+func (m *Metrics) setGaugeFunc(name string, fn func() float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fam := m.families[name]; fam != nil && fam.kind == metricGauge && len(fam.labelNames) == 0 {
+		fam.fn = fn
+	}
+}
+
+func (m *Metrics) fireRunFinished(reason string) {
+	m.add(metricFireRunsTotal, 1, reason)
+}
+
+func (m *Metrics) fireIterationObserved(tool string, d time.Duration) {
+	m.observe(metricFireIterationSeconds, d.Seconds(), toolLabel(tool))
+}
+
+// toolLabel keeps tool labels to the known tools, so that request input
+// cannot create new series.
+func toolLabel(tool string) string {
+	switch FireTool(tool) {
+	case FireToolCodex, FireToolClaude:
+		return tool
+	}
+	return "other"
+}
+
+func (m *Metrics) streamEventPublished(eventType string) {
+	m.add(metricStreamPublishedTotal, 1, eventType)
+}
+
+func (m *Metrics) streamEventDropped(subscriberID uint64, runID string) {
+	m.add(metricStreamDroppedTotal, 1)
+	m.add(metricStreamSubscriberDrops, 1, strconv.FormatUint(subscriberID, 10), runID)
+}
+
+func (m *Metrics) streamSubscriberClosed(subscriberID uint64, runID string) {
+	m.deleteSeries(metricStreamSubscriberDrops, strconv.FormatUint(subscriberID, 10), runID)
+}
+
+func (m *Metrics) archiveBytesWritten(n int) {
+	m.add(metricArchiveBytesTotal, float64(n))
+}
+
+func (m *Metrics) llmCallObserved(tool string, d time.Duration, failureCode string) {
+	tool = toolLabel(tool)
+	m.observe(metricLLMCallSeconds, d.Seconds(), tool)
+	if failureCode != "" {
+		m.add(metricLLMCallFailuresTotal, 1, tool, failureCode)
+	}
+}
+
+func (m *Metrics) render() []byte {
+	if m == nil {
+		return nil
+	}
+
+	// Gauge funcs may take other locks (e.g. service mutexes); call them without holding m.mu.
+	m.mu.Lock()
+	funcs := make(map[string]func() float64)
+	for name, fam := range m.families {
+		if fam.fn != nil {
+			funcs[name] = fam.fn
+		}
+	}
+	m.mu.Unlock()
+	funcValues := make(map[string]float64, len(funcs))
+	for name, fn := range funcs {
+		funcValues[name] = fn()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fam := m.families[name]
+		fmt.Fprintf(&buf, "# HELP %s %s\n", fam.name, fam.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", fam.name, fam.kind)
+
+		if v, ok := funcValues[name]; ok {
+			fmt.Fprintf(&buf, "%s %s\n", fam.name, formatMetricValue(v))
+			continue
+		}
+		if len(fam.labelNames) == 0 && len(fam.series) == 0 && fam.kind != metricHistogram {
+			fmt.Fprintf(&buf, "%s 0\n", fam.name)
+			continue
+		}
+
+		keys := make([]string, 0, len(fam.series))
+		for k := range fam.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := fam.series[k]
+			if fam.kind != metricHistogram {
+				fmt.Fprintf(&buf, "%s%s %s\n", fam.name, formatMetricLabels(fam.labelNames, s.labels, "", ""), formatMetricValue(s.value))
+				continue
+			}
+			for i, le := range fam.buckets {
+				fmt.Fprintf(&buf, "%s_bucket%s %d\n", fam.name, formatMetricLabels(fam.labelNames, s.labels, "le", formatMetricValue(le)), s.bucketCounts[i])
+			}
+			fmt.Fprintf(&buf, "%s_bucket%s %d\n", fam.name, formatMetricLabels(fam.labelNames, s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", fam.name, formatMetricLabels(fam.labelNames, s.labels, "", ""), formatMetricValue(s.sum))
+			fmt.Fprintf(&buf, "%s_count%s %d\n", fam.name, formatMetricLabels(fam.labelNames, s.labels, "", ""), s.count)
+		}
+	}
+	return buf.Bytes()
+}
+
+func formatMetricLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		parts = append(parts, n+`="`+escapeMetricLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+`="`+escapeMetricLabelValue(extraValue)+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escapeMetricLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,98 @@
+package console
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler_RendersPrometheusText(t *testing.T) {
+	m := NewMetrics()
+	m.fireRunFinished("completed")
+	m.fireRunFinished("completed")
+	m.fireRunFinished("stopped")
+	m.fireIterationObserved("codex", 3*time.Second)
+	m.llmCallObserved("claude", 200*time.Millisecond, "LLM_TIMEOUT")
+	m.llmCallObserved("x\"} 1\nfake_metric{a=\"", time.Second, "")
+	m.setGaugeFunc(metricChatSessionsAlive, func() float64 { return 2 })
+
+	rr := httptest.NewRecorder()
+	MetricsHandler(m).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE ohmyagentflow_fire_runs_total counter",
+		`ohmyagentflow_fire_runs_total{reason="completed"} 2`,
+		`ohmyagentflow_fire_runs_total{reason="stopped"} 1`,
+		"ohmyagentflow_fire_active_runs 0",
+		`ohmyagentflow_fire_iteration_duration_seconds_bucket{tool="codex",le="2.5"} 0`,
+		`ohmyagentflow_fire_iteration_duration_seconds_bucket{tool="codex",le="5"} 1`,
+		`ohmyagentflow_fire_iteration_duration_seconds_bucket{tool="codex",le="+Inf"} 1`,
+		`ohmyagentflow_fire_iteration_duration_seconds_count{tool="codex"} 1`,
+		"ohmyagentflow_chat_sessions_alive 2",
+		`ohmyagentflow_llm_call_failures_total{tool="claude",code="LLM_TIMEOUT"} 1`,
+		`ohmyagentflow_llm_call_duration_seconds_count{tool="claude"} 1`,
+		`ohmyagentflow_llm_call_duration_seconds_count{tool="other"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "fake_metric") {
+		t.Fatalf("expected unknown tools to be labelled other, got:\n%s", body)
+	}
+}
+
+func TestMetrics_StreamHubCountsPublishedDroppedAndArchiveBytes(t *testing.T) {
+	m := NewMetrics()
+	hub := NewStreamHub(StreamHubConfig{
+		MaxEventsPerRun:   100,
+		SubscriberBufSize: 1,
+		ArchiveDir:        filepath.Join(t.TempDir(), "runs"),
+		Metrics:           m,
+	})
+
+	_, _, unsub, _ := hub.ReplayAndSubscribe("r1", 0)
+	for i := 0; i < 3; i++ {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "x"}})
+	}
+
+	body := string(m.render())
+	if !strings.Contains(body, `ohmyagentflow_stream_events_published_total{type="process_stdout"} 3`) {
+		t.Fatalf("expected 3 published events, got:\n%s", body)
+	}
+	if !strings.Contains(body, "ohmyagentflow_stream_events_dropped_total 2") {
+		t.Fatalf("expected 2 dropped events, got:\n%s", body)
+	}
+	if !strings.Contains(body, `ohmyagentflow_stream_subscriber_dropped_events{subscriber="1",run_id="r1"} 2`) {
+		t.Fatalf("expected per-subscriber drop count, got:\n%s", body)
+	}
+	if strings.Contains(body, "ohmyagentflow_archive_bytes_written_total 0\n") {
+		t.Fatalf("expected archive bytes to be counted, got:\n%s", body)
+	}
+
+	unsub()
+	body = string(m.render())
+	if strings.Contains(body, `subscriber="1"`) {
+		t.Fatalf("expected per-subscriber series to be removed after unsubscribe, got:\n%s", body)
+	}
+}
+
+func TestMetrics_NilIsSafe(t *testing.T) {
+	var m *Metrics
+	m.fireRunFinished("completed")
+	m.streamEventDropped(1, "r")
+	m.setGaugeFunc(metricFireActiveRuns, func() float64 { return 1 })
+	if got := m.render(); got != nil {
+		t.Fatalf("expected nil render for nil metrics, got %q", got)
+	}
+}
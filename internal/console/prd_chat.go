@@ -12,6 +12,11 @@ import (
 	"time"
 )
 
+const (
+	DefaultPRDChatSessionTTL   = 30 * time.Minute
+	DefaultPRDChatModelTimeout = 25 * time.Second
+)
+
 type PRDChatConfig struct {
 	ProjectRoot string
 	SessionTTL  time.Duration
@@ -20,6 +25,11 @@ type PRDChatConfig struct {
 	// Optional. If nil, chat messages are applied directly (no model call).
 	ModelToolFunc PRDChatModelToolFunc
 	ModelTimeout  time.Duration
+
+	Metrics *Metrics
+
+	// Optional. Snapshots an existing PRD before finalize overwrites it.
+	Backups *BackupStore
 }
 
 type PRDChatService struct {
@@ -28,6 +38,9 @@ type PRDChatService struct {
 	now         func() time.Time
 	modelFunc   PRDChatModelToolFunc
 	modelTO     time.Duration
+	metrics     *Metrics
+	backups     *BackupStore
+	paths       *SafePath
 
 	mu       sync.Mutex
 	sessions map[string]*prdChatSession
@@ -93,6 +106,7 @@ type PRDChatFinalizeResponse struct {
 	Path      string           `json:"path,omitempty"`
 	Content   string           `json:"content,omitempty"`
 	Size      int64            `json:"size,omitempty"`
+	BackupID  string           `json:"backupId,omitempty"`
 	Missing   []string         `json:"missing,omitempty"`
 	Warnings  []string         `json:"warnings,omitempty"`
 	SlotState PRDChatSlotState `json:"slotState"`
@@ -105,7 +119,7 @@ func NewPRDChatService(cfg PRDChatConfig) (*PRDChatService, error) {
 	}
 	ttl := cfg.SessionTTL
 	if ttl <= 0 {
-		ttl = 30 * time.Minute
+		ttl = DefaultPRDChatSessionTTL
 	}
 	now := cfg.Now
 	if now == nil {
@@ -113,20 +127,34 @@ func NewPRDChatService(cfg PRDChatConfig) (*PRDChatService, error) {
 	}
 	modelTO := cfg.ModelTimeout
 	if modelTO <= 0 {
-		modelTO = 25 * time.Second
+		modelTO = DefaultPRDChatModelTimeout
 	}
 	modelFn := cfg.ModelToolFunc
 	if modelFn == nil {
 		modelFn = DefaultPRDChatModelToolFunc
 	}
-	return &PRDChatService{
+	paths, err := NewSafePath(SafePathConfig{ProjectRoot: projectRoot})
+	if err != nil {
+		return nil, err
+	}
+	s := &PRDChatService{
 		projectRoot: projectRoot,
 		ttl:         ttl,
 		now:         now,
 		modelFunc:   modelFn,
 		modelTO:     modelTO,
+		metrics:     cfg.Metrics,
+		backups:     cfg.Backups,
+		paths:       paths,
 		sessions:    make(map[string]*prdChatSession),
-	}, nil
+	}
+	cfg.Metrics.setGaugeFunc(metricChatSessionsAlive, func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cleanupLocked(s.now())
+		return float64(len(s.sessions))
+	})
+	return s, nil
 }
 
 func (s *PRDChatService) SessionHandler() http.HandlerFunc {
@@ -245,7 +273,13 @@ func (s *PRDChatService) MessageHandler() http.HandlerFunc {
 			}
 			ctx, cancel := context.WithTimeout(r.Context(), s.modelTO)
 			defer cancel()
+			callStartedAt := time.Now()
 			commands, apiErr, status := prdChatTranslateToCommands(ctx, s.modelFunc, PRDChatTool(req.Tool), stateSnap, activeStorySnap, req.Message)
+			failureCode := ""
+			if apiErr != nil {
+				failureCode = apiErr.Code
+			}
+			s.metrics.llmCallObserved(req.Tool, time.Since(callStartedAt), failureCode)
 			if apiErr != nil {
 				WriteAPIError(w, status, *apiErr)
 				return
@@ -393,7 +427,11 @@ func (s *PRDChatService) FinalizeHandler() http.HandlerFunc {
 		}
 
 		relPath := fmt.Sprintf("tasks/prd-%s.md", strings.TrimSpace(state.FrontMatter.FeatureSlug))
-		destAbs := filepath.Join(projectRoot, filepath.FromSlash(relPath))
+		destAbs, apiErr, status := s.paths.ResolveWrite(relPath, ConsoleWriteWhitelist)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
 		if err := os.MkdirAll(filepath.Dir(destAbs), 0o755); err != nil {
 			WriteAPIError(w, http.StatusInternalServerError, APIError{
 				Code:    "INTERNAL_ERROR",
@@ -402,7 +440,9 @@ func (s *PRDChatService) FinalizeHandler() http.HandlerFunc {
 			})
 			return
 		}
-		if err := writeFileAtomicWithPrefix(destAbs, []byte(content), 0o644, ".prd-*"); err != nil {
+		before := snapshotFile(destAbs)
+		backupID, err := s.backups.WriteFile(destAbs, []byte(content), 0o644, ".prd-*")
+		if err != nil {
 			WriteAPIError(w, http.StatusInternalServerError, APIError{
 				Code:    "INTERNAL_ERROR",
 				Message: "failed to write PRD file",
@@ -410,12 +450,14 @@ func (s *PRDChatService) FinalizeHandler() http.HandlerFunc {
 			})
 			return
 		}
+		recordAuditFileWrite(r.Context(), relPath, before, []byte(content), s.backups.RelPath(backupID))
 
 		resp := PRDChatFinalizeResponse{
 			OK:        true,
 			Path:      relPath,
 			Content:   content,
 			Size:      int64(len([]byte(content))),
+			BackupID:  backupID,
 			Warnings:  state.Warnings,
 			SlotState: state,
 		}
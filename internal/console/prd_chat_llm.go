@@ -25,15 +25,21 @@ const (
 )
 
 func DefaultPRDChatModelToolFunc(ctx context.Context, tool PRDChatTool, prompt string) ([]byte, error) {
-	var cmd *exec.Cmd
+	var (
+		cmd *exec.Cmd
+		err error
+	)
 	switch tool {
 	case PRDChatToolCodex:
-		cmd = exec.CommandContext(ctx, "codex", "exec", "--dangerously-bypass-approvals-and-sandbox", "-")
+		cmd, err = consoleExecPolicy.CommandContext(ctx, "", "codex", "exec", "--dangerously-bypass-approvals-and-sandbox", "-")
 	case PRDChatToolClaude:
-		cmd = exec.CommandContext(ctx, "claude", "--dangerously-skip-permissions", "--print")
+		cmd, err = consoleExecPolicy.CommandContext(ctx, "", "claude", "--dangerously-skip-permissions", "--print")
 	default:
 		return nil, fmt.Errorf("unsupported tool: %q", tool)
 	}
+	if err != nil {
+		return nil, err
+	}
 	cmd.Stdin = strings.NewReader(prompt)
 	return cmd.CombinedOutput()
 }
@@ -16,6 +16,8 @@ var featureSlugRe = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
 
 type PRDGenerateConfig struct {
 	ProjectRoot string
+	// Optional. Snapshots an existing PRD before it is overwritten.
+	Backups *BackupStore
 }
 
 type PRDGenerateFrontMatter struct {
@@ -48,10 +50,14 @@ type PRDGenerateResponse struct {
 	Content string `json:"content"`
 	Size    int64  `json:"size"`
 	Preview bool   `json:"preview"`
+	// BackupID identifies the snapshot of the PRD this write replaced.
+	BackupID string `json:"backupId,omitempty"`
 }
 
 func PRDGenerateHandler(cfg PRDGenerateConfig) http.HandlerFunc {
 	projectRoot := strings.TrimSpace(cfg.ProjectRoot)
+	backups := cfg.Backups
+	paths, pathsErr := NewSafePath(SafePathConfig{ProjectRoot: projectRoot})
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.Header().Set("Allow", http.MethodPost)
@@ -66,6 +72,14 @@ func PRDGenerateHandler(cfg PRDGenerateConfig) http.HandlerFunc {
 			})
 			return
 		}
+		if pathsErr != nil {
+			WriteAPIError(w, http.StatusInternalServerError, APIError{
+				Code:    "INTERNAL_ERROR",
+				Message: "failed to resolve project root",
+				Hint:    pathsErr.Error(),
+			})
+			return
+		}
 
 		preview := isTruthy(r.URL.Query().Get("preview"))
 
@@ -96,7 +110,11 @@ func PRDGenerateHandler(cfg PRDGenerateConfig) http.HandlerFunc {
 		}
 
 		if !preview {
-			destAbs := filepath.Join(projectRoot, filepath.FromSlash(relPath))
+			destAbs, apiErr, status := paths.ResolveWrite(relPath, ConsoleWriteWhitelist)
+			if apiErr != nil {
+				WriteAPIError(w, status, *apiErr)
+				return
+			}
 			if err := os.MkdirAll(filepath.Dir(destAbs), 0o755); err != nil {
 				WriteAPIError(w, http.StatusInternalServerError, APIError{
 					Code:    "INTERNAL_ERROR",
@@ -105,7 +123,9 @@ func PRDGenerateHandler(cfg PRDGenerateConfig) http.HandlerFunc {
 				})
 				return
 			}
-			if err := writeFileAtomicWithPrefix(destAbs, []byte(content), 0o644, ".prd-*"); err != nil {
+			before := snapshotFile(destAbs)
+			backupID, err := backups.WriteFile(destAbs, []byte(content), 0o644, ".prd-*")
+			if err != nil {
 				WriteAPIError(w, http.StatusInternalServerError, APIError{
 					Code:    "INTERNAL_ERROR",
 					Message: "failed to write PRD file",
@@ -113,6 +133,8 @@ func PRDGenerateHandler(cfg PRDGenerateConfig) http.HandlerFunc {
 				})
 				return
 			}
+			recordAuditFileWrite(r.Context(), relPath, before, []byte(content), backups.RelPath(backupID))
+			resp.BackupID = backupID
 		}
 
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -0,0 +1,173 @@
+package console
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procClockTicks is USER_HZ, the unit of utime/stime in /proc/<pid>/stat; it
+// is 100 on every Linux architecture Go supports.
+const procClockTicks = 100
+
+// procRoot is where procfs is mounted; tests point it at a fake tree.
+var procRoot = "/proc"
+
+// procStat is the subset of /proc/<pid>/stat the console uses.
+type procStat struct {
+	PID      int
+	PPID     int
+	PGID     int
+	Comm     string
+	State    string
+	CPUTicks uint64 // utime + stime
+	// StartTicks is the start time in clock ticks after boot.
+	StartTicks uint64
+	RSSPages   int64
+}
+
+var errProcUnavailable = errors.New("procfs is not available")
+
+// parseProcStat parses one /proc/<pid>/stat line. comm may contain spaces and
+// parentheses, so fields are taken after the last ')'.
+func parseProcStat(line string) (procStat, error) {
+	open := strings.IndexByte(line, '(')
+	end := strings.LastIndexByte(line, ')')
+	if open <= 0 || end < open {
+		return procStat{}, errors.New("malformed stat line")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line[:open]))
+	if err != nil {
+		return procStat{}, err
+	}
+	// Fields from 3 (state) on; field n is at index n-3.
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, errors.New("short stat line")
+	}
+	st := procStat{PID: pid, Comm: line[open+1 : end], State: fields[0]}
+	st.PPID, _ = strconv.Atoi(fields[1])
+	st.PGID, _ = strconv.Atoi(fields[2])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	st.CPUTicks = utime + stime
+	st.StartTicks, _ = strconv.ParseUint(fields[19], 10, 64)
+	st.RSSPages, _ = strconv.ParseInt(fields[21], 10, 64)
+	return st, nil
+}
+
+// readProcStats returns every process visible under procRoot. Processes that
+// exit while the directory is being read are skipped.
+func readProcStats() ([]procStat, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, errProcUnavailable
+	}
+	var out []procStat
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(procRoot, e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		if st, err := parseProcStat(strings.TrimSpace(string(raw))); err == nil {
+			out = append(out, st)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errProcUnavailable
+	}
+	return out, nil
+}
+
+// readProcStat returns the stat of one process.
+func readProcStat(pid int) (procStat, error) {
+	raw, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	return parseProcStat(strings.TrimSpace(string(raw)))
+}
+
+// procGroupUsage sums the live (non-zombie) members of a process group.
+type procGroupUsage struct {
+	Processes  int
+	RSSBytes   int64
+	CPUSeconds float64
+}
+
+func sampleProcessGroup(pgid int) (procGroupUsage, error) {
+	stats, err := readProcStats()
+	if err != nil {
+		return procGroupUsage{}, err
+	}
+	page := int64(os.Getpagesize())
+	var u procGroupUsage
+	var ticks uint64
+	for _, st := range stats {
+		if st.PGID != pgid || st.State == "Z" || st.State == "X" {
+			continue
+		}
+		u.Processes++
+		u.RSSBytes += st.RSSPages * page
+		ticks += st.CPUTicks
+	}
+	u.CPUSeconds = float64(ticks) / procClockTicks
+	return u, nil
+}
+
+// procCmdline returns the argv of pid joined with spaces, or "" for kernel
+// threads, zombies and processes that have exited.
+func procCmdline(pid int) string {
+	raw, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(raw), "\x00", " "))
+}
+
+// procUptime returns the seconds since boot.
+func procUptime() (float64, error) {
+	raw, err := os.ReadFile(filepath.Join(procRoot, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return 0, errors.New("empty uptime")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// procChildren indexes pids by parent pid.
+func procChildren(stats []procStat) map[int][]int {
+	children := make(map[int][]int)
+	for _, st := range stats {
+		children[st.PPID] = append(children[st.PPID], st.PID)
+	}
+	return children
+}
+
+// descendantPIDs walks children breadth-first from rootPID, excluding it.
+func descendantPIDs(children map[int][]int, rootPID int) []int {
+	var res []int
+	seen := map[int]struct{}{rootPID: {}}
+	queue := []int{rootPID}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, child := range children[cur] {
+			if _, ok := seen[child]; ok {
+				continue
+			}
+			seen[child] = struct{}{}
+			res = append(res, child)
+			queue = append(queue, child)
+		}
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseProcStat(t *testing.T) {
+	line := "4242 (node (worker) x) S 4200 4100 4100 0 -1 4194304 100 0 0 0 250 50 0 0 20 0 7 0 12345 1000000 2048 18446744073709551615"
+	st, err := parseProcStat(line)
+	if err != nil {
+		t.Fatalf("parseProcStat: %v", err)
+	}
+	if st.PID != 4242 || st.Comm != "node (worker) x" || st.State != "S" || st.PPID != 4200 || st.PGID != 4100 || st.CPUTicks != 300 || st.RSSPages != 2048 {
+		t.Fatalf("unexpected stat: %+v", st)
+	}
+	for _, bad := range []string{"", "4242 node S 1", "4242 (sh) S 1 2 3"} {
+		if _, err := parseProcStat(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSampleProcessGroup_SumsLiveMembers(t *testing.T) {
+	root := t.TempDir()
+	orig := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = orig })
+
+	stat := func(pid string, line string) {
+		dir := filepath.Join(root, pid)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(line+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat("100", "100 (bash) S 1 100 100 0 -1 0 0 0 0 0 100 50 0 0 20 0 1 0 1 0 10")
+	stat("101", "101 (codex) R 100 100 100 0 -1 0 0 0 0 0 200 0 0 0 20 0 1 0 1 0 30")
+	stat("102", "102 (defunct) Z 100 100 100 0 -1 0 0 0 0 0 900 0 0 0 20 0 1 0 1 0 0")
+	stat("200", "200 (other) S 1 200 200 0 -1 0 0 0 0 0 500 0 0 0 20 0 1 0 1 0 99")
+	if err := os.MkdirAll(filepath.Join(root, "self"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := sampleProcessGroup(100)
+	if err != nil {
+		t.Fatalf("sampleProcessGroup: %v", err)
+	}
+	if u.Processes != 2 || u.RSSBytes != 40*int64(os.Getpagesize()) || u.CPUSeconds != 3.5 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+
+	procRoot = filepath.Join(root, "missing")
+	if _, err := sampleProcessGroup(100); err != errProcUnavailable {
+		t.Fatalf("expected errProcUnavailable, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ package console
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"os/exec"
 	"strconv"
@@ -18,6 +19,15 @@ func setProcessGroup(cmd *exec.Cmd) {
 	cmd.SysProcAttr.Setpgid = true
 }
 
+// setSession starts cmd in a new session, which also makes it the leader of
+// a new process group, away from the console's terminal.
+func setSession(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+}
+
 func sendInterruptToProcessGroup(pgid int, pid int) error {
 	if pid > 0 {
 		_ = killProcessTreeBestEffort(pid, syscall.SIGINT)
@@ -42,6 +52,14 @@ func sendKillToProcessGroup(pgid int, pid int) error {
 	return nil
 }
 
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
 func processGroupExists(pgid int) bool {
 	if pgid <= 0 {
 		return false
@@ -58,7 +76,7 @@ func processGroupExists(pgid int) bool {
 }
 
 func killProcessTreeBestEffort(rootPID int, sig syscall.Signal) error {
-	pids, err := listDescendantPIDsViaPS(rootPID)
+	pids, err := listDescendantPIDs(rootPID)
 	if err != nil {
 		// Fall back to best-effort root kill.
 		if err2 := syscall.Kill(rootPID, sig); err2 != nil && !errors.Is(err2, syscall.ESRCH) {
@@ -79,8 +97,20 @@ func killProcessTreeBestEffort(rootPID int, sig syscall.Signal) error {
 	return nil
 }
 
+// listDescendantPIDs reads /proc where it is mounted (Linux) and falls back to
+// ps elsewhere, e.g. on macOS.
+func listDescendantPIDs(rootPID int) ([]int, error) {
+	if stats, err := readProcStats(); err == nil {
+		return descendantPIDs(procChildren(stats), rootPID), nil
+	}
+	return listDescendantPIDsViaPS(rootPID)
+}
+
 func listDescendantPIDsViaPS(rootPID int) ([]int, error) {
-	cmd := exec.Command("ps", "-eo", "pid=,ppid=")
+	cmd, err := consoleExecPolicy.CommandContext(context.Background(), "", "ps", "-eo", "pid=,ppid=")
+	if err != nil {
+		return nil, err
+	}
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, err
@@ -100,21 +130,5 @@ func listDescendantPIDsViaPS(rootPID int) ([]int, error) {
 		}
 		childrenByPPID[ppid] = append(childrenByPPID[ppid], pid)
 	}
-
-	var res []int
-	seen := map[int]struct{}{rootPID: {}}
-	queue := []int{rootPID}
-	for len(queue) > 0 {
-		cur := queue[0]
-		queue = queue[1:]
-		for _, child := range childrenByPPID[cur] {
-			if _, ok := seen[child]; ok {
-				continue
-			}
-			seen[child] = struct{}{}
-			res = append(res, child)
-			queue = append(queue, child)
-		}
-	}
-	return res, nil
+	return descendantPIDs(childrenByPPID, rootPID), nil
 }
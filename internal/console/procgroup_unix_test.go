@@ -0,0 +1,51 @@
+//go:build !windows
+
+package console
+
+import (
+	"os/exec"
+	"runtime"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListDescendantPIDs_FindsGrandchildren(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sh -c 'sleep 5' & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = killProcessTreeBestEffort(cmd.Process.Pid, syscall.SIGKILL)
+		_ = cmd.Wait()
+	})
+
+	var pids []int
+	deadline := time.Now().Add(3 * time.Second)
+	for len(pids) < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		var err error
+		if pids, err = listDescendantPIDs(cmd.Process.Pid); err != nil {
+			t.Fatalf("listDescendantPIDs: %v", err)
+		}
+	}
+	if len(pids) < 2 || slices.Contains(pids, cmd.Process.Pid) {
+		t.Fatalf("expected the child and grandchild, got %v", pids)
+	}
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if _, err := exec.LookPath("ps"); err != nil {
+		return
+	}
+	viaPS, err := listDescendantPIDsViaPS(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("listDescendantPIDsViaPS: %v", err)
+	}
+	slices.Sort(pids)
+	slices.Sort(viaPS)
+	if !slices.Equal(pids, viaPS) {
+		t.Fatalf("/proc and ps disagree: %v vs %v", pids, viaPS)
+	}
+}
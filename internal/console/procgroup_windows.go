@@ -11,6 +11,8 @@ func setProcessGroup(cmd *exec.Cmd) {
 	// Windows doesn't support Unix-style process groups via SysProcAttr.Setpgid.
 }
 
+func setSession(cmd *exec.Cmd) {}
+
 func sendInterruptToProcessGroup(pgid int, pid int) error {
 	if pid <= 0 {
 		return nil
@@ -35,6 +37,10 @@ func sendKillToProcessGroup(pgid int, pid int) error {
 	return nil
 }
 
+func processExists(pid int) bool {
+	return false
+}
+
 func processGroupExists(pgid int) bool {
 	return false
 }
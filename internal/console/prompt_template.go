@@ -0,0 +1,510 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// promptRecentProgressEntries is how many of the latest progress.txt
+	// entries contribute their learnings to .RecentLearnings.
+	promptRecentProgressEntries = 3
+	maxPromptLearningsBytes     = 8 << 10
+	// maxRenderedPromptRuns bounds the per-run directories kept under the
+	// rendered prompt archive.
+	maxRenderedPromptRuns = 50
+)
+
+// promptTemplateMarker, at the start of a prompt file, makes the console
+// render the file as a text/template. Other prompt files are sent as they
+// are, so a literal "{{" (a code sample, Handlebars or JSX docs) stays text.
+const promptTemplateMarker = "<!-- ohmyagentflow:template -->"
+
+// defaultPromptContextTemplate is appended to prompt files that are not
+// templates, so the stock CODEX.md/CLAUDE.md (which ralph-codex.sh also pipes
+// verbatim) still gets the iteration context in loop mode.
+const defaultPromptContextTemplate = `
+
+## Current Iteration (provided by the console)
+
+{{if .Targets}}This run is limited to {{range $i, $t := .Targets}}{{if $i}}, {{end}}{{$t.ID}}{{end}}. Do not work on any other story; the run ends when these stories pass.
+
+{{end}}Iteration {{.Iteration}} of {{.MaxIterations}}{{if .BranchName}} on branch ` + "`{{.BranchName}}`" + `{{end}}; {{.PassedStories}} of {{.TotalStories}} stories pass.
+{{with .Story}}
+Work on this story next: **{{.ID}} - {{.Title}}** (priority {{.Priority}})
+
+{{.Description}}
+
+Acceptance criteria:
+{{range .AcceptanceCriteria}}- {{.}}
+{{end}}{{if .Notes}}
+Notes: {{.Notes}}
+{{end}}{{else}}
+All stories in prd.json already pass.
+{{end}}{{if .Patterns}}
+Codebase patterns from progress.txt:
+
+{{.Patterns}}
+{{end}}{{if .RecentLearnings}}
+Recent learnings from progress.txt:
+
+{{.RecentLearnings}}
+{{end}}`
+
+var reTemplateErrLine = regexp.MustCompile(`^template: [^:]+:(\d+):(?:(\d+):)?`)
+
+// PromptIteration identifies the Fire iteration a prompt is rendered for.
+type PromptIteration struct {
+	Tool          FireTool
+	Iteration     int
+	MaxIterations int
+	// StoryIDs limits a single-story run to these stories.
+	StoryIDs []string
+}
+
+// PromptTemplateData is the data a prompt file is rendered with (text/template).
+type PromptTemplateData struct {
+	Tool          string `json:"tool"`
+	Iteration     int    `json:"iteration"`
+	MaxIterations int    `json:"maxIterations"`
+
+	Project     string `json:"project"`
+	BranchName  string `json:"branchName"`
+	Description string `json:"description"`
+
+	// Story is the next pending story (passes:false, lowest priority number,
+	// among Targets when set); nil when every such story passes.
+	Story *PromptStory `json:"story"`
+	// Targets are the stories a single-story run is limited to, in prd.json
+	// order; empty for other runs.
+	Targets       []PromptStory `json:"targets"`
+	Pending       []PromptStory `json:"pending"`
+	TotalStories  int           `json:"totalStories"`
+	PassedStories int           `json:"passedStories"`
+
+	// Patterns is the "## Codebase Patterns" section of progress.txt and
+	// RecentLearnings the learnings of its latest entries.
+	Patterns        string `json:"patterns"`
+	RecentLearnings string `json:"recentLearnings"`
+
+	Marker string `json:"marker"`
+}
+
+type PromptStory struct {
+	ID                 string   `json:"id"`
+	Title              string   `json:"title"`
+	Description        string   `json:"description"`
+	AcceptanceCriteria []string `json:"acceptanceCriteria"`
+	Priority           int      `json:"priority"`
+	Passes             bool     `json:"passes"`
+	Notes              string   `json:"notes"`
+}
+
+type PromptPreviewRequest struct {
+	Tool string `json:"tool"`
+	// Content renders an unsaved draft instead of the prompt file on disk.
+	Content       string   `json:"content,omitempty"`
+	Iteration     int      `json:"iteration,omitempty"`
+	MaxIterations int      `json:"maxIterations,omitempty"`
+	StoryIDs      []string `json:"storyIds,omitempty"`
+}
+
+type PromptPreviewResponse struct {
+	Name     string             `json:"name"`
+	Rendered string             `json:"rendered"`
+	SHA256   string             `json:"sha256"`
+	Data     PromptTemplateData `json:"data"`
+}
+
+// promptFileForTool names the prompt file ralph-codex.sh pipes to tool.
+func promptFileForTool(tool FireTool) string {
+	if tool == FireToolClaude {
+		return "CLAUDE.md"
+	}
+	return "CODEX.md"
+}
+
+func parsePromptTemplate(name string, src string) (*template.Template, error) {
+	funcs := template.FuncMap{"join": strings.Join}
+	if strings.HasPrefix(src, promptTemplateMarker) {
+		// The marker stays in the prompt: it is an HTML comment, and error
+		// line numbers keep matching the file.
+		return template.New(name).Option("missingkey=error").Funcs(funcs).Parse(src)
+	}
+	funcs["promptText"] = func() string { return src }
+	return template.New(name).Option("missingkey=error").Funcs(funcs).Parse("{{promptText}}" + defaultPromptContextTemplate)
+}
+
+func renderPromptTemplate(name string, src string, data PromptTemplateData) (string, error) {
+	tmpl, err := parsePromptTemplate(name, src)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func promptTemplateError(name string, err error) *APIError {
+	apiErr := &APIError{
+		Code:    "PROMPT_TEMPLATE_INVALID",
+		Message: fmt.Sprintf("%s is not a valid prompt template.", name),
+		Hint:    err.Error(),
+		File:    name,
+	}
+	if m := reTemplateErrLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		col, _ := strconv.Atoi(m[2])
+		apiErr.Location = &SourceLocation{Line: line, Column: max(col, 1)}
+	}
+	return apiErr
+}
+
+// loadPRD reads and parses prd.json.
+func loadPRD(paths *SafePath) (ConvertedPRD, *APIError, int) {
+	var prd ConvertedPRD
+	prdAbs, _, apiErr, status := paths.ResolveRead("prd.json", fireInputWhitelist)
+	if apiErr != nil {
+		if apiErr.Code == "FS_READ_NOT_FOUND" {
+			return prd, &APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "prd.json not found.",
+				Hint:    "Run Convert first to generate prd.json.",
+			}, http.StatusBadRequest
+		}
+		return prd, apiErr, status
+	}
+	raw, _, err := readFileUpTo(prdAbs, DefaultMaxReadBytes)
+	if err != nil {
+		return prd, &APIError{Code: "INTERNAL_ERROR", Message: "failed to read prd.json", Hint: err.Error()}, http.StatusInternalServerError
+	}
+	if err := json.Unmarshal(raw, &prd); err != nil {
+		return prd, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "prd.json is not valid JSON.",
+			Hint:    err.Error(),
+			File:    "prd.json",
+		}, http.StatusBadRequest
+	}
+	return prd, nil, http.StatusOK
+}
+
+// validateStoryIDs checks that every id names a story in prd.
+func validateStoryIDs(prd ConvertedPRD, ids []string) *APIError {
+	known := make(map[string]bool, len(prd.UserStories))
+	for _, us := range prd.UserStories {
+		known[us.ID] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			return &APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: fmt.Sprintf("story %q is not in prd.json.", id),
+				Hint:    "Use the ids from prd.json userStories (e.g. US-001).",
+				File:    "prd.json",
+			}
+		}
+	}
+	return nil
+}
+
+// loadPromptTemplateData reads prd.json and progress.txt for an iteration.
+func loadPromptTemplateData(paths *SafePath, it PromptIteration) (PromptTemplateData, *APIError, int) {
+	data := PromptTemplateData{
+		Tool:          string(it.Tool),
+		Iteration:     it.Iteration,
+		MaxIterations: it.MaxIterations,
+		Pending:       []PromptStory{},
+		Targets:       []PromptStory{},
+		Marker:        PromptCompleteMarker,
+	}
+
+	prd, apiErr, status := loadPRD(paths)
+	if apiErr != nil {
+		return data, apiErr, status
+	}
+	if apiErr := validateStoryIDs(prd, it.StoryIDs); apiErr != nil {
+		return data, apiErr, http.StatusBadRequest
+	}
+	targeted := make(map[string]bool, len(it.StoryIDs))
+	for _, id := range it.StoryIDs {
+		targeted[id] = true
+	}
+	data.Project, data.BranchName, data.Description = prd.Project, prd.BranchName, prd.Description
+	var next []PromptStory
+	for _, us := range prd.UserStories {
+		story := PromptStory{
+			ID:                 us.ID,
+			Title:              us.Title,
+			Description:        us.Description,
+			AcceptanceCriteria: us.AcceptanceCriteria,
+			Priority:           us.Priority,
+			Passes:             us.Passes,
+			Notes:              us.Notes,
+		}
+		data.TotalStories++
+		if targeted[us.ID] {
+			data.Targets = append(data.Targets, story)
+		}
+		if us.Passes {
+			data.PassedStories++
+			continue
+		}
+		data.Pending = append(data.Pending, story)
+		if len(targeted) == 0 || targeted[us.ID] {
+			next = append(next, story)
+		}
+	}
+	sort.SliceStable(data.Pending, func(i, j int) bool { return data.Pending[i].Priority < data.Pending[j].Priority })
+	sort.SliceStable(next, func(i, j int) bool { return next[i].Priority < next[j].Priority })
+	if len(next) > 0 {
+		data.Story = &next[0]
+	}
+
+	if progressAbs, _, apiErr, _ := paths.ResolveRead("progress.txt", fireInputWhitelist); apiErr == nil {
+		if raw, _, err := readFileUpTo(progressAbs, DefaultMaxReadBytes); err == nil {
+			data.Patterns, data.RecentLearnings = extractProgressLearnings(string(raw))
+		}
+	}
+	return data, nil, http.StatusOK
+}
+
+// extractProgressLearnings returns the Codebase Patterns section and the
+// "Learnings for future iterations" of the latest progress.txt entries.
+func extractProgressLearnings(progress string) (patterns string, recent string) {
+	lines := strings.Split(strings.ReplaceAll(progress, "\r\n", "\n"), "\n")
+
+	type entry struct {
+		heading   string
+		learnings []string
+	}
+	var entries []entry
+	var pat []string
+	inPatterns, inLearnings := false, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "## "):
+			inPatterns, inLearnings = false, false
+			if strings.EqualFold(trimmed, "## Codebase Patterns") {
+				inPatterns = true
+				continue
+			}
+			entries = append(entries, entry{heading: strings.TrimSpace(strings.TrimPrefix(line, "## "))})
+		case trimmed == "---" || strings.HasPrefix(line, "Started:"):
+			inPatterns, inLearnings = false, false
+		case inPatterns:
+			if trimmed != "" {
+				pat = append(pat, line)
+			}
+		case len(entries) > 0 && strings.Contains(trimmed, "Learnings for future iterations"):
+			inLearnings = true
+		case inLearnings && strings.HasPrefix(trimmed, "- "):
+			last := &entries[len(entries)-1]
+			last.learnings = append(last.learnings, trimmed)
+		case inLearnings && strings.HasPrefix(trimmed, "-"):
+			inLearnings = false
+		}
+	}
+
+	var b strings.Builder
+	start := max(0, len(entries)-promptRecentProgressEntries)
+	for _, e := range entries[start:] {
+		if len(e.learnings) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("### " + e.heading + "\n")
+		for _, l := range e.learnings {
+			b.WriteString(l + "\n")
+		}
+	}
+	return truncateLearnings(strings.Join(pat, "\n")), truncateLearnings(strings.TrimSpace(b.String()))
+}
+
+func truncateLearnings(s string) string {
+	if len(s) <= maxPromptLearningsBytes {
+		return s
+	}
+	cut := strings.LastIndexByte(s[:maxPromptLearningsBytes], '\n')
+	if cut <= 0 {
+		cut = maxPromptLearningsBytes
+	}
+	return s[:cut] + "\n…"
+}
+
+// RenderIteration renders the tool's prompt file for one Fire iteration and
+// returns it with the prompt version it was rendered from.
+func (s *PromptStore) RenderIteration(it PromptIteration) (string, PromptRef, *APIError, int) {
+	name := promptFileForTool(it.Tool)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, exists, apiErr, status := s.readCurrent(name)
+	if apiErr != nil {
+		return "", PromptRef{}, apiErr, status
+	}
+	if !exists {
+		return "", PromptRef{}, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: fmt.Sprintf("%s not found.", name),
+			Hint:    fmt.Sprintf("Create %s (see POST /api/prompts/%s) before starting Fire.", name, name),
+		}, http.StatusBadRequest
+	}
+	v, err := s.currentVersionLocked(name, content)
+	if err != nil {
+		return "", PromptRef{}, &APIError{Code: "INTERNAL_ERROR", Message: "failed to record prompt history", Hint: err.Error()}, http.StatusInternalServerError
+	}
+	data, apiErr, status := loadPromptTemplateData(s.paths, it)
+	if apiErr != nil {
+		return "", PromptRef{}, apiErr, status
+	}
+	rendered, err := renderPromptTemplate(name, content, data)
+	if err != nil {
+		return "", PromptRef{}, promptTemplateError(name, err), http.StatusBadRequest
+	}
+	return rendered, PromptRef{Name: name, Version: v.Version, SHA256: v.SHA256}, nil, http.StatusOK
+}
+
+// ArchiveRendered stores the prompt sent in one iteration and returns its
+// project-relative path.
+func (s *PromptStore) ArchiveRendered(runID string, iteration int, rendered string) (string, error) {
+	safeName := sanitizeRunIDForFilename(runID)
+	if safeName == "" {
+		return "", fmt.Errorf("invalid run id %q", runID)
+	}
+	runDir := filepath.Join(s.renderedDir, safeName)
+	created := false
+	if _, err := os.Stat(runDir); errors.Is(err, os.ErrNotExist) {
+		created = true
+	}
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		return "", err
+	}
+	if created {
+		s.pruneRendered()
+	}
+	abs := filepath.Join(runDir, fmt.Sprintf("iteration-%d.md", iteration))
+	if err := writeFileAtomicWithPrefix(abs, []byte(rendered), 0o644, ".prompt-*"); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.paths.Root(), abs)
+	if err != nil {
+		return abs, nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// pruneRendered keeps the newest maxRenderedPromptRuns run directories.
+func (s *PromptStore) pruneRendered() {
+	ents, err := os.ReadDir(s.renderedDir)
+	if err != nil || len(ents) <= maxRenderedPromptRuns {
+		return
+	}
+	type dirInfo struct {
+		name    string
+		modTime time.Time
+	}
+	var dirs []dirInfo
+	for _, ent := range ents {
+		info, err := ent.Info()
+		if err != nil || !ent.IsDir() {
+			continue
+		}
+		dirs = append(dirs, dirInfo{name: ent.Name(), modTime: info.ModTime()})
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].modTime.After(dirs[j].modTime) })
+	for _, d := range dirs[min(len(dirs), maxRenderedPromptRuns):] {
+		_ = os.RemoveAll(filepath.Join(s.renderedDir, d.name))
+	}
+}
+
+func (s *PromptStore) PreviewHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PromptPreviewRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxPromptBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "invalid JSON body",
+				Hint:    err.Error(),
+			})
+			return
+		}
+		tool, apiErr, status := parseFireTool(req.Tool)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		if req.MaxIterations <= 0 {
+			req.MaxIterations = 10
+		}
+		if req.Iteration <= 0 {
+			req.Iteration = 1
+		}
+		if req.Iteration > req.MaxIterations {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "iteration must not exceed maxIterations.",
+			})
+			return
+		}
+
+		name := promptFileForTool(tool)
+		content := req.Content
+		if content == "" {
+			current, exists, apiErr, status := s.readCurrent(name)
+			if apiErr != nil {
+				WriteAPIError(w, status, *apiErr)
+				return
+			}
+			if !exists {
+				WriteAPIError(w, http.StatusNotFound, APIError{
+					Code:    "FS_READ_NOT_FOUND",
+					Message: fmt.Sprintf("%s not found.", name),
+					Hint:    "Provide content to preview a draft.",
+				})
+				return
+			}
+			content = current
+		}
+		data, apiErr, status := loadPromptTemplateData(s.paths, PromptIteration{
+			Tool:          tool,
+			Iteration:     req.Iteration,
+			MaxIterations: req.MaxIterations,
+			StoryIDs:      req.StoryIDs,
+		})
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		rendered, err := renderPromptTemplate(name, content, data)
+		if err != nil {
+			WriteAPIError(w, http.StatusBadRequest, *promptTemplateError(name, err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(PromptPreviewResponse{
+			Name:     name,
+			Rendered: rendered,
+			SHA256:   sha256Hex([]byte(rendered)),
+			Data:     data,
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPromptPRD = `{
+  "project": "Demo",
+  "branchName": "ralph/demo",
+  "description": "Demo feature",
+  "userStories": [
+    {"id": "US-001", "title": "Done", "description": "d1", "acceptanceCriteria": ["a"], "priority": 1, "passes": true, "notes": ""},
+    {"id": "US-003", "title": "Later", "description": "d3", "acceptanceCriteria": ["c"], "priority": 3, "passes": false, "notes": ""},
+    {"id": "US-002", "title": "Next", "description": "d2", "acceptanceCriteria": ["Typecheck passes", "Tests pass"], "priority": 2, "passes": false, "notes": "failed review"}
+  ]
+}
+`
+
+const testPromptProgress = `# Ralph Progress Log
+
+## Codebase Patterns
+- Use stdlib only
+
+Started: today
+---
+
+## 2026-01-01 - US-000
+- did things
+- **Learnings for future iterations:**
+  - old learning
+---
+
+## 2026-01-02 - US-001
+- did more
+- **Learnings for future iterations:**
+  - keep handlers small
+  - run gofmt
+---
+`
+
+func writePromptFixture(t *testing.T, root string) {
+	t.Helper()
+	for name, content := range map[string]string{
+		"prd.json":     testPromptPRD,
+		"progress.txt": testPromptProgress,
+		"CODEX.md":     "# Static prompt\nPrint " + PromptCompleteMarker + " when all stories pass.\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestPromptStore_RenderIterationAppendsContextToStaticPrompt(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	store := newTestPromptStore(t, root)
+
+	rendered, ref, apiErr, _ := store.RenderIteration(PromptIteration{Tool: FireToolCodex, Iteration: 2, MaxIterations: 5})
+	if apiErr != nil {
+		t.Fatalf("RenderIteration error: %+v", apiErr)
+	}
+	if ref.Name != "CODEX.md" || ref.Version != 1 {
+		t.Fatalf("unexpected ref: %+v", ref)
+	}
+	for _, want := range []string{
+		"# Static prompt",
+		"Iteration 2 of 5 on branch `ralph/demo`; 1 of 3 stories pass.",
+		"**US-002 - Next** (priority 2)",
+		"- Typecheck passes\n- Tests pass\n",
+		"Notes: failed review",
+		"- Use stdlib only",
+		"### 2026-01-02 - US-001\n- keep handlers small\n- run gofmt",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Fatalf("rendered prompt missing %q:\n%s", want, rendered)
+		}
+	}
+}
+
+func TestRenderPromptTemplate_CustomTemplateAndErrors(t *testing.T) {
+	t.Parallel()
+
+	data := PromptTemplateData{Iteration: 1, MaxIterations: 2, Story: &PromptStory{ID: "US-9", AcceptanceCriteria: []string{"a", "b"}}}
+	got, err := renderPromptTemplate("CODEX.md", promptTemplateMarker+"\n{{.Story.ID}}: {{join .Story.AcceptanceCriteria \", \"}}", data)
+	if err != nil || got != promptTemplateMarker+"\nUS-9: a, b" {
+		t.Fatalf("unexpected render %q err=%v", got, err)
+	}
+
+	_, err = renderPromptTemplate("CODEX.md", promptTemplateMarker+"\n{{.Nope}}\n", data)
+	if err == nil {
+		t.Fatalf("expected an error for an unknown field")
+	}
+	_, err = parsePromptTemplate("CODEX.md", promptTemplateMarker+"\n{{if}}\n")
+	apiErr := promptTemplateError("CODEX.md", err)
+	if apiErr.Code != "PROMPT_TEMPLATE_INVALID" || apiErr.Location == nil || apiErr.Location.Line != 2 {
+		t.Fatalf("unexpected template error: %+v", apiErr)
+	}
+}
+
+func TestRenderPromptTemplate_LiteralBracesWithoutMarker(t *testing.T) {
+	t.Parallel()
+
+	data := PromptTemplateData{Iteration: 1, MaxIterations: 2, TotalStories: 1, Story: &PromptStory{ID: "US-9", Title: "Login"}}
+	src := "Render `{{user.name}}` in Handlebars and `style={{ color: 'red' }}` in JSX.\n{{if}}\n"
+	if _, err := parsePromptTemplate("CODEX.md", src); err != nil {
+		t.Fatalf("expected a prompt without the marker to be accepted as text, got %v", err)
+	}
+	got, err := renderPromptTemplate("CODEX.md", src, data)
+	if err != nil || !strings.HasPrefix(got, src) || !strings.Contains(got, "**US-9 - Login**") {
+		t.Fatalf("expected the prompt verbatim followed by the iteration context, got %q (%v)", got, err)
+	}
+}
+
+func TestExtractProgressLearnings(t *testing.T) {
+	t.Parallel()
+
+	patterns, recent := extractProgressLearnings(testPromptProgress)
+	if patterns != "- Use stdlib only" {
+		t.Fatalf("unexpected patterns %q", patterns)
+	}
+	want := "### 2026-01-01 - US-000\n- old learning\n\n### 2026-01-02 - US-001\n- keep handlers small\n- run gofmt"
+	if recent != want {
+		t.Fatalf("unexpected learnings:\n%s\nwant:\n%s", recent, want)
+	}
+}
+
+func TestPromptPreviewHandler(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	store := newTestPromptStore(t, root)
+
+	body, _ := json.Marshal(PromptPreviewRequest{Tool: "codex", Content: promptTemplateMarker + "Next: {{with .Story}}{{.ID}}{{end}} ({{.Iteration}}/{{.MaxIterations}})", MaxIterations: 3})
+	rr := httptest.NewRecorder()
+	store.PreviewHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/prompt/preview", bytes.NewReader(body)))
+	var resp PromptPreviewResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Rendered != promptTemplateMarker+"Next: US-002 (1/3)" || resp.Data.TotalStories != 3 {
+		t.Fatalf("unexpected preview: %d %s", rr.Code, rr.Body.String())
+	}
+
+	body, _ = json.Marshal(PromptPreviewRequest{Tool: "codex", Content: promptTemplateMarker + "{{.Missing}}"})
+	rr = httptest.NewRecorder()
+	store.PreviewHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/prompt/preview", bytes.NewReader(body)))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "PROMPT_TEMPLATE_INVALID") {
+		t.Fatalf("expected PROMPT_TEMPLATE_INVALID, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLoadPromptTemplateData_Targets(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writePromptFixture(t, root)
+	paths, _ := NewSafePath(SafePathConfig{ProjectRoot: root})
+
+	data, apiErr, _ := loadPromptTemplateData(paths, PromptIteration{Tool: FireToolCodex, Iteration: 1, MaxIterations: 1, StoryIDs: []string{"US-003"}})
+	if apiErr != nil {
+		t.Fatalf("loadPromptTemplateData error: %+v", apiErr)
+	}
+	if data.Story == nil || data.Story.ID != "US-003" || len(data.Targets) != 1 || len(data.Pending) != 2 {
+		t.Fatalf("expected US-003 to be the target story, got %+v", data)
+	}
+	rendered, err := renderPromptTemplate("CODEX.md", "static", data)
+	if err != nil || !strings.Contains(rendered, "This run is limited to US-003.") {
+		t.Fatalf("unexpected render %q err=%v", rendered, err)
+	}
+
+	_, apiErr, status := loadPromptTemplateData(paths, PromptIteration{Tool: FireToolCodex, StoryIDs: []string{"US-404"}})
+	if apiErr == nil || status != http.StatusBadRequest {
+		t.Fatalf("expected unknown story to be rejected, got %d %+v", status, apiErr)
+	}
+}
@@ -0,0 +1,523 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// PromptCompleteMarker is the stop signal ralph-codex.sh greps for; a prompt
+// that no longer asks the agent to print it would loop until maxIterations.
+const PromptCompleteMarker = "<promise>COMPLETE</promise>"
+
+const (
+	maxPromptBytes         = 256 << 10
+	promptHistoryIndexName = "history.jsonl"
+)
+
+var promptFileWhitelist = PathWhitelist{"CODEX.md", "CLAUDE.md", "prompt.md"}
+
+type PromptConfig struct {
+	ProjectRoot string
+	// HistoryDir defaults to <ProjectRoot>/.ohmyagentflow/prompts/history.
+	HistoryDir string
+	// RenderedDir holds the prompts rendered for each Fire iteration;
+	// defaults to <ProjectRoot>/.ohmyagentflow/prompts/rendered.
+	RenderedDir string
+	// Optional. Snapshots the replaced prompt like other console writes.
+	Backups *BackupStore
+	Now     func() time.Time
+}
+
+// PromptStore reads and writes the agent prompt files and keeps every version
+// under HistoryDir/<name>/ (v<N>.md plus an append-only history.jsonl).
+type PromptStore struct {
+	paths       *SafePath
+	dir         string
+	renderedDir string
+	backups     *BackupStore
+	now         func() time.Time
+
+	mu sync.Mutex
+}
+
+type PromptVersion struct {
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"createdAt"`
+	// Source is "console" for writes through the API and "external" for
+	// content first seen on disk (edited outside the console).
+	Source string `json:"source"`
+}
+
+// PromptRef identifies the prompt version a Fire run used.
+type PromptRef struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	SHA256  string `json:"sha256"`
+}
+
+type PromptFile struct {
+	Name    string `json:"name"`
+	Exists  bool   `json:"exists"`
+	Content string `json:"content,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Size    int64  `json:"size"`
+	// Version is the recorded version matching the current content, or 0 if
+	// the file changed outside the console since it was last recorded.
+	Version           int  `json:"version"`
+	HasCompleteMarker bool `json:"hasCompleteMarker"`
+}
+
+type PromptListResponse struct {
+	Prompts []PromptFile `json:"prompts"`
+}
+
+type PromptWriteRequest struct {
+	Content string `json:"content"`
+	// BaseSHA256, when set, must match the file on disk (optimistic locking).
+	BaseSHA256 string `json:"baseSha256,omitempty"`
+}
+
+type PromptWriteResponse struct {
+	Name            string `json:"name"`
+	Preview         bool   `json:"preview"`
+	Changed         bool   `json:"changed"`
+	Version         int    `json:"version,omitempty"`
+	PreviousVersion int    `json:"previousVersion,omitempty"`
+	SHA256          string `json:"sha256"`
+	Diff            string `json:"diff"`
+	BackupID        string `json:"backupId,omitempty"`
+}
+
+type PromptHistoryResponse struct {
+	Name     string          `json:"name"`
+	Versions []PromptVersion `json:"versions"`
+}
+
+type PromptVersionResponse struct {
+	PromptVersion
+	Content string `json:"content"`
+	// Diff is against the previous version ("" for the first one).
+	Diff string `json:"diff"`
+}
+
+func NewPromptStore(cfg PromptConfig) (*PromptStore, error) {
+	paths, err := NewSafePath(SafePathConfig{ProjectRoot: cfg.ProjectRoot})
+	if err != nil {
+		return nil, err
+	}
+	dir := cfg.HistoryDir
+	if dir == "" {
+		dir = filepath.Join(paths.Root(), ".ohmyagentflow", "prompts", "history")
+	}
+	renderedDir := cfg.RenderedDir
+	if renderedDir == "" {
+		renderedDir = filepath.Join(paths.Root(), ".ohmyagentflow", "prompts", "rendered")
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &PromptStore{paths: paths, dir: dir, renderedDir: renderedDir, backups: cfg.Backups, now: now}, nil
+}
+
+func validatePromptName(name string) *APIError {
+	if !promptFileWhitelist.Allows(name) {
+		return &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: fmt.Sprintf("unknown prompt file %q.", name),
+			Hint:    "Use one of: " + strings.Join(promptFileWhitelist, ", ") + ".",
+		}
+	}
+	return nil
+}
+
+// readCurrent returns the prompt's content, or exists=false if it is missing.
+func (s *PromptStore) readCurrent(name string) (string, bool, *APIError, int) {
+	real, _, apiErr, status := s.paths.ResolveRead(name, promptFileWhitelist)
+	if apiErr != nil {
+		if apiErr.Code == "FS_READ_NOT_FOUND" {
+			return "", false, nil, http.StatusOK
+		}
+		return "", false, apiErr, status
+	}
+	content, _, err := readFileUpTo(real, maxPromptBytes)
+	if err != nil {
+		return "", false, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: fmt.Sprintf("failed to read %s", name),
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+	return string(content), true, nil, http.StatusOK
+}
+
+func (s *PromptStore) historyLocked(name string) ([]PromptVersion, error) {
+	f, err := os.Open(filepath.Join(s.dir, name, promptHistoryIndexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []PromptVersion
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var v PromptVersion
+		if json.Unmarshal(sc.Bytes(), &v) == nil && v.Version > 0 {
+			out = append(out, v)
+		}
+	}
+	return out, sc.Err()
+}
+
+func (s *PromptStore) appendVersionLocked(name string, content string, source string) (PromptVersion, error) {
+	history, err := s.historyLocked(name)
+	if err != nil {
+		return PromptVersion{}, err
+	}
+	v := PromptVersion{
+		Name:      name,
+		Version:   1,
+		SHA256:    sha256Hex([]byte(content)),
+		Size:      int64(len(content)),
+		CreatedAt: s.now().UTC().Format(time.RFC3339Nano),
+		Source:    source,
+	}
+	if n := len(history); n > 0 {
+		v.Version = history[n-1].Version + 1
+	}
+	dir := filepath.Join(s.dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return PromptVersion{}, err
+	}
+	if err := writeFileAtomicWithPrefix(filepath.Join(dir, fmt.Sprintf("v%d.md", v.Version)), []byte(content), 0o644, ".prompt-*"); err != nil {
+		return PromptVersion{}, err
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return PromptVersion{}, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, promptHistoryIndexName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return PromptVersion{}, err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return PromptVersion{}, err
+	}
+	return v, nil
+}
+
+// currentVersionLocked returns the version matching content, recording it as
+// an external version when it has not been seen before.
+func (s *PromptStore) currentVersionLocked(name string, content string) (PromptVersion, error) {
+	history, err := s.historyLocked(name)
+	if err != nil {
+		return PromptVersion{}, err
+	}
+	sum := sha256Hex([]byte(content))
+	if n := len(history); n > 0 && history[n-1].SHA256 == sum {
+		return history[n-1], nil
+	}
+	return s.appendVersionLocked(name, content, "external")
+}
+
+// Snapshot records the prompt's current content as a version if needed and
+// returns a reference to it. Fire calls it before starting a run.
+func (s *PromptStore) Snapshot(name string) (PromptRef, error) {
+	if apiErr := validatePromptName(name); apiErr != nil {
+		return PromptRef{}, errors.New(apiErr.Message)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, exists, apiErr, _ := s.readCurrent(name)
+	if apiErr != nil {
+		return PromptRef{}, errors.New(apiErr.Message)
+	}
+	if !exists {
+		return PromptRef{}, fmt.Errorf("%s not found", name)
+	}
+	v, err := s.currentVersionLocked(name, content)
+	if err != nil {
+		return PromptRef{}, err
+	}
+	return PromptRef{Name: name, Version: v.Version, SHA256: v.SHA256}, nil
+}
+
+func (s *PromptStore) describe(name string, withContent bool) (PromptFile, *APIError, int) {
+	content, exists, apiErr, status := s.readCurrent(name)
+	if apiErr != nil {
+		return PromptFile{}, apiErr, status
+	}
+	out := PromptFile{Name: name, Exists: exists}
+	if !exists {
+		return out, nil, http.StatusOK
+	}
+	out.SHA256 = sha256Hex([]byte(content))
+	out.Size = int64(len(content))
+	out.HasCompleteMarker = strings.Contains(content, PromptCompleteMarker)
+	if withContent {
+		out.Content = content
+	}
+	s.mu.Lock()
+	history, _ := s.historyLocked(name)
+	s.mu.Unlock()
+	if n := len(history); n > 0 && history[n-1].SHA256 == out.SHA256 {
+		out.Version = history[n-1].Version
+	}
+	return out, nil, http.StatusOK
+}
+
+// Write validates and stores a new prompt version. With preview set it only
+// returns the diff.
+func (s *PromptStore) Write(ctx context.Context, name string, req PromptWriteRequest, preview bool) (PromptWriteResponse, *APIError, int) {
+	if apiErr := validatePromptName(name); apiErr != nil {
+		return PromptWriteResponse{}, apiErr, http.StatusBadRequest
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		return PromptWriteResponse{}, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "content must not be empty.",
+		}, http.StatusBadRequest
+	}
+	if len(req.Content) > maxPromptBytes || !utf8.ValidString(req.Content) {
+		return PromptWriteResponse{}, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: fmt.Sprintf("content must be UTF-8 text of at most %d bytes.", maxPromptBytes),
+		}, http.StatusBadRequest
+	}
+	if !strings.Contains(req.Content, PromptCompleteMarker) {
+		return PromptWriteResponse{}, &APIError{
+			Code:    "PROMPT_CONTRACT_MISSING",
+			Message: fmt.Sprintf("%s must still instruct the agent to print %s.", name, PromptCompleteMarker),
+			Hint:    "ralph-codex.sh stops the loop only when the agent outputs this marker; keep the instruction in the prompt.",
+			File:    name,
+		}, http.StatusBadRequest
+	}
+
+	if _, err := parsePromptTemplate(name, req.Content); err != nil {
+		return PromptWriteResponse{}, promptTemplateError(name, err), http.StatusBadRequest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists, apiErr, status := s.readCurrent(name)
+	if apiErr != nil {
+		return PromptWriteResponse{}, apiErr, status
+	}
+	currentSum := ""
+	if exists {
+		currentSum = sha256Hex([]byte(current))
+	}
+	if req.BaseSHA256 != "" && req.BaseSHA256 != currentSum {
+		return PromptWriteResponse{}, &APIError{
+			Code:    "PROMPT_CONFLICT",
+			Message: fmt.Sprintf("%s changed since it was loaded.", name),
+			Hint:    "Reload the prompt, reapply your edits and save again.",
+			File:    name,
+		}, http.StatusConflict
+	}
+
+	resp := PromptWriteResponse{Name: name, Preview: preview, SHA256: sha256Hex([]byte(req.Content))}
+	fromLabel := "a/" + name
+	if exists {
+		prev, err := s.currentVersionLocked(name, current)
+		if err != nil {
+			return PromptWriteResponse{}, &APIError{
+				Code:    "INTERNAL_ERROR",
+				Message: "failed to record prompt history",
+				Hint:    err.Error(),
+			}, http.StatusInternalServerError
+		}
+		resp.PreviousVersion = prev.Version
+		fromLabel = fmt.Sprintf("a/%s (v%d)", name, prev.Version)
+	}
+	resp.Diff = unifiedDiff(fromLabel, "b/"+name, current, req.Content)
+	resp.Changed = !exists || current != req.Content
+	if preview {
+		return resp, nil, http.StatusOK
+	}
+	if !resp.Changed {
+		resp.Version = resp.PreviousVersion
+		return resp, nil, http.StatusOK
+	}
+
+	destAbs, apiErr, status := s.paths.ResolveWrite(name, ConsoleWriteWhitelist)
+	if apiErr != nil {
+		return PromptWriteResponse{}, apiErr, status
+	}
+	before := snapshotFile(destAbs)
+	backupID, err := s.backups.WriteFile(destAbs, []byte(req.Content), 0o644, ".prompt-*")
+	if err != nil {
+		return PromptWriteResponse{}, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: fmt.Sprintf("failed to write %s", name),
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+	recordAuditFileWrite(ctx, name, before, []byte(req.Content), s.backups.RelPath(backupID))
+	resp.BackupID = backupID
+
+	v, err := s.appendVersionLocked(name, req.Content, "console")
+	if err != nil {
+		return PromptWriteResponse{}, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: "prompt written but its version could not be recorded",
+			Hint:    err.Error(),
+		}, http.StatusInternalServerError
+	}
+	resp.Version = v.Version
+	return resp, nil, http.StatusOK
+}
+
+func (s *PromptStore) ListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := PromptListResponse{Prompts: []PromptFile{}}
+		for _, name := range promptFileWhitelist {
+			f, apiErr, status := s.describe(name, false)
+			if apiErr != nil {
+				WriteAPIError(w, status, *apiErr)
+				return
+			}
+			resp.Prompts = append(resp.Prompts, f)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (s *PromptStore) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if apiErr := validatePromptName(name); apiErr != nil {
+			WriteAPIError(w, http.StatusNotFound, *apiErr)
+			return
+		}
+		resp, apiErr, status := s.describe(name, true)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (s *PromptStore) WriteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PromptWriteRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxPromptBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "invalid JSON body",
+				Hint:    err.Error(),
+			})
+			return
+		}
+		resp, apiErr, status := s.Write(r.Context(), r.PathValue("name"), req, isTruthy(r.URL.Query().Get("preview")))
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (s *PromptStore) HistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if apiErr := validatePromptName(name); apiErr != nil {
+			WriteAPIError(w, http.StatusNotFound, *apiErr)
+			return
+		}
+		s.mu.Lock()
+		history, err := s.historyLocked(name)
+		s.mu.Unlock()
+		if err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, APIError{
+				Code:    "INTERNAL_ERROR",
+				Message: "failed to read prompt history",
+				Hint:    err.Error(),
+			})
+			return
+		}
+		resp := PromptHistoryResponse{Name: name, Versions: make([]PromptVersion, 0, len(history))}
+		for i := len(history) - 1; i >= 0; i-- {
+			resp.Versions = append(resp.Versions, history[i])
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (s *PromptStore) VersionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if apiErr := validatePromptName(name); apiErr != nil {
+			WriteAPIError(w, http.StatusNotFound, *apiErr)
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(r.PathValue("version"), "v"))
+		notFound := APIError{
+			Code:    "PROMPT_VERSION_NOT_FOUND",
+			Message: fmt.Sprintf("%s has no version %q.", name, r.PathValue("version")),
+			Hint:    fmt.Sprintf("List versions with GET /api/prompts/%s/history.", name),
+		}
+		if err != nil || n < 1 {
+			WriteAPIError(w, http.StatusNotFound, notFound)
+			return
+		}
+
+		s.mu.Lock()
+		history, _ := s.historyLocked(name)
+		s.mu.Unlock()
+		var resp PromptVersionResponse
+		prevContent, prevLabel := "", ""
+		for i, v := range history {
+			if v.Version != n {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(s.dir, name, fmt.Sprintf("v%d.md", n)))
+			if err != nil {
+				break
+			}
+			resp = PromptVersionResponse{PromptVersion: v, Content: string(content)}
+			if i > 0 {
+				if raw, err := os.ReadFile(filepath.Join(s.dir, name, fmt.Sprintf("v%d.md", history[i-1].Version))); err == nil {
+					prevContent = string(raw)
+					prevLabel = fmt.Sprintf("a/%s (v%d)", name, history[i-1].Version)
+				}
+			}
+			break
+		}
+		if resp.Version == 0 {
+			WriteAPIError(w, http.StatusNotFound, notFound)
+			return
+		}
+		if prevLabel != "" {
+			resp.Diff = unifiedDiff(prevLabel, fmt.Sprintf("b/%s (v%d)", name, n), prevContent, resp.Content)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,213 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPromptStore(t *testing.T, root string) *PromptStore {
+	t.Helper()
+	backups, err := NewBackupStore(BackupConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewBackupStore error: %v", err)
+	}
+	store, err := NewPromptStore(PromptConfig{ProjectRoot: root, Backups: backups})
+	if err != nil {
+		t.Fatalf("NewPromptStore error: %v", err)
+	}
+	return store
+}
+
+func TestPromptStore_WriteVersionsAndDiffs(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	original := "# Agent\nDo the work.\nPrint " + PromptCompleteMarker + " when done.\n"
+	if err := os.WriteFile(filepath.Join(root, "CODEX.md"), []byte(original), 0o644); err != nil {
+		t.Fatalf("write CODEX.md: %v", err)
+	}
+	store := newTestPromptStore(t, root)
+	ctx := context.Background()
+
+	edited := strings.Replace(original, "Do the work.", "Do the work carefully.", 1)
+	preview, apiErr, _ := store.Write(ctx, "CODEX.md", PromptWriteRequest{Content: edited}, true)
+	if apiErr != nil {
+		t.Fatalf("preview error: %+v", apiErr)
+	}
+	if !preview.Changed || preview.Version != 0 || !strings.Contains(preview.Diff, "-Do the work.\n+Do the work carefully.\n") {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, "CODEX.md")); string(raw) != original {
+		t.Fatalf("preview must not write, got %q", raw)
+	}
+
+	resp, apiErr, _ := store.Write(ctx, "CODEX.md", PromptWriteRequest{Content: edited, BaseSHA256: sha256Hex([]byte(original))}, false)
+	if apiErr != nil {
+		t.Fatalf("Write error: %+v", apiErr)
+	}
+	// v1 is the external content seen on disk, v2 the console write.
+	if resp.PreviousVersion != 1 || resp.Version != 2 || resp.BackupID == "" || resp.Diff != preview.Diff {
+		t.Fatalf("unexpected write response: %+v", resp)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(root, "CODEX.md")); string(raw) != edited {
+		t.Fatalf("expected CODEX.md updated, got %q", raw)
+	}
+
+	again, apiErr, _ := store.Write(ctx, "CODEX.md", PromptWriteRequest{Content: edited}, false)
+	if apiErr != nil || again.Changed || again.Version != 2 {
+		t.Fatalf("expected no-op write to keep v2, got %+v %+v", again, apiErr)
+	}
+
+	_, apiErr, status := store.Write(ctx, "CODEX.md", PromptWriteRequest{Content: edited + "x", BaseSHA256: sha256Hex([]byte(original))}, false)
+	if apiErr == nil || apiErr.Code != "PROMPT_CONFLICT" || status != http.StatusConflict {
+		t.Fatalf("expected PROMPT_CONFLICT, got %d %+v", status, apiErr)
+	}
+
+	// An edit outside the console becomes its own version when next seen.
+	_ = os.WriteFile(filepath.Join(root, "CODEX.md"), []byte(original), 0o644)
+	ref, err := store.Snapshot("CODEX.md")
+	if err != nil || ref.Version != 3 || ref.SHA256 != sha256Hex([]byte(original)) {
+		t.Fatalf("unexpected snapshot: %+v err=%v", ref, err)
+	}
+	if ref2, _ := store.Snapshot("CODEX.md"); ref2 != ref {
+		t.Fatalf("expected repeated snapshot to reuse %+v, got %+v", ref, ref2)
+	}
+}
+
+func TestPromptStore_RejectsMissingContract(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store := newTestPromptStore(t, root)
+
+	_, apiErr, status := store.Write(context.Background(), "CLAUDE.md", PromptWriteRequest{Content: "no stop marker"}, false)
+	if apiErr == nil || apiErr.Code != "PROMPT_CONTRACT_MISSING" || status != http.StatusBadRequest {
+		t.Fatalf("expected PROMPT_CONTRACT_MISSING, got %d %+v", status, apiErr)
+	}
+	_, apiErr, status = store.Write(context.Background(), "README.md", PromptWriteRequest{Content: PromptCompleteMarker}, false)
+	if apiErr == nil || status != http.StatusBadRequest {
+		t.Fatalf("expected non-prompt file to be rejected, got %d %+v", status, apiErr)
+	}
+	if _, err := os.Stat(filepath.Join(root, "CLAUDE.md")); err == nil {
+		t.Fatalf("rejected write must not create CLAUDE.md")
+	}
+}
+
+func TestPromptHandlers(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store := newTestPromptStore(t, root)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/prompts", store.ListHandler())
+	mux.HandleFunc("GET /api/prompts/{name}", store.GetHandler())
+	mux.HandleFunc("POST /api/prompts/{name}", store.WriteHandler())
+	mux.HandleFunc("GET /api/prompts/{name}/history", store.HistoryHandler())
+	mux.HandleFunc("GET /api/prompts/{name}/history/{version}", store.VersionHandler())
+
+	for _, content := range []string{"one\n" + PromptCompleteMarker + "\n", "two\n" + PromptCompleteMarker + "\n"} {
+		body, _ := json.Marshal(PromptWriteRequest{Content: content})
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/prompts/prompt.md", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/prompts", nil))
+	var list PromptListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Prompts) != 3 {
+		t.Fatalf("unexpected list: %s", rr.Body.String())
+	}
+	for _, p := range list.Prompts {
+		if p.Name == "prompt.md" && (!p.Exists || p.Version != 2 || !p.HasCompleteMarker || p.Content != "") {
+			t.Fatalf("unexpected prompt.md entry: %+v", p)
+		}
+		if p.Name == "CLAUDE.md" && p.Exists {
+			t.Fatalf("expected CLAUDE.md to be missing: %+v", p)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/prompts/prompt.md/history", nil))
+	var history PromptHistoryResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil || len(history.Versions) != 2 || history.Versions[0].Version != 2 || history.Versions[0].Source != "console" {
+		t.Fatalf("unexpected history: %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/prompts/prompt.md/history/2", nil))
+	var v PromptVersionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil || !strings.HasPrefix(v.Content, "two") || !strings.Contains(v.Diff, "-one\n+two\n") {
+		t.Fatalf("unexpected version: %s", rr.Body.String())
+	}
+
+	for _, path := range []string{"/api/prompts/prompt.md/history/9", "/api/prompts/prd.json"} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected 404, got %d %s", path, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestFireService_RecordsPromptVersion(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "prd.json"), []byte(`{"ok":true}`+"\n"), 0644)
+	_ = os.WriteFile(filepath.Join(root, "ralph-codex.sh"), []byte("#!/usr/bin/env bash\nexit 0\n"), 0755)
+	_ = os.WriteFile(filepath.Join(root, "CODEX.md"), []byte(PromptCompleteMarker), 0644)
+
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 16})
+	svc, err := NewFireService(FireConfig{ProjectRoot: root, Hub: hub, Prompts: newTestPromptStore(t, root)})
+	if err != nil {
+		t.Fatalf("NewFireService: %v", err)
+	}
+
+	body, _ := json.Marshal(FireStartRequest{Tool: "codex", MaxIterations: 1})
+	w := httptest.NewRecorder()
+	svc.StartHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fire", bytes.NewReader(body)))
+	var resp FireStartResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Prompt == nil || resp.Prompt.Name != "CODEX.md" || resp.Prompt.Version != 1 {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hub.mu.Lock()
+		var recorded any
+		finished := false
+		if state := hub.runs[resp.RunID]; state != nil {
+			for _, ev := range state.events {
+				switch ev.Type {
+				case "run_started":
+					if data, ok := ev.Data.(map[string]any); ok {
+						recorded = data["prompt"]
+					}
+				case "run_finished":
+					finished = true
+				}
+			}
+		}
+		hub.mu.Unlock()
+		ref, ok := recorded.(*PromptRef)
+		if finished {
+			if !ok || *ref != *resp.Prompt {
+				t.Fatalf("run_started recorded prompt %#v, want %+v", recorded, resp.Prompt)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for run_finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,140 @@
+package console
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Read auth modes. "off" keeps GET /api/* open to anything that can reach the
+// port (the historical behaviour); "sensitive" protects endpoints that expose
+// project files or agent output; "all" protects every /api/* request.
+const (
+	ReadAuthOff       = "off"
+	ReadAuthSensitive = "sensitive"
+	ReadAuthAll       = "all"
+)
+
+// ReadAuthQueryParam carries the token for clients that cannot set headers,
+// notably EventSource.
+const ReadAuthQueryParam = "token"
+
+type ReadAuthConfig struct {
+	Mode string
+	// Tokens validates the page session token (X-Session-Token or ?token=).
+	Tokens *SessionTokenStore
+	// ReadTokenHash optionally admits a separate long-lived read token (see
+	// HashSecret), sent as "Authorization: Bearer <token>".
+	ReadTokenHash string
+	// Now is used by the failure limiter of read tokens.
+	Now func() time.Time
+}
+
+func ValidReadAuthMode(mode string) bool {
+	switch mode {
+	case ReadAuthOff, ReadAuthSensitive, ReadAuthAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// sensitiveReadPrefixes are the read endpoints that return project files,
+// agent output (or command lines) or chat transcripts.
+var sensitiveReadPrefixes = []string{
+	"/api/fs/",
+	"/api/stream",
+	"/api/runs",
+	"/api/prd/chat/state",
+	"/api/audit",
+	"/api/backups",
+	"/api/prompts",
+	"/api/fire/processes",
+	"/api/fire/orphan",
+}
+
+func isSensitiveReadPath(path string) bool {
+	for _, prefix := range sensitiveReadPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireReadAuth guards safe-method /api/* requests according to cfg.Mode.
+// Write requests are left to RequireWriteAuth, and requests already
+// authenticated by remote auth pass through. Session tokens are checked
+// first; only Bearer tokens fall back to the slow read token hash, and failed
+// ones count towards a per-IP limit.
+func RequireReadAuth(next http.Handler, cfg ReadAuthConfig) http.Handler {
+	if cfg.Mode == "" || cfg.Mode == ReadAuthOff {
+		return next
+	}
+
+	var verified sync.Map // sha256(read token) -> struct{}
+	failures := newFailureLimiter(cfg.Now)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isSafeMethod(r.Method) || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cfg.Mode == ReadAuthSensitive && !isSensitiveReadPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := PrincipalFromRequest(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get("X-Session-Token")
+		if token == "" {
+			token = r.URL.Query().Get(ReadAuthQueryParam)
+		}
+		status := sessionTokenUnknown
+		if token != "" && cfg.Tokens != nil {
+			status = cfg.Tokens.check(token)
+		}
+		if status == sessionTokenValid {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && cfg.ReadTokenHash != "" {
+			bearer = strings.TrimSpace(bearer)
+			sum := sha256.Sum256([]byte(bearer))
+			key := hex.EncodeToString(sum[:])
+			if _, ok := verified.Load(key); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip := clientIP(r)
+			if !failures.allow(ip) {
+				writeAuthRateLimited(w, "Too many requests with an invalid read token.")
+				return
+			}
+			if verifySecret(cfg.ReadTokenHash, bearer) {
+				verified.Store(key, struct{}{})
+				next.ServeHTTP(w, r)
+				return
+			}
+			failures.record(ip)
+		}
+
+		if token == "" {
+			WriteAPIError(w, http.StatusForbidden, APIError{
+				Code:    "SESSION_TOKEN_REQUIRED",
+				Message: "A session or read token is required to read this endpoint.",
+				Hint:    "Send X-Session-Token (or ?token= for EventSource), or a read token as \"Authorization: Bearer <token>\".",
+			})
+			return
+		}
+		apiErr, code := sessionTokenError(status)
+		WriteAPIError(w, code, apiErr)
+	})
+}
@@ -0,0 +1,120 @@
+package console
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReadAuthHandler(mode string, store *SessionTokenStore, readTokenHash string) http.Handler {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	return RequireReadAuth(ok, ReadAuthConfig{Mode: mode, Tokens: store, ReadTokenHash: readTokenHash})
+}
+
+func getStatus(h http.Handler, target string, mutate func(*http.Request)) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if mutate != nil {
+		mutate(req)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr.Code, rr.Body.String()
+}
+
+func TestRequireReadAuth_Modes(t *testing.T) {
+	t.Parallel()
+
+	store := NewSessionTokenStore(SessionTokenConfig{})
+	for _, tc := range []struct {
+		mode   string
+		path   string
+		status int
+	}{
+		{ReadAuthOff, "/api/fs/read?path=prd.json", http.StatusOK},
+		{ReadAuthSensitive, "/api/fs/read?path=prd.json", http.StatusForbidden},
+		{ReadAuthSensitive, "/api/stream?runId=r1", http.StatusForbidden},
+		{ReadAuthSensitive, "/api/runs/r1/search?q=x", http.StatusForbidden},
+		{ReadAuthSensitive, "/api/config", http.StatusOK},
+		{ReadAuthAll, "/api/config", http.StatusForbidden},
+		{ReadAuthAll, "/", http.StatusOK},
+	} {
+		if code, body := getStatus(newReadAuthHandler(tc.mode, store, ""), tc.path, nil); code != tc.status {
+			t.Fatalf("mode=%s path=%s: expected %d, got %d (%s)", tc.mode, tc.path, tc.status, code, body)
+		}
+	}
+}
+
+func TestRequireReadAuth_AcceptsSessionTokenViaHeaderOrQuery(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := NewSessionTokenStore(SessionTokenConfig{TTL: 10 * time.Minute, Now: clock.Now})
+	h := newReadAuthHandler(ReadAuthAll, store, "")
+	issued, _ := store.Issue()
+
+	if code, body := getStatus(h, "/api/stream?token="+issued.Token, nil); code != http.StatusOK {
+		t.Fatalf("expected query token to be accepted, got %d (%s)", code, body)
+	}
+	if code, _ := getStatus(h, "/api/fs/read", func(r *http.Request) { r.Header.Set("X-Session-Token", issued.Token) }); code != http.StatusOK {
+		t.Fatalf("expected header token to be accepted, got %d", code)
+	}
+	if code, body := getStatus(h, "/api/stream?token=bogus", nil); code != http.StatusForbidden || !strings.Contains(body, "SESSION_TOKEN_INVALID") {
+		t.Fatalf("expected bogus token to be rejected, got %d (%s)", code, body)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if code, body := getStatus(h, "/api/stream?token="+issued.Token, nil); code != http.StatusForbidden || !strings.Contains(body, "SESSION_TOKEN_EXPIRED") {
+		t.Fatalf("expected expired token to be rejected, got %d (%s)", code, body)
+	}
+}
+
+func TestRequireReadAuth_ReadTokenAndRemotePrincipal(t *testing.T) {
+	t.Parallel()
+
+	hash, err := HashSecret("read-only-token")
+	if err != nil {
+		t.Fatalf("HashSecret error: %v", err)
+	}
+	h := newReadAuthHandler(ReadAuthAll, NewSessionTokenStore(SessionTokenConfig{}), hash)
+
+	bearer := func(tok string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+tok) }
+	}
+	if code, _ := getStatus(h, "/api/fs/read", bearer("read-only-token")); code != http.StatusOK {
+		t.Fatalf("expected read token to be accepted, got %d", code)
+	}
+	// ?token= is only checked against the session store, never the slow hash.
+	if code, _ := getStatus(h, "/api/stream?token=read-only-token", nil); code != http.StatusForbidden {
+		t.Fatalf("expected read token in query to be rejected, got %d", code)
+	}
+	for i := 0; i < maxLoginFailures; i++ {
+		if code, _ := getStatus(h, "/api/fs/read", bearer("nope")); code != http.StatusForbidden {
+			t.Fatalf("attempt %d: expected wrong read token to be rejected, got %d", i+1, code)
+		}
+	}
+	if code, body := getStatus(h, "/api/fs/read", bearer("another-guess")); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after %d wrong read tokens, got %d (%s)", maxLoginFailures, code, body)
+	}
+	// A token verified before is cached and unaffected by the limit.
+	if code, _ := getStatus(h, "/api/fs/read", bearer("read-only-token")); code != http.StatusOK {
+		t.Fatalf("expected the verified read token to stay accepted, got %d", code)
+	}
+
+	remote := func(r *http.Request) {
+		*r = *r.WithContext(context.WithValue(r.Context(), principalCtxKey{}, Principal{Name: "viewer", Role: RoleRead}))
+	}
+	if code, _ := getStatus(h, "/api/fs/read", remote); code != http.StatusOK {
+		t.Fatalf("expected remote-authenticated request to pass, got %d", code)
+	}
+
+	// Writes are RequireWriteAuth's job.
+	req := httptest.NewRequest(http.MethodPost, "/api/ping", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected POST to pass through read auth, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,210 @@
+package console
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Redactor masks secrets in process output before it is streamed or archived.
+// Matches are replaced with "[REDACTED:<rule>]"; key/value style rules keep the
+// key so the log stays readable.
+type Redactor struct {
+	rules   []redactRule
+	entropy bool
+}
+
+type RedactConfig struct {
+	// Patterns are extra regular expressions; the whole match is redacted.
+	Patterns []string
+	// DisableEntropy turns off the high-entropy string detector.
+	DisableEntropy bool
+}
+
+type redactRule struct {
+	name string
+	re   *regexp.Regexp
+	// keep is the number of leading submatches preserved verbatim (key, separator);
+	// submatch keep+1 is the secret and anything after it is preserved too.
+	keep int
+}
+
+const (
+	redactEntropyMinLen  = 32
+	redactEntropyMinBits = 4.2
+	// A private key block without an END line stops being redacted after this many lines.
+	redactMaxPrivateKeyLines = 200
+)
+
+var builtinRedactRules = []redactRule{
+	{name: "private_key", re: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`)},
+	{name: "aws_access_key_id", re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[0-9A-Z]{16}\b`)},
+	{name: "aws_secret_access_key", re: regexp.MustCompile(`(?i)(\baws_?secret_?(?:access_?)?key\b)(["']?\s*[:=]\s*["']?)([A-Za-z0-9/+=]{40})`), keep: 2},
+	{name: "github_token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{name: "provider_api_key", re: regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`)},
+	{name: "slack_token", re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{name: "bearer_token", re: regexp.MustCompile(`(?i)(\bbearer\s+)([A-Za-z0-9\-._~+/]{8,}=*)`), keep: 1},
+	{name: "url_credentials", re: regexp.MustCompile(`(\b[a-z][a-z0-9+.-]*://[^\s:/@]+:)([^\s@/]{3,})(@)`), keep: 1},
+	{name: "secret_assignment", re: regexp.MustCompile(`(?i)(\b[A-Z0-9_.-]*(?:secret|token|passw(?:or)?d|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)[A-Z0-9_.-]*)(["']?\s*[:=]\s*["']?)([^\s"',;]{8,})`), keep: 2},
+}
+
+var (
+	reRedactMarker           = regexp.MustCompile(`\[REDACTED:[a-z_]+\]`)
+	reRedactEntropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{32,}`)
+	rePrivateKeyBegin        = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+	rePrivateKeyEnd          = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY-----`)
+)
+
+func NewRedactor(cfg RedactConfig) (*Redactor, error) {
+	r := &Redactor{entropy: !cfg.DisableEntropy}
+	r.rules = append(r.rules, builtinRedactRules...)
+	for i, pattern := range cfg.Patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %d (%q): %w", i+1, pattern, err)
+		}
+		// It would insert the marker between every character.
+		if re.MatchString("") {
+			return nil, fmt.Errorf("redact pattern %d (%q) matches the empty string", i+1, pattern)
+		}
+		r.rules = append(r.rules, redactRule{name: "custom", re: re})
+	}
+	return r, nil
+}
+
+// DefaultRedactor returns a Redactor with only the built-in detectors.
+func DefaultRedactor() *Redactor {
+	r, _ := NewRedactor(RedactConfig{})
+	return r
+}
+
+// Redact returns s with secrets masked and the number of redactions made.
+func (r *Redactor) Redact(s string) (string, int) {
+	if r == nil || s == "" {
+		return s, 0
+	}
+	count := 0
+	for _, rule := range r.rules {
+		rule := rule
+		s = rule.re.ReplaceAllStringFunc(s, func(m string) string {
+			marker := "[REDACTED:" + rule.name + "]"
+			if rule.keep == 0 {
+				out, n := maskOutsideMarkers(m, marker)
+				count += n
+				return out
+			}
+			sub := rule.re.FindStringSubmatch(m)
+			if len(sub) < rule.keep+2 {
+				out, n := maskOutsideMarkers(m, marker)
+				count += n
+				return out
+			}
+			secret, n := maskOutsideMarkers(sub[rule.keep+1], marker)
+			count += n
+			return strings.Join(sub[1:rule.keep+1], "") + secret + strings.Join(sub[rule.keep+2:], "")
+		})
+	}
+	if r.entropy {
+		s = reRedactEntropyCandidate.ReplaceAllStringFunc(s, func(m string) string {
+			if !looksLikeHighEntropySecret(m) {
+				return m
+			}
+			count++
+			return "[REDACTED:high_entropy]"
+		})
+	}
+	return s, count
+}
+
+// maskOutsideMarkers replaces secret with marker. An earlier rule may already
+// have masked part of it, so existing markers are kept and only the text
+// between them is masked.
+func maskOutsideMarkers(secret, marker string) (string, int) {
+	locs := reRedactMarker.FindAllStringIndex(secret, -1)
+	if locs == nil {
+		return marker, 1
+	}
+	var b strings.Builder
+	count, last := 0, 0
+	for _, loc := range append(locs, []int{len(secret), len(secret)}) {
+		if loc[0] > last {
+			b.WriteString(marker)
+			count++
+		}
+		b.WriteString(secret[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	return b.String(), count
+}
+
+// redactStreamLine redacts one line of process output. Output is streamed a
+// line at a time, so a PEM private key spans several calls: keyLines > 0 means
+// a BEGIN line was seen and every line is masked until END.
+func (r *Redactor) redactStreamLine(line string, keyLines int) (out string, count int, nextKeyLines int) {
+	if r == nil {
+		return line, 0, 0
+	}
+	if keyLines > 0 {
+		if loc := rePrivateKeyEnd.FindStringIndex(line); loc != nil {
+			rest, n := r.Redact(line[loc[1]:])
+			return "[REDACTED:private_key]" + rest, n, 0
+		}
+		next := keyLines + 1
+		if next > redactMaxPrivateKeyLines {
+			next = 0
+		}
+		return "[REDACTED:private_key]", 0, next
+	}
+
+	out, count = r.Redact(line)
+	if loc := rePrivateKeyBegin.FindStringIndex(out); loc != nil {
+		return out[:loc[0]] + "[REDACTED:private_key]", count + 1, 1
+	}
+	return out, count, 0
+}
+
+// looksLikeHighEntropySecret flags long random-looking tokens. It requires
+// upper case, lower case and digits so hex digests (git SHAs, checksums) and
+// ordinary identifiers are left alone.
+func looksLikeHighEntropySecret(s string) bool {
+	if len(s) < redactEntropyMinLen {
+		return false
+	}
+	var upper, lower, digit bool
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	return shannonEntropy(s) >= redactEntropyMinBits
+}
+
+func shannonEntropy(s string) float64 {
+	var freq [256]int
+	for i := 0; i < len(s); i++ {
+		freq[s[i]]++
+	}
+	n := float64(len(s))
+	var bits float64
+	for _, c := range freq {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
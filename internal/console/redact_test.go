@@ -0,0 +1,152 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Samples are assembled at runtime so the source never contains a literal token.
+func TestRedactor_BuiltinDetectors(t *testing.T) {
+	r := DefaultRedactor()
+	cases := []struct {
+		name   string
+		in     string
+		secret string
+		keep   string
+	}{
+		{name: "aws access key id", in: "key=" + "AKIA" + "IOSFODNN7EXAMPLE", secret: "IOSFODNN7EXAMPLE"},
+		{name: "aws secret key", in: "aws_secret_access_key = " + "wJalrXUtnFEMI/K7MDENG/" + "bPxRfiCYEXAMPLEKEY", secret: "bPxRfiCYEXAMPLEKEY", keep: "aws_secret_access_key = "},
+		{name: "github classic token", in: "token ghp" + "_" + strings.Repeat("a1B2c3D4e5", 4), secret: "a1B2c3D4e5"},
+		{name: "github fine-grained token", in: "github" + "_pat_" + "11ABCDEFG0" + strings.Repeat("x", 30), secret: "11ABCDEFG0"},
+		{name: "bearer header", in: "Authorization: Bearer " + "abc.def-ghi_jkl", secret: "abc.def-ghi_jkl", keep: "Bearer "},
+		{name: "provider key", in: "using sk-" + "ant-" + strings.Repeat("Zz9", 10), secret: "Zz9Zz9"},
+		{name: "slack token", in: "xox" + "b-1234567890-abcdef", secret: "1234567890-abcdef"},
+		{name: "dotenv assignment", in: "OPENAI_API_KEY=" + "notarealkey12345", secret: "notarealkey12345", keep: "OPENAI_API_KEY="},
+		{name: "yaml password", in: "  password: " + "hunter2hunter2", secret: "hunter2hunter2", keep: "password: "},
+		{name: "url credentials", in: "git clone https://bot:" + "s3cr3tpass" + "@example.com/x.git", secret: "s3cr3tpass", keep: "https://bot:"},
+		{name: "inline private key", in: "-----BEGIN RSA " + "PRIVATE KEY-----\nMIIEow\n-----END RSA " + "PRIVATE KEY-----", secret: "MIIEow"},
+		{name: "high entropy", in: "value " + "q8Xz2LmN4vB7tR1yW9kP3sD6fG0hJ5cA", secret: "q8Xz2LmN4vB7tR1yW9kP3sD6fG0hJ5cA"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, n := r.Redact(tc.in)
+			if n == 0 || strings.Contains(out, tc.secret) || !strings.Contains(out, "[REDACTED:") {
+				t.Fatalf("expected secret to be redacted, got %q (n=%d)", out, n)
+			}
+			if tc.keep != "" && !strings.Contains(out, tc.keep) {
+				t.Fatalf("expected %q to be preserved, got %q", tc.keep, out)
+			}
+		})
+	}
+}
+
+func TestRedactor_LeavesOrdinaryOutputAlone(t *testing.T) {
+	r := DefaultRedactor()
+	for _, in := range []string{
+		"commit 3f9a1c2b7d4e5f60718293a4b5c6d7e8f9012345",
+		"sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"request id 123e4567-e89b-12d3-a456-426614174000",
+		"ok  github.com/sine-io/oh-my-agent-flow/internal/console 6.4s",
+		"Ralph Iteration 2 of 10",
+		"<promise>COMPLETE</promise>",
+		"TestStreamHandler_ReplaysFinishedRunFromArchiveAfterRestart",
+	} {
+		if out, n := r.Redact(in); n != 0 || out != in {
+			t.Fatalf("expected %q to be unchanged, got %q (n=%d)", in, out, n)
+		}
+	}
+}
+
+func TestRedactor_MasksTextNextToExistingMarkers(t *testing.T) {
+	r, err := NewRedactor(RedactConfig{Patterns: []string{`\S*sk-live\S*`}})
+	if err != nil {
+		t.Fatalf("NewRedactor error: %v", err)
+	}
+	for _, tc := range []struct {
+		in   string
+		want string
+		n    int
+	}{
+		{"[REDACTED:github_token]sk-live-42", "[REDACTED:github_token][REDACTED:custom]", 1},
+		{"token=[REDACTED:custom]hunter2hunter2", "token=[REDACTED:custom][REDACTED:secret_assignment]", 1},
+		{"token=ab12cd34[REDACTED:custom]hunter2hunter2", "token=[REDACTED:secret_assignment][REDACTED:custom][REDACTED:secret_assignment]", 2},
+		// Already-redacted output is left alone.
+		{"token=[REDACTED:secret_assignment]", "token=[REDACTED:secret_assignment]", 0},
+	} {
+		out, n := r.Redact(tc.in)
+		if out != tc.want || n != tc.n {
+			t.Fatalf("Redact(%q) = %q (n=%d), want %q (n=%d)", tc.in, out, n, tc.want, tc.n)
+		}
+	}
+}
+
+func TestRedactor_CustomPatterns(t *testing.T) {
+	r, err := NewRedactor(RedactConfig{Patterns: []string{`ACME-[0-9]{6}`}})
+	if err != nil {
+		t.Fatalf("NewRedactor error: %v", err)
+	}
+	out, n := r.Redact("license ACME-123456 ok")
+	if n != 1 || out != "license [REDACTED:custom] ok" {
+		t.Fatalf("unexpected redaction: %q (n=%d)", out, n)
+	}
+
+	if _, err := NewRedactor(RedactConfig{Patterns: []string{"("}}); err == nil {
+		t.Fatalf("expected invalid pattern to fail")
+	}
+	for _, pattern := range []string{`a*`, `(?:token)?`, `^`} {
+		if _, err := NewRedactor(RedactConfig{Patterns: []string{pattern}}); err == nil || !strings.Contains(err.Error(), "empty string") {
+			t.Fatalf("expected %q to be rejected for matching the empty string, got %v", pattern, err)
+		}
+	}
+}
+
+func TestStreamHub_RedactsProcessOutputInSSEAndArchive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	hub := NewStreamHub(StreamHubConfig{ArchiveDir: dir})
+	secret := "ghp" + "_" + strings.Repeat("Q1w2E3r4T5", 4)
+	lines := []string{
+		"cloning with " + secret,
+		"-----BEGIN OPENSSH " + "PRIVATE KEY-----",
+		"b3BlbnNzaC1rZXktdjEAAAAABG5vbmUAAAAEbm9uZQ",
+		"-----END OPENSSH " + "PRIVATE KEY----- trailing",
+		"plain line",
+	}
+	hub.Publish(StreamEvent{RunID: "r1", Type: "run_started", Step: "fire", Level: "info"})
+	for _, line := range lines {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": line}})
+	}
+	finished := hub.Publish(StreamEvent{RunID: "r1", Type: "run_finished", Step: "fire", Level: "info", Data: map[string]any{"reason": "completed"}})
+
+	replay, _, unsub, _ := hub.ReplayAndSubscribe("r1", 0)
+	unsub()
+	var texts []string
+	for _, ev := range replay {
+		if data, ok := ev.Data.(map[string]any); ok && ev.Type == "process_stdout" {
+			texts = append(texts, data["text"].(string))
+		}
+	}
+	want := []string{
+		"cloning with [REDACTED:github_token]",
+		"[REDACTED:private_key]",
+		"[REDACTED:private_key]",
+		"[REDACTED:private_key] trailing",
+		"plain line",
+	}
+	if strings.Join(texts, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected redacted output:\n got %q\nwant %q", texts, want)
+	}
+
+	if got := finished.Data.(map[string]any)["redactions"]; got != 2 {
+		t.Fatalf("expected 2 redactions recorded on run_finished, got %v", got)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "r1.jsonl"))
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	if strings.Contains(string(raw), secret) || strings.Contains(string(raw), "b3BlbnNzaC1rZXkt") {
+		t.Fatalf("expected archive to contain only redacted output")
+	}
+}
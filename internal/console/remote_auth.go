@@ -0,0 +1,621 @@
+package console
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles for remote principals. Read-only principals may use every safe method
+// (view the UI, stream and search runs) but no state-changing API.
+const (
+	RoleRead     = "read"
+	RoleOperator = "operator"
+)
+
+const (
+	DefaultRemoteSessionTTL = 12 * time.Hour
+	RemoteSessionCookieName = "ohmyagentflow_session"
+
+	secretHashScheme     = "pbkdf2-sha256"
+	secretHashIterations = 210000
+	secretHashSaltBytes  = 16
+	secretHashKeyBytes   = 32
+
+	// HashToken appends a lookup id to API token hashes so a presented token
+	// is matched to at most one entry before the slow PBKDF2 check. The id is
+	// a fast hash, so tokens must be long random strings.
+	tokenLookupBytes = 16
+	minTokenLength   = 20
+
+	// Failed logins and Bearer tokens per client IP within loginFailureWindow
+	// before further attempts are refused.
+	maxLoginFailures   = 5
+	loginFailureWindow = time.Minute
+	maxLoginBodyBytes  = 4 << 10
+
+	// LoginNonceHeader carries the nonce of the login page (see LoginNonce)
+	// on POST /api/auth/login.
+	LoginNonceHeader = "X-Login-Nonce"
+	loginNonceTTL    = time.Hour
+)
+
+// RemoteToken is a static API token. Only the hash (see HashToken) is stored.
+type RemoteToken struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	Role string `json:"role"`
+}
+
+// Principal identifies the caller of a request in remote mode.
+type Principal struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Bearer is true when the request carried an API token in the
+	// Authorization header rather than a browser session cookie.
+	Bearer bool `json:"-"`
+}
+
+func (p Principal) CanWrite() bool {
+	return p.Role == RoleOperator
+}
+
+type principalCtxKey struct{}
+
+// PrincipalFromRequest returns the authenticated principal, if remote auth ran.
+func PrincipalFromRequest(r *http.Request) (Principal, bool) {
+	p, ok := r.Context().Value(principalCtxKey{}).(Principal)
+	return p, ok
+}
+
+type RemoteAuthConfig struct {
+	// PasswordHash, when set, allows an operator login with that password.
+	PasswordHash string
+	Tokens       []RemoteToken
+	SessionTTL   time.Duration
+	Now          func() time.Time
+}
+
+// RemoteAuth authenticates requests when the console is reachable from other
+// hosts. Browsers log in once and receive a session cookie; scripts send
+// "Authorization: Bearer <token>" on every request.
+type RemoteAuth struct {
+	passwordHash string
+	// tokens are indexed by the lookup id of their hash.
+	tokens map[string]RemoteToken
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]remoteSession
+	// verified caches sha256(token) -> principal so the PBKDF2 cost is paid
+	// once per token rather than on every API call.
+	verified map[string]Principal
+	failures *failureLimiter
+	// nonceKey signs login nonces; they are not stored.
+	nonceKey []byte
+}
+
+type remoteSession struct {
+	principal Principal
+	expiresAt time.Time
+}
+
+func NewRemoteAuth(cfg RemoteAuthConfig) (*RemoteAuth, error) {
+	if cfg.PasswordHash == "" && len(cfg.Tokens) == 0 {
+		return nil, errors.New("remote mode requires a password hash or at least one API token")
+	}
+	if cfg.PasswordHash != "" {
+		if _, _, _, err := parseSecretHash(cfg.PasswordHash); err != nil {
+			return nil, fmt.Errorf("remote password hash: %w", err)
+		}
+	}
+	seen := make(map[string]struct{}, len(cfg.Tokens))
+	tokens := make(map[string]RemoteToken, len(cfg.Tokens))
+	for i, tok := range cfg.Tokens {
+		if strings.TrimSpace(tok.Name) == "" {
+			return nil, fmt.Errorf("remote token %d: name is required", i+1)
+		}
+		if _, dup := seen[tok.Name]; dup {
+			return nil, fmt.Errorf("remote token %q: duplicate name", tok.Name)
+		}
+		seen[tok.Name] = struct{}{}
+		if tok.Role != RoleRead && tok.Role != RoleOperator {
+			return nil, fmt.Errorf("remote token %q: role must be %q or %q (got %q)", tok.Name, RoleRead, RoleOperator, tok.Role)
+		}
+		if _, _, _, err := parseSecretHash(tok.Hash); err != nil {
+			return nil, fmt.Errorf("remote token %q: %w", tok.Name, err)
+		}
+		lookup := hashLookupID(tok.Hash)
+		if lookup == "" {
+			return nil, fmt.Errorf("remote token %q: hash has no lookup id (regenerate it with `ohmyagentflow hash-secret --token`)", tok.Name)
+		}
+		if other, dup := tokens[lookup]; dup {
+			return nil, fmt.Errorf("remote token %q: same token as %q", tok.Name, other.Name)
+		}
+		tokens[lookup] = tok
+	}
+
+	ttl := cfg.SessionTTL
+	if ttl <= 0 {
+		ttl = DefaultRemoteSessionTTL
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	nonceKey := make([]byte, 32)
+	if _, err := rand.Read(nonceKey); err != nil {
+		return nil, err
+	}
+	return &RemoteAuth{
+		passwordHash: cfg.PasswordHash,
+		tokens:       tokens,
+		ttl:          ttl,
+		now:          now,
+		sessions:     make(map[string]remoteSession),
+		verified:     make(map[string]Principal),
+		failures:     newFailureLimiter(now),
+		nonceKey:     nonceKey,
+	}, nil
+}
+
+// LoginNonce returns the CSRF nonce the login page sends with its login
+// request. Anonymous visitors get it instead of a session token: nonces are
+// signed rather than stored, so loading the page in a loop cannot push the
+// session tokens of logged-in users out of the SessionTokenStore.
+func (a *RemoteAuth) LoginNonce() (string, error) {
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return "", err
+	}
+	payload := strconv.FormatInt(a.now().Add(loginNonceTTL).Unix(), 10) + "." + hex.EncodeToString(random[:])
+	return payload + "." + a.signNonce(payload), nil
+}
+
+func (a *RemoteAuth) signNonce(payload string) string {
+	mac := hmac.New(sha256.New, a.nonceKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *RemoteAuth) checkLoginNonce(nonce string) bool {
+	i := strings.LastIndexByte(nonce, '.')
+	if i < 0 {
+		return false
+	}
+	payload, sig := nonce[:i], nonce[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(a.signNonce(payload))) {
+		return false
+	}
+	expiry, _, _ := strings.Cut(payload, ".")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && a.now().Before(time.Unix(unix, 0))
+}
+
+// HashSecret derives a storable hash for a password or API token:
+// "pbkdf2-sha256$<iterations>$<salt>$<key>" with base64url (unpadded) fields.
+func HashSecret(secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("secret must not be empty")
+	}
+	salt := make([]byte, secretHashSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2SHA256([]byte(secret), salt, secretHashIterations, secretHashKeyBytes)
+	enc := base64.RawURLEncoding
+	return strings.Join([]string{secretHashScheme, strconv.Itoa(secretHashIterations), enc.EncodeToString(salt), enc.EncodeToString(key)}, "$"), nil
+}
+
+// HashToken is HashSecret for API tokens, followed by "$<lookup>" (see
+// tokenLookupID).
+func HashToken(token string) (string, error) {
+	if len(token) < minTokenLength {
+		return "", fmt.Errorf("API tokens must be at least %d characters; use a random one, e.g. from `openssl rand -hex 32`", minTokenLength)
+	}
+	hash, err := HashSecret(token)
+	if err != nil {
+		return "", err
+	}
+	return hash + "$" + tokenLookupID(token), nil
+}
+
+// tokenLookupID is a keyed hash of token that identifies its configured
+// entry without the PBKDF2 cost.
+func tokenLookupID(token string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("ohmyagentflow token lookup"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:tokenLookupBytes])
+}
+
+// hashLookupID returns the lookup id of a HashToken hash, or "".
+func hashLookupID(hash string) string {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return ""
+	}
+	return parts[4]
+}
+
+func parseSecretHash(hash string) (iterations int, salt []byte, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if (len(parts) != 4 && len(parts) != 5) || parts[0] != secretHashScheme {
+		return 0, nil, nil, fmt.Errorf("hash must look like %s$<iterations>$<salt>$<key> (generate one with `ohmyagentflow hash-secret`)", secretHashScheme)
+	}
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations < 10000 {
+		return 0, nil, nil, errors.New("hash iteration count must be at least 10000")
+	}
+	enc := base64.RawURLEncoding
+	if salt, err = enc.DecodeString(parts[2]); err != nil || len(salt) < 8 {
+		return 0, nil, nil, errors.New("hash salt is not valid base64url")
+	}
+	if key, err = enc.DecodeString(parts[3]); err != nil || len(key) < 16 {
+		return 0, nil, nil, errors.New("hash key is not valid base64url")
+	}
+	return iterations, salt, key, nil
+}
+
+func verifySecret(hash string, secret string) bool {
+	iterations, salt, key, err := parseSecretHash(hash)
+	if err != nil || secret == "" {
+		return false
+	}
+	got := pbkdf2SHA256([]byte(secret), salt, iterations, len(key))
+	return subtle.ConstantTimeCompare(got, key) == 1
+}
+
+// pbkdf2SHA256 implements RFC 8018 PBKDF2 with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	out := make([]byte, 0, blocks*hashLen)
+	var idx [4]byte
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		idx[0], idx[1], idx[2], idx[3] = byte(block>>24), byte(block>>16), byte(block>>8), byte(block)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(idx[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
+
+// lookupToken matches a presented API token against the configured hashes.
+// At most one hash is verified: the one with the token's lookup id.
+func (a *RemoteAuth) lookupToken(token string) (Principal, bool) {
+	if token == "" {
+		return Principal{}, false
+	}
+	sum := sha256.Sum256([]byte(token))
+	cacheKey := hex.EncodeToString(sum[:])
+
+	a.mu.Lock()
+	p, ok := a.verified[cacheKey]
+	a.mu.Unlock()
+	if ok {
+		return p, true
+	}
+	tok, ok := a.tokens[tokenLookupID(token)]
+	if !ok || !verifySecret(tok.Hash, token) {
+		return Principal{}, false
+	}
+	p = Principal{Name: tok.Name, Role: tok.Role}
+	a.mu.Lock()
+	a.verified[cacheKey] = p
+	a.mu.Unlock()
+	return p, true
+}
+
+func (a *RemoteAuth) sessionPrincipal(id string) (Principal, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[id]
+	if !ok {
+		return Principal{}, false
+	}
+	if !a.now().Before(s.expiresAt) {
+		delete(a.sessions, id)
+		return Principal{}, false
+	}
+	return s.principal, true
+}
+
+func (a *RemoteAuth) newSession(p Principal) (string, time.Time, error) {
+	id, err := GenerateSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	for k, s := range a.sessions {
+		if !now.Before(s.expiresAt) {
+			delete(a.sessions, k)
+		}
+	}
+	expiresAt := now.Add(a.ttl)
+	a.sessions[id] = remoteSession{principal: p, expiresAt: expiresAt}
+	return id, expiresAt, nil
+}
+
+func (a *RemoteAuth) authenticate(r *http.Request) (Principal, bool) {
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		scheme, token, ok := strings.Cut(authz, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			p, ok := a.lookupToken(strings.TrimSpace(token))
+			p.Bearer = ok
+			if ok {
+				return p, true
+			}
+		}
+		a.failures.record(clientIP(r))
+		return Principal{}, false
+	}
+	if c, err := r.Cookie(RemoteSessionCookieName); err == nil && c.Value != "" {
+		return a.sessionPrincipal(c.Value)
+	}
+	return Principal{}, false
+}
+
+// isRemoteAuthPublic lists the only routes reachable without credentials.
+func isRemoteAuthPublic(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/login":
+		return r.Method == http.MethodGet || r.Method == http.MethodHead
+	case "/api/auth/login":
+		return r.Method == http.MethodPost
+	}
+	return false
+}
+
+// Middleware rejects unauthenticated requests and enforces roles. It must
+// wrap RequireWriteAuth so the latter can see the principal.
+func (a *RemoteAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isRemoteAuthPublic(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "" && !a.failures.allow(clientIP(r)) {
+			writeAuthRateLimited(w, "Too many requests with invalid credentials.")
+			return
+		}
+		p, ok := a.authenticate(r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") || r.Header.Get("Authorization") != "" {
+				WriteAPIError(w, http.StatusUnauthorized, APIError{
+					Code:    "AUTH_REQUIRED",
+					Message: "Authentication is required.",
+					Hint:    "Log in at /login, or send a valid API token as \"Authorization: Bearer <token>\".",
+				})
+				return
+			}
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if !p.CanWrite() && !isSafeMethod(r.Method) && r.URL.Path != "/api/auth/logout" {
+			WriteAPIError(w, http.StatusForbidden, APIError{
+				Code:    "ROLE_FORBIDDEN",
+				Message: fmt.Sprintf("%q has the %s role and cannot change state.", p.Name, p.Role),
+				Hint:    "Use an operator token or log in with the password.",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalCtxKey{}, p)))
+	})
+}
+
+type RemoteLoginRequest struct {
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+type RemoteLoginResponse struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// failureLimiter counts failed credential checks per client IP so that
+// guessing, and the PBKDF2 work each guess costs, stays bounded.
+type failureLimiter struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func newFailureLimiter(now func() time.Time) *failureLimiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &failureLimiter{now: now, failures: make(map[string][]time.Time)}
+}
+
+// allow reports whether ip is below the failure limit.
+func (l *failureLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cutoff := l.now().Add(-loginFailureWindow)
+	recent := l.failures[ip][:0]
+	for _, t := range l.failures[ip] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(l.failures, ip)
+	} else {
+		l.failures[ip] = recent
+	}
+	return len(recent) < maxLoginFailures
+}
+
+func (l *failureLimiter) record(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures[ip] = append(l.failures[ip], l.now())
+}
+
+func writeAuthRateLimited(w http.ResponseWriter, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(loginFailureWindow.Seconds())))
+	WriteAPIError(w, http.StatusTooManyRequests, APIError{
+		Code:    "LOGIN_RATE_LIMITED",
+		Message: message,
+		Hint:    "Wait a minute before trying again.",
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// LoginHandler exchanges the password (operator) or an API token (its role)
+// for a session cookie.
+func (a *RemoteAuth) LoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !a.failures.allow(ip) {
+			writeAuthRateLimited(w, "Too many failed login attempts.")
+			return
+		}
+		if !a.checkLoginNonce(r.Header.Get(LoginNonceHeader)) {
+			WriteAPIError(w, http.StatusForbidden, APIError{
+				Code:    "LOGIN_NONCE_INVALID",
+				Message: "The login form is missing or has expired.",
+				Hint:    "Reload /login and log in again.",
+			})
+			return
+		}
+
+		var req RemoteLoginRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLoginBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "INVALID_JSON",
+				Message: "Request body must be JSON: {\"password\": \"...\"} or {\"token\": \"...\"}.",
+			})
+			return
+		}
+
+		var (
+			p  Principal
+			ok bool
+		)
+		switch {
+		case req.Password != "" && a.passwordHash != "":
+			ok = verifySecret(a.passwordHash, req.Password)
+			p = Principal{Name: "password", Role: RoleOperator}
+		case req.Token != "":
+			p, ok = a.lookupToken(req.Token)
+		}
+		if !ok {
+			a.failures.record(ip)
+			WriteAPIError(w, http.StatusUnauthorized, APIError{
+				Code:    "LOGIN_FAILED",
+				Message: "Invalid password or token.",
+			})
+			return
+		}
+
+		id, expiresAt, err := a.newSession(p)
+		if err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, APIError{
+				Code:    "INTERNAL",
+				Message: "Failed to create session.",
+			})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     RemoteSessionCookieName,
+			Value:    id,
+			Path:     "/",
+			Expires:  expiresAt,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(RemoteLoginResponse{
+			Name:      p.Name,
+			Role:      p.Role,
+			ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+func (a *RemoteAuth) LogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(RemoteSessionCookieName); err == nil {
+			a.mu.Lock()
+			delete(a.sessions, c.Value)
+			a.mu.Unlock()
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     RemoteSessionCookieName,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
+	}
+}
+
+type WhoAmIResponse struct {
+	Mode string `json:"mode"`
+	Name string `json:"name,omitempty"`
+	Role string `json:"role"`
+}
+
+// WhoAmIHandler reports how the caller is authenticated. Without remote auth
+// in front of it the caller is the local user, who may do everything.
+func WhoAmIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := WhoAmIResponse{Mode: "local", Role: RoleOperator}
+		if p, ok := PrincipalFromRequest(r); ok {
+			resp = WhoAmIResponse{Mode: "remote", Name: p.Name, Role: p.Role}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,347 @@
+package console
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2SHA256_KnownVectors(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		iterations int
+		want       string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	} {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), tc.iterations, 32))
+		if got != tc.want {
+			t.Fatalf("iterations=%d: got %s, want %s", tc.iterations, got, tc.want)
+		}
+	}
+}
+
+func TestHashSecret_VerifiesOnlyTheOriginalSecret(t *testing.T) {
+	t.Parallel()
+
+	hash, err := HashSecret("correct horse")
+	if err != nil {
+		t.Fatalf("HashSecret error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$") || strings.Contains(hash, "correct horse") {
+		t.Fatalf("unexpected hash format: %q", hash)
+	}
+	if !verifySecret(hash, "correct horse") {
+		t.Fatalf("expected secret to verify")
+	}
+	if verifySecret(hash, "correct horse!") || verifySecret("plaintext", "plaintext") {
+		t.Fatalf("expected mismatches to fail")
+	}
+}
+
+type remoteAuthFixture struct {
+	auth     *RemoteAuth
+	handler  http.Handler
+	operator string
+	reader   string
+}
+
+func newRemoteAuthFixture(t *testing.T) remoteAuthFixture {
+	t.Helper()
+	passwordHash, _ := HashSecret("pw-operator")
+	readHash, _ := HashToken("tok-read-0123456789abcdef")
+	opHash, _ := HashToken("tok-op-0123456789abcdef")
+	auth, err := NewRemoteAuth(RemoteAuthConfig{
+		PasswordHash: passwordHash,
+		Tokens: []RemoteToken{
+			{Name: "dashboard", Hash: readHash, Role: RoleRead},
+			{Name: "ci", Hash: opHash, Role: RoleOperator},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRemoteAuth error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("index")) })
+	mux.HandleFunc("POST /api/auth/login", auth.LoginHandler())
+	mux.HandleFunc("GET /api/auth/me", WhoAmIHandler())
+	mux.HandleFunc("POST /api/ping", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	protected := RequireWriteAuth(mux, WriteAuthConfig{
+		SessionToken:        "csrf",
+		AllowedOrigins:      []string{"https://127.0.0.1:8443"},
+		AllowSameHostOrigin: true,
+		LoginPath:           "/api/auth/login",
+	})
+	return remoteAuthFixture{auth: auth, handler: auth.Middleware(protected), operator: "tok-op-0123456789abcdef", reader: "tok-read-0123456789abcdef"}
+}
+
+func (f remoteAuthFixture) do(method, target string, mutate func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if mutate != nil {
+		mutate(req)
+	}
+	rr := httptest.NewRecorder()
+	f.handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func (f remoteAuthFixture) nonce(t *testing.T) string {
+	t.Helper()
+	nonce, err := f.auth.LoginNonce()
+	if err != nil {
+		t.Fatalf("LoginNonce error: %v", err)
+	}
+	return nonce
+}
+
+func TestRemoteAuth_LoginRequiresValidNonce(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	f := newRemoteAuthFixture(t)
+	f.auth.now = func() time.Time { return now }
+	nonce := f.nonce(t)
+
+	login := func(set func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "https://devbox:8443/api/auth/login", strings.NewReader(`{"password":"pw-operator"}`))
+		req.Header.Set("Origin", "https://127.0.0.1:8443")
+		set(req)
+		rr := httptest.NewRecorder()
+		f.handler.ServeHTTP(rr, req)
+		return rr
+	}
+	for name, set := range map[string]func(*http.Request){
+		// A page session token is no substitute for the nonce.
+		"session token": func(r *http.Request) { r.Header.Set("X-Session-Token", "csrf") },
+		"tampered":      func(r *http.Request) { r.Header.Set(LoginNonceHeader, "9"+nonce) },
+		"forged":        func(r *http.Request) { r.Header.Set(LoginNonceHeader, "99999999999.00.c2ln") },
+	} {
+		if rr := login(set); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "LOGIN_NONCE_INVALID") {
+			t.Fatalf("%s: expected 403 LOGIN_NONCE_INVALID, got %d (%s)", name, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := login(func(r *http.Request) { r.Header.Set(LoginNonceHeader, nonce) }); rr.Code != http.StatusOK {
+		t.Fatalf("expected login with the nonce to succeed, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	now = now.Add(loginNonceTTL + time.Second)
+	if rr := login(func(r *http.Request) { r.Header.Set(LoginNonceHeader, nonce) }); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected an expired nonce to be refused, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRemoteAuth_RequiresCredentials(t *testing.T) {
+	t.Parallel()
+	f := newRemoteAuthFixture(t)
+
+	if rr := f.do(http.MethodGet, "https://devbox:8443/api/auth/me", nil); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "AUTH_REQUIRED") {
+		t.Fatalf("expected 401 AUTH_REQUIRED, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := f.do(http.MethodGet, "https://devbox:8443/", nil); rr.Code != http.StatusFound || rr.Header().Get("Location") != "/login" {
+		t.Fatalf("expected redirect to /login, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	rr := f.do(http.MethodGet, "https://devbox:8443/api/auth/me", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") })
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown token, got %d", rr.Code)
+	}
+}
+
+func TestRemoteAuth_EnforcesTokenRoles(t *testing.T) {
+	t.Parallel()
+	f := newRemoteAuthFixture(t)
+	bearer := func(tok string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+tok) }
+	}
+
+	rr := f.do(http.MethodGet, "https://devbox:8443/api/auth/me", bearer(f.reader))
+	var me WhoAmIResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &me)
+	if rr.Code != http.StatusOK || me.Mode != "remote" || me.Name != "dashboard" || me.Role != RoleRead {
+		t.Fatalf("unexpected whoami: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := f.do(http.MethodPost, "https://devbox:8443/api/ping", bearer(f.reader)); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "ROLE_FORBIDDEN") {
+		t.Fatalf("expected read-only token to be refused writes, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	// Operator tokens are not subject to the browser CSRF checks.
+	if rr := f.do(http.MethodPost, "https://devbox:8443/api/ping", bearer(f.operator)); rr.Code != http.StatusOK {
+		t.Fatalf("expected operator token write to succeed, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRemoteAuth_PasswordLoginSessionKeepsCSRFChecks(t *testing.T) {
+	t.Parallel()
+	f := newRemoteAuthFixture(t)
+
+	login := httptest.NewRequest(http.MethodPost, "https://devbox:8443/api/auth/login", strings.NewReader(`{"password":"pw-operator"}`))
+	login.TLS = &tls.ConnectionState{}
+	login.Header.Set("Origin", "https://devbox:8443")
+	login.Header.Set(LoginNonceHeader, f.nonce(t))
+	rr := httptest.NewRecorder()
+	f.handler.ServeHTTP(rr, login)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected login to succeed, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].Secure || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected one secure session cookie, got %+v", cookies)
+	}
+	session := cookies[0]
+
+	withCookie := func(origin string) func(*http.Request) {
+		return func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{}
+			r.AddCookie(session)
+			r.Header.Set("X-Session-Token", "csrf")
+			if origin != "" {
+				r.Header.Set("Origin", origin)
+			}
+		}
+	}
+	if rr := f.do(http.MethodPost, "https://devbox:8443/api/ping", withCookie("https://devbox:8443")); rr.Code != http.StatusOK {
+		t.Fatalf("expected same-host write to succeed, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := f.do(http.MethodPost, "https://devbox:8443/api/ping", withCookie("https://evil.example")); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "ORIGIN_NOT_ALLOWED") {
+		t.Fatalf("expected cross-origin write to be refused, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := f.do(http.MethodPost, "https://devbox:8443/api/ping", withCookie("")); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected write without Origin to be refused, got %d", rr.Code)
+	}
+}
+
+func TestRemoteAuth_RateLimitsFailedLogins(t *testing.T) {
+	t.Parallel()
+	f := newRemoteAuthFixture(t)
+
+	attempt := func() int {
+		req := httptest.NewRequest(http.MethodPost, "https://devbox:8443/api/auth/login", strings.NewReader(`{"password":"nope"}`))
+		req.Header.Set("Origin", "https://127.0.0.1:8443")
+		req.Header.Set(LoginNonceHeader, f.nonce(t))
+		rr := httptest.NewRecorder()
+		f.handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	for i := 0; i < maxLoginFailures; i++ {
+		if code := attempt(); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, code)
+		}
+	}
+	if code := attempt(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after %d failures, got %d", maxLoginFailures, code)
+	}
+}
+
+func TestRemoteAuth_RateLimitsUnknownBearerTokens(t *testing.T) {
+	t.Parallel()
+	f := newRemoteAuthFixture(t)
+
+	bearer := func(tok string) int {
+		return f.do(http.MethodGet, "https://devbox:8443/api/auth/me", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+tok)
+		}).Code
+	}
+	for i := 0; i < maxLoginFailures; i++ {
+		if code := bearer("unknown-token-0123456789"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, code)
+		}
+	}
+	if code := bearer(f.operator); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after %d failures, got %d", maxLoginFailures, code)
+	}
+}
+
+func TestHashToken_IndexesTokensByLookupID(t *testing.T) {
+	t.Parallel()
+
+	if _, err := HashToken("short"); err == nil || !strings.Contains(err.Error(), "at least") {
+		t.Fatalf("expected short tokens to be rejected, got %v", err)
+	}
+	hash, err := HashToken("tok-0123456789abcdefghij")
+	if err != nil {
+		t.Fatalf("HashToken error: %v", err)
+	}
+	if hashLookupID(hash) != tokenLookupID("tok-0123456789abcdefghij") || !verifySecret(hash, "tok-0123456789abcdefghij") {
+		t.Fatalf("unexpected token hash: %q", hash)
+	}
+	auth, err := NewRemoteAuth(RemoteAuthConfig{Tokens: []RemoteToken{{Name: "a", Hash: hash, Role: RoleRead}}})
+	if err != nil {
+		t.Fatalf("NewRemoteAuth error: %v", err)
+	}
+	// An unknown token has no entry to verify against; a known one verifies
+	// against its own entry only.
+	if _, ok := auth.lookupToken("tok-0123456789abcdefghik"); ok {
+		t.Fatalf("expected an unknown token to be rejected")
+	}
+	if p, ok := auth.lookupToken("tok-0123456789abcdefghij"); !ok || p.Name != "a" {
+		t.Fatalf("expected the token to match its entry, got %+v %v", p, ok)
+	}
+}
+
+func TestNewRemoteAuth_ValidatesConfig(t *testing.T) {
+	t.Parallel()
+
+	hash, _ := HashToken("x-0123456789abcdefghij")
+	secretHash, _ := HashSecret("x")
+	for _, tc := range []struct {
+		name string
+		cfg  RemoteAuthConfig
+		want string
+	}{
+		{name: "no credentials", cfg: RemoteAuthConfig{}, want: "requires a password hash"},
+		{name: "plaintext password", cfg: RemoteAuthConfig{PasswordHash: "hunter2"}, want: "hash-secret"},
+		{name: "bad role", cfg: RemoteAuthConfig{Tokens: []RemoteToken{{Name: "a", Hash: hash, Role: "admin"}}}, want: "role must be"},
+		{name: "duplicate", cfg: RemoteAuthConfig{Tokens: []RemoteToken{{Name: "a", Hash: hash, Role: RoleRead}, {Name: "a", Hash: hash, Role: RoleRead}}}, want: "duplicate"},
+		{name: "same token", cfg: RemoteAuthConfig{Tokens: []RemoteToken{{Name: "a", Hash: hash, Role: RoleRead}, {Name: "b", Hash: hash, Role: RoleRead}}}, want: "same token"},
+		{name: "no lookup id", cfg: RemoteAuthConfig{Tokens: []RemoteToken{{Name: "a", Hash: secretHash, Role: RoleRead}}}, want: "hash-secret --token"},
+	} {
+		if _, err := NewRemoteAuth(tc.cfg); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestLoadRemoteTLS_GeneratesOnceAndServesHTTPS(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "tls")
+	first, err := LoadRemoteTLS(RemoteTLSConfig{GeneratedDir: dir, Hosts: []string{"devbox.lan"}})
+	if err != nil {
+		t.Fatalf("LoadRemoteTLS error: %v", err)
+	}
+	second, err := LoadRemoteTLS(RemoteTLSConfig{GeneratedDir: dir})
+	if err != nil {
+		t.Fatalf("LoadRemoteTLS (reuse) error: %v", err)
+	}
+	if !first.Generated || second.Generated || first.Fingerprint != second.Fingerprint {
+		t.Fatalf("expected certificate to be generated once and reused: %+v / %+v", first, second)
+	}
+
+	ln, baseURL, err := ListenRemote("127.0.0.1", 0, second.Config)
+	if err != nil {
+		t.Fatalf("ListenRemote error: %v", err)
+	}
+	if !strings.HasPrefix(baseURL, "https://127.0.0.1:") {
+		t.Fatalf("unexpected baseURL %q", baseURL)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(baseURL + "/")
+	if err != nil {
+		t.Fatalf("GET over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Fatalf("expected TLS 200, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,193 @@
+package console
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	generatedCertFile     = "cert.pem"
+	generatedKeyFile      = "key.pem"
+	generatedCertValidity = 365 * 24 * time.Hour
+)
+
+type RemoteTLSConfig struct {
+	// CertFile and KeyFile are a user-provided PEM pair. When both are empty a
+	// self-signed certificate is generated in GeneratedDir on first start and
+	// reused afterwards.
+	CertFile     string
+	KeyFile      string
+	GeneratedDir string
+	// Hosts are extra DNS names or IPs for the generated certificate;
+	// localhost, 127.0.0.1 and the machine hostname are always included.
+	Hosts []string
+}
+
+type RemoteTLSResult struct {
+	Config *tls.Config
+	// Fingerprint is the SHA-256 of the leaf certificate, printed at startup
+	// so a self-signed certificate can be verified from the browser.
+	Fingerprint string
+	Generated   bool
+	CertPath    string
+}
+
+func LoadRemoteTLS(cfg RemoteTLSConfig) (RemoteTLSResult, error) {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return RemoteTLSResult{}, errors.New("TLS cert and key must be set together")
+	}
+
+	certPath, keyPath := cfg.CertFile, cfg.KeyFile
+	generated := false
+	if certPath == "" {
+		if cfg.GeneratedDir == "" {
+			return RemoteTLSResult{}, errors.New("no TLS certificate configured and no directory for a generated one")
+		}
+		certPath = filepath.Join(cfg.GeneratedDir, generatedCertFile)
+		keyPath = filepath.Join(cfg.GeneratedDir, generatedKeyFile)
+		if _, err := os.Stat(certPath); errors.Is(err, os.ErrNotExist) {
+			if err := generateSelfSignedCert(certPath, keyPath, cfg.Hosts); err != nil {
+				return RemoteTLSResult{}, fmt.Errorf("generate self-signed certificate: %w", err)
+			}
+			generated = true
+		}
+	}
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return RemoteTLSResult{}, fmt.Errorf("load TLS certificate %s: %w", certPath, err)
+	}
+	sum := sha256.Sum256(pair.Certificate[0])
+	return RemoteTLSResult{
+		Config: &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{pair},
+		},
+		Fingerprint: formatFingerprint(sum[:]),
+		Generated:   generated,
+		CertPath:    certPath,
+	}, nil
+}
+
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = strings.ToUpper(hex.EncodeToString([]byte{b}))
+	}
+	return strings.Join(parts, ":")
+}
+
+func generateSelfSignedCert(certPath, keyPath string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"oh-my-agent-flow console"}, CommonName: "ohmyagentflow"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(generatedCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	names := append([]string{"localhost", "127.0.0.1", "::1"}, hosts...)
+	if hn, err := os.Hostname(); err == nil && hn != "" {
+		names = append(names, hn)
+	}
+	seen := make(map[string]struct{}, len(names))
+	for _, h := range names {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if _, dup := seen[h]; dup {
+			continue
+		}
+		seen[h] = struct{}{}
+		if ip := net.ParseIP(h); ip != nil {
+			if !ip.IsUnspecified() {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			}
+			continue
+		}
+		tmpl.DNSNames = append(tmpl.DNSNames, h)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0o700); err != nil {
+		return err
+	}
+	// Key first: a cert without its key would be reused and fail to load.
+	if err := writeFileAtomicWithPrefix(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600, ".key-*"); err != nil {
+		return err
+	}
+	return writeFileAtomicWithPrefix(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644, ".cert-*")
+}
+
+// ListenRemote binds host:port with TLS. Unlike ListenLocal it accepts any
+// interface; baseURL uses 127.0.0.1 when host is a wildcard so it stays
+// usable for auto-open on this machine.
+func ListenRemote(host string, port int, tlsConfig *tls.Config) (net.Listener, string, error) {
+	if port < 0 || port > 65535 {
+		return nil, "", fmt.Errorf("invalid --port %d (must be 0..65535)", port)
+	}
+	if tlsConfig == nil {
+		return nil, "", errors.New("remote mode requires TLS")
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	inner, err := net.Listen("tcp", addr)
+	if err != nil {
+		if strings.Contains(err.Error(), "address already in use") {
+			return nil, "", fmt.Errorf("port %d is already in use", port)
+		}
+		return nil, "", fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	actualPort := inner.Addr().(*net.TCPAddr).Port
+	baseURL := "https://" + net.JoinHostPort(RemoteCanonicalHost(host), strconv.Itoa(actualPort))
+	return tls.NewListener(inner, tlsConfig), baseURL, nil
+}
+
+// RemoteCanonicalHost is the host used for redirects and the printed URL:
+// the bind address itself, or 127.0.0.1 for wildcard binds.
+func RemoteCanonicalHost(bind string) string {
+	if bind == "" {
+		return bindHost
+	}
+	if ip := net.ParseIP(bind); ip != nil && ip.IsUnspecified() {
+		return bindHost
+	}
+	return bind
+}
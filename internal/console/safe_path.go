@@ -0,0 +1,424 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PathWhitelist is a declarative list of project-relative, slash-separated
+// glob patterns. Each segment is a path.Match pattern ("*" never crosses
+// "/"); a "**" segment matches zero or more whole segments.
+type PathWhitelist []string
+
+func (w PathWhitelist) Allows(rel string) bool {
+	segs := strings.Split(rel, "/")
+	for _, pattern := range w {
+		if matchGlobSegments(strings.Split(pattern, "/"), segs, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsDescendant reports whether some pattern could match a path below the
+// directory dir ("" is the root), i.e. whether listing dir can reveal
+// anything readable.
+func (w PathWhitelist) AllowsDescendant(dir string) bool {
+	var segs []string
+	if dir != "" {
+		segs = strings.Split(dir, "/")
+	}
+	for _, pattern := range w {
+		if matchGlobSegments(strings.Split(pattern, "/"), segs, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlobSegments matches path segments against pattern segments. With
+// prefix set, it reports whether segs is a strict prefix of some match.
+func matchGlobSegments(pattern []string, segs []string, prefix bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchGlobSegments(pattern[1:], segs[i:], prefix) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return prefix
+		}
+		if ok, err := path.Match(pattern[0], segs[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return !prefix && len(segs) == 0
+}
+
+// ValidatePathWhitelist rejects patterns that are empty, malformed, absolute
+// or that climb out of the root.
+func ValidatePathWhitelist(w PathWhitelist) error {
+	for _, pattern := range w {
+		switch {
+		case strings.TrimSpace(pattern) == "":
+			return errors.New("empty pattern")
+		case strings.Contains(pattern, "\\"):
+			return fmt.Errorf("pattern %q must use forward slashes", pattern)
+		case path.IsAbs(pattern) || filepath.VolumeName(pattern) != "":
+			return fmt.Errorf("pattern %q must be relative to the project root", pattern)
+		}
+		for _, seg := range strings.Split(pattern, "/") {
+			if seg == "" || seg == "." || seg == ".." {
+				return fmt.Errorf("pattern %q must not contain empty, \".\" or \"..\" segments", pattern)
+			}
+			if _, err := path.Match(seg, ""); err != nil {
+				return fmt.Errorf("pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	// FSReadWhitelist is the default for what GET /api/fs/read and
+	// /api/fs/list expose; fs.readWhitelist replaces it.
+	FSReadWhitelist = PathWhitelist{
+		"tasks/prd-*.md",
+		"prd.json",
+		"progress.txt",
+		"CODEX.md",
+		"CLAUDE.md",
+		"**/AGENTS.md",
+		"archive/*/prd.json",
+		"archive/*/progress.txt",
+	}
+
+	// ConsoleWriteWhitelist is every project file a console operation may
+	// create, overwrite or restore.
+	ConsoleWriteWhitelist = PathWhitelist{
+		"prd.json",
+		"tasks/prd-*.md",
+		".codex/skills/ralph-prd-generator/SKILL.md",
+		".codex/skills/ralph-prd-converter/SKILL.md",
+		"CODEX.md",
+		"CLAUDE.md",
+		"prompt.md",
+	}
+
+	initSourceWhitelist = PathWhitelist{
+		"skills/ralph-prd-generator/SKILL-codex.md",
+		"skills/ralph-prd-converter/SKILL-codex.md",
+	}
+
+	fireInputWhitelist = PathWhitelist{"prd.json", "progress.txt", "ralph-codex.sh"}
+)
+
+type SafePathConfig struct {
+	ProjectRoot string
+}
+
+// SafePath is the single entry point for turning a project-relative path into
+// a filesystem path (design doc §14.1). Every check happens on the
+// symlink-resolved path, so a symlinked file or directory cannot redirect a
+// read or write outside the project root.
+type SafePath struct {
+	rootAbs  string
+	rootReal string
+}
+
+type safePathAccess int
+
+const (
+	safePathRead safePathAccess = iota
+	safePathWrite
+)
+
+func NewSafePath(cfg SafePathConfig) (*SafePath, error) {
+	if strings.TrimSpace(cfg.ProjectRoot) == "" {
+		return nil, errors.New("project root is required")
+	}
+	rootAbs, err := filepath.Abs(cfg.ProjectRoot)
+	if err != nil {
+		return nil, err
+	}
+	rootReal, err := filepath.EvalSymlinks(rootAbs)
+	if err != nil {
+		return nil, err
+	}
+	return &SafePath{rootAbs: rootAbs, rootReal: rootReal}, nil
+}
+
+// Root returns the symlink-resolved project root.
+func (p *SafePath) Root() string {
+	return p.rootReal
+}
+
+// ResolveRead returns the real path of an existing regular file matching allow.
+func (p *SafePath) ResolveRead(rel string, allow PathWhitelist) (string, os.FileInfo, *APIError, int) {
+	real, exists, apiErr, status := p.resolve(rel, allow, safePathRead)
+	if apiErr != nil {
+		return "", nil, apiErr, status
+	}
+	if !exists {
+		return "", nil, &APIError{
+			Code:    "FS_READ_NOT_FOUND",
+			Message: "File not found.",
+		}, http.StatusNotFound
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, &APIError{
+				Code:    "FS_READ_NOT_FOUND",
+				Message: "File not found.",
+			}, http.StatusNotFound
+		}
+		return "", nil, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to stat file.",
+		}, http.StatusInternalServerError
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil, &APIError{
+			Code:    "FS_READ_NOT_ALLOWED",
+			Message: "Only regular files are readable.",
+		}, http.StatusForbidden
+	}
+	return real, info, nil, http.StatusOK
+}
+
+// ResolveReadDir returns the real path of an existing directory; "" is the
+// project root.
+func (p *SafePath) ResolveReadDir(rel string) (string, *APIError, int) {
+	if rel == "" || path.Clean(rel) == "." {
+		return p.rootReal, nil, http.StatusOK
+	}
+	real, exists, apiErr, status := p.resolve(rel, nil, safePathRead)
+	if apiErr != nil {
+		return "", apiErr, status
+	}
+	if !exists {
+		return "", &APIError{
+			Code:    "FS_READ_NOT_FOUND",
+			Message: "Directory not found.",
+		}, http.StatusNotFound
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to stat directory.",
+		}, http.StatusInternalServerError
+	}
+	if !info.IsDir() {
+		return "", &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "dir must point to a directory.",
+			Hint:    "Use GET /api/fs/read for files.",
+		}, http.StatusBadRequest
+	}
+	return real, nil, http.StatusOK
+}
+
+// ResolveWrite returns the real path a write to rel must target. Missing
+// parent directories are allowed; the caller creates them under the returned
+// path, which is already known to be inside the root.
+func (p *SafePath) ResolveWrite(rel string, allow PathWhitelist) (string, *APIError, int) {
+	real, exists, apiErr, status := p.resolve(rel, allow, safePathWrite)
+	if apiErr != nil {
+		return "", apiErr, status
+	}
+	if exists {
+		info, err := os.Stat(real)
+		if err != nil {
+			return "", &APIError{
+				Code:    "INTERNAL_ERROR",
+				Message: fmt.Sprintf("failed to stat %s", rel),
+				Hint:    err.Error(),
+			}, http.StatusInternalServerError
+		}
+		if !info.Mode().IsRegular() {
+			return "", &APIError{
+				Code:    "FS_WRITE_NOT_ALLOWED",
+				Message: fmt.Sprintf("%s exists but is not a regular file.", rel),
+				Hint:    "Remove or rename the existing path and retry.",
+			}, http.StatusConflict
+		}
+	}
+	return real, nil, http.StatusOK
+}
+
+// ResolveDir returns the real path of a directory under the root that the
+// caller may create.
+func (p *SafePath) ResolveDir(rel string) (string, *APIError, int) {
+	real, _, apiErr, status := p.resolve(rel, nil, safePathWrite)
+	return real, apiErr, status
+}
+
+// RequireRegularFile is the stricter check for files the console executes or
+// hands to a child process: rel itself must be a regular file, not a symlink.
+func (p *SafePath) RequireRegularFile(rel string, allow PathWhitelist) (string, *APIError, int) {
+	if _, _, apiErr, _ := p.resolve(rel, allow, safePathRead); apiErr != nil {
+		return "", &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: "unsafe server path configuration.",
+		}, http.StatusInternalServerError
+	}
+
+	abs := filepath.Join(p.rootAbs, filepath.FromSlash(path.Clean(rel)))
+	info, err := os.Lstat(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			hint := ""
+			if rel == "prd.json" {
+				hint = "Generate or Convert a PRD first so prd.json exists, then retry Fire."
+			} else if rel == "ralph-codex.sh" {
+				hint = "Ensure ralph-codex.sh exists under the project root and is not a symlink."
+			}
+			return "", &APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: fmt.Sprintf("%s is required but was not found.", rel),
+				Hint:    hint,
+			}, http.StatusBadRequest
+		}
+		return "", &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: fmt.Sprintf("Failed to stat %s.", rel),
+		}, http.StatusInternalServerError
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return "", &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: fmt.Sprintf("%s must be a regular file (symlinks are not allowed).", rel),
+			Hint:    "Replace the symlink with a real file under the project root and retry.",
+		}, http.StatusBadRequest
+	}
+	if !info.Mode().IsRegular() {
+		return "", &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: fmt.Sprintf("%s must be a regular file.", rel),
+		}, http.StatusBadRequest
+	}
+	return abs, nil, http.StatusOK
+}
+
+// resolve validates rel, checks it against allow (nil skips the whitelist)
+// and resolves it to a real path inside the root. When rel does not exist
+// yet, its nearest existing ancestor is resolved and the rest appended.
+func (p *SafePath) resolve(rel string, allow PathWhitelist, access safePathAccess) (string, bool, *APIError, int) {
+	notAllowed := "FS_READ_NOT_ALLOWED"
+	if access == safePathWrite {
+		notAllowed = "FS_WRITE_NOT_ALLOWED"
+	}
+
+	if rel == "" {
+		return "", false, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "path is required.",
+			Hint:    "Provide a project-relative path, e.g. tasks/prd-foo.md",
+		}, http.StatusBadRequest
+	}
+	if strings.Contains(rel, "\x00") {
+		return "", false, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "path must not contain NUL bytes.",
+		}, http.StatusBadRequest
+	}
+	if strings.Contains(rel, "\\") {
+		return "", false, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "path must use forward slashes (/).",
+			Hint:    "Use a project-relative path like tasks/prd-foo.md (not Windows-style backslashes).",
+		}, http.StatusBadRequest
+	}
+
+	clean := path.Clean(rel)
+	if clean == "." || clean == "/" {
+		return "", false, &APIError{
+			Code:    "VALIDATION_ERROR",
+			Message: "path must point to a file.",
+		}, http.StatusBadRequest
+	}
+	if path.IsAbs(clean) || filepath.IsAbs(filepath.FromSlash(clean)) || filepath.VolumeName(filepath.FromSlash(clean)) != "" {
+		return "", false, &APIError{
+			Code:    notAllowed,
+			Message: "Absolute paths are not allowed.",
+			Hint:    "Provide a path relative to the project root.",
+		}, http.StatusForbidden
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false, &APIError{
+			Code:    notAllowed,
+			Message: "Path escapes project root.",
+			Hint:    "Remove '..' segments and use a project-relative path.",
+		}, http.StatusForbidden
+	}
+	if allow != nil && !allow.Allows(clean) {
+		return "", false, &APIError{
+			Code:    notAllowed,
+			Message: "Path not allowed.",
+			Hint:    fmt.Sprintf("Allowed paths: %s.", strings.Join(allow, ", ")),
+		}, http.StatusForbidden
+	}
+
+	abs := filepath.Join(p.rootAbs, filepath.FromSlash(clean))
+	real, exists, err := evalSymlinksPartial(abs)
+	if err != nil {
+		return "", false, &APIError{
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to resolve path.",
+			Hint:    "Check file permissions and try again.",
+		}, http.StatusInternalServerError
+	}
+	if real == p.rootReal || !isWithinRoot(p.rootReal, real) {
+		return "", false, &APIError{
+			Code:    notAllowed,
+			Message: "Path escapes project root.",
+			Hint:    "Symlink escapes are not allowed; ensure the path resolves within the project root.",
+		}, http.StatusForbidden
+	}
+	return real, exists, nil, http.StatusOK
+}
+
+// evalSymlinksPartial resolves abs like filepath.EvalSymlinks, but tolerates
+// missing trailing components by resolving the nearest existing ancestor.
+func evalSymlinksPartial(abs string) (string, bool, error) {
+	real, err := filepath.EvalSymlinks(abs)
+	if err == nil {
+		return real, true, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return "", false, err
+	}
+	// A dangling symlink resolves through its parent: the write replaces the
+	// link itself rather than following it.
+	parentReal, _, err := evalSymlinksPartial(parent)
+	if err != nil {
+		return "", false, err
+	}
+	return filepath.Join(parentReal, filepath.Base(abs)), false, nil
+}
+
+func isWithinRoot(rootReal, candidateReal string) bool {
+	rel, err := filepath.Rel(rootReal, candidateReal)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,231 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestSafePath(t *testing.T) (*SafePath, string) {
+	t.Helper()
+	root := t.TempDir()
+	p, err := NewSafePath(SafePathConfig{ProjectRoot: root})
+	if err != nil {
+		t.Fatalf("NewSafePath error: %v", err)
+	}
+	return p, p.Root()
+}
+
+func TestPathWhitelist_Allows(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{"prd.json", true},
+		{"progress.txt", true},
+		{"tasks/prd-demo.md", true},
+		{"tasks/prd-.md", true},
+		{"tasks/sub/prd-demo.md", false},
+		{"tasks/prd-a/b.md", false},
+		{"tasks/demo.md", false},
+		{"prd.json.bak", false},
+		{".env", false},
+		{"AGENTS.md", true},
+		{"services/api/AGENTS.md", true},
+		{"archive/2025-01-01-ralph-x/prd.json", true},
+		{"archive/2025-01-01-ralph-x/notes/prd.json", false},
+	} {
+		if got := FSReadWhitelist.Allows(tc.path); got != tc.want {
+			t.Fatalf("Allows(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		dir  string
+		want bool
+	}{
+		{"", true},
+		{"tasks", true},
+		{"tasks/sub", true}, // **/AGENTS.md
+		{"archive/2025-01-01-ralph-x", true},
+	} {
+		if got := FSReadWhitelist.AllowsDescendant(tc.dir); got != tc.want {
+			t.Fatalf("AllowsDescendant(%q) = %v, want %v", tc.dir, got, tc.want)
+		}
+	}
+	narrow := PathWhitelist{"tasks/prd-*.md", "docs/**/*.md"}
+	for dir, want := range map[string]bool{"tasks": true, "tasks/sub": false, "docs": true, "docs/a/b": true, "src": false} {
+		if got := narrow.AllowsDescendant(dir); got != want {
+			t.Fatalf("narrow.AllowsDescendant(%q) = %v, want %v", dir, got, want)
+		}
+	}
+	if !narrow.Allows("docs/x.md") || !narrow.Allows("docs/a/b/x.md") || narrow.Allows("docs/x.txt") {
+		t.Fatalf("unexpected ** matching")
+	}
+
+	for _, bad := range []string{"", "/etc/*", "../x", "a/../b", "a//b", "tasks\\x", "["} {
+		if err := ValidatePathWhitelist(PathWhitelist{bad}); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSafePath_ResolveWriteRejectsSymlinkedDirEscape(t *testing.T) {
+	t.Parallel()
+
+	p, root := newTestSafePath(t)
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "tasks")); err != nil {
+		t.Skipf("symlinks not supported in this environment: %v", err)
+	}
+
+	_, apiErr, status := p.ResolveWrite("tasks/prd-demo.md", ConsoleWriteWhitelist)
+	if apiErr == nil || apiErr.Code != "FS_WRITE_NOT_ALLOWED" || status != http.StatusForbidden {
+		t.Fatalf("expected FS_WRITE_NOT_ALLOWED, got %d %+v", status, apiErr)
+	}
+
+	// Generate must refuse too instead of writing through the link.
+	body, _ := json.Marshal(validGenerateRequestForSafePath())
+	rr := httptest.NewRecorder()
+	PRDGenerateHandler(PRDGenerateConfig{ProjectRoot: root}).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/prd/generate", bytes.NewReader(body)))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "FS_WRITE_NOT_ALLOWED") {
+		t.Fatalf("expected generate to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatalf("write escaped the project root: %v", entries)
+	}
+}
+
+func TestSafePath_ResolveWriteInsideRoot(t *testing.T) {
+	t.Parallel()
+
+	p, root := newTestSafePath(t)
+	if err := os.MkdirAll(filepath.Join(root, "real-tasks"), 0o755); err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "real-tasks"), filepath.Join(root, "tasks")); err != nil {
+		t.Skipf("symlinks not supported in this environment: %v", err)
+	}
+
+	// A symlink that stays inside the root is fine; the real path is returned.
+	got, apiErr, _ := p.ResolveWrite("tasks/prd-demo.md", ConsoleWriteWhitelist)
+	if apiErr != nil || got != filepath.Join(root, "real-tasks", "prd-demo.md") {
+		t.Fatalf("unexpected resolution %q %+v", got, apiErr)
+	}
+
+	// Missing parents resolve through the nearest existing ancestor.
+	got, apiErr, _ = p.ResolveWrite(".codex/skills/ralph-prd-generator/SKILL.md", ConsoleWriteWhitelist)
+	if apiErr != nil || got != filepath.Join(root, ".codex", "skills", "ralph-prd-generator", "SKILL.md") {
+		t.Fatalf("unexpected resolution %q %+v", got, apiErr)
+	}
+
+	if _, apiErr, _ := p.ResolveWrite("notes.txt", ConsoleWriteWhitelist); apiErr == nil || apiErr.Code != "FS_WRITE_NOT_ALLOWED" {
+		t.Fatalf("expected non-whitelisted write to be rejected, got %+v", apiErr)
+	}
+	if err := os.Mkdir(filepath.Join(root, "prd.json"), 0o755); err != nil {
+		t.Fatalf("Mkdir error: %v", err)
+	}
+	if _, apiErr, status := p.ResolveWrite("prd.json", ConsoleWriteWhitelist); apiErr == nil || status != http.StatusConflict {
+		t.Fatalf("expected a directory target to be rejected, got %d %+v", status, apiErr)
+	}
+}
+
+func TestSafePath_RequireRegularFileRejectsSymlink(t *testing.T) {
+	t.Parallel()
+
+	p, root := newTestSafePath(t)
+	if err := os.WriteFile(filepath.Join(root, "real.sh"), []byte("echo\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "real.sh"), filepath.Join(root, "ralph-codex.sh")); err != nil {
+		t.Skipf("symlinks not supported in this environment: %v", err)
+	}
+	_, apiErr, _ := p.RequireRegularFile("ralph-codex.sh", fireInputWhitelist)
+	if apiErr == nil || apiErr.Code != "VALIDATION_ERROR" || !strings.Contains(apiErr.Message, "symlinks are not allowed") {
+		t.Fatalf("expected symlinked script to be rejected, got %+v", apiErr)
+	}
+}
+
+func FuzzSafePath_Resolve(f *testing.F) {
+	for _, seed := range []string{
+		"prd.json",
+		"tasks/prd-demo.md",
+		"../prd.json",
+		"tasks/../../etc/passwd",
+		"/etc/passwd",
+		"tasks/prd-x.md/..",
+		"tasks//prd-a.md",
+		"./tasks/./prd-a.md",
+		"tasks\\..\\..\\x",
+		"C:/Windows/win.ini",
+		"link/prd.json",
+		"link/../../x",
+		"escape/prd-a.md",
+		"\x00",
+		"",
+		".",
+		"..",
+	} {
+		f.Add(seed)
+	}
+
+	root := f.TempDir()
+	outside := f.TempDir()
+	p, err := NewSafePath(SafePathConfig{ProjectRoot: root})
+	if err != nil {
+		f.Fatalf("NewSafePath error: %v", err)
+	}
+	_ = os.MkdirAll(filepath.Join(p.Root(), "tasks"), 0o755)
+	_ = os.WriteFile(filepath.Join(p.Root(), "prd.json"), []byte("{}"), 0o644)
+	_ = os.WriteFile(filepath.Join(outside, "prd-a.md"), []byte("secret"), 0o644)
+	if err := os.Symlink(outside, filepath.Join(p.Root(), "escape")); err == nil {
+		_ = os.Symlink(outside, filepath.Join(p.Root(), "tasks", "prd-link.md"))
+		_ = os.Symlink(filepath.Join(outside, "prd-a.md"), filepath.Join(p.Root(), "tasks", "prd-out.md"))
+	}
+
+	f.Fuzz(func(t *testing.T, rel string) {
+		check := func(op string, real string, apiErr *APIError) {
+			if apiErr != nil {
+				return
+			}
+			if real == p.Root() || !isWithinRoot(p.Root(), real) {
+				t.Fatalf("%s(%q) resolved outside the root: %q", op, rel, real)
+			}
+			if strings.HasPrefix(real, outside) {
+				t.Fatalf("%s(%q) resolved into the outside dir: %q", op, rel, real)
+			}
+		}
+		real, _, apiErr, _ := p.ResolveRead(rel, nil)
+		check("ResolveRead", real, apiErr)
+		real, apiErr, _ = p.ResolveWrite(rel, nil)
+		check("ResolveWrite", real, apiErr)
+		real, apiErr, _ = p.ResolveDir(rel)
+		check("ResolveDir", real, apiErr)
+	})
+}
+
+func validGenerateRequestForSafePath() PRDGenerateRequest {
+	return PRDGenerateRequest{
+		Mode: "questionnaire",
+		FrontMatter: PRDGenerateFrontMatter{
+			Project:     "demo",
+			FeatureSlug: "demo",
+			Title:       "Demo",
+			Description: "Demo",
+		},
+		Goals: []string{"Do thing"},
+		UserStories: []PRDGenerateUserStory{{
+			ID:                 "US-001",
+			Title:              "First",
+			Description:        "As a user, I want one thing so that I can do it.",
+			AcceptanceCriteria: []string{"A"},
+		}},
+	}
+}
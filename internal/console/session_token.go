@@ -0,0 +1,185 @@
+package console
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSessionTokenTTL = 15 * time.Minute
+	// maxSessionTokens bounds memory when pages are reloaded in a loop; the
+	// token closest to expiry is dropped first.
+	maxSessionTokens = 1024
+)
+
+type SessionTokenConfig struct {
+	TTL time.Duration
+	Now func() time.Time
+}
+
+// SessionTokenStore issues the short-lived X-Session-Token values required by
+// RequireWriteAuth. Every page load gets its own token; the page refreshes it
+// before expiry via RefreshHandler, which revokes the token it replaces.
+type SessionTokenStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu sync.Mutex
+	// tokens maps sha256(token) to its expiry. Looking up the digest instead of
+	// the token keeps validation timing independent of the token's contents.
+	tokens map[string]time.Time
+}
+
+type IssuedSessionToken struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type sessionTokenStatus int
+
+const (
+	sessionTokenUnknown sessionTokenStatus = iota
+	sessionTokenExpired
+	sessionTokenValid
+)
+
+func NewSessionTokenStore(cfg SessionTokenConfig) *SessionTokenStore {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = DefaultSessionTokenTTL
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &SessionTokenStore{ttl: ttl, now: now, tokens: make(map[string]time.Time)}
+}
+
+func sessionTokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *SessionTokenStore) Issue() (IssuedSessionToken, error) {
+	token, err := GenerateSessionToken()
+	if err != nil {
+		return IssuedSessionToken{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.pruneLocked(now)
+	expiresAt := now.Add(s.ttl)
+	s.tokens[sessionTokenDigest(token)] = expiresAt
+	return IssuedSessionToken{Token: token, ExpiresAt: expiresAt.UTC().Format(time.RFC3339)}, nil
+}
+
+// pruneLocked forgets tokens that expired more than one TTL ago (until then
+// they are still reported as expired rather than unknown) and enforces
+// maxSessionTokens.
+func (s *SessionTokenStore) pruneLocked(now time.Time) {
+	cutoff := now.Add(-s.ttl)
+	for k, exp := range s.tokens {
+		if exp.Before(cutoff) {
+			delete(s.tokens, k)
+		}
+	}
+	for len(s.tokens) >= maxSessionTokens {
+		var oldestKey string
+		var oldest time.Time
+		for k, exp := range s.tokens {
+			if oldestKey == "" || exp.Before(oldest) {
+				oldestKey, oldest = k, exp
+			}
+		}
+		delete(s.tokens, oldestKey)
+	}
+}
+
+func (s *SessionTokenStore) check(token string) sessionTokenStatus {
+	if token == "" {
+		return sessionTokenUnknown
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.tokens[sessionTokenDigest(token)]
+	if !ok {
+		return sessionTokenUnknown
+	}
+	if !s.now().Before(exp) {
+		return sessionTokenExpired
+	}
+	return sessionTokenValid
+}
+
+// Revoke invalidates token immediately. It reports whether the token was known.
+func (s *SessionTokenStore) Revoke(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionTokenDigest(token)
+	_, ok := s.tokens[key]
+	delete(s.tokens, key)
+	return ok
+}
+
+// Rotate replaces a valid token with a fresh one.
+func (s *SessionTokenStore) Rotate(token string) (IssuedSessionToken, *APIError, int) {
+	if status := s.check(token); status != sessionTokenValid {
+		apiErr, code := sessionTokenError(status)
+		return IssuedSessionToken{}, &apiErr, code
+	}
+	issued, err := s.Issue()
+	if err != nil {
+		return IssuedSessionToken{}, &APIError{
+			Code:    "INTERNAL",
+			Message: "Failed to issue a session token.",
+		}, http.StatusInternalServerError
+	}
+	s.Revoke(token)
+	return issued, nil, http.StatusOK
+}
+
+func sessionTokenError(status sessionTokenStatus) (APIError, int) {
+	if status == sessionTokenExpired {
+		return APIError{
+			Code:    "SESSION_TOKEN_EXPIRED",
+			Message: "Session token has expired.",
+			Hint:    "Reload the console UI page to receive a new token, then retry.",
+		}, http.StatusForbidden
+	}
+	return APIError{
+		Code:    "SESSION_TOKEN_INVALID",
+		Message: "Session token is invalid.",
+		Hint:    "Reload the console UI page to receive a new token, then retry.",
+	}, http.StatusForbidden
+}
+
+// RefreshHandler serves POST /api/session/refresh. RequireWriteAuth has
+// already validated the presented token; it is revoked once the new one is
+// issued, so a captured token cannot be replayed after the page rotates it.
+func (s *SessionTokenStore) RefreshHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		issued, apiErr, status := s.Rotate(r.Header.Get("X-Session-Token"))
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(issued)
+	}
+}
+
+// RevokeHandler serves POST /api/session/revoke, used when a page unloads or
+// logs out.
+func (s *SessionTokenStore) RevokeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		revoked := s.Revoke(r.Header.Get("X-Session-Token"))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "revoked": revoked})
+	}
+}
@@ -0,0 +1,148 @@
+package console
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTokenAuthHandler(store *SessionTokenStore) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/ping", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	mux.HandleFunc("POST /api/session/refresh", store.RefreshHandler())
+	mux.HandleFunc("POST /api/session/revoke", store.RevokeHandler())
+	return RequireWriteAuth(mux, WriteAuthConfig{
+		Tokens:         store,
+		AllowedOrigins: []string{"http://127.0.0.1:1234"},
+	})
+}
+
+func postWithToken(h http.Handler, path string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:1234"+path, nil)
+	req.Header.Set("Origin", "http://127.0.0.1:1234")
+	req.Header.Set("X-Session-Token", token)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSessionTokenStore_TokensExpire(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := NewSessionTokenStore(SessionTokenConfig{TTL: 10 * time.Minute, Now: clock.Now})
+	h := newTokenAuthHandler(store)
+
+	issued, err := store.Issue()
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if issued.ExpiresAt != "2023-11-14T22:23:20Z" {
+		t.Fatalf("unexpected expiresAt %q", issued.ExpiresAt)
+	}
+	if rr := postWithToken(h, "/api/ping", issued.Token); rr.Code != http.StatusOK {
+		t.Fatalf("expected fresh token to be accepted, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	clock.Advance(10 * time.Minute)
+	rr := postWithToken(h, "/api/ping", issued.Token)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "SESSION_TOKEN_EXPIRED") {
+		t.Fatalf("expected SESSION_TOKEN_EXPIRED, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := postWithToken(h, "/api/session/refresh", issued.Token); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected an expired token not to be refreshable, got %d", rr.Code)
+	}
+
+	// Long-expired tokens are forgotten and reported as invalid.
+	clock.Advance(time.Hour)
+	if _, err := store.Issue(); err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if rr := postWithToken(h, "/api/ping", issued.Token); !strings.Contains(rr.Body.String(), "SESSION_TOKEN_INVALID") {
+		t.Fatalf("expected pruned token to be invalid, got %s", rr.Body.String())
+	}
+}
+
+func TestSessionTokenStore_RefreshRevokesOldToken(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := NewSessionTokenStore(SessionTokenConfig{TTL: 10 * time.Minute, Now: clock.Now})
+	h := newTokenAuthHandler(store)
+	issued, _ := store.Issue()
+
+	clock.Advance(7 * time.Minute)
+	rr := postWithToken(h, "/api/session/refresh", issued.Token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected refresh to succeed, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var next IssuedSessionToken
+	if err := json.Unmarshal(rr.Body.Bytes(), &next); err != nil || next.Token == "" || next.Token == issued.Token {
+		t.Fatalf("expected a new token, got %s (err=%v)", rr.Body.String(), err)
+	}
+
+	// Replaying the rotated-out token must fail, for writes and refreshes alike.
+	if rr := postWithToken(h, "/api/ping", issued.Token); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "SESSION_TOKEN_INVALID") {
+		t.Fatalf("expected replayed token to be rejected, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := postWithToken(h, "/api/session/refresh", issued.Token); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected replayed refresh to be rejected, got %d", rr.Code)
+	}
+
+	// The new token outlives the old one's expiry.
+	clock.Advance(5 * time.Minute)
+	if rr := postWithToken(h, "/api/ping", next.Token); rr.Code != http.StatusOK {
+		t.Fatalf("expected rotated token to be accepted, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	if rr := postWithToken(h, "/api/session/revoke", next.Token); rr.Code != http.StatusOK {
+		t.Fatalf("expected revoke to succeed, got %d", rr.Code)
+	}
+	if rr := postWithToken(h, "/api/ping", next.Token); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected revoked token to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestSessionTokenStore_BoundsStoredTokens(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := NewSessionTokenStore(SessionTokenConfig{Now: clock.Now})
+	first, _ := store.Issue()
+	for i := 0; i < maxSessionTokens; i++ {
+		clock.Advance(time.Millisecond)
+		if _, err := store.Issue(); err != nil {
+			t.Fatalf("Issue error: %v", err)
+		}
+	}
+	store.mu.Lock()
+	n := len(store.tokens)
+	store.mu.Unlock()
+	if n > maxSessionTokens {
+		t.Fatalf("expected at most %d tokens, got %d", maxSessionTokens, n)
+	}
+	if store.check(first.Token) != sessionTokenUnknown {
+		t.Fatalf("expected the oldest token to be evicted")
+	}
+}
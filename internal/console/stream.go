@@ -20,6 +20,7 @@ const DefaultMaxProcessTextBytes = 8 * 1024
 const DefaultMaxArchiveBytes = 50 * 1024 * 1024
 const DefaultArchiveRetentionCount = 50
 const DefaultArchiveRetentionBytes = 1024 * 1024 * 1024
+const DefaultSubscriberBufSize = 128
 
 type StreamEvent struct {
 	TS    string `json:"ts"`
@@ -37,14 +38,25 @@ type StreamHubConfig struct {
 	MaxProcessTextBytes int
 	ArchiveDir          string
 	MaxArchiveBytes     int64
+	// CompressArchives gzips finalized archives to <run>.jsonl.gz.
+	CompressArchives bool
+	// Retention limits for the archive dir: 0 means the default, negative means unlimited.
+	// ArchiveRetentionAge of 0 keeps archives regardless of age.
+	ArchiveRetentionCount int
+	ArchiveRetentionBytes int64
+	ArchiveRetentionAge   time.Duration
+	// Redactor masks secrets in process output; nil uses DefaultRedactor.
+	Redactor *Redactor
+	Metrics  *Metrics
 }
 
 type StreamHub struct {
 	mu   sync.Mutex
 	runs map[string]*streamRunState
 
-	globalSubs map[chan StreamEvent]struct{}
-	runSubs    map[string]map[chan StreamEvent]struct{}
+	globalSubs map[chan StreamEvent]*streamSubscriber
+	runSubs    map[string]map[chan StreamEvent]*streamSubscriber
+	nextSubID  uint64
 
 	maxEventsPerRun       int
 	subscriberBufSize     int
@@ -52,9 +64,19 @@ type StreamHub struct {
 	maxProcessTextBytes   int
 	emitGovernanceWarning bool
 
-	archiveDir      string
-	maxArchiveBytes int64
-	archives        map[string]*runArchiveState
+	archiveDir       string
+	maxArchiveBytes  int64
+	archives         map[string]*runArchiveState
+	compressArchives bool
+	retentionCount   int
+	retentionBytes   int64
+	retentionAge     time.Duration
+	compressWG       sync.WaitGroup
+	pins             map[string]struct{}
+	pinsLoadErr      error
+
+	redactor *Redactor
+	metrics  *Metrics
 }
 
 type streamRunState struct {
@@ -63,6 +85,10 @@ type streamRunState struct {
 
 	replayTruncateEmitted    bool
 	governanceWarningEmitted bool
+
+	redactions int
+	// privateKeyLines tracks an open PEM block per output stream (see redactStreamLine).
+	privateKeyLines map[string]int
 }
 
 type runArchiveState struct {
@@ -86,7 +112,7 @@ func NewStreamHub(cfg StreamHubConfig) *StreamHub {
 	}
 	bufSize := cfg.SubscriberBufSize
 	if bufSize <= 0 {
-		bufSize = 128
+		bufSize = DefaultSubscriberBufSize
 	}
 	maxTextBytes := cfg.MaxProcessTextBytes
 	if maxTextBytes <= 0 {
@@ -100,11 +126,23 @@ func NewStreamHub(cfg StreamHubConfig) *StreamHub {
 	if archiveDir == "" {
 		maxArchiveBytes = 0
 	}
+	retentionCount := cfg.ArchiveRetentionCount
+	if retentionCount == 0 {
+		retentionCount = DefaultArchiveRetentionCount
+	}
+	retentionBytes := cfg.ArchiveRetentionBytes
+	if retentionBytes == 0 {
+		retentionBytes = DefaultArchiveRetentionBytes
+	}
+	redactor := cfg.Redactor
+	if redactor == nil {
+		redactor = DefaultRedactor()
+	}
 
-	return &StreamHub{
+	h := &StreamHub{
 		runs:                  make(map[string]*streamRunState),
-		globalSubs:            make(map[chan StreamEvent]struct{}),
-		runSubs:               make(map[string]map[chan StreamEvent]struct{}),
+		globalSubs:            make(map[chan StreamEvent]*streamSubscriber),
+		runSubs:               make(map[string]map[chan StreamEvent]*streamSubscriber),
 		maxEventsPerRun:       maxEvents,
 		subscriberBufSize:     bufSize,
 		emitReplayTruncate:    true,
@@ -113,7 +151,15 @@ func NewStreamHub(cfg StreamHubConfig) *StreamHub {
 		archiveDir:            archiveDir,
 		maxArchiveBytes:       maxArchiveBytes,
 		archives:              make(map[string]*runArchiveState),
-	}
+		compressArchives:      cfg.CompressArchives,
+		retentionCount:        retentionCount,
+		retentionBytes:        retentionBytes,
+		retentionAge:          cfg.ArchiveRetentionAge,
+		redactor:              redactor,
+		metrics:               cfg.Metrics,
+	}
+	h.pins, h.pinsLoadErr = loadRunPins(archiveDir)
+	return h
 }
 
 func (h *StreamHub) Publish(event StreamEvent) StreamEvent {
@@ -121,18 +167,13 @@ func (h *StreamHub) Publish(event StreamEvent) StreamEvent {
 	event, extra := h.governAndPublishLocked(event)
 	runID := event.RunID
 
-	globalChans := make([]chan StreamEvent, 0, len(h.globalSubs))
-	for ch := range h.globalSubs {
-		globalChans = append(globalChans, ch)
+	subs := make([]*streamSubscriber, 0, len(h.globalSubs))
+	for _, sub := range h.globalSubs {
+		subs = append(subs, sub)
 	}
-
-	var runChans []chan StreamEvent
 	if runID != "" {
-		if subs, ok := h.runSubs[runID]; ok {
-			runChans = make([]chan StreamEvent, 0, len(subs))
-			for ch := range subs {
-				runChans = append(runChans, ch)
-			}
+		for _, sub := range h.runSubs[runID] {
+			subs = append(subs, sub)
 		}
 	}
 	h.mu.Unlock()
@@ -141,16 +182,10 @@ func (h *StreamHub) Publish(event StreamEvent) StreamEvent {
 	events = append(events, event)
 	events = append(events, extra...)
 	for _, ev := range events {
-		for _, ch := range globalChans {
-			select {
-			case ch <- ev:
-			default:
-			}
-		}
-		for _, ch := range runChans {
-			select {
-			case ch <- ev:
-			default:
+		h.metrics.streamEventPublished(ev.Type)
+		for _, sub := range subs {
+			if !sub.deliver(ev) {
+				h.metrics.streamEventDropped(sub.id, sub.runID)
 			}
 		}
 	}
@@ -160,6 +195,9 @@ func (h *StreamHub) Publish(event StreamEvent) StreamEvent {
 
 func (h *StreamHub) governAndPublishLocked(event StreamEvent) (published StreamEvent, extra []StreamEvent) {
 	event, didTruncate := h.governProcessOutput(event)
+	if event.Type == "run_finished" {
+		event = h.withRedactionCountLocked(event)
+	}
 	var archiveExtra *StreamEvent
 	published, archiveExtra = h.publishLocked(event)
 	if archiveExtra != nil {
@@ -215,21 +253,70 @@ func (h *StreamHub) governProcessOutput(event StreamEvent) (StreamEvent, bool) {
 	if !ok {
 		return event, false
 	}
-	truncatedText, didTruncate := truncateUTF8ToBytes(rawText, h.maxProcessTextBytes)
-	if !didTruncate {
+
+	// Redact before truncating so a secret cut in half by the byte limit is still caught.
+	text, redactions := h.redactProcessTextLocked(event.RunID, event.Type, rawText)
+	truncatedText, didTruncate := truncateUTF8ToBytes(text, h.maxProcessTextBytes)
+	if !didTruncate && text == rawText {
 		return event, false
 	}
 
-	copied := make(map[string]any, len(data)+3)
+	copied := make(map[string]any, len(data)+4)
 	for k, v := range data {
 		copied[k] = v
 	}
 	copied["text"] = truncatedText
-	copied["truncated"] = true
-	copied["originalBytes"] = len([]byte(rawText))
-	copied["limitBytes"] = h.maxProcessTextBytes
+	if redactions > 0 {
+		copied["redactions"] = redactions
+	}
+	if didTruncate {
+		copied["truncated"] = true
+		copied["originalBytes"] = len([]byte(rawText))
+		copied["limitBytes"] = h.maxProcessTextBytes
+	}
 	event.Data = copied
-	return event, true
+	return event, didTruncate
+}
+
+func (h *StreamHub) redactProcessTextLocked(runID string, stream string, text string) (string, int) {
+	if h.redactor == nil {
+		return text, 0
+	}
+	if runID == "" {
+		out, n := h.redactor.Redact(text)
+		return out, n
+	}
+	state := h.runs[runID]
+	if state == nil {
+		state = &streamRunState{}
+		h.runs[runID] = state
+	}
+	out, n, keyLines := h.redactor.redactStreamLine(text, state.privateKeyLines[stream])
+	if keyLines > 0 || state.privateKeyLines[stream] > 0 {
+		if state.privateKeyLines == nil {
+			state.privateKeyLines = make(map[string]int)
+		}
+		state.privateKeyLines[stream] = keyLines
+	}
+	state.redactions += n
+	return out, n
+}
+
+// withRedactionCountLocked adds the run's total redaction count to run_finished.
+func (h *StreamHub) withRedactionCountLocked(event StreamEvent) StreamEvent {
+	count := 0
+	if state := h.runs[event.RunID]; state != nil {
+		count = state.redactions
+	}
+	copied := map[string]any{}
+	if data, ok := event.Data.(map[string]any); ok {
+		for k, v := range data {
+			copied[k] = v
+		}
+	}
+	copied["redactions"] = count
+	event.Data = copied
+	return event
 }
 
 func truncateUTF8ToBytes(s string, maxBytes int) (string, bool) {
@@ -277,19 +364,31 @@ func (h *StreamHub) publishLocked(event StreamEvent) (StreamEvent, *StreamEvent)
 }
 
 func (h *StreamHub) SubscribeAll() (<-chan StreamEvent, func()) {
+	sub, unsubscribe := h.subscribeAll()
+	return sub.ch, unsubscribe
+}
+
+func (h *StreamHub) subscribeAll() (*streamSubscriber, func()) {
 	ch := make(chan StreamEvent, h.subscriberBufSize)
 	h.mu.Lock()
-	h.globalSubs[ch] = struct{}{}
+	sub := h.newSubscriberLocked("", ch)
+	h.globalSubs[ch] = sub
 	h.mu.Unlock()
 
-	return ch, func() {
+	return sub, func() {
 		h.mu.Lock()
 		delete(h.globalSubs, ch)
 		h.mu.Unlock()
-		close(ch)
+		h.metrics.streamSubscriberClosed(sub.id, sub.runID)
+		sub.close()
 	}
 }
 
+func (h *StreamHub) newSubscriberLocked(runID string, ch chan StreamEvent) *streamSubscriber {
+	h.nextSubID++
+	return &streamSubscriber{id: h.nextSubID, runID: runID, ch: ch}
+}
+
 func (h *StreamHub) archiveEventLocked(event StreamEvent) *StreamEvent {
 	if h.archiveDir == "" || h.maxArchiveBytes <= 0 {
 		return nil
@@ -317,7 +416,7 @@ func (h *StreamHub) archiveEventLocked(event StreamEvent) *StreamEvent {
 	if arch.f == nil && !arch.stopped {
 		if !arch.cleanupAttempted {
 			arch.cleanupAttempted = true
-			protected := make(map[string]struct{})
+			protected := h.pinnedArchivePathsLocked()
 			for _, a := range h.archives {
 				if a == nil || a.finalized || a.f == nil {
 					continue
@@ -330,18 +429,18 @@ func (h *StreamHub) archiveEventLocked(event StreamEvent) *StreamEvent {
 				}
 			}
 
-			maxFiles := DefaultArchiveRetentionCount
+			// Negative limits mean unlimited. The new archive counts against
+			// the limits, so its slot and headroom are reserved up front.
+			maxFiles := h.retentionCount
 			if maxFiles > 0 {
-				maxFiles-- // reserve a slot for this new archive.
+				maxFiles--
 			}
-			maxBytes := int64(DefaultArchiveRetentionBytes)
-			if h.maxArchiveBytes > 0 && maxBytes > h.maxArchiveBytes {
-				maxBytes -= h.maxArchiveBytes // reserve max archive headroom.
-			} else if h.maxArchiveBytes > 0 {
-				maxBytes = 0
+			maxBytes := h.retentionBytes
+			if maxBytes > 0 && h.maxArchiveBytes > 0 {
+				maxBytes = max(maxBytes-h.maxArchiveBytes, 0)
 			}
 
-			if err := cleanupArchiveDir(h.archiveDir, maxFiles, maxBytes, protected); err != nil && !arch.cleanupErrorEmitted {
+			if err := cleanupArchiveDir(h.archiveDir, maxFiles, maxBytes, h.retentionAge, protected); err != nil && !arch.cleanupErrorEmitted {
 				arch.cleanupErrorEmitted = true
 				return &StreamEvent{
 					RunID: event.RunID,
@@ -441,6 +540,7 @@ func (h *StreamHub) archiveEventLocked(event StreamEvent) *StreamEvent {
 		}
 
 		arch.finalized = true
+		h.compressArchiveLocked(arch)
 		return nil
 	}
 
@@ -502,6 +602,7 @@ func (h *StreamHub) archiveEventLocked(event StreamEvent) *StreamEvent {
 		return nil
 	}
 	arch.bytesWritten += int64(len(line))
+	h.metrics.archiveBytesWritten(len(line))
 
 	if event.Type == "run_finished" {
 		if err := arch.f.Close(); err != nil && !arch.errorEmitted {
@@ -538,6 +639,7 @@ func (h *StreamHub) archiveEventLocked(event StreamEvent) *StreamEvent {
 			}
 		}
 		arch.finalized = true
+		h.compressArchiveLocked(arch)
 	}
 
 	return nil
@@ -549,16 +651,14 @@ type archiveFileEntry struct {
 	size    int64
 }
 
-func cleanupArchiveDir(dir string, maxFiles int, maxTotalBytes int64, protected map[string]struct{}) error {
+// cleanupArchiveDir removes the oldest run archives in dir until at most
+// maxFiles remain, they total at most maxTotalBytes, and none is older than
+// maxAge. Negative limits (and a zero maxAge) are ignored; a zero count or
+// size keeps none. Other files are left alone.
+func cleanupArchiveDir(dir string, maxFiles int, maxTotalBytes int64, maxAge time.Duration, protected map[string]struct{}) error {
 	if dir == "" {
 		return nil
 	}
-	if maxFiles < 0 {
-		maxFiles = 0
-	}
-	if maxTotalBytes < 0 {
-		maxTotalBytes = 0
-	}
 
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -572,7 +672,7 @@ func cleanupArchiveDir(dir string, maxFiles int, maxTotalBytes int64, protected
 	var total int64
 
 	for _, ent := range entries {
-		if ent.IsDir() {
+		if ent.IsDir() || !isRunArchiveFileName(ent.Name()) {
 			continue
 		}
 		path := filepath.Join(dir, ent.Name())
@@ -605,8 +705,13 @@ func cleanupArchiveDir(dir string, maxFiles int, maxTotalBytes int64, protected
 		return files[i].modTime.Before(files[j].modTime)
 	})
 
+	var expiredBefore time.Time
+	if maxAge > 0 {
+		expiredBefore = time.Now().Add(-maxAge)
+	}
+
 	var firstErr error
-	for (maxFiles > 0 && len(files) > maxFiles) || (maxTotalBytes > 0 && total > maxTotalBytes) {
+	for len(files) > 0 && ((maxFiles >= 0 && len(files) > maxFiles) || (maxTotalBytes >= 0 && total > maxTotalBytes) || files[0].modTime.Before(expiredBefore)) {
 		oldest := files[0]
 		files = files[1:]
 		if err := os.Remove(oldest.path); err != nil {
@@ -622,7 +727,7 @@ func cleanupArchiveDir(dir string, maxFiles int, maxTotalBytes int64, protected
 		return firstErr
 	}
 	// If we couldn't reach limits (e.g., due to remove failures), still surface an error.
-	if (maxFiles > 0 && len(files) > maxFiles) || (maxTotalBytes > 0 && total > maxTotalBytes) {
+	if (maxFiles >= 0 && len(files) > maxFiles) || (maxTotalBytes >= 0 && total > maxTotalBytes) {
 		return fmt.Errorf("archive cleanup incomplete: remainingFiles=%d remainingBytes=%d", len(files), total)
 	}
 	return nil
@@ -681,9 +786,14 @@ func encodeJSONLLine(ev StreamEvent) ([]byte, error) {
 }
 
 func (h *StreamHub) ReplayAndSubscribe(runID string, sinceSeq uint64) (replay []StreamEvent, ch <-chan StreamEvent, unsubscribe func(), truncated bool) {
+	replay, sub, unsubscribe, truncated := h.replayAndSubscribe(runID, sinceSeq)
+	return replay, sub.ch, unsubscribe, truncated
+}
+
+func (h *StreamHub) replayAndSubscribe(runID string, sinceSeq uint64) (replay []StreamEvent, sub *streamSubscriber, unsubscribe func(), truncated bool) {
 	if runID == "" {
-		events, unsub := h.SubscribeAll()
-		return nil, events, unsub, false
+		sub, unsub := h.subscribeAll()
+		return nil, sub, unsub, false
 	}
 
 	subCh := make(chan StreamEvent, h.subscriberBufSize)
@@ -709,12 +819,13 @@ func (h *StreamHub) ReplayAndSubscribe(runID string, sinceSeq uint64) (replay []
 	}
 
 	if h.runSubs[runID] == nil {
-		h.runSubs[runID] = make(map[chan StreamEvent]struct{})
+		h.runSubs[runID] = make(map[chan StreamEvent]*streamSubscriber)
 	}
-	h.runSubs[runID][subCh] = struct{}{}
+	sub = h.newSubscriberLocked(runID, subCh)
+	h.runSubs[runID][subCh] = sub
 	h.mu.Unlock()
 
-	return replay, subCh, func() {
+	return replay, sub, func() {
 		h.mu.Lock()
 		if subs, ok := h.runSubs[runID]; ok {
 			delete(subs, subCh)
@@ -723,7 +834,8 @@ func (h *StreamHub) ReplayAndSubscribe(runID string, sinceSeq uint64) (replay []
 			}
 		}
 		h.mu.Unlock()
-		close(subCh)
+		h.metrics.streamSubscriberClosed(sub.id, sub.runID)
+		sub.close()
 	}, truncated
 }
 
@@ -775,6 +887,19 @@ func StreamHandler(hub *StreamHub) http.HandlerFunc {
 				}
 				sinceSeq = n
 			}
+			// EventSource sends the last seen id on automatic reconnects; it is at least as fresh as the URL.
+			if raw := r.Header.Get("Last-Event-ID"); raw != "" {
+				if n, err := strconv.ParseUint(raw, 10, 64); err == nil && n > sinceSeq {
+					sinceSeq = n
+				}
+			}
+		}
+
+		withID := runID != ""
+		filter, apiErr := parseStreamFilter(r.URL.Query(), false)
+		if apiErr != nil {
+			WriteAPIError(w, http.StatusBadRequest, *apiErr)
+			return
 		}
 
 		flusher, ok := w.(http.Flusher)
@@ -795,14 +920,39 @@ func StreamHandler(hub *StreamHub) http.HandlerFunc {
 		_, _ = w.Write([]byte(": ok\n\n"))
 		flusher.Flush()
 
-		replay, ch, unsubscribe, truncated := hub.ReplayAndSubscribe(runID, sinceSeq)
+		// Gap markers always pass so filtered consumers still learn they missed events.
+		send := func(ev StreamEvent) error {
+			if ev.Type != "gap" && !filter.match(ev) {
+				return nil
+			}
+			if err := writeSSEData(w, ev, withID); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+
+		replay, sub, unsubscribe, truncated := hub.replayAndSubscribe(runID, sinceSeq)
 		defer unsubscribe()
 
+		// Older events (beyond the ring buffer, or from a run this process never saw) come from the disk archive.
+		if runID != "" && (truncated || (len(replay) == 0 && !hub.runHasEvents(runID))) {
+			var beforeSeq uint64
+			if len(replay) > 0 {
+				beforeSeq = replay[0].Seq
+			}
+			contiguous, err := hub.replayArchive(runID, sinceSeq, beforeSeq, send)
+			if r.Context().Err() != nil {
+				return
+			}
+			if err == nil && contiguous {
+				truncated = false
+			}
+		}
 		for _, ev := range replay {
-			if err := writeSSEData(w, ev); err != nil {
+			if err := send(ev); err != nil {
 				return
 			}
-			flusher.Flush()
 		}
 
 		if truncated {
@@ -814,20 +964,24 @@ func StreamHandler(hub *StreamHub) http.HandlerFunc {
 			select {
 			case <-ctx.Done():
 				return
-			case ev, ok := <-ch:
+			case ev, ok := <-sub.ch:
 				if !ok {
 					return
 				}
-				if err := writeSSEData(w, ev); err != nil {
+				if err := send(ev); err != nil {
 					return
 				}
-				flusher.Flush()
+				if len(sub.ch) == 0 {
+					sub.flushGaps()
+				}
 			}
 		}
 	}
 }
 
-func writeSSEData(w http.ResponseWriter, ev StreamEvent) error {
+// writeSSEData writes ev as a single SSE message. withID adds an "id:" field
+// carrying the run seq so EventSource reconnects resume via Last-Event-ID.
+func writeSSEData(w http.ResponseWriter, ev StreamEvent, withID bool) error {
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
 	enc.SetEscapeHTML(false)
@@ -839,6 +993,11 @@ func writeSSEData(w http.ResponseWriter, ev StreamEvent) error {
 		return fmt.Errorf("SSE payload must be single-line JSON")
 	}
 
+	if withID && ev.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.Seq); err != nil {
+			return err
+		}
+	}
 	if _, err := w.Write([]byte("data: ")); err != nil {
 		return err
 	}
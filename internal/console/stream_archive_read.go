@@ -0,0 +1,180 @@
+package console
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxArchiveLineBytes bounds a single JSONL line when reading archives back.
+// Process text is capped at DefaultMaxProcessTextBytes, so real lines are far smaller.
+const maxArchiveLineBytes = 4 * 1024 * 1024
+
+var errArchiveNotFound = errors.New("run archive not found")
+
+// runArchivePaths returns every on-disk location a run's archive may be at:
+// compressed, finalized, in-progress, and an in-flight compression temp file.
+func (h *StreamHub) runArchivePaths(runID string) []string {
+	if h.archiveDir == "" || runID == "" {
+		return nil
+	}
+	h.mu.Lock()
+	arch := h.archives[runID]
+	h.mu.Unlock()
+	finalPath := ""
+	if arch != nil {
+		finalPath = arch.finalPath
+	} else if safeName := sanitizeRunIDForFilename(runID); safeName != "" {
+		finalPath = filepath.Join(h.archiveDir, safeName+".jsonl")
+	}
+	if finalPath == "" {
+		return nil
+	}
+	return []string{finalPath + ".gz", finalPath, finalPath + ".tmp", finalPath + ".gz.tmp"}
+}
+
+// runArchiveCandidates returns the readable archive locations in the order
+// they should be tried (compressed, finalized, then in-progress).
+func (h *StreamHub) runArchiveCandidates(runID string) []string {
+	paths := h.runArchivePaths(runID)
+	if len(paths) == 0 {
+		return nil
+	}
+	return paths[:3]
+}
+
+func (h *StreamHub) openRunArchive(runID string) (io.ReadCloser, error) {
+	candidates := h.runArchiveCandidates(runID)
+	// Files may be renamed (tmp -> final -> gz) between attempts; one extra pass covers that race.
+	candidates = append(candidates, candidates...)
+	for _, path := range candidates {
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !strings.HasSuffix(path, ".gz") {
+			return f, nil
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return gzipArchiveReader{Reader: zr, f: f}, nil
+	}
+	return nil, errArchiveNotFound
+}
+
+type gzipArchiveReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (r gzipArchiveReader) Close() error {
+	err := r.Reader.Close()
+	if ferr := r.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// scanRunArchive calls fn for every event in the run's archive, in file order,
+// reading one line at a time. A trailing partial line (a write in progress) is ignored.
+func (h *StreamHub) scanRunArchive(runID string, fn func(StreamEvent) error) error {
+	rc, err := h.openRunArchive(runID)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReaderSize(rc, 64*1024)
+	for {
+		line, err := readArchiveLine(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		var ev StreamEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// readArchiveLine returns the next complete line without its newline. Lines
+// longer than maxArchiveLineBytes are skipped (returned as empty).
+func readArchiveLine(br *bufio.Reader) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > maxArchiveLineBytes {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err == nil {
+			break
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		// EOF without a newline means the writer is mid-line; drop the fragment.
+		return nil, err
+	}
+	if tooLong {
+		return []byte{}, nil
+	}
+	return line[:len(line)-1], nil
+}
+
+// replayArchive streams archived events with afterSeq < seq < beforeSeq
+// (beforeSeq == 0 means unbounded) to fn. contiguous reports whether every seq
+// in that window was found, i.e. whether the archive fully covers the gap.
+func (h *StreamHub) replayArchive(runID string, afterSeq, beforeSeq uint64, fn func(StreamEvent) error) (contiguous bool, err error) {
+	expected := afterSeq + 1
+	contiguous = true
+	err = h.scanRunArchive(runID, func(ev StreamEvent) error {
+		if ev.Seq <= afterSeq || (beforeSeq > 0 && ev.Seq >= beforeSeq) {
+			return nil
+		}
+		if ev.Seq != expected {
+			contiguous = false
+		}
+		expected = ev.Seq + 1
+		return fn(ev)
+	})
+	if err != nil {
+		return false, err
+	}
+	if beforeSeq > 0 && expected != beforeSeq {
+		contiguous = false
+	}
+	return contiguous, nil
+}
+
+func (h *StreamHub) runHasEvents(runID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := h.runs[runID]
+	return state != nil && state.nextSeq > 0
+}
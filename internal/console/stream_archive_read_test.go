@@ -0,0 +1,98 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openRunStream(t *testing.T, hub *StreamHub, query string) *bufio.Reader {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(StreamHandler(hub)))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?"+query, nil)
+	if err != nil {
+		t.Fatalf("NewRequest error: %v", err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Do error: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamHandler_ReplaysTruncatedRingFromArchive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 3, SubscriberBufSize: 16, ArchiveDir: dir})
+	for i := 0; i < 10; i++ {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "x"}})
+	}
+
+	reader := openRunStream(t, hub, "runId=r1&sinceSeq=0")
+	for want := uint64(1); want <= 10; want++ {
+		ev := mustReadNextSSEEvent(t, reader)
+		if ev.Seq != want {
+			t.Fatalf("expected seq %d, got %d (type=%q)", want, ev.Seq, ev.Type)
+		}
+	}
+
+	// The archive covered the gap, so no truncation warning should have been published.
+	hub.mu.Lock()
+	emitted := hub.runs["r1"].replayTruncateEmitted
+	hub.mu.Unlock()
+	if emitted {
+		t.Fatalf("expected no replay truncated warning when the archive covers the gap")
+	}
+}
+
+func TestStreamHandler_ReplaysFinishedRunFromArchiveAfterRestart(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, ArchiveDir: dir})
+	for i := 0; i < 4; i++ {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "x"}})
+	}
+	hub.Publish(StreamEvent{RunID: "r1", Type: "run_finished", Step: "fire", Level: "info", Data: map[string]any{"reason": "completed"}})
+	if _, err := os.Stat(filepath.Join(dir, "r1.jsonl")); err != nil {
+		t.Fatalf("expected finalized archive: %v", err)
+	}
+
+	restarted := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, ArchiveDir: dir})
+	reader := openRunStream(t, restarted, "runId=r1&sinceSeq=2")
+	for want := uint64(3); want <= 5; want++ {
+		ev := mustReadNextSSEEvent(t, reader)
+		if ev.Seq != want {
+			t.Fatalf("expected seq %d, got %d", want, ev.Seq)
+		}
+	}
+}
+
+func TestStreamHub_ReplayArchiveIgnoresPartialTrailingLine(t *testing.T) {
+	dir := t.TempDir()
+	hub := NewStreamHub(StreamHubConfig{ArchiveDir: dir})
+	content := `{"seq":1,"runId":"r1","type":"progress"}` + "\n" +
+		`{"seq":2,"runId":"r1","type":"progress"}` + "\n" +
+		`{"seq":3,"runId":"r1","ty`
+	if err := os.WriteFile(filepath.Join(dir, "r1.jsonl.tmp"), []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	var seqs []uint64
+	contiguous, err := hub.replayArchive("r1", 0, 3, func(ev StreamEvent) error {
+		seqs = append(seqs, ev.Seq)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replayArchive error: %v", err)
+	}
+	if !contiguous || len(seqs) != 2 || seqs[0] != 1 || seqs[1] != 2 {
+		t.Fatalf("expected contiguous seqs [1 2], got %v (contiguous=%v)", seqs, contiguous)
+	}
+}
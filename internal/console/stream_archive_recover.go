@@ -0,0 +1,159 @@
+package console
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// recoverOrphanedArchives finalizes the in-progress archives (<run>.jsonl.tmp)
+// a previous console process left behind. Each gets a synthetic run_finished
+// with reason "orphaned", merged with extra(runID) when extra is set, unless
+// it already ends with run_finished. It returns the recovered run ids.
+func (h *StreamHub) recoverOrphanedArchives(extra func(runID string) map[string]any) ([]string, error) {
+	if h.archiveDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(h.archiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var recovered []string
+	var firstErr error
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || !strings.HasSuffix(name, ".jsonl.tmp") || name == ".jsonl.tmp" {
+			continue
+		}
+		tmpPath := filepath.Join(h.archiveDir, name)
+		h.mu.Lock()
+		open := false
+		for _, arch := range h.archives {
+			if arch != nil && arch.tmpPath == tmpPath && !arch.finalized {
+				open = true
+			}
+		}
+		h.mu.Unlock()
+		if open {
+			continue
+		}
+
+		runID, err := finalizeOrphanedArchive(tmpPath, strings.TrimSuffix(name, ".jsonl.tmp"), extra)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		recovered = append(recovered, runID)
+		h.mu.Lock()
+		h.compressArchiveLocked(&runArchiveState{finalPath: strings.TrimSuffix(tmpPath, ".tmp")})
+		h.mu.Unlock()
+	}
+	return recovered, firstErr
+}
+
+// finalizeOrphanedArchive appends the synthetic run_finished to tmpPath and
+// renames it to the finalized archive name. A trailing partial line (the
+// console died mid-write) is cut off first.
+func finalizeOrphanedArchive(tmpPath string, fallbackRunID string, extra func(runID string) map[string]any) (string, error) {
+	f, err := os.OpenFile(tmpPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var runID, step, op, lastType string
+	var lastSeq uint64
+	var end int64
+	cr := &countingReader{r: f}
+	br := bufio.NewReaderSize(cr, 64*1024)
+	for {
+		line, err := readArchiveLine(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", err
+		}
+		end = cr.n - int64(br.Buffered())
+		var ev StreamEvent
+		if len(line) == 0 || json.Unmarshal(line, &ev) != nil {
+			continue
+		}
+		if runID == "" {
+			runID, step = ev.RunID, ev.Step
+		}
+		if ev.Type == "run_started" {
+			step = ev.Step
+			if data, ok := ev.Data.(map[string]any); ok {
+				op, _ = data["op"].(string)
+			}
+		}
+		lastSeq = max(lastSeq, ev.Seq)
+		lastType = ev.Type
+	}
+	if runID == "" {
+		runID = fallbackRunID
+	}
+
+	if lastType != "run_finished" {
+		data := map[string]any{
+			"ok":       false,
+			"reason":   fireReasonOrphaned,
+			"exitCode": nil,
+			"signal":   nil,
+			"note":     "The console exited before the run finished.",
+		}
+		if op != "" {
+			data["op"] = op
+		}
+		if extra != nil {
+			for k, v := range extra(runID) {
+				data[k] = v
+			}
+		}
+		line, err := encodeJSONLLine(StreamEvent{
+			TS:    time.Now().UTC().Format(time.RFC3339Nano),
+			Seq:   lastSeq + 1,
+			RunID: runID,
+			Type:  "run_finished",
+			Step:  step,
+			Level: "warn",
+			Data:  data,
+		})
+		if err != nil {
+			return "", err
+		}
+		if err := f.Truncate(end); err != nil {
+			return "", err
+		}
+		if _, err := f.WriteAt(line, end); err != nil {
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return runID, os.Rename(tmpPath, strings.TrimSuffix(tmpPath, ".tmp"))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
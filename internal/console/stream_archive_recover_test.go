@@ -0,0 +1,59 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStreamHub_RecoverOrphanedArchives(t *testing.T) {
+	dir := t.TempDir()
+	orphaned := `{"ts":"t1","seq":1,"runId":"fire-a","type":"run_started","step":"fire","data":{"op":"fire"}}` + "\n" +
+		`{"ts":"t2","seq":2,"runId":"fire-a","type":"process_stdout","step":"fire","data":{"text":"working"}}` + "\n" +
+		`{"ts":"t3","seq":3,"runId":"fire-a","ty`
+	finished := `{"ts":"t1","seq":1,"runId":"fire-b","type":"run_finished","step":"fire","data":{"reason":"stopped"}}` + "\n"
+	writeConfigFile(t, filepath.Join(dir, "fire-a.jsonl.tmp"), orphaned)
+	writeConfigFile(t, filepath.Join(dir, "fire-b.jsonl.tmp"), finished)
+
+	hub := NewStreamHub(StreamHubConfig{ArchiveDir: dir})
+	recovered, err := hub.recoverOrphanedArchives(func(runID string) map[string]any {
+		if runID == "fire-a" {
+			return map[string]any{"pgid": 42}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("recoverOrphanedArchives: %v", err)
+	}
+	slices.Sort(recovered)
+	if !slices.Equal(recovered, []string{"fire-a", "fire-b"}) {
+		t.Fatalf("unexpected recovered runs: %v", recovered)
+	}
+	for _, name := range []string{"fire-a.jsonl.tmp", "fire-b.jsonl.tmp"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be finalized, got %v", name, err)
+		}
+	}
+
+	var events []StreamEvent
+	if err := hub.scanRunArchive("fire-a", func(ev StreamEvent) error {
+		events = append(events, ev)
+		return nil
+	}); err != nil {
+		t.Fatalf("scanRunArchive: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected the partial line to be replaced by run_finished, got %+v", events)
+	}
+	last := events[2]
+	data, _ := last.Data.(map[string]any)
+	if last.Type != "run_finished" || last.Seq != 3 || last.Step != "fire" || data["reason"] != fireReasonOrphaned || data["op"] != "fire" || data["pgid"] != float64(42) {
+		t.Fatalf("unexpected synthetic run_finished: %+v", last)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "fire-b.jsonl"))
+	if err != nil || string(raw) != finished {
+		t.Fatalf("expected a finished archive to be renamed as is, got %q (%v)", raw, err)
+	}
+}
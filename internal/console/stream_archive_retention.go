@@ -0,0 +1,407 @@
+package console
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const runPinsFileName = "pins.json"
+
+var runArchiveSuffixes = []string{".jsonl", ".jsonl.gz", ".jsonl.tmp", ".jsonl.gz.tmp"}
+
+func isRunArchiveFileName(name string) bool {
+	for _, suffix := range runArchiveSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressArchiveLocked gzips a just-finalized archive in the background so
+// Publish is not blocked on large runs.
+func (h *StreamHub) compressArchiveLocked(arch *runArchiveState) {
+	if !h.compressArchives || arch == nil || arch.finalPath == "" {
+		return
+	}
+	finalPath := arch.finalPath
+	h.compressWG.Add(1)
+	go func() {
+		defer h.compressWG.Done()
+		_ = compressRunArchive(finalPath)
+	}()
+}
+
+// waitArchiveCompression blocks until background compression has finished.
+func (h *StreamHub) waitArchiveCompression() {
+	h.compressWG.Wait()
+}
+
+// compressRunArchive writes path+".gz" and removes path once the compressed
+// copy is complete. Readers prefer the .gz file, so there is no window in
+// which neither exists.
+func compressRunArchive(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+
+	gzPath := path + ".gz"
+	tmpPath := gzPath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = zw.Close()
+		_ = dst.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if info, err := src.Stat(); err == nil {
+		_ = os.Chtimes(tmpPath, info.ModTime(), info.ModTime())
+	}
+	if err := os.Rename(tmpPath, gzPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(path)
+}
+
+type runPinsFile struct {
+	Pinned []string `json:"pinned"`
+}
+
+func loadRunPins(archiveDir string) (map[string]struct{}, error) {
+	pins := make(map[string]struct{})
+	if archiveDir == "" {
+		return pins, nil
+	}
+	raw, err := os.ReadFile(filepath.Join(archiveDir, runPinsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pins, nil
+		}
+		return pins, err
+	}
+	var f runPinsFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return pins, fmt.Errorf("parse %s: %w", runPinsFileName, err)
+	}
+	for _, runID := range f.Pinned {
+		if runID != "" {
+			pins[runID] = struct{}{}
+		}
+	}
+	return pins, nil
+}
+
+func (h *StreamHub) savePinsLocked() error {
+	f := runPinsFile{Pinned: make([]string, 0, len(h.pins))}
+	for runID := range h.pins {
+		f.Pinned = append(f.Pinned, runID)
+	}
+	sort.Strings(f.Pinned)
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(h.archiveDir, 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomicWithPrefix(filepath.Join(h.archiveDir, runPinsFileName), append(raw, '\n'), 0o644, ".pins-*")
+}
+
+// pinnedArchivePathsLocked returns the archive files retention must never delete.
+func (h *StreamHub) pinnedArchivePathsLocked() map[string]struct{} {
+	protected := make(map[string]struct{})
+	for runID := range h.pins {
+		safeName := sanitizeRunIDForFilename(runID)
+		if safeName == "" {
+			continue
+		}
+		base := filepath.Join(h.archiveDir, safeName)
+		for _, suffix := range runArchiveSuffixes {
+			protected[base+suffix] = struct{}{}
+		}
+	}
+	return protected
+}
+
+func (h *StreamHub) isPinned(runID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.pins[runID]
+	return ok
+}
+
+// runExists reports whether the run has events in memory or an archive on disk.
+func (h *StreamHub) runExists(runID string) bool {
+	if h.runHasEvents(runID) {
+		return true
+	}
+	for _, path := range h.runArchiveCandidates(runID) {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *StreamHub) SetRunPinned(runID string, pinned bool) (*APIError, int) {
+	if h.archiveDir == "" {
+		return &APIError{
+			Code:    "ARCHIVE_DISABLED",
+			Message: "Run archives are disabled; there is nothing to pin.",
+		}, http.StatusConflict
+	}
+	if pinned && !h.runExists(runID) {
+		return runNotFoundError(runID), http.StatusNotFound
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pinsLoadErr != nil {
+		return &APIError{
+			Code:    "PINS_UNREADABLE",
+			Message: fmt.Sprintf("Failed to read %s: %v", runPinsFileName, h.pinsLoadErr),
+			Hint:    "Fix or remove the pins file, then restart the console.",
+		}, http.StatusInternalServerError
+	}
+	_, was := h.pins[runID]
+	if was == pinned {
+		return nil, http.StatusOK
+	}
+	if pinned {
+		h.pins[runID] = struct{}{}
+	} else {
+		delete(h.pins, runID)
+	}
+	if err := h.savePinsLocked(); err != nil {
+		if pinned {
+			delete(h.pins, runID)
+		} else {
+			h.pins[runID] = struct{}{}
+		}
+		return &APIError{
+			Code:    "PINS_WRITE_FAILED",
+			Message: fmt.Sprintf("Failed to save %s: %v", runPinsFileName, err),
+		}, http.StatusInternalServerError
+	}
+	return nil, http.StatusOK
+}
+
+type RunDeleteResponse struct {
+	OK      bool     `json:"ok"`
+	RunID   string   `json:"runId"`
+	Removed []string `json:"removed"`
+}
+
+// DeleteRun removes a finished, unpinned run from memory and disk.
+func (h *StreamHub) DeleteRun(runID string) (RunDeleteResponse, *APIError, int) {
+	resp := RunDeleteResponse{RunID: runID, Removed: []string{}}
+
+	h.mu.Lock()
+	arch := h.archives[runID]
+	active := arch != nil && !arch.finalized
+	_, pinned := h.pins[runID]
+	h.mu.Unlock()
+	if active {
+		return resp, &APIError{
+			Code:    "RUN_ACTIVE",
+			Message: "Run is still in progress and cannot be deleted.",
+			Hint:    "Stop the run first, then retry.",
+		}, http.StatusConflict
+	}
+	if pinned {
+		return resp, &APIError{
+			Code:    "RUN_PINNED",
+			Message: "Run is pinned and cannot be deleted.",
+			Hint:    "Unpin it with DELETE /api/runs/{id}/pin, then retry.",
+		}, http.StatusConflict
+	}
+
+	// Let an in-flight compression finish so it cannot recreate the .gz afterwards.
+	h.waitArchiveCompression()
+
+	existed := h.runHasEvents(runID)
+	for _, path := range h.runArchivePaths(runID) {
+		err := os.Remove(path)
+		switch {
+		case err == nil:
+			existed = true
+			resp.Removed = append(resp.Removed, filepath.Base(path))
+		case errors.Is(err, os.ErrNotExist):
+		default:
+			return resp, &APIError{
+				Code:    "RUN_DELETE_FAILED",
+				Message: fmt.Sprintf("Failed to remove %s: %v", filepath.Base(path), err),
+			}, http.StatusInternalServerError
+		}
+	}
+	if !existed {
+		return resp, runNotFoundError(runID), http.StatusNotFound
+	}
+
+	h.mu.Lock()
+	delete(h.runs, runID)
+	delete(h.archives, runID)
+	h.mu.Unlock()
+
+	resp.OK = true
+	return resp, nil, http.StatusOK
+}
+
+type RunArchiveInfo struct {
+	RunID      string `json:"runId"`
+	File       string `json:"file"`
+	Size       int64  `json:"size"`
+	ModifiedAt string `json:"modifiedAt"`
+	Compressed bool   `json:"compressed"`
+	InProgress bool   `json:"inProgress"`
+	Pinned     bool   `json:"pinned"`
+}
+
+// ListRuns returns the archived runs on disk, newest first. The run id is
+// derived from the archive file name.
+func (h *StreamHub) ListRuns() ([]RunArchiveInfo, error) {
+	runs := []RunArchiveInfo{}
+	if h.archiveDir == "" {
+		return runs, nil
+	}
+	entries, err := os.ReadDir(h.archiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return runs, nil
+		}
+		return nil, err
+	}
+
+	h.mu.Lock()
+	pins := make(map[string]struct{}, len(h.pins))
+	for runID := range h.pins {
+		pins[sanitizeRunIDForFilename(runID)] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	seen := make(map[string]int)
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasSuffix(name, ".gz.tmp") {
+			continue
+		}
+		var runID string
+		info := RunArchiveInfo{File: name}
+		switch {
+		case strings.HasSuffix(name, ".jsonl.gz"):
+			runID, info.Compressed = strings.TrimSuffix(name, ".jsonl.gz"), true
+		case strings.HasSuffix(name, ".jsonl.tmp"):
+			runID, info.InProgress = strings.TrimSuffix(name, ".jsonl.tmp"), true
+		case strings.HasSuffix(name, ".jsonl"):
+			runID = strings.TrimSuffix(name, ".jsonl")
+		default:
+			continue
+		}
+		if runID == "" {
+			continue
+		}
+		fi, err := ent.Info()
+		if err != nil {
+			continue
+		}
+		info.RunID = runID
+		info.Size = fi.Size()
+		info.ModifiedAt = fi.ModTime().UTC().Format(time.RFC3339)
+		_, info.Pinned = pins[runID]
+		// During compression both .jsonl and .jsonl.gz exist briefly; list the run once.
+		if i, ok := seen[runID]; ok {
+			if info.Compressed {
+				runs[i] = info
+			}
+			continue
+		}
+		seen[runID] = len(runs)
+		runs = append(runs, info)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].ModifiedAt == runs[j].ModifiedAt {
+			return runs[i].RunID < runs[j].RunID
+		}
+		return runs[i].ModifiedAt > runs[j].ModifiedAt
+	})
+	return runs, nil
+}
+
+func runNotFoundError(runID string) *APIError {
+	return &APIError{
+		Code:    "RUN_NOT_FOUND",
+		Message: fmt.Sprintf("No events found for run %q.", runID),
+		Hint:    "The run may have been removed by archive retention.",
+	}
+}
+
+func RunListHandler(hub *StreamHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runs, err := hub.ListRuns()
+		if err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, APIError{
+				Code:    "ARCHIVE_READ_FAILED",
+				Message: fmt.Sprintf("Failed to list run archives: %v", err),
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]any{"runs": runs})
+	}
+}
+
+func RunDeleteHandler(hub *StreamHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recordAuditRun(r.Context(), r.PathValue("id"))
+		resp, apiErr, status := hub.DeleteRun(r.PathValue("id"))
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// RunPinHandler serves POST (pin) and DELETE (unpin) on /api/runs/{id}/pin.
+func RunPinHandler(hub *StreamHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runID := r.PathValue("id")
+		recordAuditRun(r.Context(), runID)
+		pinned := r.Method != http.MethodDelete
+		if apiErr, status := hub.SetRunPinned(runID, pinned); apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "runId": runID, "pinned": pinned})
+	}
+}
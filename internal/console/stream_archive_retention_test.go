@@ -0,0 +1,167 @@
+package console
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func publishFinishedRun(hub *StreamHub, runID string, lines int) {
+	hub.Publish(StreamEvent{RunID: runID, Type: "run_started", Step: "fire", Level: "info"})
+	for i := 0; i < lines; i++ {
+		hub.Publish(StreamEvent{RunID: runID, Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "line"}})
+	}
+	hub.Publish(StreamEvent{RunID: runID, Type: "run_finished", Step: "fire", Level: "info", Data: map[string]any{"reason": "completed"}})
+}
+
+func TestStreamHub_CompressesFinishedArchiveAndReplaysIt(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	hub := NewStreamHub(StreamHubConfig{ArchiveDir: dir, CompressArchives: true})
+	publishFinishedRun(hub, "r1", 3)
+	hub.waitArchiveCompression()
+
+	if _, err := os.Stat(filepath.Join(dir, "r1.jsonl.gz")); err != nil {
+		t.Fatalf("expected compressed archive: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "r1.jsonl")); !os.IsNotExist(err) {
+		t.Fatalf("expected plain archive to be removed after compression, got err=%v", err)
+	}
+
+	restarted := NewStreamHub(StreamHubConfig{ArchiveDir: dir})
+	var seqs []uint64
+	contiguous, err := restarted.replayArchive("r1", 0, 0, func(ev StreamEvent) error {
+		seqs = append(seqs, ev.Seq)
+		return nil
+	})
+	if err != nil || !contiguous || len(seqs) != 5 {
+		t.Fatalf("expected 5 contiguous events from the gzip archive, got %v (contiguous=%v err=%v)", seqs, contiguous, err)
+	}
+
+	resp, apiErr, _ := restarted.SearchRun("r1", streamFilter{iteration: -1, query: "line"}, 0, 10)
+	if apiErr != nil || len(resp.Matches) != 3 {
+		t.Fatalf("expected 3 search matches in the gzip archive, got %d (err=%v)", len(resp.Matches), apiErr)
+	}
+}
+
+func TestStreamHub_RetentionByAgeSkipsPinnedRuns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	hub := NewStreamHub(StreamHubConfig{ArchiveDir: dir, ArchiveRetentionAge: time.Hour})
+	publishFinishedRun(hub, "old-pinned", 1)
+	publishFinishedRun(hub, "old", 1)
+	publishFinishedRun(hub, "recent", 1)
+	if apiErr, _ := hub.SetRunPinned("old-pinned", true); apiErr != nil {
+		t.Fatalf("SetRunPinned error: %+v", apiErr)
+	}
+
+	past := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"old-pinned.jsonl", "old.jsonl"} {
+		if err := os.Chtimes(filepath.Join(dir, name), past, past); err != nil {
+			t.Fatalf("Chtimes error: %v", err)
+		}
+	}
+
+	// Pins persist across restarts; cleanup runs when the next archive is opened.
+	restarted := NewStreamHub(StreamHubConfig{ArchiveDir: dir, ArchiveRetentionAge: time.Hour})
+	restarted.Publish(StreamEvent{RunID: "new", Type: "run_started", Step: "fire", Level: "info"})
+
+	for name, wantExists := range map[string]bool{
+		"old-pinned.jsonl": true,
+		"old.jsonl":        false,
+		"recent.jsonl":     true,
+		runPinsFileName:    true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != wantExists {
+			t.Fatalf("%s: expected exists=%v, got err=%v", name, wantExists, err)
+		}
+	}
+}
+
+func TestRunHandlers_PinAndDelete(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	hub := NewStreamHub(StreamHubConfig{ArchiveDir: dir})
+	publishFinishedRun(hub, "done", 1)
+	hub.Publish(StreamEvent{RunID: "live", Type: "run_started", Step: "fire", Level: "info"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/runs", RunListHandler(hub))
+	mux.HandleFunc("DELETE /api/runs/{id}", RunDeleteHandler(hub))
+	mux.HandleFunc("POST /api/runs/{id}/pin", RunPinHandler(hub))
+	mux.HandleFunc("DELETE /api/runs/{id}/pin", RunPinHandler(hub))
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+	wantCode := func(rr *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+		if rr.Code != status {
+			t.Fatalf("expected %d, got %d: %s", status, rr.Code, rr.Body.String())
+		}
+		if code == "" {
+			return
+		}
+		var got APIError
+		_ = json.Unmarshal(rr.Body.Bytes(), &got)
+		if got.Code != code {
+			t.Fatalf("expected %s, got %q", code, got.Code)
+		}
+	}
+
+	wantCode(do(http.MethodDelete, "/api/runs/live"), http.StatusConflict, "RUN_ACTIVE")
+	wantCode(do(http.MethodPost, "/api/runs/missing/pin"), http.StatusNotFound, "RUN_NOT_FOUND")
+
+	wantCode(do(http.MethodPost, "/api/runs/done/pin"), http.StatusOK, "")
+	rr := do(http.MethodGet, "/api/runs")
+	var list struct {
+		Runs []RunArchiveInfo `json:"runs"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	var donePinned bool
+	for _, run := range list.Runs {
+		if run.RunID == "done" {
+			donePinned = run.Pinned
+		}
+	}
+	if !donePinned {
+		t.Fatalf("expected done to be listed as pinned, got %+v", list.Runs)
+	}
+
+	wantCode(do(http.MethodDelete, "/api/runs/done"), http.StatusConflict, "RUN_PINNED")
+	wantCode(do(http.MethodDelete, "/api/runs/done/pin"), http.StatusOK, "")
+	wantCode(do(http.MethodDelete, "/api/runs/done"), http.StatusOK, "")
+
+	if _, err := os.Stat(filepath.Join(dir, "done.jsonl")); !os.IsNotExist(err) {
+		t.Fatalf("expected archive to be deleted, got err=%v", err)
+	}
+	if hub.runHasEvents("done") {
+		t.Fatalf("expected in-memory events to be dropped")
+	}
+	wantCode(do(http.MethodDelete, "/api/runs/done"), http.StatusNotFound, "RUN_NOT_FOUND")
+}
+
+func TestStreamHub_RetentionCountIncludesTheNewArchive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	hub := NewStreamHub(StreamHubConfig{ArchiveDir: dir, ArchiveRetentionCount: 1})
+	publishFinishedRun(hub, "r1", 1)
+	publishFinishedRun(hub, "r2", 1)
+	hub.Publish(StreamEvent{RunID: "r3", Type: "run_started", Step: "fire", Level: "info"})
+
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir error: %v", err)
+	}
+	var names []string
+	for _, ent := range ents {
+		names = append(names, ent.Name())
+	}
+	if len(names) != 1 || names[0] != "r3.jsonl.tmp" {
+		t.Fatalf("expected only the in-progress archive with retentionCount=1, got %v", names)
+	}
+}
@@ -0,0 +1,138 @@
+package console
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// streamSubscriber is one SSE consumer of the hub. Sends are non-blocking; when
+// the buffer is full the missed seq range is remembered per run and reported
+// in-band as a "gap" event as soon as the subscriber has room again.
+type streamSubscriber struct {
+	id    uint64
+	runID string
+	ch    chan StreamEvent
+
+	mu      sync.Mutex
+	closed  bool
+	dropped uint64
+	gaps    map[string]*streamSeqGap
+}
+
+type streamSeqGap struct {
+	fromSeq uint64
+	toSeq   uint64
+	dropped uint64
+}
+
+// deliver reports whether ev was handed to the subscriber.
+func (s *streamSubscriber) deliver(ev StreamEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+	if !s.flushGapLocked(ev.RunID) {
+		s.recordDropLocked(ev)
+		return false
+	}
+	select {
+	case s.ch <- ev:
+		return true
+	default:
+		s.recordDropLocked(ev)
+		return false
+	}
+}
+
+// flushGaps tries to deliver any pending gap events. Consumers call it after
+// draining their buffer so a gap is reported even if no further events arrive.
+func (s *streamSubscriber) flushGaps() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.gaps) == 0 {
+		return
+	}
+	runIDs := make([]string, 0, len(s.gaps))
+	for runID := range s.gaps {
+		runIDs = append(runIDs, runID)
+	}
+	sort.Strings(runIDs)
+	for _, runID := range runIDs {
+		if !s.flushGapLocked(runID) {
+			return
+		}
+	}
+}
+
+func (s *streamSubscriber) droppedCount() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *streamSubscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.ch)
+}
+
+func (s *streamSubscriber) recordDropLocked(ev StreamEvent) {
+	s.dropped++
+	// Events without a run seq (global-only events, other gap markers) cannot be re-requested.
+	if ev.RunID == "" || ev.Seq == 0 {
+		return
+	}
+	if s.gaps == nil {
+		s.gaps = make(map[string]*streamSeqGap)
+	}
+	gap := s.gaps[ev.RunID]
+	if gap == nil {
+		s.gaps[ev.RunID] = &streamSeqGap{fromSeq: ev.Seq, toSeq: ev.Seq, dropped: 1}
+		return
+	}
+	if ev.Seq < gap.fromSeq {
+		gap.fromSeq = ev.Seq
+	}
+	if ev.Seq > gap.toSeq {
+		gap.toSeq = ev.Seq
+	}
+	gap.dropped++
+}
+
+// flushGapLocked reports whether there is no pending gap for runID left.
+func (s *streamSubscriber) flushGapLocked(runID string) bool {
+	gap := s.gaps[runID]
+	if gap == nil {
+		return true
+	}
+	select {
+	case s.ch <- newStreamGapEvent(runID, *gap):
+		delete(s.gaps, runID)
+		return true
+	default:
+		return false
+	}
+}
+
+func newStreamGapEvent(runID string, gap streamSeqGap) StreamEvent {
+	return StreamEvent{
+		TS:    time.Now().UTC().Format(time.RFC3339Nano),
+		RunID: runID,
+		Type:  "gap",
+		Step:  "stream",
+		Level: "warn",
+		Data: map[string]any{
+			"fromSeq": gap.fromSeq,
+			"toSeq":   gap.toSeq,
+			"dropped": gap.dropped,
+			"note":    fmt.Sprintf("subscriber too slow; missed seq %d..%d (re-request with sinceSeq=%d)", gap.fromSeq, gap.toSeq, gap.fromSeq-1),
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamHub_SlowSubscriberGetsGapEvent(t *testing.T) {
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 2})
+	_, sub, unsub, _ := hub.replayAndSubscribe("r1", 0)
+	t.Cleanup(unsub)
+
+	for i := 0; i < 5; i++ {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "x"}})
+	}
+	if got := sub.droppedCount(); got != 3 {
+		t.Fatalf("expected 3 dropped events, got %d", got)
+	}
+
+	ev1 := mustReadStreamEvent(t, sub.ch)
+	ev2 := mustReadStreamEvent(t, sub.ch)
+	if ev1.Seq != 1 || ev2.Seq != 2 {
+		t.Fatalf("expected buffered seq 1,2 got %d,%d", ev1.Seq, ev2.Seq)
+	}
+
+	// Nothing new is published; the consumer flushes the pending gap after draining.
+	sub.flushGaps()
+	gap := mustReadStreamEvent(t, sub.ch)
+	if gap.Type != "gap" || gap.RunID != "r1" {
+		t.Fatalf("expected gap event for r1, got type=%q runId=%q", gap.Type, gap.RunID)
+	}
+	data, _ := gap.Data.(map[string]any)
+	if data["fromSeq"] != uint64(3) || data["toSeq"] != uint64(5) {
+		t.Fatalf("expected gap 3..5, got %v..%v", data["fromSeq"], data["toSeq"])
+	}
+
+	hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "y"}})
+	ev6 := mustReadStreamEvent(t, sub.ch)
+	if ev6.Type != "process_stdout" || ev6.Seq != 6 {
+		t.Fatalf("expected live event seq 6 after gap, got type=%q seq=%d", ev6.Type, ev6.Seq)
+	}
+}
+
+func TestStreamHub_GapIsDeliveredBeforeNextEvent(t *testing.T) {
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 1})
+	_, sub, unsub, _ := hub.replayAndSubscribe("r1", 0)
+	t.Cleanup(unsub)
+
+	hub.Publish(StreamEvent{RunID: "r1", Type: "progress", Step: "fire"})
+	hub.Publish(StreamEvent{RunID: "r1", Type: "progress", Step: "fire"})
+	_ = mustReadStreamEvent(t, sub.ch)
+
+	hub.Publish(StreamEvent{RunID: "r1", Type: "progress", Step: "fire"})
+	gap := mustReadStreamEvent(t, sub.ch)
+	if gap.Type != "gap" {
+		t.Fatalf("expected gap before seq 3, got %q", gap.Type)
+	}
+	// The gap filled the buffer, so seq 3 was dropped too and is reported by the next gap.
+	hub.Publish(StreamEvent{RunID: "r1", Type: "progress", Step: "fire"})
+	next := mustReadStreamEvent(t, sub.ch)
+	if next.Type != "gap" {
+		t.Fatalf("expected second gap for seq 3, got type=%q seq=%d", next.Type, next.Seq)
+	}
+}
+
+func TestStreamHandler_WritesSSEIDsAndResumesFromLastEventID(t *testing.T) {
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 16})
+	for i := 0; i < 3; i++ {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "x"}})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(StreamHandler(hub)))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?runId=r1", nil)
+	if err != nil {
+		t.Fatalf("NewRequest error: %v", err)
+	}
+	req.Header.Set("Last-Event-ID", "2")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Do error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	var idLine string
+	deadline := time.Now().Add(2 * time.Second)
+	for idLine == "" && time.Now().Before(deadline) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		if strings.HasPrefix(line, "id: ") {
+			idLine = strings.TrimSpace(line)
+		}
+	}
+	if idLine != "id: 3" {
+		t.Fatalf("expected replay to resume at id 3, got %q", idLine)
+	}
+	ev := mustReadNextSSEEvent(t, reader)
+	if ev.Seq != 3 {
+		t.Fatalf("expected seq 3, got %d", ev.Seq)
+	}
+}
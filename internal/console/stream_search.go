@@ -0,0 +1,340 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultRunSearchLimit   = 200
+	MaxRunSearchLimit       = 2000
+	DefaultRunSearchContext = 2
+	MaxRunSearchContext     = 50
+)
+
+var errStopRunScan = errors.New("stop run scan")
+
+// streamFilter selects events for filtered SSE subscriptions and run search.
+// The zero value matches everything.
+type streamFilter struct {
+	types     map[string]struct{}
+	minLevel  int
+	iteration int // -1 = any
+	query     string
+	re        *regexp.Regexp
+}
+
+var streamLevelRank = map[string]int{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+}
+
+func parseStreamFilter(q url.Values, allowText bool) (streamFilter, *APIError) {
+	f := streamFilter{iteration: -1}
+
+	if raw := strings.TrimSpace(q.Get("type")); raw != "" {
+		f.types = make(map[string]struct{})
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				f.types[t] = struct{}{}
+			}
+		}
+	}
+
+	// "level>=warn" parses as key "level>" with value "warn"; accept it alongside level=warn.
+	rawLevel := q.Get("level")
+	if rawLevel == "" {
+		rawLevel = q.Get("level>")
+	}
+	if rawLevel = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(rawLevel), ">=")); rawLevel != "" {
+		rank, ok := streamLevelRank[rawLevel]
+		if !ok {
+			return f, &APIError{
+				Code:    "INVALID_QUERY",
+				Message: "level must be one of debug, info, warn, error.",
+				Hint:    "level is a minimum: level=warn returns warn and error events.",
+			}
+		}
+		f.minLevel = rank
+	}
+
+	if raw := strings.TrimSpace(q.Get("iteration")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return f, &APIError{
+				Code:    "INVALID_QUERY",
+				Message: "iteration must be a non-negative integer.",
+			}
+		}
+		f.iteration = n
+	}
+
+	if !allowText {
+		return f, nil
+	}
+	f.query = q.Get("q")
+	if raw := q.Get("regex"); raw != "" {
+		useRegex, err := strconv.ParseBool(raw)
+		if err != nil {
+			return f, &APIError{
+				Code:    "INVALID_QUERY",
+				Message: "regex must be a boolean.",
+				Hint:    "Use regex=1 to treat q as a regular expression.",
+			}
+		}
+		if useRegex && f.query != "" {
+			re, err := regexp.Compile(f.query)
+			if err != nil {
+				return f, &APIError{
+					Code:    "INVALID_QUERY",
+					Message: "q is not a valid regular expression.",
+					Hint:    err.Error(),
+				}
+			}
+			f.re = re
+		}
+	}
+	f.query = strings.ToLower(f.query)
+	return f, nil
+}
+
+func (f streamFilter) match(ev StreamEvent) bool {
+	if len(f.types) > 0 {
+		if _, ok := f.types[ev.Type]; !ok {
+			return false
+		}
+	}
+	if f.minLevel > 0 {
+		rank, ok := streamLevelRank[ev.Level]
+		if !ok {
+			rank = streamLevelRank["info"]
+		}
+		if rank < f.minLevel {
+			return false
+		}
+	}
+	if f.iteration >= 0 {
+		n, ok := streamEventIteration(ev)
+		if !ok || n != f.iteration {
+			return false
+		}
+	}
+	if f.re == nil && f.query == "" {
+		return true
+	}
+	text := streamEventSearchText(ev)
+	if f.re != nil {
+		return f.re.MatchString(text)
+	}
+	return strings.Contains(strings.ToLower(text), f.query)
+}
+
+// streamEventIteration reads data.iteration, which is an int for live events
+// and a float64 for events decoded from the archive.
+func streamEventIteration(ev StreamEvent) (int, bool) {
+	data, ok := ev.Data.(map[string]any)
+	if !ok {
+		return 0, false
+	}
+	switch v := data["iteration"].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	default:
+		return 0, false
+	}
+}
+
+// streamEventSearchText joins the event type and the string fields of its data
+// (text, message, note, ...) in a stable order.
+func streamEventSearchText(ev StreamEvent) string {
+	data, ok := ev.Data.(map[string]any)
+	if !ok {
+		return ev.Type
+	}
+	keys := make([]string, 0, len(data))
+	for k, v := range data {
+		if _, ok := v.(string); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(ev.Type)
+	for _, k := range keys {
+		b.WriteByte('\n')
+		b.WriteString(data[k].(string))
+	}
+	return b.String()
+}
+
+// forEachRunEvent visits every event of a run in seq order: archived events
+// older than the ring buffer first, then the in-memory ones. found is false
+// when the run is neither in memory nor on disk.
+func (h *StreamHub) forEachRunEvent(runID string, fn func(StreamEvent) error) (found bool, err error) {
+	h.mu.Lock()
+	var events []StreamEvent
+	if state := h.runs[runID]; state != nil {
+		events = append(events, state.events...)
+	}
+	h.mu.Unlock()
+
+	var beforeSeq uint64
+	if len(events) > 0 {
+		beforeSeq = events[0].Seq
+		found = true
+	}
+	if beforeSeq != 1 {
+		_, err := h.replayArchive(runID, 0, beforeSeq, fn)
+		switch {
+		case err == nil:
+			found = true
+		case errors.Is(err, errArchiveNotFound):
+		default:
+			return found, err
+		}
+	}
+	for _, ev := range events {
+		if err := fn(ev); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+type RunSearchMatch struct {
+	Seq    uint64        `json:"seq"`
+	Event  StreamEvent   `json:"event"`
+	Before []StreamEvent `json:"before,omitempty"`
+	After  []StreamEvent `json:"after,omitempty"`
+}
+
+type RunSearchResponse struct {
+	RunID   string           `json:"runId"`
+	Matches []RunSearchMatch `json:"matches"`
+	Scanned int              `json:"scanned"`
+	Limited bool             `json:"limited"`
+}
+
+// SearchRun returns events of runID matching f, each with up to contextLines
+// neighbouring events on either side (regardless of the filter).
+func (h *StreamHub) SearchRun(runID string, f streamFilter, contextLines int, limit int) (RunSearchResponse, *APIError, int) {
+	resp := RunSearchResponse{RunID: runID, Matches: []RunSearchMatch{}}
+	if runID == "" {
+		return resp, &APIError{Code: "VALIDATION_ERROR", Message: "run id is required."}, http.StatusBadRequest
+	}
+
+	var before []StreamEvent
+	var pending []int // indexes into resp.Matches still collecting "after" context
+	found, err := h.forEachRunEvent(runID, func(ev StreamEvent) error {
+		resp.Scanned++
+		kept := pending[:0]
+		for _, i := range pending {
+			resp.Matches[i].After = append(resp.Matches[i].After, ev)
+			if len(resp.Matches[i].After) < contextLines {
+				kept = append(kept, i)
+			}
+		}
+		pending = kept
+
+		if !resp.Limited && f.match(ev) {
+			if len(resp.Matches) >= limit {
+				resp.Limited = true
+			} else {
+				m := RunSearchMatch{Seq: ev.Seq, Event: ev}
+				if len(before) > 0 {
+					m.Before = append([]StreamEvent(nil), before...)
+				}
+				resp.Matches = append(resp.Matches, m)
+				if contextLines > 0 {
+					pending = append(pending, len(resp.Matches)-1)
+				}
+			}
+		}
+		if resp.Limited && len(pending) == 0 {
+			return errStopRunScan
+		}
+
+		if contextLines > 0 {
+			if len(before) == contextLines {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, ev)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopRunScan) {
+		return resp, &APIError{
+			Code:    "ARCHIVE_READ_FAILED",
+			Message: fmt.Sprintf("Failed to read the run archive: %v", err),
+		}, http.StatusInternalServerError
+	}
+	if !found {
+		return resp, runNotFoundError(runID), http.StatusNotFound
+	}
+	return resp, nil, http.StatusOK
+}
+
+func RunSearchHandler(hub *StreamHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f, apiErr := parseStreamFilter(q, true)
+		if apiErr != nil {
+			WriteAPIError(w, http.StatusBadRequest, *apiErr)
+			return
+		}
+
+		contextLines, ok := parseBoundedQueryInt(q.Get("context"), DefaultRunSearchContext, MaxRunSearchContext)
+		if !ok {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "INVALID_QUERY",
+				Message: fmt.Sprintf("context must be an integer between 0 and %d.", MaxRunSearchContext),
+			})
+			return
+		}
+		limit, ok := parseBoundedQueryInt(q.Get("limit"), DefaultRunSearchLimit, MaxRunSearchLimit)
+		if !ok || limit == 0 {
+			WriteAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "INVALID_QUERY",
+				Message: fmt.Sprintf("limit must be an integer between 1 and %d.", MaxRunSearchLimit),
+			})
+			return
+		}
+
+		resp, apiErr, status := hub.SearchRun(r.PathValue("id"), f, contextLines, limit)
+		if apiErr != nil {
+			WriteAPIError(w, status, *apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func parseBoundedQueryInt(raw string, def int, max int) (int, bool) {
+	if raw == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 || n > max {
+		return 0, false
+	}
+	return n, true
+}
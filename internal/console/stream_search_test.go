@@ -0,0 +1,124 @@
+package console
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func publishSearchFixture(hub *StreamHub) {
+	hub.Publish(StreamEvent{RunID: "r1", Type: "progress", Step: "fire", Level: "info", Data: map[string]any{"iteration": 1, "phase": "iteration_started"}})
+	for i := 0; i < 6; i++ {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "building", "iteration": 1}})
+	}
+	hub.Publish(StreamEvent{RunID: "r1", Type: "process_stderr", Step: "fire", Level: "error", Data: map[string]any{"text": "panic: Boom at main.go:12", "iteration": 1}})
+	for i := 0; i < 3; i++ {
+		hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "retrying", "iteration": 2}})
+	}
+}
+
+func serveRunSearch(t *testing.T, hub *StreamHub, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/runs/{id}/search", RunSearchHandler(hub))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	return rr
+}
+
+func TestRunSearchHandler_FindsMatchesAcrossArchiveAndMemory(t *testing.T) {
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 3, ArchiveDir: filepath.Join(t.TempDir(), "runs")})
+	publishSearchFixture(hub)
+
+	rr := serveRunSearch(t, hub, "/api/runs/r1/search?q=boom&context=1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp RunSearchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Matches) != 1 || resp.Matches[0].Seq != 8 {
+		t.Fatalf("expected one match at seq 8, got %+v", resp.Matches)
+	}
+	m := resp.Matches[0]
+	if len(m.Before) != 1 || m.Before[0].Seq != 7 || len(m.After) != 1 || m.After[0].Seq != 9 {
+		t.Fatalf("expected context seq 7 and 9, got before=%v after=%v", m.Before, m.After)
+	}
+	if resp.Scanned != 11 || resp.Limited {
+		t.Fatalf("expected all 11 events scanned without hitting the limit, got scanned=%d limited=%v", resp.Scanned, resp.Limited)
+	}
+
+	// seq 1..8 only exist in the archive; iteration comes back as a JSON number there.
+	rr = serveRunSearch(t, hub, "/api/runs/r1/search?iteration=1&type=process_stdout&limit=100&context=0")
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Matches) != 6 || resp.Matches[0].Seq != 2 {
+		t.Fatalf("expected 6 iteration-1 stdout matches starting at seq 2, got %d", len(resp.Matches))
+	}
+}
+
+func TestRunSearchHandler_RegexLevelAndLimit(t *testing.T) {
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100})
+	publishSearchFixture(hub)
+
+	rr := serveRunSearch(t, hub, "/api/runs/r1/search?q=main%5C.go:%5Cd%2B&regex=1&level=warn")
+	var resp RunSearchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Matches) != 1 || resp.Matches[0].Event.Level != "error" {
+		t.Fatalf("expected the error line to match, got %+v", resp.Matches)
+	}
+
+	rr = serveRunSearch(t, hub, "/api/runs/r1/search?q=retrying&limit=2&context=0")
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Matches) != 2 || !resp.Limited {
+		t.Fatalf("expected 2 limited matches, got %d limited=%v", len(resp.Matches), resp.Limited)
+	}
+}
+
+func TestRunSearchHandler_Errors(t *testing.T) {
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100})
+	publishSearchFixture(hub)
+
+	if rr := serveRunSearch(t, hub, "/api/runs/r1/search?q=(&regex=1"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid regex, got %d", rr.Code)
+	}
+	if rr := serveRunSearch(t, hub, "/api/runs/r1/search?level=loud"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid level, got %d", rr.Code)
+	}
+	rr := serveRunSearch(t, hub, "/api/runs/nope/search?q=x")
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "RUN_NOT_FOUND") {
+		t.Fatalf("expected 404 RUN_NOT_FOUND, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStreamHandler_AppliesTypeAndLevelFilters(t *testing.T) {
+	hub := NewStreamHub(StreamHubConfig{MaxEventsPerRun: 100, SubscriberBufSize: 16})
+	publishSearchFixture(hub)
+
+	reader := openRunStream(t, hub, "runId=r1&level>=warn")
+	ev := mustReadNextSSEEvent(t, reader)
+	if ev.Seq != 8 || ev.Level != "error" {
+		t.Fatalf("expected only the error event (seq 8), got seq=%d level=%q", ev.Seq, ev.Level)
+	}
+
+	reader = openRunStream(t, hub, "runId=r1&type=progress")
+	ev = mustReadNextSSEEvent(t, reader)
+	if ev.Type != "progress" || ev.Seq != 1 {
+		t.Fatalf("expected progress seq 1, got type=%q seq=%d", ev.Type, ev.Seq)
+	}
+	hub.Publish(StreamEvent{RunID: "r1", Type: "process_stdout", Step: "fire", Level: "info", Data: map[string]any{"text": "skip me"}})
+	hub.Publish(StreamEvent{RunID: "r1", Type: "progress", Step: "fire", Level: "info", Data: map[string]any{"phase": "iteration_finished"}})
+	ev = mustReadNextSSEEvent(t, reader)
+	if ev.Type != "progress" || ev.Seq != 13 {
+		t.Fatalf("expected live progress seq 13, got type=%q seq=%d", ev.Type, ev.Seq)
+	}
+}
@@ -364,7 +364,7 @@ func TestCleanupArchiveDir_DeletesOldestUntilSizeWithinLimit(t *testing.T) {
 		}
 	}
 
-	if err := cleanupArchiveDir(dir, 10, 15, nil); err != nil {
+	if err := cleanupArchiveDir(dir, 10, 15, 0, nil); err != nil {
 		t.Fatalf("cleanupArchiveDir error: %v", err)
 	}
 	if _, err := os.Stat(paths[0]); err == nil {
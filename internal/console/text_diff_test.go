@@ -0,0 +1,24 @@
+package console
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Parallel()
+
+	if got := unifiedDiff("a", "b", "same\n", "same\n"); got != "" {
+		t.Fatalf("expected empty diff, got %q", got)
+	}
+
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	want := "--- a\n+++ b\n" +
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+	if got := unifiedDiff("a", "b", a, b); got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got, want := unifiedDiff("a", "b", "", "x\n"), "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n"; got != want {
+		t.Fatalf("unexpected diff for new file:\n%s\nwant:\n%s", got, want)
+	}
+}
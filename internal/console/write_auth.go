@@ -2,14 +2,26 @@ package console
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
 type WriteAuthConfig struct {
+	// Tokens issues and validates short-lived per-page tokens. When nil the
+	// single SessionToken is accepted for the whole process lifetime.
+	Tokens         *SessionTokenStore
 	SessionToken   string
 	AllowedOrigins []string
+	// AllowSameHostOrigin also accepts an Origin whose scheme and host match the
+	// request itself. Remote mode needs it because the hostname a remote
+	// browser uses is not known in advance.
+	AllowSameHostOrigin bool
+	// LoginPath skips the session token check: the remote login handler
+	// checks its own nonce (see RemoteAuth.LoginNonce). Origin still applies.
+	LoginPath string
 }
 
 func GenerateSessionToken() (string, error) {
@@ -27,7 +39,13 @@ func RequireWriteAuth(next http.Handler, cfg WriteAuthConfig) http.Handler {
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, "/api/") {
+		if isSafeMethod(r.Method) || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Browsers never attach an Authorization header on their own, so an
+		// API-token request cannot be forged cross-site.
+		if p, ok := PrincipalFromRequest(r); ok && p.Bearer {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -41,7 +59,7 @@ func RequireWriteAuth(next http.Handler, cfg WriteAuthConfig) http.Handler {
 			})
 			return
 		}
-		if _, ok := allowed[origin]; !ok {
+		if _, ok := allowed[origin]; !ok && !(cfg.AllowSameHostOrigin && isSameHostOrigin(r, origin)) {
 			WriteAPIError(w, http.StatusForbidden, APIError{
 				Code:    "ORIGIN_NOT_ALLOWED",
 				Message: "Origin is not allowed for write operations.",
@@ -50,6 +68,11 @@ func RequireWriteAuth(next http.Handler, cfg WriteAuthConfig) http.Handler {
 			return
 		}
 
+		if cfg.LoginPath != "" && r.URL.Path == cfg.LoginPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		token := r.Header.Get("X-Session-Token")
 		if token == "" {
 			WriteAPIError(w, http.StatusForbidden, APIError{
@@ -59,15 +82,41 @@ func RequireWriteAuth(next http.Handler, cfg WriteAuthConfig) http.Handler {
 			})
 			return
 		}
-		if cfg.SessionToken == "" || token != cfg.SessionToken {
-			WriteAPIError(w, http.StatusForbidden, APIError{
-				Code:    "SESSION_TOKEN_INVALID",
-				Message: "Session token is invalid.",
-				Hint:    "Reload the console UI page to receive a new token, then retry.",
-			})
+		if cfg.Tokens != nil {
+			if status := cfg.Tokens.check(token); status != sessionTokenValid {
+				apiErr, code := sessionTokenError(status)
+				WriteAPIError(w, code, apiErr)
+				return
+			}
+		} else if cfg.SessionToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.SessionToken)) != 1 {
+			apiErr, code := sessionTokenError(sessionTokenUnknown)
+			WriteAPIError(w, code, apiErr)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+func isSameHostOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return u.Scheme == scheme && strings.EqualFold(u.Host, r.Host)
+}
+
+// isSafeMethod reports whether the method cannot change server state; every
+// other method (POST, PUT, PATCH, DELETE, ...) requires write auth.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
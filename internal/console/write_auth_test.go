@@ -229,3 +229,30 @@ func TestRequireWriteAuth_DoesNotProtectNonPostOrNonAPI(t *testing.T) {
 		t.Fatalf("expected next handler to be called twice, got %d", called)
 	}
 }
+
+func TestRequireWriteAuth_ProtectsDelete(t *testing.T) {
+	t.Parallel()
+
+	h := RequireWriteAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), WriteAuthConfig{
+		SessionToken:   "abc",
+		AllowedOrigins: []string{"http://127.0.0.1:1234"},
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "http://127.0.0.1/api/runs/r1", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for unauthenticated DELETE, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "http://127.0.0.1/api/runs/r1", nil)
+	req.Header.Set("Origin", "http://127.0.0.1:1234")
+	req.Header.Set("X-Session-Token", "abc")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for authenticated DELETE, got %d (%s)", rr.Code, rr.Body.String())
+	}
+}